@@ -0,0 +1,119 @@
+package consensus
+
+import (
+	"github.com/madebymany/doozerd/store"
+	"strconv"
+	"time"
+)
+
+const batchPrefixLen = len("batch:")
+
+type batchReq struct {
+	mut string
+	c   chan store.Event
+}
+
+// A Batcher is a Proposer that combines proposals made within a short
+// window of each other into one batch mutation (see store.EncodeBatch),
+// so that a burst of writes takes one round of consensus instead of
+// one round each. Each caller still gets the event for its own
+// mutation, with Mut set to what it proposed.
+type Batcher struct {
+	p      Proposer
+	st     *store.Store
+	window time.Duration
+	maxLen int
+	reqs   chan batchReq
+}
+
+// NewBatcher returns a Batcher that proposes through p and reads the
+// events of its batches from st. Once a proposal arrives, it waits
+// window for more, and sends what it has when the window ends or the
+// batch would grow longer than maxLen bytes. A proposal that can't be
+// batched or is longer than maxLen on its own goes straight to p.
+func NewBatcher(p Proposer, st *store.Store, window time.Duration, maxLen int) *Batcher {
+	b := &Batcher{p, st, window, maxLen, make(chan batchReq)}
+	go b.run()
+	return b
+}
+
+func (b *Batcher) Propose(v []byte) store.Event {
+	mut := string(v)
+	if !store.CanBatch(mut) || batchPrefixLen+batchLen(mut) > b.maxLen {
+		return b.p.Propose(v)
+	}
+
+	c := make(chan store.Event, 1)
+	b.reqs <- batchReq{mut, c}
+	return <-c
+}
+
+func (b *Batcher) run() {
+	for r := range b.reqs {
+		batch := []batchReq{r}
+		n := batchPrefixLen + batchLen(r.mut)
+
+		timeout := time.After(b.window)
+	collect:
+		for {
+			select {
+			case r := <-b.reqs:
+				if n+batchLen(r.mut) > b.maxLen {
+					go b.propose(batch)
+					batch, n = nil, batchPrefixLen
+				}
+				batch = append(batch, r)
+				n += batchLen(r.mut)
+			case <-timeout:
+				break collect
+			}
+		}
+
+		go b.propose(batch)
+	}
+}
+
+// Returns the length of mut in a batch, with its length prefix.
+func batchLen(mut string) int {
+	return len(strconv.Itoa(len(mut))) + 1 + len(mut)
+}
+
+func (b *Batcher) propose(batch []batchReq) {
+	if len(batch) == 1 {
+		batch[0].c <- b.p.Propose([]byte(batch[0].mut))
+		return
+	}
+
+	muts := make([]string, len(batch))
+	for i, r := range batch {
+		muts[i] = r.mut
+	}
+	mut, err := store.EncodeBatch(muts...)
+	if err != nil {
+		for _, r := range batch {
+			r.c <- store.Event{Mut: r.mut, Err: err}
+		}
+		return
+	}
+
+	e := b.p.Propose([]byte(mut))
+	if e.Err == ErrNoQuorum {
+		for _, r := range batch {
+			r.c <- store.Event{Mut: r.mut, Err: e.Err}
+		}
+		return
+	}
+	evs, err := b.st.Events(e.Seqn)
+	if err == nil && len(evs) != len(batch) {
+		err = store.ErrBadMutation // can't happen
+	}
+	for i, r := range batch {
+		if err != nil {
+			r.c <- store.Event{Seqn: e.Seqn, Mut: r.mut, Err: err}
+			continue
+		}
+		ev := evs[i]
+		ev.Mut = r.mut
+		r.c <- ev
+	}
+}
@@ -0,0 +1,137 @@
+package consensus
+
+import (
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A proposer that takes a fixed time for each round, one round at a
+// time, as a stand-in for the network.
+type slowProposer struct {
+	sync.Mutex
+	test.FakeProposer
+	delay time.Duration
+	n     int // rounds
+}
+
+func (sp *slowProposer) Propose(v []byte) store.Event {
+	sp.Lock()
+	defer sp.Unlock()
+	time.Sleep(sp.delay)
+	sp.n++
+	return sp.FakeProposer.Propose(v)
+}
+
+func proposeAll(p Proposer, muts []string) []store.Event {
+	evs := make([]store.Event, len(muts))
+	var wg sync.WaitGroup
+	for i, m := range muts {
+		wg.Add(1)
+		go func(i int, m string) {
+			evs[i] = p.Propose([]byte(m))
+			wg.Done()
+		}(i, m)
+	}
+	wg.Wait()
+	return evs
+}
+
+func TestBatcherCombines(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	sp := &slowProposer{FakeProposer: test.FakeProposer{Store: st}}
+	b := NewBatcher(sp, st, 10*time.Millisecond, 3000)
+
+	var muts []string
+	for i := 0; i < 10; i++ {
+		muts = append(muts, store.MustEncodeSet("/x/"+strconv.Itoa(i), "a", store.Clobber))
+	}
+	evs := proposeAll(b, muts)
+
+	assert.Equal(t, 1, sp.n)
+	for i, ev := range evs {
+		assert.Equal(t, nil, ev.Err)
+		assert.Equal(t, int64(1), ev.Seqn)
+		assert.Equal(t, muts[i], ev.Mut)
+		assert.Equal(t, "/x/"+strconv.Itoa(i), ev.Path)
+	}
+	assert.Equal(t, 10, len(store.Getdir(st, "/x")))
+}
+
+func TestBatcherErrors(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	sp := &slowProposer{FakeProposer: test.FakeProposer{Store: st}}
+	b := NewBatcher(sp, st, 10*time.Millisecond, 3000)
+
+	ok := store.MustEncodeSet("/a", "a", store.Clobber)
+	bad := store.MustEncodeSet("/b", "b", 0) // fails once /b exists
+	b.Propose([]byte(store.MustEncodeSet("/b", "b", store.Clobber)))
+
+	evs := proposeAll(b, []string{ok, bad})
+	assert.Equal(t, 2, sp.n)
+	assert.Equal(t, nil, evs[0].Err)
+	assert.Equal(t, store.ErrRevMismatch, evs[1].Err)
+	assert.Equal(t, bad, evs[1].Mut)
+}
+
+func TestBatcherMaxLen(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	sp := &slowProposer{FakeProposer: test.FakeProposer{Store: st}}
+	b := NewBatcher(sp, st, 10*time.Millisecond, 50)
+
+	a := store.MustEncodeSet("/a", "0123456789", store.Clobber)
+	long := store.MustEncodeSet("/b", "0123456789012345678901234567890123456789", store.Clobber)
+	evs := proposeAll(b, []string{a, a, a, long})
+
+	// The long one goes alone, and the rest need two batches.
+	assert.Equal(t, 3, sp.n)
+	for _, ev := range evs {
+		assert.Equal(t, nil, ev.Err)
+	}
+}
+
+func TestBatcherUnbatchable(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	sp := &slowProposer{FakeProposer: test.FakeProposer{Store: st}}
+	b := NewBatcher(sp, st, time.Hour, 3000)
+
+	m := store.MustEncodeDeltree("/a", store.Clobber)
+	ev := b.Propose([]byte(m))
+	assert.Equal(t, m, ev.Mut)
+	assert.Equal(t, 1, sp.n)
+}
+
+func benchmarkPropose(b *testing.B, batched bool) {
+	st := store.New()
+	defer close(st.Ops)
+	var p Proposer = &slowProposer{
+		FakeProposer: test.FakeProposer{Store: st},
+		delay:        time.Millisecond,
+	}
+	if batched {
+		p = NewBatcher(p, st, 2*time.Millisecond, 3000)
+	}
+
+	muts := make([]string, b.N)
+	for i := range muts {
+		muts[i] = store.MustEncodeSet("/x", "a", store.Clobber)
+	}
+	b.ResetTimer()
+	proposeAll(p, muts)
+}
+
+func BenchmarkProposeUnbatched(b *testing.B) {
+	benchmarkPropose(b, false)
+}
+
+func BenchmarkProposeBatched(b *testing.B) {
+	benchmarkPropose(b, true)
+}
@@ -0,0 +1,127 @@
+package consensus
+
+import (
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type memNode struct {
+	name  string
+	st    *store.Store
+	pc    *test.PacketConn
+	seqns chan int64
+	props chan *Prop
+}
+
+// Starts a cluster of Managers, one for each name, each with its own
+// store, talking over a PacketNet instead of UDP. Closing the returned
+// nodes' PacketConns stops their traffic. The window is as wide as the
+// cluster, so each node coordinates one of the first seqns.
+func memCluster(names ...string) []*memNode {
+	alpha := int64(len(names))
+	var pn test.PacketNet
+	var addrs []*net.UDPAddr
+	var ops []store.Op
+	for i, name := range names {
+		addr := &net.UDPAddr{IP: net.IP{10, 0, 0, byte(i + 1)}, Port: 8046}
+		addrs = append(addrs, addr)
+		ops = append(ops, store.Op{int64(len(ops) + 1), store.MustEncodeSet("/ctl/node/"+name+"/addr", addr.String(), 0)})
+	}
+	for i, name := range names {
+		ops = append(ops, store.Op{int64(len(ops) + 1), store.MustEncodeSet("/ctl/cal/"+strconv.Itoa(i), name, 0)})
+	}
+
+	// The runs for the first alpha seqns are made from the events
+	// alpha before them, so those must all see every cal.
+	defRev := int64(len(ops))
+	for i := int64(1); i < alpha; i++ {
+		ops = append(ops, store.Op{int64(len(ops) + 1), store.Nop})
+	}
+
+	var nodes []*memNode
+	for i, name := range names {
+		st := store.New()
+		for _, op := range ops {
+			st.Ops <- op
+		}
+
+		in := make(chan Packet)
+		out := make(chan Packet)
+		nd := &memNode{
+			name:  name,
+			st:    st,
+			pc:    pn.Listen(addrs[i]),
+			seqns: make(chan int64, alpha),
+			props: make(chan *Prop),
+		}
+		m := &Manager{
+			Self:   name,
+			DefRev: defRev,
+			Alpha:  alpha,
+			In:     in,
+			Out:    out,
+			Ops:    st.Ops,
+			PSeqn:  nd.seqns,
+			Props:  nd.props,
+			TFill:  10e9,
+			Store:  st,
+			Ticker: time.Tick(10e6),
+		}
+		go m.Run()
+
+		go func() {
+			for o := range out {
+				nd.pc.WriteTo(o.Data, o.Addr)
+			}
+		}()
+
+		go func() {
+			for {
+				buf := make([]byte, 3000)
+				n, addr, err := nd.pc.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				in <- Packet{addr.(*net.UDPAddr), buf[:n]}
+			}
+		}()
+
+		nodes = append(nodes, nd)
+	}
+	return nodes
+}
+
+func TestMemCluster(t *testing.T) {
+	nodes := memCluster("a", "b", "c")
+	defer func() {
+		for _, nd := range nodes {
+			nd.pc.Close()
+		}
+	}()
+
+	// Each node proposes at the seqn it coordinates.
+	var last int64
+	for _, nd := range nodes {
+		n := <-nd.seqns
+		if n > last {
+			last = n
+		}
+		go func(nd *memNode, n int64) {
+			nd.props <- &Prop{n, []byte(store.MustEncodeSet("/"+nd.name, nd.name, store.Clobber)), nil}
+		}(nd, n)
+	}
+
+	for _, nd := range nodes {
+		w, err := nd.st.Wait(store.Any, last)
+		assert.Equal(t, nil, err)
+		<-w
+		for _, want := range nodes {
+			assert.Equal(t, want.name, store.GetString(nd.st, "/"+want.name), nd.name)
+		}
+	}
+}
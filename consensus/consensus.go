@@ -1,13 +1,88 @@
 package consensus
 
 import (
+	"errors"
 	"github.com/madebymany/doozerd/store"
 )
 
+// ErrNoQuorum is the error for a proposal that hasn't been committed
+// after as many rounds of consensus as it is allowed, as when this
+// node has lost touch with most of the others. It may yet be
+// committed.
+var ErrNoQuorum = errors.New("no quorum")
+
 type Proposer interface {
 	Propose(v []byte) store.Event
 }
 
+type traced struct {
+	p  Proposer
+	id string
+}
+
+// Traced returns a Proposer that marks each mutation proposed to it
+// with id (see store.EncodeTrace) before proposing it through p, so
+// that each node logs id when it learns the change.
+func Traced(p Proposer, id string) Proposer {
+	return traced{p, id}
+}
+
+func (t traced) Propose(v []byte) (e store.Event) {
+	e.Mut, e.Err = store.EncodeTrace(t.id, string(v))
+	if e.Err != nil {
+		return
+	}
+
+	return t.p.Propose([]byte(e.Mut))
+}
+
+type once struct {
+	p        Proposer
+	id       string
+	deadline int64
+}
+
+// Once returns a Proposer that makes each mutation proposed to it with
+// operation ID id (see store.EncodeOnce), recorded until deadline, so
+// that proposing it again, through any node, doesn't apply it twice.
+// The event for a mutation already applied stands for the original
+// change: its Seqn is the revision at which that was made, and for an
+// incr its Body is the value that made.
+func Once(p Proposer, id string, deadline int64) Proposer {
+	return once{p, id, deadline}
+}
+
+func (o once) Propose(v []byte) (e store.Event) {
+	e.Mut, e.Err = store.EncodeOnce(o.id, o.deadline, string(v))
+	if e.Err != nil {
+		return
+	}
+
+	e = o.p.Propose([]byte(e.Mut))
+	if e.Err == nil && e.Getter != nil {
+		if rev, value, ok := store.OpResult(e.Getter, o.id); ok && rev != e.Seqn {
+			e.Seqn, e.Body = rev, value
+		}
+	}
+	return e
+}
+
+// Returns the fields kv for a log line, followed by the trace ID that
+// mut is marked with, if any.
+func traceFields(mut []byte, kv ...interface{}) []interface{} {
+	if id, ok := store.TraceID(string(mut)); ok {
+		return append(kv, "trace", id)
+	}
+	return kv
+}
+
+// Sync proposes a nop. When it returns, the local store holds every
+// change committed anywhere before Sync was called, so a read at the
+// event's Seqn sees them all.
+func Sync(p Proposer) store.Event {
+	return p.Propose([]byte(store.Nop))
+}
+
 func Set(p Proposer, path string, body []byte, rev int64) (e store.Event) {
 	e.Mut, e.Err = store.EncodeSet(path, string(body), rev)
 	if e.Err != nil {
@@ -25,3 +100,101 @@ func Del(p Proposer, path string, rev int64) (e store.Event) {
 
 	return p.Propose([]byte(e.Mut))
 }
+
+// Deltree deletes path and everything beneath it in a single mutation.
+func Deltree(p Proposer, path string, rev int64) (e store.Event) {
+	e.Mut, e.Err = store.EncodeDeltree(path, rev)
+	if e.Err != nil {
+		return
+	}
+
+	return p.Propose([]byte(e.Mut))
+}
+
+// DelGlob deletes every file matching glob in a single mutation, if
+// none has a revision greater than rev. The event for each deleted
+// file can be had from store.Events at e.Seqn.
+func DelGlob(p Proposer, glob *store.Glob, rev int64) (e store.Event) {
+	e.Mut, e.Err = store.EncodeDelGlob(glob, rev)
+	if e.Err != nil {
+		return
+	}
+
+	return p.Propose([]byte(e.Mut))
+}
+
+// Copy copies the file or directory at src to dst in a single mutation.
+func Copy(p Proposer, src, dst string, rev int64) (e store.Event) {
+	e.Mut, e.Err = store.EncodeCopy(src, dst, rev)
+	if e.Err != nil {
+		return
+	}
+
+	return p.Propose([]byte(e.Mut))
+}
+
+// Move moves the file or directory at src to dst in a single mutation.
+func Move(p Proposer, src, dst string, rev int64) (e store.Event) {
+	e.Mut, e.Err = store.EncodeMove(src, dst, rev)
+	if e.Err != nil {
+		return
+	}
+
+	return p.Propose([]byte(e.Mut))
+}
+
+func SetTTL(p Proposer, path string, body []byte, rev, deadline int64) (e store.Event) {
+	e.Mut, e.Err = store.EncodeSetTTL(path, string(body), rev, deadline)
+	if e.Err != nil {
+		return
+	}
+
+	return p.Propose([]byte(e.Mut))
+}
+
+func Refresh(p Proposer, path string, deadline int64) (e store.Event) {
+	e.Mut, e.Err = store.EncodeRefresh(path, deadline)
+	if e.Err != nil {
+		return
+	}
+
+	return p.Propose([]byte(e.Mut))
+}
+
+func Txn(p Proposer, t *store.Txn) (e store.Event) {
+	e.Mut, e.Err = t.Mutation()
+	if e.Err != nil {
+		return
+	}
+
+	return p.Propose([]byte(e.Mut))
+}
+
+func Incr(p Proposer, path string, delta int64) (e store.Event) {
+	e.Mut, e.Err = store.EncodeIncr(path, delta)
+	if e.Err != nil {
+		return
+	}
+
+	return p.Propose([]byte(e.Mut))
+}
+
+func Append(p Proposer, path string, suffix []byte, rev int64, maxLen int) (e store.Event) {
+	e.Mut, e.Err = store.EncodeAppend(path, string(suffix), rev, maxLen)
+	if e.Err != nil {
+		return
+	}
+
+	return p.Propose([]byte(e.Mut))
+}
+
+// CompareAndDelete deletes the file at path, in a single mutation, if
+// its body is exactly value. See store.EncodeCompareAndDelete.
+func CompareAndDelete(p Proposer, path string, value []byte) (e store.Event) {
+	e.Mut, e.Err = store.EncodeCompareAndDelete(path, string(value))
+	if e.Err != nil {
+		return
+	}
+
+	return p.Propose([]byte(e.Mut))
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/bmizerany/assert"
 	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
 	"net"
 	"testing"
 	"time"
@@ -49,7 +50,7 @@ func TestConsensusOne(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	props <- &Prop{n, []byte("foo")}
+	props <- &Prop{n, []byte("foo"), nil}
 	e := <-w
 
 	exp := store.Event{
@@ -148,7 +149,7 @@ func TestConsensusTwo(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	aprops <- &Prop{n, []byte("foo")}
+	aprops <- &Prop{n, []byte("foo"), nil}
 	e := <-w
 
 	exp := store.Event{
@@ -163,3 +164,82 @@ func TestConsensusTwo(t *testing.T) {
 	e.Getter = nil
 	assert.Equal(t, exp, e)
 }
+
+func TestConsensusNoQuorum(t *testing.T) {
+	a := "a"
+	x := &net.UDPAddr{IP: net.IP{1, 2, 3, 4}, Port: 5}
+	const alpha = 1
+	st := store.New()
+	defer close(st.Ops)
+
+	st.Ops <- store.Op{1, store.Nop}
+	st.Ops <- store.Op{2, store.MustEncodeSet("/ctl/node/a/addr", "1.2.3.4:5", 0)}
+	st.Ops <- store.Op{3, store.MustEncodeSet("/ctl/cal/1", a, 0)}
+	st.Ops <- store.Op{4, store.MustEncodeSet("/ctl/node/b/addr", "2.3.4.5:6", 0)}
+	st.Ops <- store.Op{5, store.MustEncodeSet("/ctl/cal/2", "b", 0)}
+
+	in := make(chan Packet)
+	out := make(chan Packet)
+	seqns := make(chan int64, alpha)
+	props := make(chan *Prop)
+	m := &Manager{
+		Self:   a,
+		DefRev: 5,
+		Alpha:  alpha,
+		In:     in,
+		Out:    out,
+		Ops:    st.Ops,
+		PSeqn:  seqns,
+		Props:  props,
+		TFill:  10e9,
+		NRound: 3,
+		Store:  st,
+		Ticker: time.Tick(1e6),
+	}
+	go m.Run()
+
+	// b is cut off, so a can't make a quorum of its own.
+	go func() {
+		for o := range out {
+			o := o
+			if o.Addr.Port == x.Port && o.Addr.IP.Equal(x.IP) {
+				go func() { in <- o }()
+			}
+		}
+	}()
+
+	n := <-seqns
+	fail := make(chan error, 1)
+	props <- &Prop{n, []byte("foo"), fail}
+	select {
+	case err := <-fail:
+		assert.Equal(t, ErrNoQuorum, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("proposal still waiting")
+	}
+	rev, _ := st.Snap()
+	assert.Equal(t, int64(5), rev)
+}
+
+func TestTraced(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	p := Traced(&test.FakeProposer{Store: st}, "abc")
+
+	e := Set(p, "/a", []byte("x"), store.Clobber)
+	assert.Equal(t, nil, e.Err)
+	assert.Equal(t, "/a", e.Path)
+	assert.Equal(t, "x", e.Body)
+	id, ok := store.TraceID(e.Mut)
+	assert.T(t, ok)
+	assert.Equal(t, "abc", id)
+}
+
+func TestTracedBadID(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	p := Traced(&test.FakeProposer{Store: st}, "a b")
+
+	e := Set(p, "/a", []byte("x"), store.Clobber)
+	assert.Equal(t, store.ErrBadTrace, e.Err)
+}
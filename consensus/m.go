@@ -9,9 +9,10 @@ var (
 	tick     = msg_TICK.Enum()
 	propose  = msg_PROPOSE.Enum()
 	learn    = msg_LEARN.Enum()
+	tooLate  = msg_TOO_LATE.Enum()
 )
 
-const nmsg = 8
+const nmsg = 9
 
 var (
 	msgTick = &msg{Cmd: tick}
@@ -24,6 +24,7 @@ const (
 	msg_TICK     msg_Cmd = 5
 	msg_PROPOSE  msg_Cmd = 6
 	msg_LEARN    msg_Cmd = 7
+	msg_TOO_LATE msg_Cmd = 8
 )
 
 var msg_Cmd_name = map[int32]string{
@@ -35,6 +36,7 @@ var msg_Cmd_name = map[int32]string{
 	5: "TICK",
 	6: "PROPOSE",
 	7: "LEARN",
+	8: "TOO_LATE",
 }
 var msg_Cmd_value = map[string]int32{
 	"NOP":      0,
@@ -45,6 +47,7 @@ var msg_Cmd_value = map[string]int32{
 	"TICK":     5,
 	"PROPOSE":  6,
 	"LEARN":    7,
+	"TOO_LATE": 8,
 }
 
 func (x msg_Cmd) Enum() *msg_Cmd {
@@ -3,10 +3,11 @@ package consensus
 import (
 	"code.google.com/p/goprotobuf/proto"
 	"container/heap"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/store"
-	"log"
 	"net"
 	"sort"
+	"sync/atomic"
 	"time"
 )
 
@@ -94,29 +95,72 @@ type Stats struct {
 
 // DefRev is the rev in which this manager was defined;
 // it will participate starting at DefRev+Alpha.
+//
+// A Learner is not a member of the consensus set. It never votes or
+// proposes; it applies values learned by the members, starting at
+// DefRev, and asks them again for any it has gone TFill without.
+//
+// If a member answers a run this manager hasn't learned with TOO_LATE,
+// the member's address is sent on Behind, if it is set and ready;
+// the value is gone from the log, and only a snapshot will do.
+//
+// TRound bounds how long a coordinator waits, at first, before it
+// gives up on a round and starts another; the bound doubles each
+// time. Zero means 1ms, which suits a LAN.
+//
+// If NRound is positive, a value proposed with a Fail channel that
+// hasn't been learned once its run has begun NRound rounds fails:
+// ErrNoQuorum is sent on Fail. The run goes on trying, since the
+// value may yet be chosen, but the proposer needn't wait for it.
+//
+// A member fills a seqn that another leads, so as not to leave a gap,
+// once it has gone TFill without the value, and a little more the
+// later it comes after the leader, lowest index first (see tiePos).
+// So if several must fill the same seqn, each gives the ones before it
+// time to, rather than all starting rounds at once.
+//
+// For TSettle after it starts, the manager doesn't fill seqns that
+// other members lead, so that a node that has just joined gives the
+// established ones time to use them, rather than contest them at once.
+//
+// If Highest is set, the highest seqn seen in any packet is stored
+// there, atomically, so others can tell how far the cluster has got.
 type Manager struct {
-	Self   string
-	DefRev int64
-	Alpha  int64
-	In     <-chan Packet
-	Out    chan<- Packet
-	Ops    chan<- store.Op
-	PSeqn  chan<- int64
-	Props  <-chan *Prop
-	TFill  int64
-	Store  *store.Store
-	Ticker <-chan time.Time
-	Stats  Stats
-	run    map[int64]*run
-	next   int64 // unused seqn
-	fill   triggers
-	packet packets
-	tick   triggers
+	Self    string
+	DefRev  int64
+	Alpha   int64
+	In      <-chan Packet
+	Out     chan<- Packet
+	Ops     chan<- store.Op
+	PSeqn   chan<- int64
+	Props   <-chan *Prop
+	TFill   int64
+	TRound  int64
+	NRound  int
+	TSettle int64
+	Store   *store.Store
+	Ticker  <-chan time.Time
+	Stats   Stats
+	Learner bool
+	Behind  chan<- *net.UDPAddr
+	Highest *int64
+	run     map[int64]*run
+	next    int64 // unused seqn
+	fill    triggers
+	packet  packets
+	tick    triggers
+	want    int64 // lowest seqn a learner is missing
+	since   int64 // time a learner began missing want
+	settled int64 // time TSettle is up
 }
 
+// A Prop asks the manager to propose Mut at Seqn, a seqn it sent on
+// PSeqn. If Fail is set, it is told if the cluster can't make progress
+// (see NRound).
 type Prop struct {
 	Seqn int64
 	Mut  []byte
+	Fail chan<- error
 }
 
 var tickTemplate = &msg{Cmd: tick}
@@ -124,11 +168,16 @@ var fillTemplate = &msg{Cmd: propose, Value: []byte(store.Nop)}
 
 func (m *Manager) Run() {
 	m.run = make(map[int64]*run)
+	m.settled = time.Now().UnixNano() + m.TSettle
 	runCh, err := m.Store.Wait(store.Any, m.DefRev)
 	if err != nil {
 		panic(err) // can't happen
 	}
 
+	if m.Learner {
+		m.addLearnerRuns()
+	}
+
 	for {
 		m.Stats.Runs = len(m.run)
 		m.Stats.WaitPackets = len(m.packet)
@@ -139,7 +188,7 @@ func (m *Manager) Run() {
 			if !ok {
 				return
 			}
-			log.Println("event", e)
+			logging.Debug("event", "seqn", e.Seqn, "path", e.Path)
 
 			runCh, err = m.Store.Wait(store.Any, e.Seqn+1)
 			if err != nil {
@@ -148,12 +197,19 @@ func (m *Manager) Run() {
 
 			m.event(e)
 			m.Stats.TotalRuns++
-			log.Println("runs:", fmtRuns(m.run))
-			log.Println("avg tick delay:", avg(m.tick))
-			log.Println("avg fill delay:", avg(m.fill))
+			if logging.Enabled(logging.LevelDebug) {
+				logging.Debug("runs",
+					"runs", fmtRuns(m.run),
+					"avgtick", avg(m.tick),
+					"avgfill", avg(m.fill),
+				)
+			}
 		case p := <-m.In:
 			if p1 := recvPacket(&m.packet, p); p1 != nil {
-				m.Stats.TotalRecv[*p1.msg.Cmd]++
+				if *p1.msg.Cmd < nmsg {
+					m.Stats.TotalRecv[*p1.msg.Cmd]++
+				}
+				m.seen(*p1.Seqn)
 			}
 		case pr := <-m.Props:
 			m.propose(&m.packet, pr, time.Now().UnixNano())
@@ -168,7 +224,7 @@ func (m *Manager) Run() {
 func (m *Manager) pump() {
 	for len(m.packet) > 0 {
 		p := m.packet[0]
-		log.Printf("p.seqn=%d m.next=%d", *p.Seqn, m.next)
+		logging.Debug("pump", "seqn", *p.Seqn, "next", m.next)
 		if *p.Seqn >= m.next {
 			break
 		}
@@ -177,39 +233,114 @@ func (m *Manager) pump() {
 		r := m.run[*p.Seqn]
 		if r == nil || r.l.done {
 			go sendLearn(m.Out, p, m.Store)
+		} else if *p.msg.Cmd == msg_TOO_LATE {
+			m.behind(p.Addr)
 		} else {
 			r.update(p, r.indexOfAddr(p.Addr), &m.tick)
 		}
 	}
 }
 
+func (m *Manager) seen(n int64) {
+	if m.Highest != nil && n > atomic.LoadInt64(m.Highest) {
+		atomic.StoreInt64(m.Highest, n)
+	}
+}
+
+// Tells whoever is listening on Behind that addr has cleaned a value
+// this manager is still trying to learn, so it won't catch up from
+// the log. It doesn't wait; one signal at a time is enough.
+func (m *Manager) behind(addr *net.UDPAddr) {
+	logging.Info("behind", "addr", addr)
+	select {
+	case m.Behind <- addr:
+	default:
+	}
+}
+
 func (m *Manager) doTick(t int64) {
 	n := applyTriggers(&m.packet, &m.fill, t, fillTemplate)
 	m.Stats.TotalFills += int64(n)
 	if n > 0 {
-		log.Println("applied fills", n)
+		logging.Debug("applied fills", "n", n)
 	}
 
 	n = applyTriggers(&m.packet, &m.tick, t, tickTemplate)
 	m.Stats.TotalTicks += int64(n)
 	if n > 0 {
-		log.Println("applied m.tick", n)
+		logging.Debug("applied ticks", "n", n)
+	}
+
+	if m.Learner {
+		m.catchUp(t)
+	}
+}
+
+// A member makes the runs for DefRev through DefRev+Alpha-1 from the
+// events alpha revisions earlier, but a learner starts with none of
+// those, so it makes them from the store as it is now. A learner only
+// uses a run's members to know whom to ask for its value.
+func (m *Manager) addLearnerRuns() {
+	_, g := m.Store.Snap()
+	for n := m.DefRev; n < m.DefRev+m.Alpha; n++ {
+		m.addRun(store.Event{Seqn: n - m.Alpha, Getter: g})
+	}
+}
+
+// Asks the members of the lowest run that hasn't learned its value to
+// send it, if that run has been stuck for TFill. A member that has
+// learned the value answers an invite with no round by sending it.
+func (m *Manager) catchUp(t int64) {
+	var r *run
+	for n, x := range m.run {
+		if !x.l.done && (r == nil || n < r.seqn) {
+			r = x
+		}
+	}
+	if r == nil {
+		return
+	}
+
+	if r.seqn != m.want {
+		m.want, m.since = r.seqn, t
+		return
+	}
+	if t-m.since < m.TFill {
+		return
+	}
+	m.since = t
+
+	logging.Info("learner asking", "seqn", r.seqn)
+	buf, _ := proto.Marshal(&msg{Seqn: &r.seqn, Cmd: invite})
+	for _, addr := range r.addr {
+		m.Out <- Packet{addr, buf}
 	}
 }
 
 func (m *Manager) propose(q heap.Interface, pr *Prop, t int64) {
-	log.Println("prop", pr)
+	if logging.Enabled(logging.LevelDebug) {
+		logging.Debug("prop", traceFields(pr.Mut, "seqn", pr.Seqn)...)
+	}
 	p := new(packet)
 	p.msg.Seqn = &pr.Seqn
 	p.msg.Cmd = propose
 	p.msg.Value = pr.Mut
 	heap.Push(q, p)
+	if r := m.run[pr.Seqn]; r != nil && !r.prop {
+		r.prop, r.propT = true, t
+		if m.NRound > 0 {
+			r.fail, r.maxRounds = pr.Fail, m.NRound
+		}
+	}
+	if t < m.settled {
+		t = m.settled
+	}
 	for n := pr.Seqn - 1; ; n-- {
 		r := m.run[n]
 		if r == nil || r.isLeader(m.Self) {
 			break
 		} else {
-			schedTrigger(&m.fill, n, t, m.TFill)
+			schedTrigger(&m.fill, n, t, m.TFill+m.TFill*r.tiePos(m.Self)/int64(len(r.cals)))
 		}
 	}
 }
@@ -219,7 +350,10 @@ func sendLearn(out chan<- Packet, p *packet, st *store.Store) {
 		ch, err := st.Wait(store.Any, *p.Seqn)
 
 		if err == store.ErrTooLate {
-			log.Println(err)
+			logging.Warn("send learn", "seqn", *p.Seqn, "addr", p.Addr, "err", err)
+			m := msg{Seqn: p.Seqn, Cmd: tooLate}
+			buf, _ := proto.Marshal(&m)
+			out <- Packet{p.Addr, buf}
 		} else {
 			e := <-ch
 			m := msg{
@@ -239,12 +373,12 @@ func recvPacket(q heap.Interface, P Packet) (p *packet) {
 
 	err := proto.Unmarshal(P.Data, &p.msg)
 	if err != nil {
-		log.Println(err)
+		logging.Warn("bad packet", "addr", P.Addr, "err", err)
 		return nil
 	}
 
 	if p.msg.Seqn == nil || p.msg.Cmd == nil {
-		log.Printf("discarding %#v", p)
+		logging.Warn("discarding packet", "addr", p.Addr)
 		return nil
 	}
 
@@ -279,7 +413,7 @@ func applyTriggers(ps *packets, ticks *triggers, now int64, tpl *msg) (n int) {
 		p := new(packet)
 		p.msg = *tpl
 		p.msg.Seqn = &tt.n
-		log.Println("applying", *p.Seqn, msg_Cmd_name[int32(*p.Cmd)])
+		logging.Debug("applying", "seqn", *p.Seqn, "cmd", msg_Cmd_name[int32(*p.Cmd)])
 		heap.Push(ps, p)
 		n++
 	}
@@ -287,34 +421,62 @@ func applyTriggers(ps *packets, ticks *triggers, now int64, tpl *msg) (n int) {
 }
 
 func (m *Manager) event(e store.Event) {
+	if m.next != 0 && e.Seqn+m.Alpha > m.next {
+		m.jump(e)
+		return
+	}
 	delete(m.run, e.Seqn)
-	log.Printf("del run %d", e.Seqn)
+	logging.Debug("del run", "seqn", e.Seqn)
 	m.addRun(e)
 }
 
+// Handles an event past the one the manager expects next, as when the
+// store has installed a snapshot. Runs at or before e are dropped, and
+// the runs e skipped over are made from e's tree, since the events
+// alpha revisions before them were never seen here.
+func (m *Manager) jump(e store.Event) {
+	logging.Info("jump", "seqn", e.Seqn)
+	for n := range m.run {
+		if n <= e.Seqn {
+			delete(m.run, n)
+		}
+	}
+	from := m.next
+	if from < e.Seqn+1 {
+		from = e.Seqn + 1
+	}
+	for n := from; n <= e.Seqn+m.Alpha; n++ {
+		m.addRun(store.Event{Seqn: n - m.Alpha, Getter: e.Getter})
+	}
+}
+
 func (m *Manager) addRun(e store.Event) (r *run) {
 	r = new(run)
 	r.self = m.Self
 	r.out = m.Out
 	r.ops = m.Ops
-	r.bound = initialWaitBound
+	r.bound = m.TRound
+	if r.bound <= 0 {
+		r.bound = initialWaitBound
+	}
 	r.seqn = e.Seqn + m.Alpha
 	r.cals = getCals(e)
 	r.addr = getAddrs(e, r.cals)
+	r.learners = getLearners(e)
 	if len(r.cals) < 1 {
 		r.cals = m.run[r.seqn-1].cals
 		r.addr = m.run[r.seqn-1].addr
 	}
 	r.c.size = len(r.cals)
 	r.c.quor = r.quorum()
-	r.c.crnd = r.indexOf(r.self) + int64(len(r.cals))
+	r.c.crnd = r.firstRound()
 	r.l.init(len(r.cals), int64(r.quorum()))
 	m.run[r.seqn] = r
 	if r.isLeader(m.Self) {
-		log.Printf("pseqn %d", r.seqn)
+		logging.Debug("pseqn", "seqn", r.seqn)
 		m.PSeqn <- r.seqn
 	}
-	log.Printf("add run %d", r.seqn)
+	logging.Debug("add run", "seqn", r.seqn)
 	m.next = r.seqn + 1
 	return r
 }
@@ -346,7 +508,7 @@ func getAddrs(g store.Getter, cals []string) (a []*net.UDPAddr) {
 		s := store.GetString(g, "/ctl/node/"+id+"/addr")
 		a[i], err = net.ResolveUDPAddr("udp", s)
 		if err != nil {
-			log.Println(err)
+			logging.Error("bad node addr", "id", id, "err", err)
 		} else {
 			i++
 		}
@@ -354,6 +516,23 @@ func getAddrs(g store.Getter, cals []string) (a []*net.UDPAddr) {
 	return a[:i]
 }
 
+// Returns the addresses of nodes whose role is "replica".
+func getLearners(g store.Getter) (a []*net.UDPAddr) {
+	for _, id := range store.Getdir(g, "/ctl/node") {
+		if store.GetString(g, "/ctl/node/"+id+"/role") != "replica" {
+			continue
+		}
+		s := store.GetString(g, "/ctl/node/"+id+"/addr")
+		addr, err := net.ResolveUDPAddr("udp", s)
+		if err != nil {
+			logging.Error("bad node addr", "id", id, "err", err)
+			continue
+		}
+		a = append(a, addr)
+	}
+	return a
+}
+
 func fmtRuns(rs map[int64]*run) (s string) {
 	var ns []int
 	for i := range rs {
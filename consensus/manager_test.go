@@ -199,6 +199,50 @@ func TestManagerProposeFill(t *testing.T) {
 	assert.Equal(t, exp, m.fill)
 }
 
+func TestManagerProposeFillSettling(t *testing.T) {
+	q := new(packets)
+	var m Manager
+	m.Self = "a"
+	m.TFill = 10
+	m.settled = 500
+	m.run = map[int64]*run{
+		7: &run{seqn: 7, cals: []string{"a", "b", "c"}},
+		8: &run{seqn: 8, cals: []string{"a", "b", "c"}},
+	}
+	m.propose(q, &Prop{Seqn: 9, Mut: []byte("foo")}, 123)
+	assert.Equal(t, 2, len(m.fill))
+	for _, tr := range m.fill {
+		assert.Equal(t, int64(513), tr.t)
+	}
+
+	// Once settled, fills wait only TFill, and a little for a's place
+	// after the leader.
+	m.fill = nil
+	m.propose(q, &Prop{Seqn: 9, Mut: []byte("foo")}, 600)
+	assert.Equal(t, 2, len(m.fill))
+	for _, tr := range m.fill {
+		assert.Equal(t, int64(613), tr.t)
+	}
+}
+
+// Each member waits a little longer to fill, the later it comes after
+// the leader, so they don't all contest the seqn at once.
+func TestManagerProposeFillStaggered(t *testing.T) {
+	cals := []string{"a", "b", "c"}
+	// Seqn 7 is b's to lead; a comes next, then c.
+	exp := map[string]int64{"a": 133, "c": 166}
+	for self, at := range exp {
+		var m Manager
+		m.Self = self
+		m.TFill = 100
+		m.run = map[int64]*run{
+			7: &run{seqn: 7, cals: cals},
+		}
+		m.propose(new(packets), &Prop{Seqn: 8, Mut: []byte("foo")}, 0)
+		assert.Equal(t, triggers{{at, 7}}, m.fill, self)
+	}
+}
+
 func TestApplyTriggers(t *testing.T) {
 	pkts := new(packets)
 	tgrs := new(triggers)
@@ -430,3 +474,184 @@ func TestGetAddrs(t *testing.T) {
 	addrs := getAddrs(st, []string{"1", "2", "3"})
 	assert.Equal(t, []*net.UDPAddr{x, y, z}, addrs)
 }
+
+func TestGetLearners(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+
+	st.Ops <- store.Op{1, store.MustEncodeSet(node+"/1/addr", "1.2.3.4:5", 0)}
+	st.Ops <- store.Op{2, store.MustEncodeSet(node+"/2/addr", "2.3.4.5:6", 0)}
+	st.Ops <- store.Op{3, store.MustEncodeSet(node+"/2/role", "replica", 0)}
+	<-st.Seqns
+
+	y, _ := net.ResolveUDPAddr("udp", "2.3.4.5:6")
+	assert.Equal(t, []*net.UDPAddr{y}, getLearners(st))
+}
+
+func TestManagerAddLearnerRuns(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+
+	st.Ops <- store.Op{1, store.MustEncodeSet(node+"/a/addr", "1.2.3.4:5", 0)}
+	st.Ops <- store.Op{2, store.MustEncodeSet(cal+"/1", "a", 0)}
+	<-st.Seqns
+
+	m := &Manager{
+		Self:    "r",
+		DefRev:  10,
+		Alpha:   3,
+		Store:   st,
+		Learner: true,
+		run:     make(map[int64]*run),
+	}
+	m.addLearnerRuns()
+
+	var ns []int
+	for n, r := range m.run {
+		ns = append(ns, int(n))
+		assert.Equal(t, []string{"a"}, r.cals)
+	}
+	sort.Ints(ns)
+	assert.Equal(t, []int{10, 11, 12}, ns)
+	assert.Equal(t, int64(13), m.next)
+}
+
+func TestManagerLearnerCatchUp(t *testing.T) {
+	out := make(chan Packet, 100)
+	x := &net.UDPAddr{IP: net.IP{1, 2, 3, 4}, Port: 5}
+	y := &net.UDPAddr{IP: net.IP{2, 3, 4, 5}, Port: 6}
+	m := &Manager{
+		Out:     out,
+		TFill:   10,
+		Learner: true,
+		run: map[int64]*run{
+			5: &run{seqn: 5, addr: []*net.UDPAddr{x, y}, l: learner{done: true}},
+			6: &run{seqn: 6, addr: []*net.UDPAddr{x, y}},
+			7: &run{seqn: 7, addr: []*net.UDPAddr{x, y}},
+		},
+	}
+
+	m.catchUp(100)
+	m.catchUp(109)
+	assert.Equal(t, 0, len(out))
+
+	m.catchUp(110)
+	assert.Equal(t, 2, len(out))
+	exp := msg{Seqn: proto.Int64(6), Cmd: invite}
+	for _, addr := range []*net.UDPAddr{x, y} {
+		p := <-out
+		var got msg
+		assert.Equal(t, nil, proto.Unmarshal(p.Data, &got))
+		assert.Equal(t, addr, p.Addr)
+		assert.Equal(t, exp, got)
+	}
+
+	// Once 6 is learned, 7 gets its own wait.
+	m.run[6].l.done = true
+	m.catchUp(111)
+	m.catchUp(120)
+	assert.Equal(t, 0, len(out))
+	m.catchUp(121)
+	assert.Equal(t, 2, len(out))
+}
+
+func TestSendLearnTooLate(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.Nop}
+	st.Ops <- store.Op{2, store.Nop}
+	<-st.Seqns
+	st.Clean(1)
+
+	out := make(chan Packet, 1)
+	x := &net.UDPAddr{IP: net.IP{1, 2, 3, 4}, Port: 5}
+	sendLearn(out, &packet{x, msg{Seqn: proto.Int64(1), Cmd: invite}}, st)
+
+	p := <-out
+	var got msg
+	assert.Equal(t, nil, proto.Unmarshal(p.Data, &got))
+	assert.Equal(t, x, p.Addr)
+	assert.Equal(t, msg{Seqn: proto.Int64(1), Cmd: tooLate}, got)
+}
+
+func TestManagerPumpBehind(t *testing.T) {
+	behind := make(chan *net.UDPAddr, 1)
+	x := &net.UDPAddr{IP: net.IP{1, 2, 3, 4}, Port: 5}
+	m := &Manager{
+		Behind: behind,
+		next:   6,
+		run: map[int64]*run{
+			5: &run{seqn: 5, addr: []*net.UDPAddr{x}},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		heap.Push(&m.packet, &packet{x, msg{Seqn: proto.Int64(5), Cmd: tooLate}})
+	}
+	m.pump()
+	assert.Equal(t, 0, len(m.packet))
+	assert.Equal(t, x, <-behind)
+	assert.Equal(t, 0, len(behind))
+	assert.Equal(t, false, m.run[5].l.done)
+}
+
+func TestManagerSeen(t *testing.T) {
+	var n int64
+	m := &Manager{Highest: &n}
+	m.seen(5)
+	m.seen(3)
+	assert.Equal(t, int64(5), n)
+	m.seen(8)
+	assert.Equal(t, int64(8), n)
+
+	(&Manager{}).seen(9) // no Highest; mustn't panic
+}
+
+func TestManagerEventJump(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet(node+"/a/addr", "1.2.3.4:5", 0)}
+	st.Ops <- store.Op{2, store.MustEncodeSet(cal+"/1", "a", 0)}
+	for n := int64(3); n <= 9; n++ {
+		st.Ops <- store.Op{n, store.Nop}
+	}
+
+	m := &Manager{
+		Self:  "b",
+		Alpha: 2,
+		run:   make(map[int64]*run),
+	}
+	m.event(<-mustWait(st, 2))
+	m.event(<-mustWait(st, 3))
+	assert.Equal(t, int64(6), m.next)
+
+	m.event(<-mustWait(st, 9))
+	var ns []int
+	for n, r := range m.run {
+		ns = append(ns, int(n))
+		assert.Equal(t, []string{"a"}, r.cals)
+	}
+	sort.Ints(ns)
+	assert.Equal(t, []int{10, 11}, ns)
+	assert.Equal(t, int64(12), m.next)
+}
+
+func TestManagerRoundTimeout(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet(node+"/a/addr", "1.2.3.4:5", 0)}
+	st.Ops <- store.Op{2, store.MustEncodeSet(cal+"/1", "a", 0)}
+
+	m := &Manager{
+		Self:   "b",
+		Alpha:  2,
+		TRound: 250e6,
+		run:    make(map[int64]*run),
+	}
+	r := m.addRun(<-mustWait(st, 2))
+	assert.Equal(t, int64(250e6), r.bound)
+
+	m.TRound = 0
+	r = m.addRun(<-mustWait(st, 2))
+	assert.Equal(t, int64(initialWaitBound), r.bound)
+}
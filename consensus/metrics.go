@@ -0,0 +1,49 @@
+package consensus
+
+import (
+	"sync/atomic"
+)
+
+// A Histogram counts observations in buckets, each counting those no
+// greater than its bound, in the manner of Prometheus. It is safe to
+// observe and read at the same time; each observation costs a few
+// atomic adds.
+type Histogram struct {
+	Bounds []float64 // upper bounds, ascending
+	counts []int64   // by bucket, then one for observations past them all
+	sum    int64     // of observations, in ns
+}
+
+func NewHistogram(bounds ...float64) *Histogram {
+	return &Histogram{Bounds: bounds, counts: make([]int64, len(bounds)+1)}
+}
+
+// Observe records one observation of ns nanoseconds.
+func (h *Histogram) Observe(ns int64) {
+	s := float64(ns) / 1e9
+	i := 0
+	for i < len(h.Bounds) && s > h.Bounds[i] {
+		i++
+	}
+	atomic.AddInt64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, ns)
+}
+
+// Read returns the cumulative count for each bound, the total count,
+// and the sum of all observations in seconds.
+func (h *Histogram) Read() (cum []int64, count int64, sum float64) {
+	cum = make([]int64, len(h.Bounds))
+	for i := range h.counts {
+		count += atomic.LoadInt64(&h.counts[i])
+		if i < len(cum) {
+			cum[i] = count
+		}
+	}
+	return cum, count, float64(atomic.LoadInt64(&h.sum)) / 1e9
+}
+
+// ProposeLatency holds, in seconds, how long each value this node
+// proposed took to be learned, from the time the manager got it.
+var ProposeLatency = NewHistogram(
+	.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+)
@@ -0,0 +1,26 @@
+package consensus
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(.01, .1, 1)
+	h.Observe(5e6)
+	h.Observe(1e7)
+	h.Observe(5e8)
+	h.Observe(3e9)
+
+	cum, count, sum := h.Read()
+	assert.Equal(t, []int64{2, 2, 3}, cum)
+	assert.Equal(t, int64(4), count)
+	assert.Equal(t, 3.515, sum)
+}
+
+func TestManagerProposeMarksRun(t *testing.T) {
+	m := &Manager{run: map[int64]*run{3: &run{seqn: 3}}}
+	m.propose(new(packets), &Prop{Seqn: 3, Mut: []byte("foo")}, 123)
+	assert.Equal(t, true, m.run[3].prop)
+	assert.Equal(t, int64(123), m.run[3].propT)
+}
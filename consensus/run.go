@@ -3,8 +3,8 @@ package consensus
 import (
 	"code.google.com/p/goprotobuf/proto"
 	"container/heap"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/store"
-	"log"
 	"math/rand"
 	"net"
 	"time"
@@ -18,6 +18,9 @@ type run struct {
 	cals []string
 	addr []*net.UDPAddr
 
+	// learners get what this run learns, but don't vote
+	learners []*net.UDPAddr
+
 	c coordinator
 	a acceptor
 	l learner
@@ -27,6 +30,12 @@ type run struct {
 	bound int64
 	ntick int
 	prop  bool
+	propT int64 // when this node proposed a value here
+
+	// told ErrNoQuorum once maxRounds rounds have begun without the
+	// value this node proposed being learned
+	fail      chan<- error
+	maxRounds int
 }
 
 func (r *run) quorum() int {
@@ -35,7 +44,7 @@ func (r *run) quorum() int {
 
 func (r *run) update(p *packet, from int, ticks heap.Interface) {
 	if p.msg.Cmd != nil && *p.msg.Cmd == msg_TICK {
-		log.Printf("tick wasteful=%v", r.l.done)
+		logging.Debug("tick", "wasteful", r.l.done)
 	}
 
 	m, tick := r.c.update(p, from)
@@ -44,8 +53,16 @@ func (r *run) update(p *packet, from int, ticks heap.Interface) {
 		r.ntick++
 		r.bound *= 2
 		t := rand.Int63n(r.bound + 1) // +1 because it panics if bound is 0.
-		log.Printf("sched tick=%d seqn=%d t=%d", r.ntick, r.seqn, t)
+		logging.Debug("sched", "tick", r.ntick, "seqn", r.seqn, "t", t)
 		schedTrigger(ticks, r.seqn, time.Now().UnixNano(), t)
+		if r.fail != nil && r.ntick > r.maxRounds && !r.l.done {
+			logging.Warn("no quorum", "seqn", r.seqn, "rounds", r.maxRounds)
+			select {
+			case r.fail <- ErrNoQuorum:
+			default:
+			}
+			r.fail = nil
+		}
 	}
 
 	m = r.a.update(&p.msg)
@@ -54,7 +71,12 @@ func (r *run) update(p *packet, from int, ticks heap.Interface) {
 	m, v, ok := r.l.update(p, from)
 	r.broadcast(m)
 	if ok {
-		log.Printf("learn seqn=%d", r.seqn)
+		if r.prop {
+			ProposeLatency.Observe(time.Now().UnixNano() - r.propT)
+		}
+		if logging.Enabled(logging.LevelDebug) {
+			logging.Debug("learn", traceFields(v, "seqn", r.seqn)...)
+		}
 		r.ops <- store.Op{r.seqn, string(v)}
 	}
 }
@@ -66,6 +88,11 @@ func (r *run) broadcast(m *msg) {
 		for _, addr := range r.addr {
 			r.out <- Packet{addr, b}
 		}
+		if *m.Cmd == msg_LEARN {
+			for _, addr := range r.learners {
+				r.out <- Packet{addr, b}
+			}
+		}
 	}
 }
 
@@ -90,6 +117,32 @@ func (r *run) indexOfAddr(a *net.UDPAddr) int {
 	return -1
 }
 
+// Returns the first round this node coordinates, its index plus the
+// number of members. A coordinator's rounds step by the number of
+// members, so every round a node coordinates leaves its index as the
+// remainder. No two members share a round, whatever the seqn, and
+// however long either has been running.
+func (r *run) firstRound() int64 {
+	return r.indexOf(r.self) + int64(len(r.cals))
+}
+
+// Returns self's place in the order in which this run's members step
+// in for each other: 0 for the leader, then the rest, lowest index
+// first. It returns -1 if self is not a member.
+func (r *run) tiePos(self string) int64 {
+	i, n := r.indexOf(self), int64(len(r.cals))
+	if i < 0 {
+		return -1
+	}
+	switch lead := r.seqn % n; {
+	case i == lead:
+		return 0
+	case i < lead:
+		return i + 1
+	}
+	return i
+}
+
 func (r *run) isLeader(self string) bool {
 	for i, id := range r.cals {
 		if id == self {
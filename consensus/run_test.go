@@ -1,10 +1,16 @@
 package consensus
 
 import (
+	"bytes"
 	"code.google.com/p/goprotobuf/proto"
 	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/store"
+	"log"
+	"math/rand"
 	"net"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -168,6 +174,26 @@ func TestRunAppliesOp(t *testing.T) {
 	assert.Equal(t, store.Op{1, "foo"}, <-c)
 }
 
+func TestRunLogsTrace(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	logging.SetLevel(logging.LevelDebug)
+	defer logging.SetLevel(logging.LevelInfo)
+
+	c := make(chan store.Op, 100)
+	var r run
+	r.seqn = 1
+	r.out = make(chan Packet, 100)
+	r.ops = c
+	r.l.init(1, 1)
+
+	mut, _ := store.EncodeTrace("abc", store.Nop)
+	r.update(&packet{msg: *newVote(1, mut)}, 0, new(triggers))
+	assert.Equal(t, store.Op{1, mut}, <-c)
+	assert.T(t, strings.Contains(buf.String(), "msg=learn seqn=1 trace=abc\n"), buf.String())
+}
+
 func TestRunBroadcastThree(t *testing.T) {
 	c := make(chan Packet, 100)
 	var r run
@@ -202,6 +228,24 @@ func TestRunBroadcastThree(t *testing.T) {
 	assert.Equal(t, r.addr, addr)
 }
 
+func TestRunBroadcastLearnToLearners(t *testing.T) {
+	c := make(chan Packet, 100)
+	var r run
+	r.seqn = 1
+	r.out = c
+	r.addr = []*net.UDPAddr{&net.UDPAddr{IP: net.IP{1, 2, 3, 4}, Port: 5}}
+	r.learners = []*net.UDPAddr{&net.UDPAddr{IP: net.IP{2, 3, 4, 5}, Port: 6}}
+
+	r.broadcast(newInvite(1))
+	assert.Equal(t, 1, len(c))
+	assert.Equal(t, r.addr[0], (<-c).Addr)
+
+	r.broadcast(&msg{Cmd: learn, Value: []byte("foo")})
+	assert.Equal(t, 2, len(c))
+	assert.Equal(t, r.addr[0], (<-c).Addr)
+	assert.Equal(t, r.learners[0], (<-c).Addr)
+}
+
 func TestRunBroadcastFive(t *testing.T) {
 	c := make(chan Packet, 100)
 	var r run
@@ -299,3 +343,128 @@ func TestRunIndexOfNilAddr(t *testing.T) {
 	r := run{addr: []*net.UDPAddr{new(net.UDPAddr)}}
 	assert.Equal(t, -1, r.indexOfAddr(nil))
 }
+
+func TestRunFirstRound(t *testing.T) {
+	cals := []string{"a", "b", "c"}
+	for seqn := int64(0); seqn < 6; seqn++ {
+		for i, self := range cals {
+			r := &run{seqn: seqn, self: self, cals: cals}
+			assert.Equal(t, int64(i+3), r.firstRound(), seqn, self)
+		}
+	}
+	r := &run{seqn: 3, self: "x", cals: cals}
+	assert.Equal(t, int64(2), r.firstRound())
+}
+
+// A node numbers its rounds as nodes always have, index plus a
+// multiple of the number of members, so in a cluster where some nodes
+// run older code, no two coordinators ever share a round.
+func TestRunRoundsDisjointAcrossVersions(t *testing.T) {
+	cals := []string{"a", "b", "c", "d"}
+	n := int64(len(cals))
+	oldRound := func(i, k int64) int64 { return i + n + k*n }
+
+	for seqn := int64(0); seqn < 8; seqn++ {
+		owner := make(map[int64]string)
+		for i, self := range cals {
+			r := &run{seqn: seqn, self: self, cals: cals}
+			r.c.size = len(cals)
+			r.c.crnd = r.firstRound()
+			for k := int64(0); k < 5; k++ {
+				// Odd members run the old numbering.
+				rnd := r.c.crnd
+				if i%2 == 1 {
+					rnd = oldRound(int64(i), k)
+				}
+				if o, ok := owner[rnd]; ok {
+					t.Fatalf("seqn %d: %s and %s share round %d", seqn, o, self, rnd)
+				}
+				owner[rnd] = self
+				assert.Equal(t, oldRound(int64(i), k), r.c.crnd, seqn, self, k)
+				r.c.update(&packet{msg: msg{Cmd: tick}}, -1)
+			}
+		}
+	}
+}
+
+func TestRunTiePos(t *testing.T) {
+	cals := []string{"a", "b", "c"}
+	// Seqn 4 is b's to lead; then a, the lowest index, then c.
+	exp := map[string]int64{"a": 1, "b": 0, "c": 2}
+	for self, pos := range exp {
+		r := &run{seqn: 4, cals: cals}
+		assert.Equal(t, pos, r.tiePos(self), self)
+	}
+
+	r := &run{seqn: 3, cals: cals}
+	assert.Equal(t, int64(0), r.tiePos("a"))
+	assert.Equal(t, int64(-1), r.tiePos("x"))
+}
+
+// Every member starts coordinating the same run at once, each with its
+// own value, and every message of one step arrives, in some order,
+// before any of the next. However they're ordered, they all learn the
+// same value: the one of the member whose rounds are highest.
+func TestRunSimultaneousCoordinators(t *testing.T) {
+	cals := []string{"a", "b", "c"}
+	addrs := []*net.UDPAddr{
+		{IP: net.IP{127, 0, 0, 1}, Port: 1},
+		{IP: net.IP{127, 0, 0, 1}, Port: 2},
+		{IP: net.IP{127, 0, 0, 1}, Port: 3},
+	}
+
+	for seed := int64(0); seed < 20; seed++ {
+		rs := make([]*run, len(cals))
+		outs := make([]chan Packet, len(cals))
+		ops := make([]chan store.Op, len(cals))
+		for i := range rs {
+			outs[i], ops[i] = make(chan Packet, 100), make(chan store.Op, 1)
+			r := &run{
+				seqn:  1, // b leads
+				self:  cals[i],
+				cals:  cals,
+				addr:  addrs,
+				out:   outs[i],
+				ops:   ops[i],
+				bound: initialWaitBound,
+			}
+			r.c.size = len(cals)
+			r.c.quor = r.quorum()
+			r.c.crnd = r.firstRound()
+			r.l.init(len(cals), int64(r.quorum()))
+			rs[i] = r
+		}
+
+		for i, r := range rs {
+			p := &packet{msg: msg{Seqn: proto.Int64(1), Cmd: propose, Value: []byte(cals[i])}}
+			r.update(p, -1, new(triggers))
+		}
+
+		rnd := rand.New(rand.NewSource(seed))
+		for step := 0; step < 5; step++ {
+			type delivery struct {
+				to, from int
+				p        *packet
+			}
+			var ds []delivery
+			for from, out := range outs {
+				for len(out) > 0 {
+					P := <-out
+					p := &packet{Addr: addrs[from]}
+					err := proto.Unmarshal(P.Data, &p.msg)
+					assert.Equal(t, nil, err)
+					ds = append(ds, delivery{P.Addr.Port - 1, from, p})
+				}
+			}
+			for _, i := range rnd.Perm(len(ds)) {
+				d := ds[i]
+				rs[d.to].update(d.p, d.from, new(triggers))
+			}
+		}
+
+		for i, r := range rs {
+			assert.Equal(t, true, r.l.done, seed, i)
+			assert.Equal(t, store.Op{1, "c"}, <-ops[i], seed, i)
+		}
+	}
+}
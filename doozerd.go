@@ -2,11 +2,17 @@ package main
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	_ "expvar"
 	"flag"
 	"fmt"
 	"github.com/madebymany/doozer"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/peer"
+	"github.com/madebymany/doozerd/server"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/web"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
@@ -28,6 +34,7 @@ func (a *strings) String() string {
 
 var (
 	laddr       = flag.String("l", "127.0.0.1:8046", "The address to bind to.")
+	usockPath   = flag.String("unix", "", "also take clients on a Unix domain socket at this path")
 	aaddrs      = strings{}
 	buri        = flag.String("b", "", "boot cluster uri (tried after -a)")
 	waddr       = flag.String("w", "", "web listen addr (default: see below)")
@@ -35,10 +42,31 @@ var (
 	showVersion = flag.Bool("v", false, "print doozerd's version string")
 	pi          = flag.Float64("pulse", 1, "how often (in seconds) to set applied key")
 	fd          = flag.Float64("fill", .1, "delay (in seconds) to fill unowned seqns")
+	bw          = flag.Float64("batch", 0, "delay (in seconds) to wait for more writes to batch with one (0 means no batching)")
 	kt          = flag.Float64("timeout", 60, "timeout (in seconds) to kick inactive nodes")
+	rt          = flag.Float64("round", .001, "initial timeout (in seconds) before retrying a consensus round")
+	settle      = flag.Float64("settle", 1, "time (in seconds) a node joining a cluster waits before filling seqns other nodes lead")
+	rounds      = flag.Int("rounds", peer.DefaultConfig.MaxRounds, "consensus rounds a client's write may take before it fails with NO_QUORUM (0 means no limit)")
 	hi          = flag.Int64("hist", 2000, "length of history/revisions to keep")
+	histAge     = flag.Float64("histage", 0, "time (in seconds) to keep history for, if longer than -hist revisions (0 means just -hist)")
+	dataDir     = flag.String("data", "", "directory to save the store in, and to recover it from when starting a new cluster")
+	snapInt     = flag.Float64("snapint", 60, "how often (in seconds) to write a new snapshot to the -data directory")
+	maxValue    = flag.Int("maxvalue", store.DefaultMaxValueLen, "maximum length (in bytes) of a file's body")
+	rate        = flag.Float64("rate", 0, "requests per second each client connection may make (0 means no limit)")
+	burst       = flag.Int("burst", 100, "requests a client connection may make at once, beyond -rate")
+	rto         = flag.Float64("readtimeout", 0, "time (in seconds) to wait for a request from an idle client before closing its connection (0 means forever)")
+	kat         = flag.Float64("keepalive", 0, "time (in seconds) to wait for a request from a client that has sent a PING, even while it waits, before closing its connection (0 means forever)")
+	wto         = flag.Float64("writetimeout", 0, "time (in seconds) to wait for a client to accept a response before closing its connection (0 means forever)")
+	drain       = flag.Float64("drain", 10, "time (in seconds) to let requests finish on SIGTERM")
+	opWindow    = flag.Float64("opwindow", 600, "time (in seconds) to remember a write made with an op_id, so that a retry isn't applied again")
+	maxWaits    = flag.Int("maxwaits", server.MaxWaits, "WAIT requests each client connection may have outstanding (0 means no limit)")
+	replica     = flag.Bool("replica", false, "follow the cluster without joining the consensus set (requires -a)")
+	metrics     = flag.Bool("metrics", true, "serve Prometheus metrics at /metrics on the web listener")
 	certFile    = flag.String("tlscert", "", "TLS public certificate")
 	keyFile     = flag.String("tlskey", "", "TLS private key")
+	caFile      = flag.String("tlsca", "", "TLS certificates of the CAs that sign client and member certificates (requires -tlscert)")
+	webWrite    = flag.Bool("webwrite", false, "let clients change the store through /keys/ on the web listener (not with -tlsca)")
+	logLevel    = flag.String("loglevel", "info", "least severe level to log: debug, info, warn, or error")
 )
 
 var (
@@ -58,6 +86,11 @@ func Usage() {
 The default for -w is to use the addr from -l,
 and change the port to 8000. If you give "-w false",
 doozerd will not listen for for web connections.
+
+On high-latency links, raise -round above the round trip
+time between nodes, and -pulse and -timeout to match.
+-timeout must be at least 3 times -pulse, and longer
+than -round.
 `)
 }
 
@@ -72,12 +105,31 @@ func main() {
 		return
 	}
 
+	if err := peer.CheckTimeouts(ns(*pi), ns(*fd), ns(*kt), ns(*rt)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *webWrite && *caFile != "" {
+		fmt.Fprintln(os.Stderr, "-webwrite can't be used with -tlsca")
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	if *laddr == "" {
 		fmt.Fprintln(os.Stderr, "require a listen address")
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	logging.SetLevel(level)
 	log.SetPrefix("DOOZER ")
 	log.SetFlags(log.Ldate | log.Lmicroseconds)
 
@@ -86,8 +138,13 @@ func main() {
 		panic(err)
 	}
 
-	if *certFile != "" || *keyFile != "" {
-		tsock = tlsWrap(tsock, *certFile, *keyFile)
+	var peerTLS *tls.Config
+	if *certFile != "" || *keyFile != "" || *caFile != "" {
+		tsock, peerTLS = tlsWrap(tsock, *certFile, *keyFile, *caFile)
+	}
+
+	if *usockPath != "" {
+		tsock = server.MultiListener(tsock, listenUnix(*usockPath))
 	}
 
 	uaddr, err := net.ResolveUDPAddr("udp", *laddr)
@@ -116,9 +173,20 @@ func main() {
 		}
 	}
 
+	web.ServeMetrics = *metrics
+	server.DefaultLimit = server.Limit{Rate: *rate, Burst: *burst}
+	server.ReadTimeout, server.WriteTimeout = ns(*rto), ns(*wto)
+	server.KeepaliveTimeout = ns(*kat)
+	server.MaxWaits = *maxWaits
+	server.OpWindow = ns(*opWindow)
+
 	id := randId()
 	var cl *doozer.Conn
 	switch {
+	case *replica && len(aaddrs) == 0:
+		fmt.Fprintln(os.Stderr, "a replica requires an attach address")
+		flag.Usage()
+		os.Exit(1)
 	case len(aaddrs) > 0 && *buri != "":
 		cl = attach(*name, aaddrs)
 		if cl == nil {
@@ -133,7 +201,25 @@ func main() {
 		cl = boot(*name, id, *laddr, *buri)
 	}
 
-	peer.Main(*name, id, *buri, rwsk, rosk, cl, usock, tsock, wsock, ns(*pi), ns(*fd), ns(*kt), *hi)
+	cfg := peer.Config{
+		PulseInterval:    ns(*pi),
+		FillDelay:        ns(*fd),
+		KickTimeout:      ns(*kt),
+		Hist:             *hi,
+		HistAge:          ns(*histAge),
+		MaxValueLen:      *maxValue,
+		BatchWindow:      ns(*bw),
+		RoundTimeout:     ns(*rt),
+		DrainTimeout:     ns(*drain),
+		MaxRounds:        *rounds,
+		SettleDelay:      ns(*settle),
+		Replica:          *replica,
+		DataDir:          *dataDir,
+		SnapshotInterval: ns(*snapInt),
+		TLSConfig:        peerTLS,
+		WebWrites:        *webWrite,
+	}
+	peer.Main(*name, id, *buri, rwsk, rosk, cl, usock, tsock, wsock, cfg)
 	panic("main exit")
 }
 
@@ -141,7 +227,9 @@ func ns(x float64) int64 {
 	return int64(x * 1e9)
 }
 
-func tlsWrap(l net.Listener, cfile, kfile string) net.Listener {
+// Wraps l to serve TLS, and returns as well the config for dialing
+// other members, which serve it the same way.
+func tlsWrap(l net.Listener, cfile, kfile, cafile string) (net.Listener, *tls.Config) {
 	if cfile == "" || kfile == "" {
 		panic("need both cert file and key file")
 	}
@@ -153,5 +241,39 @@ func tlsWrap(l net.Listener, cfile, kfile string) net.Listener {
 
 	tc := new(tls.Config)
 	tc.Certificates = append(tc.Certificates, cert)
-	return tls.NewListener(l, tc)
+
+	if cafile != "" {
+		pem, err := ioutil.ReadFile(cafile)
+		if err != nil {
+			panic(err)
+		}
+		tc.ClientCAs = x509.NewCertPool()
+		if !tc.ClientCAs.AppendCertsFromPEM(pem) {
+			panic("no certificates in " + cafile)
+		}
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	// This node dials other members with its own cert, trusting the
+	// same CA. Without one, there's nothing to check their certs
+	// against; the secret still guards what they serve.
+	pc := &tls.Config{
+		Certificates:       tc.Certificates,
+		RootCAs:            tc.ClientCAs,
+		InsecureSkipVerify: tc.ClientCAs == nil,
+	}
+	return tls.NewListener(l, tc), pc
+}
+
+// Listens on a Unix socket at path, first removing any socket left
+// there by a doozerd that didn't shut down cleanly.
+func listenUnix(path string) net.Listener {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		panic(err)
+	}
+	return l
 }
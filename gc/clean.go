@@ -1,13 +1,137 @@
 package gc
 
 import (
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/store"
+	"strconv"
 	"time"
 )
 
+const (
+	ctlDir      = "/ctl/gc"
+	triggerPath = ctlDir + "/trigger"
+	horizonPath = ctlDir + "/horizon"
+	lastrunPath = ctlDir + "/lastrun"
+)
+
+var triggerGlob = store.MustCompileGlob(triggerPath)
+
+// The revision st had reached at some tick.
+type mark struct {
+	t    time.Time
+	seqn int64
+}
+
+// Clean is CleanAge with no age limit.
 func Clean(st *store.Store, keep int64, ticker <-chan time.Time) {
-	for _ = range ticker {
-		last := (<-st.Seqns) - keep
+	CleanAge(st, keep, 0, ticker)
+}
+
+// CleanAge tells st, on each tick, to forget history it no longer
+// needs. It keeps at least the last keep revisions, and, if age is
+// positive, every revision applied within the last age ns, as near as
+// the ticks can tell.
+func CleanAge(st *store.Store, keep, age int64, ticker <-chan time.Time) {
+	CleanCtl(st, nil, keep, age, ticker)
+}
+
+// CleanCtl is CleanAge, but also cleans as soon as anyone sets
+// /ctl/gc/trigger. After such a run, it records, through p, the oldest
+// revision still kept in /ctl/gc/horizon and the time, in ns, in
+// /ctl/gc/lastrun. Every node sees the trigger and cleans; the record
+// is conditional on the revision of /ctl/gc/horizon as of the trigger,
+// so only the first node's lands. If p is nil, nothing is recorded.
+func CleanCtl(st *store.Store, p consensus.Proposer, keep, age int64, ticker <-chan time.Time) {
+	var marks []mark // oldest first
+	clean := func(t time.Time) (last int64) {
+		seqn := <-st.Seqns
+		last = seqn - keep
+		if age > 0 {
+			marks = append(marks, mark{t, seqn})
+
+			// Keep the newest mark from before the cutoff, and
+			// none older; every revision up to its seqn was
+			// applied before the cutoff.
+			cut := t.Add(-time.Duration(age))
+			i := 0
+			for i+1 < len(marks) && !marks[i+1].t.After(cut) {
+				i++
+			}
+			marks = marks[i:]
+
+			old := int64(0)
+			if !marks[0].t.After(cut) {
+				old = marks[0].seqn
+			}
+			if old < last {
+				last = old
+			}
+		}
 		st.Clean(last)
+		return last
+	}
+
+	triggers := make(chan store.Event)
+	rev, _ := st.Snap()
+	go watchTrigger(st, rev, triggers)
+	for {
+		select {
+		case t, ok := <-ticker:
+			if !ok {
+				return
+			}
+			clean(t)
+		case ev, ok := <-triggers:
+			if !ok {
+				return
+			}
+			now := time.Now()
+			last := clean(now)
+			if p != nil {
+				record(p, ev, last+1, now)
+			}
+		}
+	}
+}
+
+// Sends each change to /ctl/gc/trigger after rev that sets it, until
+// st closes.
+func watchTrigger(st *store.Store, rev int64, triggers chan<- store.Event) {
+	defer close(triggers)
+	for {
+		ch, err := st.Wait(triggerGlob, rev+1)
+		if err == store.ErrTooLate {
+			rev, _ = st.Snap()
+			continue
+		} else if err != nil {
+			return
+		}
+		ev, ok := <-ch
+		if !ok {
+			return
+		}
+		if ev.IsSet() {
+			triggers <- ev
+		}
+		rev = ev.Seqn
+	}
+}
+
+func record(p consensus.Proposer, trigger store.Event, horizon int64, now time.Time) {
+	if horizon < 1 {
+		horizon = 1
+	}
+	_, rev := trigger.Get(horizonPath)
+
+	var t store.Txn
+	t.Set(horizonPath, strconv.FormatInt(horizon, 10), rev)
+	t.Set(lastrunPath, strconv.FormatInt(now.UnixNano(), 10), store.Clobber)
+	e := consensus.Txn(p, &t)
+	if te, ok := e.Err.(*store.TxnError); ok && te.Err == store.ErrRevMismatch {
+		return // another node recorded this run first
+	}
+	if e.Err != nil {
+		logging.Error("clean", "err", e.Err)
 	}
 }
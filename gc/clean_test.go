@@ -2,7 +2,10 @@ package gc
 
 import (
 	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/consensus"
 	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -28,3 +31,146 @@ func TestGcClean(t *testing.T) {
 	_, err = st.Wait(store.Any, 1)
 	assert.Equal(t, store.ErrTooLate, err)
 }
+
+func TestGcCleanAgeKeeps(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+
+	ticker := make(chan time.Time)
+	defer close(ticker)
+
+	go CleanAge(st, 3, 60e9, ticker)
+
+	st.Ops <- store.Op{1, store.Nop}
+	st.Ops <- store.Op{2, store.Nop}
+	ticker <- time.Unix(100, 0)
+	ticker <- time.Unix(130, 0) // Extra tick to ensure 100 saw only revision 2
+	st.Ops <- store.Op{3, store.Nop}
+	st.Ops <- store.Op{4, store.Nop}
+	st.Ops <- store.Op{5, store.Nop}
+	st.Ops <- store.Op{6, store.Nop}
+	ticker <- time.Unix(130, 0)
+	ticker <- time.Unix(130, 0)
+
+	// Revision 1 is more than 3 back, but younger than a minute.
+	_, err := st.Wait(store.Any, 1)
+	assert.Equal(t, nil, err)
+}
+
+func TestGcCleanAgeExpires(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+
+	ticker := make(chan time.Time)
+	defer close(ticker)
+
+	go CleanAge(st, 3, 60e9, ticker)
+
+	st.Ops <- store.Op{1, store.Nop}
+	st.Ops <- store.Op{2, store.Nop}
+	ticker <- time.Unix(100, 0)
+	ticker <- time.Unix(130, 0) // Extra tick to ensure 100 saw only revision 2
+	st.Ops <- store.Op{3, store.Nop}
+	st.Ops <- store.Op{4, store.Nop}
+	st.Ops <- store.Op{5, store.Nop}
+	st.Ops <- store.Op{6, store.Nop}
+	ticker <- time.Unix(170, 0)
+	ticker <- time.Unix(170, 0)
+
+	// Revisions 1 and 2 were applied by 100, more than a minute ago.
+	_, err := st.Wait(store.Any, 2)
+	assert.Equal(t, store.ErrTooLate, err)
+	_, err = st.Wait(store.Any, 3)
+	assert.Equal(t, nil, err)
+}
+
+func TestGcCleanAgeKeepsRevs(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+
+	ticker := make(chan time.Time)
+	defer close(ticker)
+
+	go CleanAge(st, 3, 1e9, ticker)
+
+	st.Ops <- store.Op{1, store.Nop}
+	st.Ops <- store.Op{2, store.Nop}
+	st.Ops <- store.Op{3, store.Nop}
+	st.Ops <- store.Op{4, store.Nop}
+	ticker <- time.Unix(100, 0)
+	ticker <- time.Unix(200, 0)
+	ticker <- time.Unix(200, 0)
+
+	// Everything is older than a second, but the last 3 are kept.
+	_, err := st.Wait(store.Any, 1)
+	assert.Equal(t, store.ErrTooLate, err)
+	_, err = st.Wait(store.Any, 2)
+	assert.Equal(t, nil, err)
+}
+
+func TestGcCleanTrigger(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	fp := &test.FakeProposer{Store: st}
+
+	ticker := make(chan time.Time)
+	defer close(ticker)
+
+	for i := 0; i < 5; i++ {
+		consensus.Set(fp, "/x", []byte("a"), store.Clobber)
+	}
+	ch, err := st.Wait(store.MustCompileGlob("/ctl/gc/lastrun"), 1)
+	assert.Equal(t, nil, err)
+	go CleanCtl(st, fp, 3, 0, ticker)
+	waitWatches(st, 2)
+
+	before := time.Now().UnixNano()
+	consensus.Set(fp, "/ctl/gc/trigger", nil, store.Clobber) // seqn 6
+	ev := <-ch
+
+	// The run cleaned everything older than the last 3 revisions as of
+	// the trigger.
+	_, err = st.Wait(store.Any, 3)
+	assert.Equal(t, store.ErrTooLate, err)
+	_, err = st.Wait(store.Any, 4)
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, "4", store.GetString(ev, "/ctl/gc/horizon"))
+	lastrun, err := strconv.ParseInt(ev.Body, 10, 64)
+	assert.Equal(t, nil, err)
+	assert.T(t, lastrun >= before, lastrun, before)
+}
+
+func TestGcCleanTriggerRecordsOnce(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	fp := &test.FakeProposer{Store: st}
+
+	ticker := make(chan time.Time)
+	defer close(ticker)
+
+	// Two nodes, sharing a store for simplicity.
+	ch, err := st.Wait(store.MustCompileGlob("/ctl/gc/lastrun"), 1)
+	assert.Equal(t, nil, err)
+	go CleanCtl(st, fp, 3, 0, ticker)
+	go CleanCtl(st, fp, 3, 0, ticker)
+	waitWatches(st, 3)
+	consensus.Set(fp, "/ctl/gc/trigger", nil, store.Clobber)
+	ev := <-ch
+
+	ch, err = st.Wait(store.MustCompileGlob("/ctl/gc/*"), ev.Seqn+1)
+	assert.Equal(t, nil, err)
+	consensus.Set(fp, "/y", nil, store.Clobber)
+	select {
+	case ev = <-ch:
+		t.Fatal("recorded twice:", ev.Path)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// Waits until st has n watches, such as one for each CleanCtl started.
+func waitWatches(st *store.Store, n int) {
+	for <-st.Waiting < n {
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,24 @@
+package gc
+
+import (
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/logging"
+	"github.com/madebymany/doozerd/store"
+	"time"
+)
+
+// Expire deletes files whose TTL has passed, checking on each tick.
+// The deletes go through p like any other, so every replica sees the
+// same thing; if two nodes race to delete the same files, the
+// revision checks make all but the first a no-op.
+func Expire(st *store.Store, p consensus.Proposer, ticker <-chan time.Time) {
+	for now := range ticker {
+		_, g := st.Snap()
+		if t := store.Expired(g, now.UnixNano()); t != nil {
+			e := consensus.Txn(p, t)
+			if e.Err != nil {
+				logging.Error("expire", "err", e.Err)
+			}
+		}
+	}
+}
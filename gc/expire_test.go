@@ -0,0 +1,31 @@
+package gc
+
+import (
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"testing"
+	"time"
+)
+
+func TestGcExpire(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+
+	m, _ := store.EncodeSetTTL("/x", "a", store.Clobber, 100)
+	st.Ops <- store.Op{1, m}
+	st.Ops <- store.Op{2, store.MustEncodeSet("/y", "b", store.Clobber)}
+	<-st.Seqns
+
+	ticker := make(chan time.Time)
+	defer close(ticker)
+	fs := make(FakeProposer)
+	go Expire(st, fs, ticker)
+
+	ticker <- time.Unix(0, 99)
+	ticker <- time.Unix(0, 100)
+	exp, _ := store.EncodeTxn(
+		store.MustEncodeDel("/x", 1),
+		store.MustEncodeDel("/ctl/ttl/x", 1),
+	)
+	assert.Equal(t, exp, <-fs)
+}
@@ -2,23 +2,39 @@ package gc
 
 import (
 	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/store"
-	"log"
 	"strconv"
 	"time"
 )
 
-func Pulse(node string, seqns <-chan int64, p consensus.Proposer, sleep int64) {
-	path := "/ctl/node/" + node + "/applied"
+// Pulse sets the node's applied file to each seqn it reads, sleeping
+// between. If lag is set, it also sets the node's lag file, in the same
+// mutation, to what lag says of each seqn: how many revisions behind
+// the rest of the cluster the node is.
+func Pulse(node string, seqns <-chan int64, p consensus.Proposer, sleep int64, lag func(applied int64) int64) {
+	dir := "/ctl/node/" + node + "/"
 	for {
 		seqn, ok := <-seqns
 		if !ok {
 			break
 		}
 
-		e := consensus.Set(p, path, []byte(strconv.FormatInt(seqn, 10)), store.Clobber)
+		var e store.Event
+		if lag == nil {
+			e = consensus.Set(p, dir+"applied", []byte(strconv.FormatInt(seqn, 10)), store.Clobber)
+		} else {
+			var tx store.Txn
+			e.Err = tx.Set(dir+"applied", strconv.FormatInt(seqn, 10), store.Clobber)
+			if e.Err == nil {
+				e.Err = tx.Set(dir+"lag", strconv.FormatInt(lag(seqn), 10), store.Clobber)
+			}
+			if e.Err == nil {
+				e = consensus.Txn(p, &tx)
+			}
+		}
 		if e.Err != nil {
-			log.Println(e.Err)
+			logging.Error("pulse", "err", e.Err)
 		}
 
 		time.Sleep(time.Duration(sleep))
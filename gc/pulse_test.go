@@ -21,7 +21,7 @@ func TestGcPulse(t *testing.T) {
 	defer close(seqns)
 	fs := make(FakeProposer)
 
-	go Pulse("test", seqns, fs, 1)
+	go Pulse("test", seqns, fs, 1, nil)
 
 	seqns <- 0
 	assert.Equal(t, "-1:/ctl/node/test/applied=0", <-fs)
@@ -29,3 +29,18 @@ func TestGcPulse(t *testing.T) {
 	seqns <- 1
 	assert.Equal(t, "-1:/ctl/node/test/applied=1", <-fs)
 }
+
+func TestGcPulseLag(t *testing.T) {
+	seqns := make(chan int64)
+	defer close(seqns)
+	fs := make(FakeProposer)
+
+	go Pulse("test", seqns, fs, 1, func(applied int64) int64 { return 10 - applied })
+
+	seqns <- 3
+	exp, _ := store.EncodeTxn(
+		"-1:/ctl/node/test/applied=3",
+		"-1:/ctl/node/test/lag=7",
+	)
+	assert.Equal(t, exp, <-fs)
+}
@@ -0,0 +1,115 @@
+// Package logging writes leveled log lines of key=value fields through
+// the standard log package, so that its prefix, flags, and output still
+// apply. A line looks like
+//
+//	level=info msg="installed snapshot" addr=10.0.0.2:8046 rev=1234
+//
+// Lines below the level set with SetLevel are skipped before their
+// fields are formatted, so a debug line on a hot path costs little
+// unless debug logging is on.
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// A Level is the severity of a log line.
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < 0 || int(l) >= len(levelNames) {
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ErrBadLevel is the error for a name ParseLevel doesn't know.
+var ErrBadLevel = errors.New("unknown log level")
+
+// ParseLevel returns the level named s, one of "debug", "info",
+// "warn", and "error".
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, ErrBadLevel
+}
+
+var level = int32(LevelInfo)
+
+// SetLevel makes lines below l be skipped. The default is LevelInfo.
+func SetLevel(l Level) {
+	atomic.StoreInt32(&level, int32(l))
+}
+
+// Enabled reports whether lines at l are written. Use it to skip work
+// done only to make a line's fields.
+func Enabled(l Level) bool {
+	return int32(l) >= atomic.LoadInt32(&level)
+}
+
+// Debug writes msg and the fields in kv, which alternate between keys
+// and values, at LevelDebug. The other functions are the same at their
+// own levels.
+func Debug(msg string, kv ...interface{}) { output(LevelDebug, msg, kv) }
+func Info(msg string, kv ...interface{})  { output(LevelInfo, msg, kv) }
+func Warn(msg string, kv ...interface{})  { output(LevelWarn, msg, kv) }
+func Error(msg string, kv ...interface{}) { output(LevelError, msg, kv) }
+
+func output(l Level, msg string, kv []interface{}) {
+	if !Enabled(l) {
+		return
+	}
+	log.Output(3, format(l, msg, kv))
+}
+
+func format(l Level, msg string, kv []interface{}) string {
+	var b bytes.Buffer
+	b.WriteString("level=")
+	b.WriteString(l.String())
+	b.WriteString(" msg=")
+	b.WriteString(quote(msg))
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 == len(kv) {
+			// A value with no key.
+			fmt.Fprintf(&b, " arg=%s", value(kv[i]))
+			break
+		}
+		fmt.Fprintf(&b, " %v=%s", kv[i], value(kv[i+1]))
+	}
+	return b.String()
+}
+
+func value(v interface{}) string {
+	switch x := v.(type) {
+	case error:
+		return quote(x.Error())
+	case string:
+		return quote(x)
+	}
+	return quote(fmt.Sprint(v))
+}
+
+// Quotes s if it would otherwise be hard to tell where it ends.
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
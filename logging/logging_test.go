@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"github.com/bmizerany/assert"
+	"log"
+	"os"
+	"testing"
+)
+
+// Sends log output to a buffer, with no prefix or flags, at level l,
+// until the returned func is called.
+func capture(l Level) (*bytes.Buffer, func()) {
+	var buf bytes.Buffer
+	flags, prefix := log.Flags(), log.Prefix()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	log.SetPrefix("")
+	SetLevel(l)
+	return &buf, func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+		SetLevel(LevelInfo)
+	}
+}
+
+func TestLevelSuppresses(t *testing.T) {
+	buf, done := capture(LevelWarn)
+	defer done()
+
+	Debug("a")
+	Info("b")
+	Warn("c")
+	Error("d")
+	assert.Equal(t, "level=warn msg=c\nlevel=error msg=d\n", buf.String())
+	assert.T(t, !Enabled(LevelInfo))
+	assert.T(t, Enabled(LevelError))
+}
+
+func TestLevelDebug(t *testing.T) {
+	buf, done := capture(LevelDebug)
+	defer done()
+
+	Debug("a")
+	assert.Equal(t, "level=debug msg=a\n", buf.String())
+}
+
+func TestFields(t *testing.T) {
+	buf, done := capture(LevelInfo)
+	defer done()
+
+	Info("learn", "seqn", 5, "path", "/a b", "err", errors.New("x=y"), "empty", "")
+	Info("two words", "lone")
+	exp := `level=info msg=learn seqn=5 path="/a b" err="x=y" empty=""` + "\n" +
+		`level=info msg="two words" arg=lone` + "\n"
+	assert.Equal(t, exp, buf.String())
+}
+
+func TestParseLevel(t *testing.T) {
+	for i, s := range []string{"debug", "info", "WARN", "error"} {
+		l, err := ParseLevel(s)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, Level(i), l)
+	}
+	_, err := ParseLevel("loud")
+	assert.Equal(t, ErrBadLevel, err)
+	assert.Equal(t, "warn", LevelWarn.String())
+	assert.Equal(t, "Level(9)", Level(9).String())
+}
@@ -8,6 +8,8 @@ GOFILES="
 	main.html.go
 	stats.html.go
 	main.js.go
+	tree.html.go
+	tree.js.go
 "
 
 for f in $GOFILES
@@ -2,8 +2,8 @@ package member
 
 import (
 	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/store"
-	"log"
 )
 
 var (
@@ -15,14 +15,20 @@ func Clean(c chan string, st *store.Store, p consensus.Proposer) {
 		_, g := st.Snap()
 		name := getName(addr, g)
 		if name != "" {
-			go func() {
-				clearSlot(p, g, name)
-				removeInfo(p, g, name)
-			}()
+			go Forget(p, g, name)
 		}
 	}
 }
 
+// Forget removes node name from the cluster as g has it: it gives up
+// the node's slot in the consensus set, deletes its info, and ends its
+// sessions.
+func Forget(p consensus.Proposer, g store.Getter, name string) {
+	clearSlot(p, g, name)
+	removeInfo(p, g, name)
+	endSessions(p, g, name)
+}
+
 func getName(addr string, g store.Getter) string {
 	for _, name := range store.Getdir(g, "/ctl/node") {
 		if store.GetString(g, "/ctl/node/"+name+"/addr") == addr {
@@ -44,7 +50,7 @@ func clearSlot(p consensus.Proposer, g store.Getter, name string) {
 func removeInfo(p consensus.Proposer, g store.Getter, name string) {
 	glob, err := store.CompileGlob("/ctl/node/" + name + "/**")
 	if err != nil {
-		log.Println(err)
+		logging.Error("remove info", "node", name, "err", err)
 		return
 	}
 	store.Walk(g, glob, func(path, _ string, rev int64) bool {
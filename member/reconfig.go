@@ -0,0 +1,174 @@
+package member
+
+import (
+	"errors"
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/store"
+	"strconv"
+)
+
+const calDir = "/ctl/cal"
+
+var (
+	ErrIsMember  = errors.New("already a member")
+	ErrNotMember = errors.New("not a member")
+	ErrQuorum    = errors.New("too few members would remain writable for a quorum")
+)
+
+type slot struct {
+	path string
+	id   string
+	rev  int64
+}
+
+func getSlots(g store.Getter) (slots []slot) {
+	store.Walk(g, calGlob, func(path, body string, rev int64) bool {
+		slots = append(slots, slot{path, body, rev})
+		return false
+	})
+	return slots
+}
+
+// Adds operations to t that fail if any occupied slot other than
+// skip has changed since g, so that two membership changes proposed
+// from the same revision can't both commit. Empty slots are left
+// alone; rewriting one would look like a vacancy to a waiting node.
+func guardSlots(t *store.Txn, slots []slot, skip string) error {
+	for _, s := range slots {
+		if s.id != "" && s.path != skip {
+			if err := t.Set(s.path, s.id, s.rev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AddMember makes id a member of the consensus set, with addr as its
+// address, in a single mutation. It takes an empty slot if there is
+// one, and otherwise makes a new slot. As with any change to /ctl/cal,
+// the new member participates starting alpha revisions after the
+// change commits; it should already be running and following the
+// cluster by then.
+//
+// Like RemoveMember, it refuses, with ErrQuorum, if fewer members would
+// be writable than the enlarged set needs for a quorum. Id counts as
+// writable only if it has already said so.
+func AddMember(p consensus.Proposer, g store.Getter, id, addr string) error {
+	slots := getSlots(g)
+	path, rev := "", store.Missing
+	n, members, live := 0, 0, 0
+	for _, s := range slots {
+		if s.id == id {
+			return ErrIsMember
+		}
+		if s.id == "" && path == "" {
+			path, rev = s.path, s.rev
+		}
+		if s.id != "" {
+			members++
+			if store.GetString(g, "/ctl/node/"+s.id+"/writable") == "true" {
+				live++
+			}
+		}
+		if i, err := strconv.Atoi(s.path[len(calDir)+1:]); err == nil && i >= n {
+			n = i + 1
+		}
+	}
+	if path == "" {
+		path = calDir + "/" + strconv.Itoa(n)
+	}
+	if store.GetString(g, "/ctl/node/"+id+"/writable") == "true" {
+		live++
+	}
+	if live < (members+1)/2+1 {
+		return ErrQuorum
+	}
+
+	var t store.Txn
+	if err := guardSlots(&t, slots, path); err != nil {
+		return err
+	}
+	if err := t.Set("/ctl/node/"+id+"/addr", addr, store.Clobber); err != nil {
+		return err
+	}
+	if err := t.Set(path, id, rev); err != nil {
+		return err
+	}
+	return consensus.Txn(p, &t).Err
+}
+
+// Finds id's slot, and counts the other members and how many of them
+// are writable.
+func findMember(g store.Getter, id string) (slots []slot, mine slot, rest, live int, err error) {
+	slots = getSlots(g)
+	for _, s := range slots {
+		switch {
+		case s.id == "":
+		case s.id == id:
+			mine = s
+		default:
+			rest++
+			if store.GetString(g, "/ctl/node/"+s.id+"/writable") == "true" {
+				live++
+			}
+		}
+	}
+	if mine.path == "" {
+		return nil, mine, 0, 0, ErrNotMember
+	}
+	return slots, mine, rest, live, nil
+}
+
+// RemoveMember takes id out of the consensus set in a single mutation,
+// deleting its slot so that no other node will take it. It refuses,
+// with ErrQuorum, if fewer of the remaining members are writable than
+// the remaining set needs for a quorum, or if no members would remain.
+// The node's information in /ctl/node is left in place.
+func RemoveMember(p consensus.Proposer, g store.Getter, id string) error {
+	slots, mine, rest, live, err := findMember(g, id)
+	if err != nil {
+		return err
+	}
+	if rest == 0 || live < rest/2+1 {
+		return ErrQuorum
+	}
+
+	var t store.Txn
+	if err := guardSlots(&t, slots, mine.path); err != nil {
+		return err
+	}
+	if err := t.Del(mine.path, mine.rev); err != nil {
+		return err
+	}
+	return consensus.Txn(p, &t).Err
+}
+
+// Leave gives up id's slot, for a member that is about to stop, so
+// that another node can take it. Id stays in the consensus set for
+// alpha more revisions after the change, which it won't be around
+// for; so Leave refuses, with ErrQuorum, unless the other writable
+// members make a quorum of the set as it is now. The node's
+// information in /ctl/node is deleted, as if it had been kicked.
+func Leave(p consensus.Proposer, g store.Getter, id string) error {
+	slots, mine, rest, live, err := findMember(g, id)
+	if err != nil {
+		return err
+	}
+	if live < (rest+1)/2+1 {
+		return ErrQuorum
+	}
+
+	var t store.Txn
+	if err := guardSlots(&t, slots, mine.path); err != nil {
+		return err
+	}
+	if err := t.Set(mine.path, "", mine.rev); err != nil {
+		return err
+	}
+	if err := consensus.Txn(p, &t).Err; err != nil {
+		return err
+	}
+	removeInfo(p, g, id)
+	return nil
+}
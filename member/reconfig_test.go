@@ -0,0 +1,164 @@
+package member
+
+import (
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func newCluster(cals ...string) (*store.Store, *test.FakeProposer) {
+	st := store.New()
+	fp := &test.FakeProposer{Store: st}
+	for i, id := range cals {
+		fp.Propose([]byte(store.MustEncodeSet("/ctl/cal/"+strconv.Itoa(i), id, store.Missing)))
+		if id != "" {
+			fp.Propose([]byte(store.MustEncodeSet("/ctl/node/"+id+"/writable", "true", store.Clobber)))
+		}
+	}
+	return st, fp
+}
+
+func cals(g store.Getter) map[string]string {
+	m := make(map[string]string)
+	for _, s := range getSlots(g) {
+		m[s.path] = s.id
+	}
+	return m
+}
+
+func sorted(a []string) []string {
+	sort.Strings(a)
+	return a
+}
+
+func TestAddMemberNewSlot(t *testing.T) {
+	st, fp := newCluster("a", "b")
+	defer close(st.Ops)
+
+	err := AddMember(fp, st, "c", "1.2.3.4:5")
+	assert.Equal(t, nil, err)
+	exp := map[string]string{"/ctl/cal/0": "a", "/ctl/cal/1": "b", "/ctl/cal/2": "c"}
+	assert.Equal(t, exp, cals(st))
+	assert.Equal(t, "1.2.3.4:5", store.GetString(st, "/ctl/node/c/addr"))
+}
+
+func TestAddMemberEmptySlot(t *testing.T) {
+	st, fp := newCluster("a", "", "b")
+	defer close(st.Ops)
+
+	err := AddMember(fp, st, "c", "1.2.3.4:5")
+	assert.Equal(t, nil, err)
+	exp := map[string]string{"/ctl/cal/0": "a", "/ctl/cal/1": "c", "/ctl/cal/2": "b"}
+	assert.Equal(t, exp, cals(st))
+}
+
+func TestAddMemberTwice(t *testing.T) {
+	st, fp := newCluster("a")
+	defer close(st.Ops)
+
+	assert.Equal(t, ErrIsMember, AddMember(fp, st, "a", "1.2.3.4:5"))
+}
+
+func TestAddMemberStale(t *testing.T) {
+	st, fp := newCluster("a")
+	defer close(st.Ops)
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/b/writable", "true", store.Clobber)))
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/c/writable", "true", store.Clobber)))
+
+	_, g := st.Snap()
+	assert.Equal(t, nil, AddMember(fp, g, "b", "1.2.3.4:5"))
+	err := AddMember(fp, g, "c", "1.2.3.4:6")
+	assert.Equal(t, &store.TxnError{Op: 0, Err: store.ErrRevMismatch}, err)
+	exp := map[string]string{"/ctl/cal/0": "a", "/ctl/cal/1": "b"}
+	assert.Equal(t, exp, cals(st))
+}
+
+func TestAddMemberQuorum(t *testing.T) {
+	// A set of 4 needs 3 writable members, but c isn't.
+	st, fp := newCluster("a", "b", "c")
+	defer close(st.Ops)
+	fp.Propose([]byte(store.MustEncodeDel("/ctl/node/c/writable", store.Clobber)))
+
+	assert.Equal(t, ErrQuorum, AddMember(fp, st, "d", "1.2.3.4:5"))
+	exp := map[string]string{"/ctl/cal/0": "a", "/ctl/cal/1": "b", "/ctl/cal/2": "c"}
+	assert.Equal(t, exp, cals(st))
+
+	// A new member that is already writable counts.
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/d/writable", "true", store.Clobber)))
+	assert.Equal(t, nil, AddMember(fp, st, "d", "1.2.3.4:5"))
+}
+
+func TestRemoveMember(t *testing.T) {
+	st, fp := newCluster("a", "b", "c")
+	defer close(st.Ops)
+
+	err := RemoveMember(fp, st, "b")
+	assert.Equal(t, nil, err)
+	exp := map[string]string{"/ctl/cal/0": "a", "/ctl/cal/2": "c"}
+	assert.Equal(t, exp, cals(st))
+	assert.Equal(t, "true", store.GetString(st, "/ctl/node/b/writable"))
+}
+
+func TestRemoveMemberNotMember(t *testing.T) {
+	st, fp := newCluster("a", "")
+	defer close(st.Ops)
+
+	assert.Equal(t, ErrNotMember, RemoveMember(fp, st, "b"))
+	assert.Equal(t, ErrNotMember, RemoveMember(fp, st, ""))
+}
+
+func TestRemoveMemberLast(t *testing.T) {
+	st, fp := newCluster("a")
+	defer close(st.Ops)
+
+	assert.Equal(t, ErrQuorum, RemoveMember(fp, st, "a"))
+}
+
+func TestRemoveMemberQuorum(t *testing.T) {
+	// Remaining set of 3 needs 2 writable members.
+	st, fp := newCluster("a", "b", "c", "d")
+	defer close(st.Ops)
+	fp.Propose([]byte(store.MustEncodeDel("/ctl/node/b/writable", store.Clobber)))
+
+	assert.Equal(t, nil, RemoveMember(fp, st, "a"))
+
+	// Remaining set of 2 needs 2 writable members, but b isn't.
+	assert.Equal(t, ErrQuorum, RemoveMember(fp, st, "c"))
+	assert.Equal(t, ErrQuorum, RemoveMember(fp, st, "d"))
+
+	// Removing b itself leaves c and d, both writable.
+	assert.Equal(t, nil, RemoveMember(fp, st, "b"))
+	exp := map[string]string{"/ctl/cal/2": "c", "/ctl/cal/3": "d"}
+	assert.Equal(t, exp, cals(st))
+}
+
+func TestLeave(t *testing.T) {
+	st, fp := newCluster("a", "b", "c")
+	defer close(st.Ops)
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/b/addr", "1.2.3.4:5", store.Clobber)))
+
+	assert.Equal(t, nil, Leave(fp, st, "b"))
+	exp := map[string]string{"/ctl/cal/0": "a", "/ctl/cal/1": "", "/ctl/cal/2": "c"}
+	assert.Equal(t, exp, cals(st))
+	assert.Equal(t, []string{"a", "c"}, sorted(store.Getdir(st, "/ctl/node")))
+}
+
+func TestLeaveQuorum(t *testing.T) {
+	// With b gone, a alone isn't a quorum of a and b.
+	st, fp := newCluster("a", "b")
+	defer close(st.Ops)
+
+	assert.Equal(t, ErrQuorum, Leave(fp, st, "b"))
+	assert.Equal(t, ErrQuorum, Leave(fp, st, "a"))
+	assert.Equal(t, ErrNotMember, Leave(fp, st, "x"))
+}
+
+func TestLeaveLast(t *testing.T) {
+	st, fp := newCluster("a")
+	defer close(st.Ops)
+
+	assert.Equal(t, ErrQuorum, Leave(fp, st, "a"))
+}
@@ -0,0 +1,42 @@
+package member
+
+import (
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/logging"
+	"github.com/madebymany/doozerd/store"
+)
+
+// SessionDir holds a record of each session-scoped file: for the file
+// at path, set by session sid on node, the empty file
+// SessionDir/node/sid followed by path. The two are set in one
+// mutation, so the record's revision is the file's as of its set.
+const SessionDir = "/ctl/session"
+
+// SessionPath returns the path of the record for the file at path in
+// session sid on node.
+func SessionPath(node, sid, path string) string {
+	return SessionDir + "/" + node + "/" + sid + path
+}
+
+// EndSession deletes each file that session sid on node set and that
+// hasn't changed since, and then its records.
+func EndSession(p consensus.Proposer, g store.Getter, node, sid string) {
+	dir := SessionDir + "/" + node + "/" + sid
+	glob, err := store.CompileGlob(dir + "/**")
+	if err != nil {
+		logging.Error("end session", "node", node, "sid", sid, "err", err)
+		return
+	}
+	store.Walk(g, glob, func(path, _ string, rev int64) bool {
+		consensus.Del(p, path[len(dir):], rev)
+		return false
+	})
+	consensus.Deltree(p, dir, store.Clobber)
+}
+
+// Ends every session on node, for a node that has gone away.
+func endSessions(p consensus.Proposer, g store.Getter, node string) {
+	for _, sid := range store.Getdir(g, SessionDir+"/"+node) {
+		EndSession(p, g, node, sid)
+	}
+}
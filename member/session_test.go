@@ -0,0 +1,73 @@
+package member
+
+import (
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"testing"
+)
+
+// Sets path to body in session sid on node, as the server would.
+func sessionSet(fp *test.FakeProposer, node, sid, path, body string) {
+	mut, err := store.EncodeTxn(
+		store.MustEncodeSet(path, body, store.Clobber),
+		store.MustEncodeSet(SessionPath(node, sid, path), "", store.Clobber),
+	)
+	if err != nil {
+		panic(err)
+	}
+	fp.Propose([]byte(mut))
+}
+
+func TestEndSession(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	fp := &test.FakeProposer{Store: st}
+
+	sessionSet(fp, "a", "1", "/app/leader", "me")
+	sessionSet(fp, "a", "1", "/app/taken", "me")
+	sessionSet(fp, "a", "2", "/app/other", "me")
+	fp.Propose([]byte(store.MustEncodeSet("/app/taken", "you", store.Clobber)))
+
+	_, g := st.Snap()
+	EndSession(fp, g, "a", "1")
+
+	_, rev := st.Get("/app/leader")
+	assert.Equal(t, store.Missing, rev)
+	v, _ := st.Get("/app/taken")
+	assert.Equal(t, []string{"you"}, v)
+	v, _ = st.Get("/app/other")
+	assert.Equal(t, []string{"me"}, v)
+	_, rev = st.Get(SessionDir + "/a/1")
+	assert.Equal(t, store.Missing, rev)
+	_, rev = st.Get(SessionDir + "/a/2")
+	assert.Equal(t, store.Dir, rev)
+}
+
+func TestCleanEndsSessions(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	fp := &test.FakeProposer{Store: st}
+	c := make(chan string)
+	go Clean(c, fp.Store, fp)
+
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/a/addr", "1.2.3.4", store.Missing)))
+	sessionSet(fp, "a", "1", "/app/leader", "a")
+	sessionSet(fp, "a", "2", "/app/present/a", "")
+	sessionSet(fp, "b", "1", "/app/present/b", "")
+
+	// The four changes above are seqns 1 to 4. Then come five more, in
+	// no particular order: removing a's addr, and a del and a deltree
+	// for each of its sessions.
+	ch, err := st.Wait(store.Any, 9)
+	assert.Equal(t, nil, err)
+	c <- "1.2.3.4"
+	<-ch
+
+	_, rev := st.Get("/app/leader")
+	assert.Equal(t, store.Missing, rev)
+	_, rev = st.Get("/app/present/a")
+	assert.Equal(t, store.Missing, rev)
+	_, rev = st.Get("/app/present/b")
+	assert.Equal(t, int64(4), rev)
+}
@@ -0,0 +1,67 @@
+package member
+
+import (
+	"github.com/madebymany/doozerd/store"
+	"sort"
+	"strconv"
+)
+
+// A Member describes a node of the cluster, as the control tree has
+// it.
+type Member struct {
+	ID       string
+	Addr     string
+	Role     string // "member", "replica", or "slave", as for a node's health
+	Writable bool   // whether it has said it is ready to take writes
+	Applied  int64  // the revision it last said it had applied
+	Lag      int64  // how many revisions behind the cluster it last said it was
+}
+
+// Members returns each node that g has under /ctl/node or in the
+// consensus set, sorted by ID. A node with a slot in the consensus set
+// is a "member"; of the rest, those that follow the cluster without
+// voting are "replica"s, and those waiting for a slot are "slave"s.
+//
+// A node that stops, or that the others kick for going quiet, is
+// taken out of /ctl/node, and so out of the list. Until then, Applied
+// and Lag, which each node sets as it pulses, say how far behind it is.
+func Members(g store.Getter) []Member {
+	ids := map[string]bool{}
+	for _, s := range getSlots(g) {
+		if s.id != "" {
+			ids[s.id] = true
+		}
+	}
+	for _, id := range store.Getdir(g, "/ctl/node") {
+		if _, ok := ids[id]; !ok && id != "" {
+			ids[id] = false
+		}
+	}
+
+	ms := make([]Member, 0, len(ids))
+	for id, isCal := range ids {
+		dir := "/ctl/node/" + id + "/"
+		m := Member{
+			ID:       id,
+			Addr:     store.GetString(g, dir+"addr"),
+			Role:     "slave",
+			Writable: store.GetString(g, dir+"writable") == "true",
+		}
+		m.Applied, _ = strconv.ParseInt(store.GetString(g, dir+"applied"), 10, 64)
+		m.Lag, _ = strconv.ParseInt(store.GetString(g, dir+"lag"), 10, 64)
+		if isCal {
+			m.Role = "member"
+		} else if store.GetString(g, dir+"role") == "replica" {
+			m.Role = "replica"
+		}
+		ms = append(ms, m)
+	}
+	sort.Sort(byID(ms))
+	return ms
+}
+
+type byID []Member
+
+func (a byID) Len() int           { return len(a) }
+func (a byID) Less(i, j int) bool { return a[i].ID < a[j].ID }
+func (a byID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
@@ -0,0 +1,50 @@
+package member
+
+import (
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"testing"
+)
+
+func TestMembers(t *testing.T) {
+	st, fp := newCluster("a", "", "b")
+	defer close(st.Ops)
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/a/addr", "1.2.3.4:5", store.Clobber)))
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/a/applied", "7", store.Clobber)))
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/a/lag", "2", store.Clobber)))
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/r/addr", "2.3.4.5:6", store.Clobber)))
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/r/role", "replica", store.Clobber)))
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/s/addr", "3.4.5.6:7", store.Clobber)))
+
+	exp := []Member{
+		{"a", "1.2.3.4:5", "member", true, 7, 2},
+		{"b", "", "member", true, 0, 0},
+		{"r", "2.3.4.5:6", "replica", false, 0, 0},
+		{"s", "3.4.5.6:7", "slave", false, 0, 0},
+	}
+	assert.Equal(t, exp, Members(st))
+}
+
+func TestMembersFollowReconfig(t *testing.T) {
+	st, fp := newCluster("a", "b")
+	defer close(st.Ops)
+
+	err := AddMember(fp, st, "c", "1.2.3.4:5")
+	assert.Equal(t, nil, err)
+	ms := Members(st)
+	assert.Equal(t, 3, len(ms))
+	assert.Equal(t, Member{"c", "1.2.3.4:5", "member", false, 0, 0}, ms[2])
+	fp.Propose([]byte(store.MustEncodeSet("/ctl/node/c/writable", "true", store.Clobber)))
+
+	err = RemoveMember(fp, st, "a")
+	assert.Equal(t, nil, err)
+	ms = Members(st)
+	assert.Equal(t, 3, len(ms))
+	assert.Equal(t, Member{"a", "", "slave", true, 0, 0}, ms[0])
+
+	// As when the others kick a node.
+	Forget(fp, st, "a")
+	ms = Members(st)
+	assert.Equal(t, 2, len(ms))
+	assert.Equal(t, []string{"b", "c"}, []string{ms[0].ID, ms[1].ID})
+}
@@ -0,0 +1,72 @@
+package peer
+
+import (
+	"crypto/tls"
+	"github.com/madebymany/doozerd/store"
+)
+
+// A Config holds the settings a node runs with. Times are in
+// nanoseconds.
+type Config struct {
+	PulseInterval int64 // how often to set the node's applied key
+	FillDelay     int64 // how long to wait before filling unowned seqns
+	KickTimeout   int64 // how long a member may be silent before it is kicked
+
+	// The store keeps at least Hist revisions of history, and as
+	// much more as changed in the last HistAge, if that is set.
+	Hist    int64
+	HistAge int64
+
+	MaxValueLen  int   // most bytes in a file's body
+	BatchWindow  int64 // how long to wait for writes to batch with one; 0 means no batching
+	RoundTimeout int64 // how long a consensus round waits at first before it is retried
+	DrainTimeout int64 // how long requests may take to finish on SIGTERM
+
+	// MaxRounds is how many rounds of consensus a client's change may
+	// take before the server gives up on it and answers NO_QUORUM, as
+	// when this node can't reach most of the others. 0 means the
+	// server waits for as long as it takes. The node's own changes,
+	// such as its pulse, always wait.
+	MaxRounds int
+
+	// SettleDelay is how long a node that joins a running cluster
+	// waits before it fills seqns that other nodes lead, so that it
+	// doesn't contest them while the cluster takes it in.
+	SettleDelay int64
+
+	// A Replica follows the cluster, and serves reads, without
+	// joining the consensus set.
+	Replica bool
+
+	// DataDir, if set, is the directory where a node saves its store
+	// as it changes, writing a new snapshot every SnapshotInterval. A
+	// node that starts a new cluster first recovers the store from
+	// there.
+	DataDir          string
+	SnapshotInterval int64
+
+	// TLSConfig, if set, is used to dial other members' servers, which
+	// then must serve TLS, as this node's does when it is started with
+	// -tlscert. A node uses it to fetch a snapshot when it falls
+	// behind.
+	TLSConfig *tls.Config
+
+	// WebWrites lets clients change the store through the web
+	// listener's /keys/, which is otherwise read-only.
+	WebWrites bool
+}
+
+// DefaultConfig holds the settings doozerd uses unless its flags say
+// otherwise.
+var DefaultConfig = Config{
+	PulseInterval:    1e9,
+	FillDelay:        1e8,
+	KickTimeout:      60e9,
+	Hist:             2000,
+	MaxValueLen:      store.DefaultMaxValueLen,
+	RoundTimeout:     1e6,
+	DrainTimeout:     10e9,
+	MaxRounds:        14,
+	SettleDelay:      1e9,
+	SnapshotInterval: 60e9,
+}
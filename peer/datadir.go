@@ -0,0 +1,63 @@
+package peer
+
+import (
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/logging"
+	"github.com/madebymany/doozerd/member"
+	"github.com/madebymany/doozerd/persist"
+	"github.com/madebymany/doozerd/store"
+	"time"
+)
+
+// Recovers the store saved in dir, if any, into st, and returns the
+// revision it reached, or 0 if there was nothing to recover.
+func recoverStore(st *store.Store, dir string) int64 {
+	if dir == "" {
+		return 0
+	}
+	start := time.Now()
+	rev, n, err := persist.Recover(st, dir)
+	if err != nil {
+		panic(err)
+	}
+	if rev > 0 {
+		logging.Info("recovered", "dir", dir, "rev", rev, "replayed", n, "took", time.Since(start))
+	}
+	return rev
+}
+
+// Makes self the whole consensus set of a recovered store, in place of
+// the members it had, none of which are here to vote. Each of the
+// other nodes can join again as a new one.
+func adopt(st *store.Store, self string) {
+	_, g := st.Snap()
+	slots := store.Getdir(g, calDir)
+	if len(slots) == 0 {
+		slots = []string{"0"}
+	}
+	for i, slot := range slots {
+		body := ""
+		if i == 0 {
+			body = self
+		}
+		set(st, calDir+"/"+slot, body, store.Clobber)
+	}
+}
+
+// Forgets, through p, every node g knows of but self.
+func forgetOthers(p consensus.Proposer, g store.Getter, self string) {
+	for _, name := range store.Getdir(g, "/ctl/node") {
+		if name != self {
+			member.Forget(p, g, name)
+		}
+	}
+}
+
+// Saves st to dir, with a new snapshot every ival ns, until st is
+// closed.
+func keepStore(st *store.Store, dir string, ival int64) {
+	err := persist.Keep(st, dir, time.Tick(time.Duration(ival)))
+	if err != nil {
+		logging.Error("save store", "dir", dir, "err", err)
+	}
+}
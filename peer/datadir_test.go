@@ -0,0 +1,63 @@
+package peer
+
+import (
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPeerRecover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doozerd-peer")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	cfg := testConfig(1e8, 1e7, 1e9, 1e9)
+	cfg.DataDir = dir
+
+	l0 := mustListen()
+	a0 := l0.Addr().String()
+	u0 := mustListenUDP(a0)
+
+	go Main("a", "X", "", "", "", nil, u0, l0, nil, cfg)
+	cl := dial(a0)
+	waitFor(cl, "/ctl/node/X/writable")
+	rev, err := cl.Set("/app/config", store.Missing, []byte("a"))
+	assert.Equal(t, nil, err)
+
+	// Stop X, and let it finish saving what it had.
+	l0.Close()
+	u0.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	l1 := mustListen()
+	defer l1.Close()
+	a1 := l1.Addr().String()
+	u1 := mustListenUDP(a1)
+	defer u1.Close()
+
+	go Main("a", "Y", "", "", "", nil, u1, l1, nil, cfg)
+	cl = dial(a1)
+	// Y's history starts at the snapshot, so waitFor can't be used.
+	for {
+		body, _, err := cl.Get("/ctl/node/Y/writable", nil)
+		assert.Equal(t, nil, err)
+		if len(body) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	body, frev, err := cl.Get("/app/config", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte("a"), body)
+	assert.Equal(t, rev, frev)
+
+	// Y has taken X's place, and can make changes on its own.
+	body, _, err = cl.Get("/ctl/cal/0", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte("Y"), body)
+	_, err = cl.Set("/app/config", frev, []byte("b"))
+	assert.Equal(t, nil, err)
+}
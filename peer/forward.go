@@ -0,0 +1,86 @@
+package peer
+
+import (
+	"errors"
+	"github.com/madebymany/doozer"
+	"github.com/madebymany/doozerd/store"
+	"syscall"
+)
+
+var errNotForwarded = errors.New("a replica forwards only set, del, and nop")
+
+// Errors from the cluster, as the server would have got them from
+// its own store.
+var forwardErrs = map[error]error{
+	doozer.ErrOldRev:  store.ErrRevMismatch,
+	doozer.ErrBadPath: store.ErrBadPath,
+	doozer.ErrTooLate: store.ErrTooLate,
+	doozer.ErrIsDir:   syscall.EISDIR,
+	doozer.ErrNotDir:  syscall.ENOTDIR,
+	doozer.ErrNoEnt:   syscall.ENOENT,
+}
+
+// A forwarder makes each change proposed to it through cl, a
+// connection to a member of the cluster, and returns once the change
+// has reached st, so a client that writes to a replica can read its
+// own write there. A replica uses it in place of a proposer.
+type forwarder struct {
+	cl *doozer.Conn
+	st *store.Store
+}
+
+// A trace ID can't be sent through the client, so the change is made
+// without it.
+func (f *forwarder) Propose(v []byte) (e store.Event) {
+	v = []byte(store.Untrace(string(v)))
+	if string(v) == store.Nop {
+		return f.sync()
+	}
+
+	path, body, rev, isSet, err := store.Decode(string(v))
+	if err != nil {
+		e.Err = errNotForwarded
+		return
+	}
+
+	var n int64
+	if isSet {
+		n, err = f.cl.Set(path, rev, []byte(body))
+	} else if err = f.cl.Del(path, rev); err == nil {
+		n, err = f.cl.Rev()
+	}
+	if err != nil {
+		if de, ok := err.(*doozer.Error); ok && forwardErrs[de.Err] != nil {
+			err = forwardErrs[de.Err]
+		}
+		e.Err = err
+		return
+	}
+
+	return f.wait(n)
+}
+
+// A member's nop is done once it has been applied there, so the
+// member's revision after it covers everything committed before.
+func (f *forwarder) sync() (e store.Event) {
+	err := f.cl.Nop()
+	var n int64
+	if err == nil {
+		n, err = f.cl.Rev()
+	}
+	if err != nil {
+		e.Err = err
+		return
+	}
+	return f.wait(n)
+}
+
+// Returns the event at n once it has reached f.st.
+func (f *forwarder) wait(n int64) (e store.Event) {
+	ch, err := f.st.Wait(store.Any, n)
+	if err != nil {
+		e.Seqn = n // too late, so it's already here
+		return
+	}
+	return <-ch
+}
@@ -0,0 +1,94 @@
+package peer
+
+import (
+	"github.com/madebymany/doozerd/server"
+	"github.com/madebymany/doozerd/store"
+	"sync/atomic"
+	"time"
+)
+
+// A node more than this many revisions behind the rest of the cluster
+// reports itself as not caught up.
+const maxLag = 100
+
+// A freshness remembers when a node's store last held the cluster's
+// latest revision.
+type freshness struct {
+	at int64 // ns; accessed atomically
+}
+
+// Returns how long, in ns as of now, the store has been behind the
+// cluster, and notes now if it isn't.
+func (f *freshness) staleness(rev, latest, now int64) int64 {
+	if rev >= latest {
+		atomic.StoreInt64(&f.at, now)
+		return 0
+	}
+	return now - atomic.LoadInt64(&f.at)
+}
+
+// Checks on each tick whether st has caught up, so that f stays close
+// to the truth even when nobody asks for the node's health.
+func (f *freshness) track(st *store.Store, highest *int64, ticker <-chan time.Time) {
+	for t := range ticker {
+		rev, latest := latestRev(st, highest)
+		f.staleness(rev, latest, t.UnixNano())
+	}
+}
+
+// Returns the revision of st and the cluster's latest. Highest is the
+// highest seqn the node's consensus manager has seen in a packet; any
+// seqn within alpha of it may still be undecided, so the cluster's
+// latest revision is taken to be alpha less.
+func latestRev(st *store.Store, highest *int64) (rev, latest int64) {
+	rev, _ = st.Snap()
+	latest = atomic.LoadInt64(highest) - alpha
+	if latest < rev {
+		latest = rev
+	}
+	return rev, latest
+}
+
+// Returns a function giving how many revisions a store at rev is
+// behind the cluster's latest, as latestRev reckons it.
+func lagFunc(highest *int64) func(rev int64) int64 {
+	return func(rev int64) int64 {
+		if latest := atomic.LoadInt64(highest) - alpha; latest > rev {
+			return latest - rev
+		}
+		return 0
+	}
+}
+
+// Returns a function that describes the node's health, taking its
+// staleness from fresh.
+func healthFunc(st *store.Store, self string, replica bool, highest *int64, fresh *freshness, start int64) func() server.Health {
+	return func() server.Health {
+		rev, latest := latestRev(st, highest)
+		now := time.Now().UnixNano()
+
+		role := "slave"
+		if replica {
+			role = "replica"
+		} else if isMember(st, self) {
+			role = "member"
+		}
+
+		return server.Health{
+			Role:      role,
+			Rev:       rev,
+			Latest:    latest,
+			CaughtUp:  latest-rev <= maxLag,
+			Staleness: fresh.staleness(rev, latest, now),
+			Uptime:    now - start,
+		}
+	}
+}
+
+func isMember(g store.Getter, self string) (is bool) {
+	store.Walk(g, calGlob, func(path, body string, rev int64) bool {
+		is = body == self
+		return is
+	})
+	return is
+}
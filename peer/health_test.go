@@ -0,0 +1,108 @@
+package peer
+
+import (
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/gc"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func healthStore(rev int64) *store.Store {
+	st := store.New()
+	st.Ops <- store.Op{1, store.MustEncodeSet("/ctl/cal/0", "a", store.Clobber)}
+	for n := int64(2); n <= rev; n++ {
+		st.Ops <- store.Op{n, store.Nop}
+	}
+	st.Flush()
+	return st
+}
+
+func TestHealthCaughtUp(t *testing.T) {
+	st := healthStore(20)
+	defer close(st.Ops)
+	highest := int64(20 + alpha)
+	start := time.Now().UnixNano() - 5e9
+
+	h := healthFunc(st, "a", false, &highest, &freshness{}, start)()
+	assert.Equal(t, "member", h.Role)
+	assert.Equal(t, int64(20), h.Rev)
+	assert.Equal(t, int64(20), h.Latest)
+	assert.Equal(t, true, h.CaughtUp)
+	assert.Equal(t, int64(0), h.Staleness)
+	assert.T(t, h.Uptime >= 5e9, h.Uptime)
+}
+
+func TestHealthLagging(t *testing.T) {
+	st := healthStore(20)
+	defer close(st.Ops)
+	highest := int64(20 + maxLag + 1 + alpha)
+
+	h := healthFunc(st, "b", false, &highest, &freshness{}, 0)()
+	assert.Equal(t, "slave", h.Role)
+	assert.Equal(t, int64(20), h.Rev)
+	assert.Equal(t, int64(20+maxLag+1), h.Latest)
+	assert.Equal(t, false, h.CaughtUp)
+}
+
+func TestHealthReplica(t *testing.T) {
+	st := healthStore(20)
+	defer close(st.Ops)
+	var highest int64 // nothing seen yet
+
+	h := healthFunc(st, "a", true, &highest, &freshness{}, 0)()
+	assert.Equal(t, "replica", h.Role)
+	assert.Equal(t, int64(20), h.Latest)
+	assert.Equal(t, true, h.CaughtUp)
+}
+
+func TestHealthStaleness(t *testing.T) {
+	st := healthStore(20)
+	defer close(st.Ops)
+	highest := int64(25 + alpha)
+	fresh := &freshness{time.Now().UnixNano() - 3e9}
+
+	h := healthFunc(st, "a", false, &highest, fresh, 0)()
+	assert.Equal(t, true, h.CaughtUp)
+	assert.T(t, h.Staleness >= 3e9, h.Staleness)
+
+	highest = 20 + alpha
+	h = healthFunc(st, "a", false, &highest, fresh, 0)()
+	assert.Equal(t, int64(0), h.Staleness)
+
+	highest = 25 + alpha
+	h = healthFunc(st, "a", false, &highest, fresh, 0)()
+	assert.T(t, h.Staleness < 3e9, h.Staleness)
+}
+
+func TestLag(t *testing.T) {
+	highest := int64(30 + alpha)
+	lag := lagFunc(&highest)
+	assert.Equal(t, int64(10), lag(20))
+	assert.Equal(t, int64(0), lag(30))
+	assert.Equal(t, int64(0), lag(31))
+}
+
+func TestPulseLagGrows(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	seqns := make(chan int64)
+	defer close(seqns)
+	var highest int64
+	go gc.Pulse("b", seqns, &test.FakeProposer{Store: st}, 1, lagFunc(&highest))
+
+	// The cluster gets 10 revisions further on for each one this
+	// slow node applies.
+	var lags []string
+	for n := int64(1); n <= 3; n++ {
+		atomic.StoreInt64(&highest, 10*n+alpha)
+		seqns <- n
+		ch, err := st.Wait(store.Any, n)
+		assert.Equal(t, nil, err)
+		<-ch
+		lags = append(lags, store.GetString(st, "/ctl/node/b/lag"))
+	}
+	assert.Equal(t, []string{"9", "18", "27"}, lags)
+}
@@ -47,3 +47,11 @@ func waitFor(cl *doozer.Conn, path string) {
 		rev = ev.Rev + 1
 	}
 }
+
+// Returns DefaultConfig with the given pulse interval, fill delay, kick
+// timeout and history length.
+func testConfig(pulse, fill, kick, hist int64) Config {
+	cfg := DefaultConfig
+	cfg.PulseInterval, cfg.FillDelay, cfg.KickTimeout, cfg.Hist = pulse, fill, kick, hist
+	return cfg
+}
@@ -4,12 +4,12 @@ import (
 	"github.com/madebymany/doozer"
 	"github.com/madebymany/doozerd/consensus"
 	"github.com/madebymany/doozerd/gc"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/member"
 	"github.com/madebymany/doozerd/server"
 	"github.com/madebymany/doozerd/store"
 	"github.com/madebymany/doozerd/web"
 	"io"
-	"log"
 	"net"
 	"os"
 	"strings"
@@ -17,8 +17,14 @@ import (
 )
 
 const (
-	alpha     = 50
-	maxUDPLen = 3000
+	alpha       = 50
+	maxUDPLen   = 3000
+	maxBatchLen = maxUDPLen - 100 // leaves room for the rest of the packet
+
+	// A node catching up reads recent history from the others, and
+	// may need anything since alpha revisions back, so the store keeps
+	// at least that much however it is configured.
+	minHist = alpha
 )
 
 const calDir = "/ctl/cal"
@@ -32,35 +38,75 @@ type proposer struct {
 }
 
 func (p *proposer) Propose(v []byte) (e store.Event) {
+	return p.propose(v, false)
+}
+
+// If bounded, gives up, returning consensus.ErrNoQuorum, once the
+// manager says the seqn v is being tried at has taken NRound rounds.
+func (p *proposer) propose(v []byte, bounded bool) (e store.Event) {
 	for e.Mut != string(v) {
 		n := <-p.seqns
 		w, err := p.st.Wait(store.Any, n)
 		if err != nil {
 			panic(err) // can't happen
 		}
-		p.props <- &consensus.Prop{n, v}
-		e = <-w
+		var fail chan error
+		if bounded {
+			fail = make(chan error, 1)
+		}
+		p.props <- &consensus.Prop{n, v, fail}
+		select {
+		case e = <-w:
+		case err := <-fail:
+			return store.Event{Mut: string(v), Err: err}
+		}
 	}
 	return
 }
 
-func Main(clusterName, self, buri, rwsk, rosk string, cl *doozer.Conn, udpConn *net.UDPConn, listener, webListener net.Listener, pulseInterval, fillDelay, kickTimeout int64, hi int64) {
+// A bounded proposer is a proposer for clients' changes, which fail
+// after the manager's NRound, if there is a limit.
+type bounded struct {
+	p     *proposer
+	limit bool
+}
+
+func (b bounded) Propose(v []byte) store.Event {
+	return b.p.propose(v, b.limit)
+}
+
+func Main(clusterName, self, buri, rwsk, rosk string, cl *doozer.Conn, udpConn net.PacketConn, listener, webListener net.Listener, cfg Config) {
 	listenAddr := listener.Addr().String()
+	hi, histAge, replica := cfg.Hist, cfg.HistAge, cfg.Replica
+	if hi < minHist {
+		hi = minHist
+	}
+	started := time.Now().UnixNano()
 
 	canWrite := make(chan bool, 1)
 	in := make(chan consensus.Packet, 50)
 	out := make(chan consensus.Packet, 50)
 
 	st := store.New()
+	st.MaxValueLen = cfg.MaxValueLen
 	pr := &proposer{
 		seqns: make(chan int64, alpha),
 		props: make(chan *consensus.Prop),
 		st:    st,
 	}
 
-	calSrv := func(start int64) {
-		go gc.Pulse(self, st.Seqns, pr, pulseInterval)
-		go gc.Clean(st, hi, time.Tick(1e9))
+	secret := rwsk
+	if secret == "" {
+		secret = rosk
+	}
+	behind := make(chan *net.UDPAddr, 1)
+	go installSnapshots(st, behind, secret, cfg.TLSConfig)
+	var highest int64
+
+	calSrv := func(start, settle int64) {
+		go gc.Pulse(self, st.Seqns, pr, cfg.PulseInterval, lagFunc(&highest))
+		go gc.CleanCtl(st, pr, hi, histAge, time.Tick(1e9))
+		go gc.Expire(st, pr, time.Tick(1e9))
 		var m consensus.Manager
 		m.Self = self
 		m.DefRev = start
@@ -70,27 +116,65 @@ func Main(clusterName, self, buri, rwsk, rosk string, cl *doozer.Conn, udpConn *
 		m.Ops = st.Ops
 		m.PSeqn = pr.seqns
 		m.Props = pr.props
-		m.TFill = fillDelay
+		m.TFill = cfg.FillDelay
+		m.TRound = cfg.RoundTimeout
+		m.NRound = cfg.MaxRounds
+		m.TSettle = settle
 		m.Store = st
 		m.Ticker = time.Tick(10e6)
+		m.Behind = behind
+		m.Highest = &highest
 		go m.Run()
 	}
 
+	// A replica learns what the members commit, and never votes.
+	learnSrv := func(start int64) {
+		go gc.CleanAge(st, hi, histAge, time.Tick(1e9))
+		var m consensus.Manager
+		m.Self = self
+		m.DefRev = start
+		m.Alpha = alpha
+		m.In = in
+		m.Out = out
+		m.Ops = st.Ops
+		m.TFill = cfg.FillDelay
+		m.Store = st
+		m.Ticker = time.Tick(10e6)
+		m.Learner = true
+		m.Behind = behind
+		m.Highest = &highest
+		go m.Run()
+	}
+
+	var p consensus.Proposer = bounded{pr, cfg.MaxRounds > 0}
+	if cfg.BatchWindow > 0 {
+		p = consensus.NewBatcher(p, st, time.Duration(cfg.BatchWindow), maxBatchLen)
+	}
+
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "unknown"
 	}
 
 	if cl == nil { // we are the only node in a new cluster
-		set(st, "/ctl/name", clusterName, store.Missing)
-		set(st, "/ctl/node/"+self+"/addr", listenAddr, store.Missing)
-		set(st, "/ctl/node/"+self+"/hostname", hostname, store.Missing)
-		set(st, "/ctl/node/"+self+"/version", Version, store.Missing)
-		set(st, "/ctl/cal/0", self, store.Missing)
+		recovered := recoverStore(st, cfg.DataDir) > 0
+		rev := store.Missing
+		if recovered {
+			adopt(st, self)
+			rev = store.Clobber
+		} else {
+			set(st, "/ctl/name", clusterName, store.Missing)
+		}
+		set(st, "/ctl/node/"+self+"/addr", listenAddr, rev)
+		set(st, "/ctl/node/"+self+"/hostname", hostname, rev)
+		set(st, "/ctl/node/"+self+"/version", Version, rev)
+		if !recovered {
+			set(st, "/ctl/cal/0", self, store.Missing)
+		}
 		if buri == "" {
-			set(st, "/ctl/ns/"+clusterName+"/"+self, listenAddr, store.Missing)
+			set(st, "/ctl/ns/"+clusterName+"/"+self, listenAddr, rev)
 		}
-		calSrv(<-st.Seqns)
+		calSrv(<-st.Seqns, 0)
 		// Skip ahead alpha steps so that the registrar can provide a
 		// meaningful cluster.
 		for i := 0; i < alpha; i++ {
@@ -98,6 +182,37 @@ func Main(clusterName, self, buri, rwsk, rosk string, cl *doozer.Conn, udpConn *
 		}
 		canWrite <- true
 		go setReady(pr, self)
+		if recovered {
+			_, g := st.Snap()
+			go forgetOthers(pr, g, self)
+		}
+	} else if replica {
+		setC(cl, "/ctl/node/"+self+"/addr", listenAddr, store.Clobber)
+		setC(cl, "/ctl/node/"+self+"/hostname", hostname, store.Clobber)
+		setC(cl, "/ctl/node/"+self+"/version", Version, store.Clobber)
+		setC(cl, "/ctl/node/"+self+"/role", "replica", store.Clobber)
+
+		rev, err := cl.Rev()
+		if err != nil {
+			panic(err)
+		}
+
+		errs := make(chan error)
+		go func() {
+			e, ok := <-errs
+			if ok {
+				panic(e)
+			}
+		}()
+		doozer.Walk(cl, rev, "/", cloner{st.Ops, cl, rev}, errs)
+		close(errs)
+		// Bring the store to rev even if no file has that revision.
+		st.Ops <- store.Op{rev, store.Nop}
+		st.Flush()
+
+		learnSrv(rev + 1)
+		p = &forwarder{cl, st}
+		canWrite <- true
 	} else {
 		setC(cl, "/ctl/node/"+self+"/addr", listenAddr, store.Clobber)
 		setC(cl, "/ctl/node/"+self+"/hostname", hostname, store.Clobber)
@@ -129,7 +244,7 @@ func Main(clusterName, self, buri, rwsk, rosk string, cl *doozer.Conn, udpConn *
 
 		go func() {
 			n := activate(st, self, cl)
-			calSrv(n)
+			calSrv(n, cfg.SettleDelay)
 			advanceUntil(cl, st.Seqns, n+alpha)
 			stop <- true
 			canWrite <- true
@@ -150,12 +265,28 @@ func Main(clusterName, self, buri, rwsk, rosk string, cl *doozer.Conn, udpConn *
 	}
 
 	shun := make(chan string, 3) // sufficient for a cluster of 7
-	go member.Clean(shun, st, pr)
-	go server.ListenAndServe(listener, canWrite, st, pr, rwsk, rosk, self)
+	if !replica {
+		go member.Clean(shun, st, pr)
+	}
+	fresh := &freshness{started}
+	go fresh.track(st, &highest, time.Tick(10e6))
+	if cfg.DataDir != "" {
+		go keepStore(st, cfg.DataDir, cfg.SnapshotInterval)
+	}
+	health := healthFunc(st, self, replica, &highest, fresh, started)
+	srv := server.NewServer(listener, canWrite, st, p, rwsk, rosk, self)
+	srv.Health = health
+	srv.Observer = server.ConnCount
+	go srv.Serve()
+	go shutdownOnTerm(srv, st, pr, self, replica, cfg.DrainTimeout)
 
 	if rwsk == "" && rosk == "" && webListener != nil {
 		web.Store = st
 		web.ClusterName = clusterName
+		if cfg.WebWrites {
+			web.Proposer = p
+		}
+		web.Health = health
 		go web.Serve(webListener)
 	}
 
@@ -163,11 +294,11 @@ func Main(clusterName, self, buri, rwsk, rosk string, cl *doozer.Conn, udpConn *
 		for p := range out {
 			n, err := udpConn.WriteTo(p.Data, p.Addr)
 			if err != nil {
-				log.Println(err)
+				logging.Warn("send packet", "addr", p.Addr, "err", err)
 				continue
 			}
 			if n != len(p.Data) {
-				log.Println("packet len too long:", len(p.Data))
+				logging.Error("packet too long", "len", len(p.Data))
 				continue
 			}
 		}
@@ -178,8 +309,8 @@ func Main(clusterName, self, buri, rwsk, rosk string, cl *doozer.Conn, udpConn *
 		panic("no UDP addr")
 	}
 	lv := liveness{
-		timeout: kickTimeout,
-		ival:    kickTimeout / 2,
+		timeout: cfg.KickTimeout,
+		ival:    cfg.KickTimeout / 2,
 		self:    selfAddr,
 		shun:    shun,
 	}
@@ -187,20 +318,28 @@ func Main(clusterName, self, buri, rwsk, rosk string, cl *doozer.Conn, udpConn *
 		t := time.Now().UnixNano()
 
 		buf := make([]byte, maxUDPLen)
-		n, addr, err := udpConn.ReadFromUDP(buf)
+		n, a, err := udpConn.ReadFrom(buf)
 		if err != nil && strings.Contains(err.Error(), "use of closed network connection") {
-			log.Printf("<<<< EXITING >>>>")
+			logging.Info("exiting")
 			return
 		}
 		if err != nil {
-			log.Println(err)
+			logging.Warn("receive packet", "err", err)
+			continue
+		}
+		addr, ok := a.(*net.UDPAddr)
+		if !ok {
+			logging.Warn("receive packet", "addr", a, "err", "not a UDP addr")
 			continue
 		}
 
 		buf = buf[:n]
 
-		lv.mark(addr, t)
-		lv.check(t)
+		// Only members decide who's too quiet to stay in the set.
+		if !replica {
+			lv.mark(addr, t)
+			lv.check(t)
+		}
 
 		in <- consensus.Packet{addr, buf}
 	}
@@ -212,10 +351,13 @@ func activate(st *store.Store, self string, c *doozer.Conn) int64 {
 	for _, base := range store.Getdir(st, calDir) {
 		p := calDir + "/" + base
 		v, rev := st.Get(p)
+		if rev != store.Dir && v[0] == self {
+			return rev // we were added by member.AddMember
+		}
 		if rev != store.Dir && v[0] == "" {
 			seqn, err := c.Set(p, rev, []byte(self))
 			if err != nil {
-				log.Println(err)
+				logging.Warn("activate", "path", p, "err", err)
 				continue
 			}
 
@@ -237,7 +379,7 @@ func activate(st *store.Store, self string, c *doozer.Conn) int64 {
 		if ev.IsSet() && ev.Body == "" {
 			seqn, err := c.Set(ev.Path, ev.Rev, []byte(self))
 			if err != nil {
-				log.Println(err)
+				logging.Warn("activate", "path", ev.Path, "err", err)
 				continue
 			}
 			return seqn
@@ -312,7 +454,7 @@ func (c cloner) VisitFile(path string, f *doozer.FileInfo) {
 func setReady(p consensus.Proposer, self string) {
 	m, err := store.EncodeSet("/ctl/node/"+self+"/writable", "true", 0)
 	if err != nil {
-		log.Println(err)
+		logging.Error("set ready", "err", err)
 		return
 	}
 	p.Propose([]byte(m))
@@ -16,7 +16,7 @@ func TestDoozerNop(t *testing.T) {
 	u := mustListenUDP(l.Addr().String())
 	defer u.Close()
 
-	go Main("a", "X", "", "", "", nil, u, l, nil, 1e9, 2e9, 3e9, 101)
+	go Main("a", "X", "", "", "", nil, u, l, nil, testConfig(1e9, 2e9, 3e9, 101))
 
 	cl := dial(l.Addr().String())
 	err := cl.Nop()
@@ -29,7 +29,7 @@ func TestDoozerGet(t *testing.T) {
 	u := mustListenUDP(l.Addr().String())
 	defer u.Close()
 
-	go Main("a", "X", "", "", "", nil, u, l, nil, 1e9, 2e9, 3e9, 101)
+	go Main("a", "X", "", "", "", nil, u, l, nil, testConfig(1e9, 2e9, 3e9, 101))
 
 	cl := dial(l.Addr().String())
 
@@ -58,7 +58,7 @@ func TestDoozerSet(t *testing.T) {
 	u := mustListenUDP(l.Addr().String())
 	defer u.Close()
 
-	go Main("a", "X", "", "", "", nil, u, l, nil, 1e9, 2e9, 3e9, 101)
+	go Main("a", "X", "", "", "", nil, u, l, nil, testConfig(1e9, 2e9, 3e9, 101))
 
 	cl := dial(l.Addr().String())
 
@@ -77,7 +77,7 @@ func TestDoozerGetWithRev(t *testing.T) {
 	u := mustListenUDP(l.Addr().String())
 	defer u.Close()
 
-	go Main("a", "X", "", "", "", nil, u, l, nil, 1e9, 2e9, 3e9, 101)
+	go Main("a", "X", "", "", "", nil, u, l, nil, testConfig(1e9, 2e9, 3e9, 101))
 
 	cl := dial(l.Addr().String())
 
@@ -109,7 +109,7 @@ func TestDoozerWaitSimple(t *testing.T) {
 	u := mustListenUDP(l.Addr().String())
 	defer u.Close()
 
-	go Main("a", "X", "", "", "", nil, u, l, nil, 1e9, 2e9, 3e9, 101)
+	go Main("a", "X", "", "", "", nil, u, l, nil, testConfig(1e9, 2e9, 3e9, 101))
 
 	cl := dial(l.Addr().String())
 	var rev int64 = 1
@@ -143,7 +143,7 @@ func TestDoozerWaitWithRev(t *testing.T) {
 	u := mustListenUDP(l.Addr().String())
 	defer u.Close()
 
-	go Main("a", "X", "", "", "", nil, u, l, nil, 1e9, 2e9, 3e9, 101)
+	go Main("a", "X", "", "", "", nil, u, l, nil, testConfig(1e9, 2e9, 3e9, 101))
 
 	cl := dial(l.Addr().String())
 
@@ -171,7 +171,7 @@ func TestDoozerStat(t *testing.T) {
 	u := mustListenUDP(l.Addr().String())
 	defer u.Close()
 
-	go Main("a", "X", "", "", "", nil, u, l, nil, 1e9, 2e9, 3e9, 101)
+	go Main("a", "X", "", "", "", nil, u, l, nil, testConfig(1e9, 2e9, 3e9, 101))
 
 	cl := dial(l.Addr().String())
 
@@ -195,7 +195,7 @@ func TestDoozerGetdirOnDir(t *testing.T) {
 	u := mustListenUDP(l.Addr().String())
 	defer u.Close()
 
-	go Main("a", "X", "", "", "", nil, u, l, nil, 1e9, 2e9, 3e9, 101)
+	go Main("a", "X", "", "", "", nil, u, l, nil, testConfig(1e9, 2e9, 3e9, 101))
 
 	cl := dial(l.Addr().String())
 
@@ -219,7 +219,7 @@ func TestDoozerGetdirOnFile(t *testing.T) {
 	u := mustListenUDP(l.Addr().String())
 	defer u.Close()
 
-	go Main("a", "X", "", "", "", nil, u, l, nil, 1e9, 2e9, 3e9, 101)
+	go Main("a", "X", "", "", "", nil, u, l, nil, testConfig(1e9, 2e9, 3e9, 101))
 
 	cl := dial(l.Addr().String())
 
@@ -241,7 +241,7 @@ func TestDoozerGetdirMissing(t *testing.T) {
 	u := mustListenUDP(l.Addr().String())
 	defer u.Close()
 
-	go Main("a", "X", "", "", "", nil, u, l, nil, 1e9, 2e9, 3e9, 101)
+	go Main("a", "X", "", "", "", nil, u, l, nil, testConfig(1e9, 2e9, 3e9, 101))
 
 	cl := dial(l.Addr().String())
 
@@ -261,7 +261,7 @@ func TestDoozerGetdirOffsetLimit(t *testing.T) {
 	u := mustListenUDP(l.Addr().String())
 	defer u.Close()
 
-	go Main("a", "X", "", "", "", nil, u, l, nil, 1e9, 2e9, 3e9, 101)
+	go Main("a", "X", "", "", "", nil, u, l, nil, testConfig(1e9, 2e9, 3e9, 101))
 
 	cl := dial(l.Addr().String())
 	cl.Set("/test/a", store.Clobber, []byte("1"))
@@ -295,9 +295,9 @@ func TestPeerShun(t *testing.T) {
 	u2 := mustListenUDP(l2.Addr().String())
 	defer u2.Close()
 
-	go Main("a", "X", "", "", "", nil, u0, l0, nil, 1e8, 1e7, 1e9, 1e9)
-	go Main("a", "Y", "", "", "", dial(a0), u1, l1, nil, 1e8, 1e7, 1e9, 1e9)
-	go Main("a", "Z", "", "", "", dial(a0), u2, l2, nil, 1e8, 1e7, 1e9, 1e9)
+	go Main("a", "X", "", "", "", nil, u0, l0, nil, testConfig(1e8, 1e7, 1e9, 1e9))
+	go Main("a", "Y", "", "", "", dial(a0), u1, l1, nil, testConfig(1e8, 1e7, 1e9, 1e9))
+	go Main("a", "Z", "", "", "", dial(a0), u2, l2, nil, testConfig(1e8, 1e7, 1e9, 1e9))
 
 	cl := dial(l0.Addr().String())
 	cl.Set("/ctl/cal/1", store.Missing, nil)
@@ -338,7 +338,7 @@ func TestPeerLateJoin(t *testing.T) {
 	u1 := mustListenUDP(l1.Addr().String())
 	defer u1.Close()
 
-	go Main("a", "X", "", "", "", nil, u0, l0, nil, 1e8, 1e7, 1e9, 60)
+	go Main("a", "X", "", "", "", nil, u0, l0, nil, testConfig(1e8, 1e7, 1e9, 60))
 
 	cl := dial(l0.Addr().String())
 	waitFor(cl, "/ctl/node/X/writable")
@@ -348,7 +348,7 @@ func TestPeerLateJoin(t *testing.T) {
 	// so we can drop this down to something reasonable
 	time.Sleep(1100 * time.Millisecond)
 
-	go Main("a", "Y", "", "", "", dial(a0), u1, l1, nil, 1e8, 1e7, 1e9, 60)
+	go Main("a", "Y", "", "", "", dial(a0), u1, l1, nil, testConfig(1e8, 1e7, 1e9, 60))
 	rev, _ := cl.Set("/ctl/cal/1", store.Missing, nil)
 	for {
 		ev, err := cl.Wait("/ctl/node/Y/writable", rev)
@@ -362,6 +362,54 @@ func TestPeerLateJoin(t *testing.T) {
 	}
 }
 
+func TestPeerReplica(t *testing.T) {
+	l0 := mustListen()
+	defer l0.Close()
+	a0 := l0.Addr().String()
+	u0 := mustListenUDP(a0)
+	defer u0.Close()
+
+	l1 := mustListen()
+	defer l1.Close()
+	u1 := mustListenUDP(l1.Addr().String())
+	defer u1.Close()
+
+	go Main("a", "X", "", "", "", nil, u0, l0, nil, testConfig(1e8, 1e7, 1e9, 1e9))
+
+	cl := dial(a0)
+	waitFor(cl, "/ctl/node/X/writable")
+
+	cfg := testConfig(1e8, 1e7, 1e9, 1e9)
+	cfg.Replica = true
+	go Main("a", "R", "", "", "", dial(a0), u1, l1, nil, cfg)
+	waitFor(cl, "/ctl/node/R/role")
+
+	rev, err := cl.Set("/test", store.Clobber, []byte("a"))
+	assert.Equal(t, nil, err)
+
+	// The replica converges on what the cluster commits.
+	rc := dial(l1.Addr().String())
+	ev, err := rc.Wait("/test", rev)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, rev, ev.Rev)
+	assert.Equal(t, []byte("a"), ev.Body)
+
+	// Its writes go through the cluster.
+	rev, err = rc.Set("/test", rev, []byte("b"))
+	assert.Equal(t, nil, err)
+	body, _, err := cl.Get("/test", &rev)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte("b"), body)
+	body, _, err = rc.Get("/test", &rev)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte("b"), body)
+
+	// It never takes a slot.
+	names, err := cl.Getdir("/ctl/cal", rev, 0, -1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"0"}, names)
+}
+
 func assertDenied(t *testing.T, err error) {
 	assert.NotEqual(t, nil, err)
 	assert.Equal(t, doozer.ErrOther, err.(*doozer.Error).Err)
@@ -0,0 +1,38 @@
+package peer
+
+import (
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/logging"
+	"github.com/madebymany/doozerd/member"
+	"github.com/madebymany/doozerd/server"
+	"github.com/madebymany/doozerd/store"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Waits for SIGTERM, then shuts down: srv finishes what its clients
+// have asked for, within timeout ns, and a member gives up its slot
+// while it is still around to vote on that, before the process exits.
+func shutdownOnTerm(srv *server.Server, st *store.Store, p consensus.Proposer, self string, replica bool, timeout int64) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM)
+	<-c
+	logging.Info("shutting down")
+
+	srv.Shutdown(timeout)
+	if !replica {
+		errs := make(chan error, 1)
+		go func() { errs <- member.Leave(p, st, self) }()
+		select {
+		case err := <-errs:
+			if err != nil {
+				logging.Error("leave", "err", err)
+			}
+		case <-time.After(time.Duration(timeout)):
+			logging.Error("leave", "err", "timed out")
+		}
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,31 @@
+package peer
+
+import (
+	"crypto/tls"
+	"github.com/madebymany/doozerd/logging"
+	"github.com/madebymany/doozerd/server"
+	"github.com/madebymany/doozerd/store"
+	"io"
+	"net"
+)
+
+// Installs a snapshot from each node sent on behind, a member that
+// has cleaned the values st still needs. A member serves clients on
+// the same address it uses for consensus, so addr names its server.
+// The snapshot is read into st as it arrives, not buffered whole first.
+// If tc is not nil, the servers are dialed with TLS.
+func installSnapshots(st *store.Store, behind <-chan *net.UDPAddr, secret string, tc *tls.Config) {
+	for addr := range behind {
+		pr, pw := io.Pipe()
+		go func(addr string) {
+			pw.CloseWithError(server.FetchSnapshot(addr, secret, tc, pw))
+		}(addr.String())
+		rev, err := st.InstallSnapshot(pr)
+		pr.Close()
+		if err != nil {
+			logging.Error("install snapshot", "addr", addr, "err", err)
+			continue
+		}
+		logging.Info("installed snapshot", "addr", addr, "rev", rev)
+	}
+}
@@ -0,0 +1,36 @@
+package peer
+
+import (
+	"errors"
+)
+
+// A node is kicked from the consensus set once it has been silent for
+// the kick timeout. Every node writes its pulse at least this many
+// times within one timeout, so that a few lost pulses, or a slow link,
+// don't get a healthy node kicked.
+const minPulsesPerKick = 3
+
+var (
+	ErrBadTimeout = errors.New("timeouts and intervals must be positive")
+	ErrKickPulse  = errors.New("kick timeout must be at least 3 pulse intervals")
+	ErrKickRound  = errors.New("kick timeout must be longer than the round timeout")
+)
+
+// CheckTimeouts reports whether the given timing, all in nanoseconds,
+// makes sense for a cluster. Pulse is how often a node announces
+// itself, fill how long a proposer waits for a node to use a seqn
+// before filling it with a nop, kick how long a node may be silent
+// before it's removed from the consensus set, and round the initial
+// time a coordinator waits on a round before starting another.
+func CheckTimeouts(pulse, fill, kick, round int64) error {
+	if pulse <= 0 || fill <= 0 || kick <= 0 || round <= 0 {
+		return ErrBadTimeout
+	}
+	if kick < minPulsesPerKick*pulse {
+		return ErrKickPulse
+	}
+	if kick <= round {
+		return ErrKickRound
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package peer
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestCheckTimeoutsDefaults(t *testing.T) {
+	assert.Equal(t, nil, CheckTimeouts(1e9, 1e8, 60e9, 1e6))
+}
+
+func TestCheckTimeoutsWAN(t *testing.T) {
+	assert.Equal(t, nil, CheckTimeouts(5e9, 2e9, 120e9, 250e6))
+}
+
+func TestCheckTimeoutsBad(t *testing.T) {
+	assert.Equal(t, ErrBadTimeout, CheckTimeouts(0, 1e8, 60e9, 1e6))
+	assert.Equal(t, ErrBadTimeout, CheckTimeouts(1e9, -1, 60e9, 1e6))
+	assert.Equal(t, ErrBadTimeout, CheckTimeouts(1e9, 1e8, 60e9, 0))
+	assert.Equal(t, ErrKickPulse, CheckTimeouts(30e9, 1e8, 60e9, 1e6))
+	assert.Equal(t, ErrKickRound, CheckTimeouts(1e9, 1e8, 60e9, 60e9))
+}
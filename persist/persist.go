@@ -0,0 +1,315 @@
+package persist
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/madebymany/doozerd/logging"
+	"github.com/madebymany/doozerd/store"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A data directory holds a snapshot of the store, in the format of
+// store.WriteSnapshot, and a log of every mutation applied since.
+// Each log record is:
+//
+//	seqn     uvarint
+//	len(mut) uvarint, mut
+//	checksum 4 bytes, big-endian CRC-32 (IEEE) of the above
+//
+// A node that starts again loads the snapshot and applies the records
+// after it, stopping at the first one that is missing, out of order,
+// or damaged by a crash in the middle of writing it.
+const (
+	snapName = "snapshot"
+	logName  = "log"
+	tmpExt   = ".tmp"
+)
+
+// No mutation comes near this long; a longer record is damaged.
+const maxRecordLen = 1 << 30
+
+// ErrBadRecord is the error for a log record that fails its checksum.
+var ErrBadRecord = errors.New("bad log record")
+
+// Recover brings st, a new store, to the state saved in dir, and
+// returns the revision it reached and the number of log records it
+// applied to get there. If dir holds nothing, st is left alone and rev
+// is 0.
+func Recover(st *store.Store, dir string) (rev int64, replayed int, err error) {
+	f, err := os.Open(filepath.Join(dir, snapName))
+	switch {
+	case err == nil:
+		rev, err = st.InstallSnapshot(bufio.NewReader(f))
+		f.Close()
+		if err == store.ErrSnapshotStale {
+			// Saved before anything had happened.
+			rev, err = 0, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	case !os.IsNotExist(err):
+		return 0, 0, err
+	}
+
+	f, err = os.Open(filepath.Join(dir, logName))
+	if os.IsNotExist(err) {
+		return rev, 0, nil
+	} else if err != nil {
+		return rev, 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		seqn, mut, err := readRecord(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			logging.Warn("recover", "dir", dir, "after", rev, "err", err)
+			break
+		}
+		if seqn <= rev {
+			continue // already in the snapshot
+		}
+		if seqn != rev+1 {
+			logging.Warn("recover", "dir", dir, "after", rev, "next", seqn)
+			break
+		}
+		st.Ops <- store.Op{seqn, mut}
+		rev++
+		replayed++
+	}
+
+	for rev > 0 && <-st.Seqns < rev {
+	}
+	return rev, replayed, nil
+}
+
+// Keep saves st to dir as it changes: straight away a snapshot, and
+// then a log record for each mutation applied. On each tick it writes
+// a new snapshot and starts the log over, so a node that starts again
+// has only the changes since the last tick to apply. It returns once
+// st is closed, or at the first error writing to dir.
+//
+// The log is not synced to disk after each record, so a machine that
+// loses power may lose the last few changes; a process that crashes
+// loses nothing the store had applied.
+func Keep(st *store.Store, dir string, ticker <-chan time.Time) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	last, g := st.Snap()
+	w, err := save(dir, last, g)
+	if err != nil {
+		return err
+	}
+	defer func() { w.close() }()
+
+	ls, err := st.LogStream(last + 1)
+	if err != nil {
+		return err
+	}
+	defer ls.Stop()
+
+	for {
+		select {
+		case e, ok := <-ls.C:
+			if !ok {
+				return w.flush()
+			}
+			if err := w.record(e); err != nil {
+				return err
+			}
+			last, g = e.Seqn, e.Getter
+		case <-ticker:
+			if last == w.from {
+				continue
+			}
+			if err := w.close(); err != nil {
+				return err
+			}
+			if w, err = save(dir, last, g); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Writes a snapshot of g, the store at rev, into dir, and starts a new,
+// empty log to follow it. Each replaces the old file only once it is
+// complete and synced, so a crash at any point leaves a snapshot and a
+// log that together make a state the store once had.
+//
+// The snapshot is written from g, not asked of the store, which may be
+// waiting meanwhile for Keep to take the next log entry.
+func save(dir string, rev int64, g store.Getter) (*logWriter, error) {
+	err := writeFile(dir, snapName, func(w io.Writer) error {
+		return store.WriteSnapshotOf(g, rev, w)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeFile(dir, logName, func(io.Writer) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, logName), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	logging.Info("saved snapshot", "dir", dir, "rev", rev)
+	return &logWriter{f: f, w: bufio.NewWriter(f), from: rev}, nil
+}
+
+// Writes a file called name in dir by way of a temporary file, which
+// is synced and then renamed into place.
+func writeFile(dir, name string, write func(io.Writer) error) error {
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path+tmpExt, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+	err = write(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + tmpExt)
+		return err
+	}
+
+	if err := os.Rename(path+tmpExt, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// Makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Appends records to the log that follows the snapshot at from.
+type logWriter struct {
+	f    *os.File
+	w    *bufio.Writer
+	from int64
+	buf  [binary.MaxVarintLen64]byte
+}
+
+func (lw *logWriter) record(e store.LogEntry) error {
+	crc := crc32.NewIEEE()
+	w := io.MultiWriter(lw.w, crc)
+	n := binary.PutUvarint(lw.buf[:], uint64(e.Seqn))
+	w.Write(lw.buf[:n])
+	n = binary.PutUvarint(lw.buf[:], uint64(len(e.Mut)))
+	w.Write(lw.buf[:n])
+	io.WriteString(w, e.Mut)
+	binary.BigEndian.PutUint32(lw.buf[:4], crc.Sum32())
+	lw.w.Write(lw.buf[:4])
+
+	// Hand each record to the OS at once, so that a crash of this
+	// process doesn't lose it.
+	return lw.flush()
+}
+
+func (lw *logWriter) flush() error {
+	return lw.w.Flush()
+}
+
+func (lw *logWriter) close() error {
+	if lw == nil || lw.f == nil {
+		return nil
+	}
+	err := lw.flush()
+	if cerr := lw.f.Close(); err == nil {
+		err = cerr
+	}
+	lw.f = nil
+	return err
+}
+
+// Reads one log record from r. Returns io.EOF if r is at its end, and
+// io.ErrUnexpectedEOF or ErrBadRecord for a record cut short or
+// damaged.
+func readRecord(r *bufio.Reader) (seqn int64, mut string, err error) {
+	crc := crc32.NewIEEE()
+	cr := &crcReader{r, crc}
+
+	n, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return 0, "", err
+	}
+	l, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return 0, "", eof(err)
+	}
+	if l > maxRecordLen {
+		return 0, "", ErrBadRecord
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(cr, b); err != nil {
+		return 0, "", eof(err)
+	}
+
+	sum := crc.Sum32()
+	var got [4]byte
+	if _, err := io.ReadFull(r, got[:]); err != nil {
+		return 0, "", eof(err)
+	}
+	if binary.BigEndian.Uint32(got[:]) != sum {
+		return 0, "", ErrBadRecord
+	}
+	return int64(n), string(b), nil
+}
+
+// A record that ends early was cut short, not missing.
+func eof(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Reads through to r, adding what it reads to the checksum.
+type crcReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (cr *crcReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.crc.Write(p[:n])
+	return n, err
+}
+
+func (cr *crcReader) ReadByte() (byte, error) {
+	c, err := cr.r.ReadByte()
+	if err == nil {
+		cr.crc.Write([]byte{c})
+	}
+	return c, err
+}
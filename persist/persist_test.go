@@ -0,0 +1,154 @@
+package persist
+
+import (
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "doozerd-persist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// Applies n sets of /x and /n/<i> to st, from seqn from on.
+func setMany(st *store.Store, from, n int64) {
+	for i := from; i < from+n; i++ {
+		s := strconv.FormatInt(i, 10)
+		st.Ops <- store.Op{i, store.MustEncodeSet("/n/"+s, s, store.Clobber)}
+	}
+	for <-st.Seqns < from+n-1 {
+	}
+}
+
+// Runs Keep on st until st is closed, and returns its error.
+func keep(st *store.Store, dir string, ticker <-chan time.Time) <-chan error {
+	c := make(chan error, 1)
+	go func() { c <- Keep(st, dir, ticker) }()
+	for <-st.Waiting < 1 {
+	}
+	return c
+}
+
+func TestRecoverEmpty(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	st := store.New()
+	defer close(st.Ops)
+	rev, n, err := Recover(st, dir)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(0), rev)
+	assert.Equal(t, 0, n)
+}
+
+func TestRecoverFromSnapshotAndTail(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	st := store.New()
+	tick := make(chan time.Time)
+	done := keep(st, dir, tick)
+	setMany(st, 1, 100)
+	tick <- time.Now()
+	setMany(st, 101, 3)
+	st.Ops <- store.Op{104, store.MustEncodeDel("/n/1", store.Clobber)}
+	for <-st.Seqns < 104 {
+	}
+	close(st.Ops)
+	assert.Equal(t, nil, <-done)
+
+	// Keep may take the tick before it has logged every change sent
+	// ahead of it, so the snapshot is at some revision up to 100, and
+	// the log holds the rest.
+	f, err := os.Open(filepath.Join(dir, snapName))
+	assert.Equal(t, nil, err)
+	snap, snapRev, err := store.ReadSnapshot(f)
+	f.Close()
+	assert.Equal(t, nil, err)
+	close(snap.Ops)
+	assert.T(t, snapRev <= 100, snapRev)
+
+	again := store.New()
+	defer close(again.Ops)
+	rev, n, err := Recover(again, dir)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(104), rev)
+	assert.Equal(t, int(104-snapRev), n) // just the changes after the snapshot
+
+	_, g := again.Snap()
+	assert.Equal(t, 102, len(store.Getdir(g, "/n")))
+	assert.Equal(t, "103", store.GetString(g, "/n/103"))
+	_, frev := g.Get("/n/1")
+	assert.Equal(t, store.Missing, frev)
+	_, frev = g.Get("/n/50")
+	assert.Equal(t, int64(50), frev)
+}
+
+func TestRecoverTornRecord(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	st := store.New()
+	done := keep(st, dir, nil)
+	setMany(st, 1, 5)
+	close(st.Ops)
+	assert.Equal(t, nil, <-done)
+
+	// Cut the last record short, as a crash while writing it would,
+	// and leave a half-written snapshot behind.
+	path := filepath.Join(dir, logName)
+	fi, err := os.Stat(path)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, os.Truncate(path, fi.Size()-2))
+	err = ioutil.WriteFile(filepath.Join(dir, snapName+tmpExt), []byte("doozer"), 0600)
+	assert.Equal(t, nil, err)
+
+	again := store.New()
+	defer close(again.Ops)
+	rev, n, err := Recover(again, dir)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(4), rev)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, "4", store.GetString(again, "/n/4"))
+	_, frev := again.Get("/n/5")
+	assert.Equal(t, store.Missing, frev)
+}
+
+func TestKeepAfterRecover(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	st := store.New()
+	done := keep(st, dir, nil)
+	setMany(st, 1, 3)
+	close(st.Ops)
+	assert.Equal(t, nil, <-done)
+
+	// A recovered node saves from where it got to, and can be
+	// recovered again.
+	st = store.New()
+	_, _, err := Recover(st, dir)
+	assert.Equal(t, nil, err)
+	done = keep(st, dir, nil)
+	setMany(st, 4, 2)
+	close(st.Ops)
+	assert.Equal(t, nil, <-done)
+
+	again := store.New()
+	defer close(again.Ops)
+	rev, n, err := Recover(again, dir)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(5), rev)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "1", store.GetString(again, "/n/1"))
+	assert.Equal(t, "5", store.GetString(again, "/n/5"))
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"github.com/madebymany/doozerd/store"
+	"regexp"
+	"strings"
+)
+
+// Rules restricting what each identity may change live under
+// /ctl/acl, one to a file. The file /ctl/acl/<id>/<name> holds a glob and
+// a comma-separated list of verbs, or "*" for any verb, such as
+//
+//	/public/** SET,DEL
+//
+// An identity with no rules may change whatever its access allows. One
+// with rules may make a change only if some rule's glob matches the
+// path and lists the verb. Rules are read from the store on every
+// request that changes a file, so a new rule takes effect at once.
+const aclDir = "/ctl/acl"
+
+// Identity names must work as a path component.
+var identRe = regexp.MustCompile(`^[a-zA-Z0-9.\-]+$`)
+
+// HasRules reports whether any identity has rules in g. A client with
+// no identity, such as one through the web gateway, is not bound by
+// them, so the gateway refuses changes while there are any.
+func HasRules(g store.Getter) bool {
+	_, rev := g.Get(aclDir)
+	return rev == store.Dir
+}
+
+// Reports whether the ACL lets c's identity use verb on path.
+func (c *conn) permitted(verb request_Verb, path string) bool {
+	if c.id == "" {
+		return true
+	}
+	if !identRe.MatchString(c.id) {
+		return false // it can't have rules; don't let it write freely
+	}
+
+	_, g := c.st.Snap()
+	dir := aclDir + "/" + c.id
+	v, rev := g.Get(dir)
+	if rev == store.Missing {
+		return true
+	}
+	if rev != store.Dir {
+		return false
+	}
+	for _, name := range v {
+		if ruleAllows(store.GetString(g, dir+"/"+name), verb, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleAllows(rule string, verb request_Verb, path string) bool {
+	f := strings.Fields(rule)
+	if len(f) != 2 {
+		return false
+	}
+	glob, err := store.CompileGlob(f[0])
+	if err != nil || !glob.Match(path) {
+		return false
+	}
+	for _, s := range strings.Split(f[1], ",") {
+		if s == "*" || s == verb.String() {
+			return true
+		}
+	}
+	return false
+}
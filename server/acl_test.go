@@ -0,0 +1,121 @@
+package server
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"testing"
+)
+
+// Makes a writable connection for id, on a store holding the given
+// ACL rules, by name.
+func aclConn(id string, rules map[string]string) (*conn, bchan) {
+	st := store.New()
+	fp := &test.FakeProposer{Store: st}
+	for name, rule := range rules {
+		fp.Propose([]byte(store.MustEncodeSet(aclDir+"/"+name, rule, store.Clobber)))
+	}
+	b := make(bchan, 2)
+	return &conn{
+		c:        b,
+		waccess:  true,
+		raccess:  true,
+		canWrite: true,
+		st:       st,
+		p:        fp,
+		id:       id,
+	}, b
+}
+
+func aclDo(t *testing.T, c *conn, b bchan, verb request_Verb, path string) *response {
+	tx := &txn{
+		c: c,
+		req: request{
+			Tag:   proto.Int32(1),
+			Verb:  &verb,
+			Path:  proto.String(path),
+			Rev:   proto.Int64(store.Clobber),
+			Delta: proto.Int64(1),
+			Ttl:   proto.Int64(60e9),
+		},
+	}
+	ops[int32(verb)](tx)
+	assert.Equal(t, 4, len(<-b))
+	return mustUnmarshal(<-b)
+}
+
+func TestACLReadOnlyIdentity(t *testing.T) {
+	c, b := aclConn("app", map[string]string{"app/0": "/public/** GET"})
+	defer close(c.st.Ops)
+
+	for _, p := range []string{"/public/x", "/private/x"} {
+		resp := aclDo(t, c, b, request_SET, p)
+		assert.Equal(t, response_PERMISSION_DENIED, resp.GetErrCode())
+	}
+	assert.Equal(t, "", store.GetString(c.st, "/public/x"))
+}
+
+func TestACLAllowsListedVerbs(t *testing.T) {
+	c, b := aclConn("app", map[string]string{
+		"app/0": "/app/** SET,DEL",
+		"app/1": "/count INCR",
+	})
+	defer close(c.st.Ops)
+
+	assert.Equal(t, (*response_Err)(nil), aclDo(t, c, b, request_SET, "/app/x").ErrCode)
+	assert.Equal(t, (*response_Err)(nil), aclDo(t, c, b, request_DEL, "/app/x").ErrCode)
+	assert.Equal(t, (*response_Err)(nil), aclDo(t, c, b, request_INCR, "/count").ErrCode)
+
+	denied := []struct {
+		verb request_Verb
+		path string
+	}{
+		{request_APPEND, "/app/x"},
+		{request_REFRESH, "/app/x"},
+		{request_SET, "/count"},
+		{request_SET, "/ctl/acl/app/0"},
+	}
+	for _, d := range denied {
+		resp := aclDo(t, c, b, d.verb, d.path)
+		assert.Equal(t, response_PERMISSION_DENIED, resp.GetErrCode(), d)
+	}
+}
+
+func TestACLAnyVerb(t *testing.T) {
+	c, b := aclConn("app", map[string]string{"app/0": "/app/** *"})
+	defer close(c.st.Ops)
+
+	assert.Equal(t, (*response_Err)(nil), aclDo(t, c, b, request_APPEND, "/app/x").ErrCode)
+}
+
+func TestACLUnrestricted(t *testing.T) {
+	c, b := aclConn("rw", map[string]string{"app/0": "/public/** GET"})
+	defer close(c.st.Ops)
+
+	assert.Equal(t, (*response_Err)(nil), aclDo(t, c, b, request_SET, "/private/x").ErrCode)
+}
+
+func TestACLBadRule(t *testing.T) {
+	c, b := aclConn("app", map[string]string{"app/0": "/app/[ SET"})
+	defer close(c.st.Ops)
+
+	resp := aclDo(t, c, b, request_SET, "/app/x")
+	assert.Equal(t, response_PERMISSION_DENIED, resp.GetErrCode())
+}
+
+func TestACLBadIdentity(t *testing.T) {
+	c, b := aclConn("a b", nil)
+	defer close(c.st.Ops)
+
+	resp := aclDo(t, c, b, request_SET, "/x")
+	assert.Equal(t, response_PERMISSION_DENIED, resp.GetErrCode())
+}
+
+func TestACLAccessIdentity(t *testing.T) {
+	c := &conn{rwsk: "a", rosk: "b"}
+	c.grant("b")
+	assert.Equal(t, "ro", c.id)
+	c.grant("a")
+	assert.Equal(t, "rw", c.id)
+}
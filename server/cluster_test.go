@@ -0,0 +1,172 @@
+package server
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Proposes through a Manager, as a peer does: at each seqn the manager
+// gives it, until its value is the one learned.
+type memProposer struct {
+	seqns chan int64
+	props chan *consensus.Prop
+	st    *store.Store
+}
+
+func (p *memProposer) Propose(v []byte) (e store.Event) {
+	for e.Mut != string(v) {
+		n := <-p.seqns
+		w, err := p.st.Wait(store.Any, n)
+		if err != nil {
+			panic(err)
+		}
+		p.props <- &consensus.Prop{n, v, nil}
+		e = <-w
+	}
+	return
+}
+
+type memNode struct {
+	st *store.Store
+	pc *test.PacketConn
+	l  *test.PipeListener
+	s  *Server
+}
+
+func (nd *memNode) close() {
+	nd.s.Shutdown(0)
+	nd.pc.Close()
+}
+
+// Starts a cluster of doozer servers, one for each name, each with its
+// own store and consensus Manager. The managers talk over a PacketNet,
+// and each server listens on a PipeListener, so nothing touches the
+// network.
+func memCluster(names ...string) []*memNode {
+	alpha := int64(len(names))
+	var pn test.PacketNet
+	var addrs []*net.UDPAddr
+	var ops []store.Op
+	for i, name := range names {
+		addr := &net.UDPAddr{IP: net.IP{10, 0, 0, byte(i + 1)}, Port: 8046}
+		addrs = append(addrs, addr)
+		ops = append(ops, store.Op{int64(len(ops) + 1), store.MustEncodeSet("/ctl/node/"+name+"/addr", addr.String(), 0)})
+	}
+	for i, name := range names {
+		ops = append(ops, store.Op{int64(len(ops) + 1), store.MustEncodeSet("/ctl/cal/"+strconv.Itoa(i), name, 0)})
+	}
+
+	// The runs for the first alpha seqns are made from the events
+	// alpha before them, so those must all see every cal.
+	defRev := int64(len(ops))
+	for i := int64(1); i < alpha; i++ {
+		ops = append(ops, store.Op{int64(len(ops) + 1), store.Nop})
+	}
+
+	var nodes []*memNode
+	for i, name := range names {
+		st := store.New()
+		for _, op := range ops {
+			st.Ops <- op
+		}
+
+		in := make(chan consensus.Packet)
+		out := make(chan consensus.Packet)
+		p := &memProposer{make(chan int64, alpha), make(chan *consensus.Prop), st}
+		m := &consensus.Manager{
+			Self:   name,
+			DefRev: defRev,
+			Alpha:  alpha,
+			In:     in,
+			Out:    out,
+			Ops:    st.Ops,
+			PSeqn:  p.seqns,
+			Props:  p.props,
+			TFill:  10e6,
+			Store:  st,
+			Ticker: time.Tick(10e6),
+		}
+		go m.Run()
+
+		pc := pn.Listen(addrs[i])
+		go func() {
+			for o := range out {
+				pc.WriteTo(o.Data, o.Addr)
+			}
+		}()
+		go func() {
+			for {
+				buf := make([]byte, 3000)
+				n, addr, err := pc.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				in <- consensus.Packet{addr.(*net.UDPAddr), buf[:n]}
+			}
+		}()
+
+		l := test.NewPipeListener(addrs[i].String())
+		canWrite := make(chan bool, 1)
+		canWrite <- true
+		s := NewServer(l, canWrite, st, p, "", "", name)
+		go s.Serve()
+
+		nodes = append(nodes, &memNode{st, pc, l, s})
+	}
+	return nodes
+}
+
+func TestMemCluster(t *testing.T) {
+	nodes := memCluster("a", "b", "c")
+	defer func() {
+		for _, nd := range nodes {
+			nd.close()
+		}
+	}()
+
+	var conns []net.Conn
+	for _, nd := range nodes {
+		c, err := nd.l.Dial()
+		assert.Equal(t, nil, err)
+		defer c.Close()
+		conns = append(conns, c)
+	}
+
+	// A write to any node can be read from every node.
+	for i, c := range conns {
+		path := "/x" + strconv.Itoa(i)
+		writeRequest(c, &request{
+			Tag:   proto.Int32(1),
+			Verb:  request_SET.Enum(),
+			Path:  proto.String(path),
+			Rev:   proto.Int64(store.Clobber),
+			Value: []byte(path),
+		})
+		resp := readResponse(c)
+		assert.Equal(t, (*response_Err)(nil), resp.ErrCode, i)
+		rev := resp.GetRev()
+
+		for j, nd := range nodes {
+			w, err := nd.st.Wait(store.Any, rev)
+			assert.Equal(t, nil, err)
+			<-w
+
+			writeRequest(conns[j], &request{
+				Tag:  proto.Int32(2),
+				Verb: request_GET.Enum(),
+				Path: proto.String(path),
+			})
+			resp := readResponse(conns[j])
+			assert.Equal(t, (*response_Err)(nil), resp.ErrCode, i, j)
+			assert.Equal(t, []byte(path), resp.Value, i, j)
+			assert.Equal(t, rev, resp.GetRev(), i, j)
+		}
+	}
+}
@@ -1,13 +1,18 @@
 package server
 
 import (
+	"bytes"
 	"code.google.com/p/goprotobuf/proto"
+	"compress/gzip"
 	"encoding/binary"
 	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/store"
 	"io"
-	"log"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type conn struct {
@@ -21,33 +26,158 @@ type conn struct {
 	rosk     string
 	waccess  bool
 	raccess  bool
+	id       string // who the client is, for the ACL
 	self     string
+	limit    *bucket     // nil means no limit
+	rtimeout int64       // ns to wait for a request; 0 means forever
+	wtimeout int64       // ns to wait for a response to be written
+	ktimeout int64       // ns to wait for a request once the client pings
+	pinging  bool        // whether the client has sent a PING
+	pending  int64       // requests not yet responded to
+	quit     <-chan bool // closed when the server is shutting down
+	maxWaits int         // outstanding WAITs allowed; 0 means any number
+	wmu      sync.Mutex
+	waits    map[int32]chan bool // by tag; closing one cancels it
+	health   func() Health
+	gzip     int32          // nonzero once the client has asked for compression
+	sid      string         // the client's session, once it has one
+	sets     sync.WaitGroup // session sets not yet done
+	served   int64          // requests read
 }
 
-func (c *conn) serve() {
+// CompressMin is the smallest response, in bytes, that is compressed on
+// a connection that has asked for compression. Smaller ones gain little
+// and cost a gzip header.
+var CompressMin = 1024
+
+// Set in a response's length header if its body is gzipped.
+const gzipFlag = 1 << 31
+
+// What a connection needs for its timeouts; a net.Conn has these.
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// Registers an outstanding WAIT with the given tag, returning the
+// channel that cancels it, or the error to respond with instead.
+func (c *conn) addWait(tag int32) (chan bool, response_Err) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, ok := c.waits[tag]; ok {
+		return nil, response_TAG_IN_USE
+	}
+	if c.maxWaits > 0 && len(c.waits) >= c.maxWaits {
+		return nil, response_TOO_MANY_WATCHES
+	}
+	if c.waits == nil {
+		c.waits = make(map[int32]chan bool)
+	}
+	ch := make(chan bool)
+	c.waits[tag] = ch
+	return ch, 0
+}
+
+// Forgets the WAIT with the given tag, if ch is still the one for it.
+func (c *conn) delWait(tag int32, ch chan bool) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.waits[tag] == ch {
+		delete(c.waits, tag)
+	}
+}
+
+// Cancels the WAIT with the given tag, if there is one.
+func (c *conn) cancelWait(tag int32) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if ch, ok := c.waits[tag]; ok {
+		close(ch)
+		delete(c.waits, tag)
+	}
+}
+
+// Cancels every outstanding WAIT.
+func (c *conn) cancelWaits() {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	for tag, ch := range c.waits {
+		close(ch)
+		delete(c.waits, tag)
+	}
+}
+
+func (c *conn) quitting() bool {
+	select {
+	case <-c.quit:
+		return true
+	default:
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+// Serves requests until the client closes the connection or the server
+// shuts down, which return nil, or until an error.
+func (c *conn) serve() error {
 	for {
 		var t txn
 		t.c = c
 		err := c.read(&t.req)
 		if err != nil {
-			if err != io.EOF {
-				log.Println(err)
+			if err == io.EOF || c.quitting() {
+				return nil
 			}
-			return
+			logging.Warn("read", "addr", c.addr, "err", err)
+			return err
+		}
+		atomic.AddInt64(&c.served, 1)
+		if t.req.GetGzip() {
+			atomic.StoreInt32(&c.gzip, 1)
+		}
+		atomic.AddInt64(&c.pending, 1)
+		if c.limit != nil && !c.limit.take(time.Now().UnixNano()) {
+			t.respondErrCode(response_TOO_MANY)
+			continue
 		}
 		t.run()
 	}
 }
 
+// Reads a request. If c has a read timeout, the whole request must
+// arrive within it, and c is closed if none does; but a client with a
+// response still to come, such as for a WAIT, may be idle for as long
+// as it likes. A client that pings gets no such leave: once it has
+// sent a PING, it is closed if no request arrives within c's keepalive
+// timeout.
 func (c *conn) read(r *request) error {
-	var size int32
-	err := binary.Read(c.c, binary.BigEndian, &size)
-	if err != nil {
-		return err
+	ns, spare := c.rtimeout, true
+	if c.pinging && c.ktimeout > 0 {
+		ns, spare = c.ktimeout, false
+	}
+
+	var hdr [4]byte
+	for {
+		c.setDeadline(ns, deadliner.SetReadDeadline)
+		if c.quitting() {
+			return io.EOF
+		}
+		n, err := io.ReadFull(c.c, hdr[:])
+		if n == 0 && isTimeout(err) && spare && atomic.LoadInt64(&c.pending) > 0 && !c.quitting() {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		break
 	}
 
-	buf := make([]byte, size)
-	_, err = io.ReadFull(c.c, buf)
+	buf := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+	_, err := io.ReadFull(c.c, buf)
 	if err != nil {
 		return err
 	}
@@ -55,24 +185,54 @@ func (c *conn) read(r *request) error {
 	return proto.Unmarshal(buf, r)
 }
 
+// Writes a response. Once the client has asked for compression, a
+// response of at least CompressMin bytes is gzipped, if that makes it
+// smaller, and gzipFlag is set in its length header.
 func (c *conn) write(r *response) error {
 	buf, err := proto.Marshal(r)
 	if err != nil {
 		return err
 	}
+	hdr := uint32(len(buf))
+	if atomic.LoadInt32(&c.gzip) != 0 && len(buf) >= CompressMin {
+		if z := compress(buf); len(z) < len(buf) {
+			buf, hdr = z, uint32(len(z))|gzipFlag
+		}
+	}
 
 	c.wl.Lock()
 	defer c.wl.Unlock()
 
-	err = binary.Write(c.c, binary.BigEndian, int32(len(buf)))
-	if err != nil {
-		return err
+	c.setDeadline(c.wtimeout, deadliner.SetWriteDeadline)
+	err = binary.Write(c.c, binary.BigEndian, hdr)
+	if err == nil {
+		_, err = c.c.Write(buf)
+	}
+	if isTimeout(err) {
+		// The client isn't reading; give up on it.
+		if cl, ok := c.c.(io.Closer); ok {
+			cl.Close()
+		}
 	}
-
-	_, err = c.c.Write(buf)
 	return err
 }
 
+func compress(p []byte) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(p)
+	w.Close()
+	return b.Bytes()
+}
+
+// Sets a deadline ns from now with set, if ns is positive and c's
+// connection can have one.
+func (c *conn) setDeadline(ns int64, set func(deadliner, time.Time) error) {
+	if d, ok := c.c.(deadliner); ok && ns > 0 {
+		set(d, time.Now().Add(time.Duration(ns)))
+	}
+}
+
 // Grant compares sk against c.rwsk and c.rosk and
 // updates c.waccess and c.raccess as necessary.
 // It returns true if sk matched either password.
@@ -81,9 +241,11 @@ func (c *conn) grant(sk string) bool {
 	case c.rwsk:
 		c.waccess = true
 		c.raccess = true
+		c.id = "rw"
 		return true
 	case c.rosk:
 		c.raccess = true
+		c.id = "ro"
 		return true
 	}
 	return false
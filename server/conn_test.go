@@ -1,9 +1,19 @@
 package server
 
 import (
+	"bytes"
+	"code.google.com/p/goprotobuf/proto"
+	"compress/gzip"
+	"encoding/binary"
 	"github.com/bmizerany/assert"
 	"github.com/kr/pretty"
+	"github.com/madebymany/doozerd/store"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
 	"testing"
+	"time"
 )
 
 type grantTest struct {
@@ -39,3 +49,300 @@ func TestConnGrant(t *testing.T) {
 		assert.Equalf(t, tst.w, tst.c.waccess, "%# v", pretty.Formatter(tst))
 	}
 }
+
+func writeRequest(w io.Writer, r *request) {
+	buf, err := proto.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+	binary.Write(w, binary.BigEndian, int32(len(buf)))
+	w.Write(buf)
+}
+
+func readResponse(r io.Reader) *response {
+	resp, _ := readFrame(r)
+	return resp
+}
+
+// Reads a response, and reports whether it was compressed.
+func readFrame(r io.Reader) (*response, bool) {
+	var hdr uint32
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		panic(err)
+	}
+	buf := make([]byte, hdr&^gzipFlag)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		panic(err)
+	}
+	z := hdr&gzipFlag != 0
+	if z {
+		zr, err := gzip.NewReader(bytes.NewReader(buf))
+		if err != nil {
+			panic(err)
+		}
+		if buf, err = ioutil.ReadAll(zr); err != nil {
+			panic(err)
+		}
+	}
+	return mustUnmarshal(buf), z
+}
+
+// Serves c in the background, closing done when serve returns.
+func serveBg(c *conn) (done chan bool) {
+	done = make(chan bool)
+	go func() {
+		c.serve()
+		c.c.(net.Conn).Close()
+		close(done)
+	}()
+	return done
+}
+
+func TestConnReadTimeout(t *testing.T) {
+	s, cl := net.Pipe()
+	defer cl.Close()
+	done := serveBg(&conn{c: s, rtimeout: 20e6})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection not closed")
+	}
+}
+
+func TestConnReadTimeoutSparesWait(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s, cl := net.Pipe()
+	defer cl.Close()
+	done := serveBg(&conn{c: s, st: st, raccess: true, rtimeout: 20e6})
+
+	writeRequest(cl, &request{
+		Tag:  proto.Int32(1),
+		Verb: request_WAIT.Enum(),
+		Path: proto.String("/x"),
+		Rev:  proto.Int64(1),
+	})
+
+	select {
+	case <-done:
+		t.Fatal("connection closed with a wait outstanding")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	st.Ops <- store.Op{Seqn: 1, Mut: store.MustEncodeSet("/x", "a", store.Clobber)}
+	assert.Equal(t, "/x", readResponse(cl).GetPath())
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection not closed")
+	}
+}
+
+func TestConnPing(t *testing.T) {
+	s, cl := net.Pipe()
+	defer cl.Close()
+	serveBg(&conn{c: s})
+
+	writeRequest(cl, &request{Tag: proto.Int32(1), Verb: request_PING.Enum()})
+	resp := readResponse(cl)
+	assert.Equal(t, int32(1), resp.GetTag())
+	assert.Equal(t, response_Err(0), resp.GetErrCode())
+}
+
+func TestConnKeepalive(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s, cl := net.Pipe()
+	defer cl.Close()
+	done := serveBg(&conn{c: s, st: st, raccess: true, ktimeout: 50e6})
+
+	writeRequest(cl, &request{
+		Tag:  proto.Int32(1),
+		Verb: request_WAIT.Enum(),
+		Path: proto.String("/x"),
+		Rev:  proto.Int64(1),
+	})
+
+	// Until the client pings, its wait spares it.
+	select {
+	case <-done:
+		t.Fatal("connection closed before the client pinged")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Pings in time keep it open.
+	for i := int32(2); i < 6; i++ {
+		writeRequest(cl, &request{Tag: proto.Int32(i), Verb: request_PING.Enum()})
+		assert.Equal(t, i, readResponse(cl).GetTag())
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("connection closed while the client pinged")
+	default:
+	}
+
+	// A client that stops is closed, though it still waits.
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("silent connection not closed")
+	}
+}
+
+func TestConnWriteTimeout(t *testing.T) {
+	s, cl := net.Pipe()
+	defer cl.Close()
+	done := serveBg(&conn{c: s, self: "a", wtimeout: 20e6})
+
+	// ask for a response and never read it
+	writeRequest(cl, &request{Tag: proto.Int32(1), Verb: request_SELF.Enum()})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stalled connection not closed")
+	}
+}
+
+func TestConnNoTimeouts(t *testing.T) {
+	s, cl := net.Pipe()
+	defer cl.Close()
+	done := serveBg(&conn{c: s, self: "a"})
+
+	select {
+	case <-done:
+		t.Fatal("connection closed without a timeout")
+	case <-time.After(50 * time.Millisecond):
+	}
+	writeRequest(cl, &request{Tag: proto.Int32(1), Verb: request_SELF.Enum()})
+	assert.Equal(t, "a", string(readResponse(cl).Value))
+}
+
+func waitReq(tag int32) *request {
+	return &request{
+		Tag:  proto.Int32(tag),
+		Verb: request_WAIT.Enum(),
+		Path: proto.String("/x"),
+		Rev:  proto.Int64(1),
+	}
+}
+
+func TestConnMaxWaits(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s, cl := net.Pipe()
+	defer cl.Close()
+	serveBg(&conn{c: s, st: st, raccess: true, maxWaits: 2})
+
+	writeRequest(cl, waitReq(1))
+	writeRequest(cl, waitReq(2))
+	writeRequest(cl, waitReq(3))
+	resp := readResponse(cl)
+	assert.Equal(t, int32(3), resp.GetTag())
+	assert.Equal(t, response_TOO_MANY_WATCHES, resp.GetErrCode())
+
+	// cancelling one frees its slot, and its waiter in the store
+	writeRequest(cl, &request{
+		Tag:      proto.Int32(4),
+		Verb:     request_CANCEL.Enum(),
+		OtherTag: proto.Int32(1),
+	})
+	resp = readResponse(cl)
+	assert.Equal(t, int32(4), resp.GetTag())
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	for <-st.Waiting != 1 {
+	}
+
+	writeRequest(cl, waitReq(5))
+	for <-st.Waiting != 2 {
+	}
+
+	st.Ops <- store.Op{Seqn: 1, Mut: store.MustEncodeSet("/x", "a", store.Clobber)}
+	tags := map[int32]bool{}
+	for i := 0; i < 2; i++ {
+		resp = readResponse(cl)
+		assert.Equal(t, "/x", resp.GetPath())
+		tags[resp.GetTag()] = true
+	}
+	assert.Equal(t, map[int32]bool{2: true, 5: true}, tags)
+}
+
+func TestConnWaitTagInUse(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s, cl := net.Pipe()
+	defer cl.Close()
+	serveBg(&conn{c: s, st: st, raccess: true})
+
+	writeRequest(cl, waitReq(1))
+	writeRequest(cl, waitReq(1))
+	assert.Equal(t, response_TAG_IN_USE, readResponse(cl).GetErrCode())
+}
+
+// Gets path on a new connection, asking for compression if gz is set.
+func getGzip(st *store.Store, path string, gz bool) (*response, bool) {
+	s, cl := net.Pipe()
+	defer cl.Close()
+	serveBg(&conn{c: s, st: st, raccess: true})
+	writeRequest(cl, &request{
+		Tag:  proto.Int32(1),
+		Verb: request_GET.Enum(),
+		Path: proto.String(path),
+		Gzip: proto.Bool(gz),
+	})
+	return readFrame(cl)
+}
+
+func TestConnGzip(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	big := strings.Repeat("abc", CompressMin)
+	st.Ops <- store.Op{Seqn: 1, Mut: store.MustEncodeSet("/big", big, store.Clobber)}
+	st.Ops <- store.Op{Seqn: 2, Mut: store.MustEncodeSet("/small", "a", store.Clobber)}
+	for <-st.Seqns < 2 {
+	}
+
+	resp, z := getGzip(st, "/big", true)
+	assert.T(t, z)
+	assert.Equal(t, big, string(resp.Value))
+	assert.Equal(t, int64(1), resp.GetRev())
+
+	resp, z = getGzip(st, "/small", true)
+	assert.T(t, !z)
+	assert.Equal(t, "a", string(resp.Value))
+}
+
+func TestConnNoGzip(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	big := strings.Repeat("abc", CompressMin)
+	st.Ops <- store.Op{Seqn: 1, Mut: store.MustEncodeSet("/big", big, store.Clobber)}
+	for <-st.Seqns < 1 {
+	}
+
+	resp, z := getGzip(st, "/big", false)
+	assert.T(t, !z)
+	assert.Equal(t, big, string(resp.Value))
+}
+
+func benchmarkConnWrite(b *testing.B, gz int32) {
+	w := new(bytes.Buffer)
+	c := &conn{c: w, gzip: gz}
+	r := &response{Tag: proto.Int32(1), Value: []byte(strings.Repeat("abcdefgh", 1024))}
+	b.SetBytes(int64(len(r.Value)))
+	for i := 0; i < b.N; i++ {
+		w.Reset()
+		c.write(r)
+	}
+}
+
+func BenchmarkConnWrite(b *testing.B) {
+	benchmarkConnWrite(b, 0)
+}
+
+func BenchmarkConnWriteGzip(b *testing.B) {
+	benchmarkConnWrite(b, 1)
+}
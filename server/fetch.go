@@ -0,0 +1,109 @@
+package server
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+)
+
+// MaxFetchFrame is the most bytes FetchSnapshot will read for one
+// response. A server streams its snapshot in chunks of SnapshotChunk,
+// well under it; a bigger frame is refused before anything is
+// allocated for it.
+var MaxFetchFrame int32 = 16 << 20
+
+var errFrameTooBig = errors.New("response frame too big")
+
+// FetchSnapshot asks the server at addr for a snapshot of its store,
+// as written by store.WriteSnapshot, and copies it to w as it arrives.
+// It presents secret first if it is not empty. If tc is not nil, the
+// connection uses TLS, configured by tc. If FetchSnapshot fails after
+// it has written to w, what it wrote is only part of a snapshot.
+func FetchSnapshot(addr, secret string, tc *tls.Config, w io.Writer) error {
+	var c net.Conn
+	var err error
+	if tc != nil {
+		c, err = tls.Dial("tcp", addr, tc)
+	} else {
+		c, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if secret != "" {
+		r := &request{Verb: request_ACCESS.Enum(), Value: []byte(secret)}
+		if _, err := roundTrip(c, r); err != nil {
+			return err
+		}
+	}
+
+	r := &request{Verb: request_SNAPSHOT.Enum(), Stream: proto.Bool(true)}
+	if err := writeReq(c, r); err != nil {
+		return err
+	}
+	for {
+		resp, err := readResp(c)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(resp.Value); err != nil {
+			return err
+		}
+		if resp.GetFlags()&more == 0 {
+			return nil
+		}
+	}
+}
+
+func roundTrip(c io.ReadWriter, r *request) (*response, error) {
+	if err := writeReq(c, r); err != nil {
+		return nil, err
+	}
+	return readResp(c)
+}
+
+func writeReq(c io.Writer, r *request) error {
+	buf, err := proto.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err = binary.Write(c, binary.BigEndian, int32(len(buf))); err != nil {
+		return err
+	}
+	_, err = c.Write(buf)
+	return err
+}
+
+// Reads one response, and returns its error, if it has one, as an
+// error. Nothing here asks for compression, so a frame with the gzip
+// flag set is as much too big as any other over MaxFetchFrame.
+func readResp(c io.Reader) (*response, error) {
+	var size int32
+	if err := binary.Read(c, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 0 || size > MaxFetchFrame {
+		return nil, errFrameTooBig
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return nil, err
+	}
+
+	var resp response
+	if err := proto.Unmarshal(buf, &resp); err != nil {
+		return nil, err
+	}
+	if resp.ErrCode != nil {
+		if resp.ErrDetail != nil {
+			return nil, errors.New(*resp.ErrDetail)
+		}
+		return nil, errors.New(resp.ErrCode.String())
+	}
+	return &resp, nil
+}
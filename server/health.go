@@ -0,0 +1,64 @@
+package server
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"encoding/json"
+	"github.com/madebymany/doozerd/member"
+	"syscall"
+)
+
+// Health describes how a node is doing, for load balancers and the
+// like to decide whether to send it clients.
+type Health struct {
+	Role      string // "member", "slave", or "replica"
+	Rev       int64  // the latest revision in the node's store
+	Latest    int64  // roughly the latest anywhere in the cluster
+	CaughtUp  bool   // whether Rev is close enough to Latest
+	Staleness int64  // ns since Rev was last Latest; 0 if it is now
+	Uptime    int64  // ns since the node started
+}
+
+func (t *txn) health() {
+	if t.c.health == nil {
+		t.resp.ErrDetail = proto.String("no health information")
+		t.respondErrCode(response_OTHER)
+		return
+	}
+
+	h := t.c.health()
+	buf, err := json.Marshal(h)
+	if err != nil {
+		t.respondOsError(err)
+		return
+	}
+	t.resp.Value = buf
+	t.resp.Rev = &h.Rev
+	t.respond()
+}
+
+// Describes the nodes of the cluster, from the control tree, so that
+// clients can find others to fail over to without reading it
+// themselves.
+func (t *txn) members() {
+	if !t.c.raccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	go func() {
+		rev, g, err := t.revGetter()
+		if err != nil {
+			t.respondOsError(err)
+			return
+		}
+
+		buf, err := json.Marshal(member.Members(g))
+		if err != nil {
+			t.respondOsError(err)
+			return
+		}
+		t.resp.Value = buf
+		t.resp.Rev = &rev
+		t.respond()
+	}()
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"github.com/madebymany/doozerd/store"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Limit is how many requests a connection may make: Rate each
+// second, on average, and up to Burst at once. A zero Rate means no
+// limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// DefaultLimit applies to each connection whose identity has no limit
+// of its own.
+var DefaultLimit Limit
+
+// The file /ctl/limit/<id> gives connections with identity id a limit
+// in place of DefaultLimit: a rate and a burst, separated by a space,
+// such as
+//
+//	100 20
+//
+// A rate of 0 means no limit. The file is read when a connection gets
+// its identity, so a change applies to connections identified after it.
+const limitDir = "/ctl/limit"
+
+// A bucket is a token bucket holding up to l.Burst tokens, and filling
+// at l.Rate tokens each second. Each request takes one.
+type bucket struct {
+	l      Limit
+	tokens float64
+	last   int64 // when tokens was last brought up to date
+}
+
+func newBucket(l Limit, now int64) *bucket {
+	if l.Burst < 1 {
+		l.Burst = 1
+	}
+	return &bucket{l: l, tokens: float64(l.Burst), last: now}
+}
+
+// Takes a token at time now, if there is one.
+func (b *bucket) take(now int64) bool {
+	if b.l.Rate <= 0 {
+		return true
+	}
+
+	b.tokens += b.l.Rate * float64(now-b.last) / 1e9
+	if max := float64(b.l.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Sets the limit on c's requests from now on, starting with a full
+// burst.
+func (c *conn) setLimit(l Limit) {
+	c.limit = newBucket(l, time.Now().UnixNano())
+}
+
+// Sets c's limit to the one for its identity, or to DefaultLimit if
+// its identity has none.
+func (c *conn) limitIdentity() {
+	l := DefaultLimit
+	if c.id != "" && identRe.MatchString(c.id) {
+		if il, ok := parseLimit(store.GetString(c.st, limitDir+"/"+c.id)); ok {
+			l = il
+		}
+	}
+	if l.Rate > 0 {
+		c.setLimit(l)
+	} else {
+		c.limit = nil
+	}
+}
+
+func parseLimit(s string) (l Limit, ok bool) {
+	f := strings.Fields(s)
+	if len(f) != 2 {
+		return l, false
+	}
+	rate, err := strconv.ParseFloat(f[0], 64)
+	if err != nil || rate < 0 {
+		return l, false
+	}
+	burst, err := strconv.Atoi(f[1])
+	if err != nil {
+		return l, false
+	}
+	return Limit{Rate: rate, Burst: burst}, true
+}
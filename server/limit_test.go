@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"code.google.com/p/goprotobuf/proto"
+	"encoding/binary"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"io"
+	"testing"
+)
+
+func TestBucketBurst(t *testing.T) {
+	b := newBucket(Limit{Rate: 1, Burst: 3}, 0)
+	assert.T(t, b.take(0))
+	assert.T(t, b.take(0))
+	assert.T(t, b.take(0))
+	assert.T(t, !b.take(0))
+	assert.T(t, !b.take(5e8))
+	assert.T(t, b.take(1e9))
+	assert.T(t, !b.take(1e9))
+}
+
+func TestBucketSlowSender(t *testing.T) {
+	b := newBucket(Limit{Rate: 10, Burst: 1}, 0)
+	for i := int64(0); i < 100; i++ {
+		assert.T(t, b.take(i*1e8), i)
+	}
+}
+
+func TestBucketNoLimit(t *testing.T) {
+	b := newBucket(Limit{}, 0)
+	for i := 0; i < 100; i++ {
+		assert.T(t, b.take(0))
+	}
+}
+
+func TestBucketZeroBurst(t *testing.T) {
+	b := newBucket(Limit{Rate: 1}, 0)
+	assert.T(t, b.take(0))
+	assert.T(t, !b.take(0))
+}
+
+type splitRW struct {
+	io.Reader
+	io.Writer
+}
+
+func TestConnThrottlesFastSender(t *testing.T) {
+	var in, out bytes.Buffer
+	for i := 0; i < 10; i++ {
+		buf, err := proto.Marshal(&request{Tag: proto.Int32(int32(i)), Verb: request_SELF.Enum()})
+		assert.Equal(t, nil, err)
+		binary.Write(&in, binary.BigEndian, int32(len(buf)))
+		in.Write(buf)
+	}
+
+	c := &conn{c: splitRW{&in, &out}, self: "a"}
+	c.setLimit(Limit{Rate: 1e-3, Burst: 3})
+	c.serve()
+
+	var ok, limited int
+	for out.Len() > 0 {
+		var size int32
+		binary.Read(&out, binary.BigEndian, &size)
+		r := mustUnmarshal(out.Next(int(size)))
+		switch r.GetErrCode() {
+		case 0:
+			ok++
+			assert.Equal(t, "a", string(r.Value))
+		case response_TOO_MANY:
+			limited++
+		default:
+			t.Fatal("unexpected", r)
+		}
+	}
+	assert.Equal(t, 3, ok)
+	assert.Equal(t, 7, limited)
+}
+
+// Serves reqs on a conn to st whose secrets are "rw" and "ro", and
+// returns how many responses were TOO_MANY.
+func countLimited(t *testing.T, st *store.Store, reqs ...*request) (limited int) {
+	var in, out bytes.Buffer
+	for i, r := range reqs {
+		r.Tag = proto.Int32(int32(i))
+		buf, err := proto.Marshal(r)
+		assert.Equal(t, nil, err)
+		binary.Write(&in, binary.BigEndian, int32(len(buf)))
+		in.Write(buf)
+	}
+
+	c := &conn{c: splitRW{&in, &out}, st: st, self: "a", rwsk: "rw", rosk: "ro"}
+	c.limitIdentity()
+	c.serve()
+
+	for out.Len() > 0 {
+		var size int32
+		binary.Read(&out, binary.BigEndian, &size)
+		if mustUnmarshal(out.Next(int(size))).GetErrCode() == response_TOO_MANY {
+			limited++
+		}
+	}
+	return limited
+}
+
+func TestIdentityLimit(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet(limitDir+"/rw", "0.001 2", store.Clobber)}
+	<-st.Seqns
+
+	reqs := func(secret string) []*request {
+		rs := []*request{{Verb: request_ACCESS.Enum(), Value: []byte(secret)}}
+		for i := 0; i < 5; i++ {
+			rs = append(rs, &request{Verb: request_SELF.Enum()})
+		}
+		return rs
+	}
+	assert.Equal(t, 3, countLimited(t, st, reqs("rw")...))
+	assert.Equal(t, 0, countLimited(t, st, reqs("ro")...))
+}
+
+func TestIdentityLimitOverridesDefault(t *testing.T) {
+	defer func(l Limit) { DefaultLimit = l }(DefaultLimit)
+	DefaultLimit = Limit{Rate: 1e-3, Burst: 1}
+
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet(limitDir+"/rw", "0 0", store.Clobber)}
+	<-st.Seqns
+
+	access := &request{Verb: request_ACCESS.Enum(), Value: []byte("rw")}
+	self := func() *request { return &request{Verb: request_SELF.Enum()} }
+	assert.Equal(t, 0, countLimited(t, st, access, self(), self(), self()))
+
+	access = &request{Verb: request_ACCESS.Enum(), Value: []byte("ro")}
+	assert.Equal(t, 2, countLimited(t, st, access, self(), self(), self()))
+}
+
+func TestParseLimit(t *testing.T) {
+	l, ok := parseLimit("100 20")
+	assert.T(t, ok)
+	assert.Equal(t, Limit{Rate: 100, Burst: 20}, l)
+	for _, s := range []string{"", "100", "x 20", "100 x", "-1 20", "1 2 3"} {
+		_, ok := parseLimit(s)
+		assert.T(t, !ok, s)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// A net.Listener that accepts connections from several others, so that
+// one Server can take clients over TCP and a Unix socket alike.
+type multiListener struct {
+	ls   []net.Listener
+	c    chan accepted
+	done chan bool
+	once sync.Once
+}
+
+type accepted struct {
+	c   net.Conn
+	err error
+}
+
+// MultiListener returns a listener that accepts connections from each
+// of ls, which must not be empty. Its Addr is that of ls[0]. Closing it
+// closes all of them; closing a Unix socket listener removes its file.
+func MultiListener(ls ...net.Listener) net.Listener {
+	m := &multiListener{
+		ls:   ls,
+		c:    make(chan accepted),
+		done: make(chan bool),
+	}
+	for _, l := range ls {
+		go m.accept(l)
+	}
+	return m
+}
+
+func (m *multiListener) accept(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		select {
+		case m.c <- accepted{c, err}:
+		case <-m.done:
+			if c != nil {
+				c.Close()
+			}
+			return
+		}
+		if ne, ok := err.(net.Error); err != nil && !(ok && ne.Temporary()) {
+			return
+		}
+	}
+}
+
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case a := <-m.c:
+		return a.c, a.err
+	case <-m.done:
+		return nil, syscall.EINVAL
+	}
+}
+
+func (m *multiListener) Close() (err error) {
+	m.once.Do(func() {
+		close(m.done)
+		for _, l := range m.ls {
+			if e := l.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	})
+	return err
+}
+
+func (m *multiListener) Addr() net.Addr {
+	return m.ls[0].Addr()
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doozerd")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sock")
+
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	ul, err := net.Listen("unix", path)
+	assert.Equal(t, nil, err)
+
+	st := store.New()
+	defer close(st.Ops)
+	canWrite := make(chan bool, 1)
+	canWrite <- true
+	l := MultiListener(tl, ul)
+	assert.Equal(t, tl.Addr(), l.Addr())
+	s := NewServer(l, canWrite, st, &test.FakeProposer{Store: st}, "", "", "a")
+	go s.Serve()
+
+	c, err := net.Dial("unix", path)
+	assert.Equal(t, nil, err)
+	defer c.Close()
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(1),
+		Verb:  request_SET.Enum(),
+		Path:  proto.String("/x"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte("a"),
+	})
+	resp := readResponse(c)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	rev := resp.GetRev()
+
+	writeRequest(c, &request{
+		Tag:  proto.Int32(2),
+		Verb: request_GET.Enum(),
+		Path: proto.String("/x"),
+	})
+	resp = readResponse(c)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, []byte("a"), resp.Value)
+	assert.Equal(t, rev, resp.GetRev())
+
+	// The same server still answers over TCP.
+	tc, err := net.Dial("tcp", tl.Addr().String())
+	assert.Equal(t, nil, err)
+	defer tc.Close()
+	writeRequest(tc, &request{
+		Tag:  proto.Int32(1),
+		Verb: request_GET.Enum(),
+		Path: proto.String("/x"),
+	})
+	assert.Equal(t, []byte("a"), readResponse(tc).Value)
+
+	s.Shutdown(0)
+	_, err = os.Stat(path)
+	assert.T(t, os.IsNotExist(err))
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"sync/atomic"
+)
+
+// Counts of requests by verb, and of open connections. The map is
+// filled in once, before any connection is served; after that only
+// the counters change, so reading them needs no lock.
+var (
+	requests = map[int32]*int64{}
+	conns    int64
+)
+
+func init() {
+	for v := range request_Verb_name {
+		requests[v] = new(int64)
+	}
+}
+
+func countRequest(verb int32) {
+	if n, ok := requests[verb]; ok {
+		atomic.AddInt64(n, 1)
+	}
+}
+
+// Requests returns the number of requests served so far for each
+// verb, by name. Verbs this server doesn't know aren't counted.
+func Requests() map[string]int64 {
+	m := make(map[string]int64, len(requests))
+	for v, n := range requests {
+		m[request_Verb_name[v]] = atomic.LoadInt64(n)
+	}
+	return m
+}
+
+// Conns returns the number of client connections now open.
+func Conns() int64 {
+	return atomic.LoadInt64(&conns)
+}
@@ -16,17 +16,31 @@ var _ = math.Inf
 type request_Verb int32
 
 const (
-	request_GET    request_Verb = 1
-	request_SET    request_Verb = 2
-	request_DEL    request_Verb = 3
-	request_REV    request_Verb = 5
-	request_WAIT   request_Verb = 6
-	request_NOP    request_Verb = 7
-	request_WALK   request_Verb = 9
-	request_GETDIR request_Verb = 14
-	request_STAT   request_Verb = 16
-	request_SELF   request_Verb = 20
-	request_ACCESS request_Verb = 99
+	request_GET        request_Verb = 1
+	request_SET        request_Verb = 2
+	request_DEL        request_Verb = 3
+	request_REV        request_Verb = 5
+	request_WAIT       request_Verb = 6
+	request_NOP        request_Verb = 7
+	request_WALK       request_Verb = 9
+	request_CANCEL     request_Verb = 10
+	request_GETDIR     request_Verb = 14
+	request_STAT       request_Verb = 16
+	request_SELF       request_Verb = 20
+	request_REFRESH    request_Verb = 21
+	request_INCR       request_Verb = 22
+	request_APPEND     request_Verb = 23
+	request_HISTORY    request_Verb = 24
+	request_GETDIRSTAT request_Verb = 25
+	request_SYNC       request_Verb = 26
+	request_SNAPSHOT   request_Verb = 27
+	request_HEALTH     request_Verb = 28
+	request_CAD        request_Verb = 29
+	request_GETALL     request_Verb = 30
+	request_PING       request_Verb = 31
+	request_SCAN       request_Verb = 32
+	request_MEMBERS    request_Verb = 33
+	request_ACCESS     request_Verb = 99
 )
 
 var request_Verb_name = map[int32]string{
@@ -37,23 +51,51 @@ var request_Verb_name = map[int32]string{
 	6:  "WAIT",
 	7:  "NOP",
 	9:  "WALK",
+	10: "CANCEL",
 	14: "GETDIR",
 	16: "STAT",
 	20: "SELF",
+	21: "REFRESH",
+	22: "INCR",
+	23: "APPEND",
+	24: "HISTORY",
+	25: "GETDIRSTAT",
+	26: "SYNC",
+	27: "SNAPSHOT",
+	28: "HEALTH",
+	29: "CAD",
+	30: "GETALL",
+	31: "PING",
+	32: "SCAN",
+	33: "MEMBERS",
 	99: "ACCESS",
 }
 var request_Verb_value = map[string]int32{
-	"GET":    1,
-	"SET":    2,
-	"DEL":    3,
-	"REV":    5,
-	"WAIT":   6,
-	"NOP":    7,
-	"WALK":   9,
-	"GETDIR": 14,
-	"STAT":   16,
-	"SELF":   20,
-	"ACCESS": 99,
+	"GET":        1,
+	"SET":        2,
+	"DEL":        3,
+	"REV":        5,
+	"WAIT":       6,
+	"NOP":        7,
+	"WALK":       9,
+	"CANCEL":     10,
+	"GETDIR":     14,
+	"STAT":       16,
+	"SELF":       20,
+	"REFRESH":    21,
+	"INCR":       22,
+	"APPEND":     23,
+	"HISTORY":    24,
+	"GETDIRSTAT": 25,
+	"SYNC":       26,
+	"SNAPSHOT":   27,
+	"HEALTH":     28,
+	"CAD":        29,
+	"GETALL":     30,
+	"PING":       31,
+	"SCAN":       32,
+	"MEMBERS":    33,
+	"ACCESS":     99,
 }
 
 func (x request_Verb) Enum() *request_Verb {
@@ -79,18 +121,28 @@ func (x *request_Verb) UnmarshalJSON(data []byte) error {
 type response_Err int32
 
 const (
-	response_OTHER        response_Err = 127
-	response_TAG_IN_USE   response_Err = 1
-	response_UNKNOWN_VERB response_Err = 2
-	response_READONLY     response_Err = 3
-	response_TOO_LATE     response_Err = 4
-	response_REV_MISMATCH response_Err = 5
-	response_BAD_PATH     response_Err = 6
-	response_MISSING_ARG  response_Err = 7
-	response_RANGE        response_Err = 8
-	response_NOTDIR       response_Err = 20
-	response_ISDIR        response_Err = 21
-	response_NOENT        response_Err = 22
+	response_OTHER             response_Err = 127
+	response_TAG_IN_USE        response_Err = 1
+	response_UNKNOWN_VERB      response_Err = 2
+	response_READONLY          response_Err = 3
+	response_TOO_LATE          response_Err = 4
+	response_REV_MISMATCH      response_Err = 5
+	response_BAD_PATH          response_Err = 6
+	response_MISSING_ARG       response_Err = 7
+	response_RANGE             response_Err = 8
+	response_TOO_LONG          response_Err = 9
+	response_TOO_MANY          response_Err = 10
+	response_TOO_MANY_WATCHES  response_Err = 11
+	response_PERMISSION_DENIED response_Err = 12
+	response_BAD_GLOB          response_Err = 13
+	response_VALUE_MISMATCH    response_Err = 14
+	response_VALIDATION_FAILED response_Err = 15
+	response_BEHIND            response_Err = 16
+	response_QUOTA_EXCEEDED    response_Err = 17
+	response_NO_QUORUM         response_Err = 18
+	response_NOTDIR            response_Err = 20
+	response_ISDIR             response_Err = 21
+	response_NOENT             response_Err = 22
 )
 
 var response_Err_name = map[int32]string{
@@ -103,23 +155,43 @@ var response_Err_name = map[int32]string{
 	6:   "BAD_PATH",
 	7:   "MISSING_ARG",
 	8:   "RANGE",
+	9:   "TOO_LONG",
+	10:  "TOO_MANY",
+	11:  "TOO_MANY_WATCHES",
+	12:  "PERMISSION_DENIED",
+	13:  "BAD_GLOB",
+	14:  "VALUE_MISMATCH",
+	15:  "VALIDATION_FAILED",
+	16:  "BEHIND",
+	17:  "QUOTA_EXCEEDED",
+	18:  "NO_QUORUM",
 	20:  "NOTDIR",
 	21:  "ISDIR",
 	22:  "NOENT",
 }
 var response_Err_value = map[string]int32{
-	"OTHER":        127,
-	"TAG_IN_USE":   1,
-	"UNKNOWN_VERB": 2,
-	"READONLY":     3,
-	"TOO_LATE":     4,
-	"REV_MISMATCH": 5,
-	"BAD_PATH":     6,
-	"MISSING_ARG":  7,
-	"RANGE":        8,
-	"NOTDIR":       20,
-	"ISDIR":        21,
-	"NOENT":        22,
+	"OTHER":             127,
+	"TAG_IN_USE":        1,
+	"UNKNOWN_VERB":      2,
+	"READONLY":          3,
+	"TOO_LATE":          4,
+	"REV_MISMATCH":      5,
+	"BAD_PATH":          6,
+	"MISSING_ARG":       7,
+	"RANGE":             8,
+	"TOO_LONG":          9,
+	"TOO_MANY":          10,
+	"TOO_MANY_WATCHES":  11,
+	"PERMISSION_DENIED": 12,
+	"BAD_GLOB":          13,
+	"VALUE_MISMATCH":    14,
+	"VALIDATION_FAILED": 15,
+	"BEHIND":            16,
+	"QUOTA_EXCEEDED":    17,
+	"NO_QUORUM":         18,
+	"NOTDIR":            20,
+	"ISDIR":             21,
+	"NOENT":             22,
 }
 
 func (x response_Err) Enum() *response_Err {
@@ -149,7 +221,20 @@ type request struct {
 	Value            []byte        `protobuf:"bytes,5,opt,name=value" json:"value,omitempty"`
 	OtherTag         *int32        `protobuf:"varint,6,opt,name=other_tag" json:"other_tag,omitempty"`
 	Offset           *int32        `protobuf:"varint,7,opt,name=offset" json:"offset,omitempty"`
+	Limit            *int32        `protobuf:"varint,11,opt,name=limit" json:"limit,omitempty"`
 	Rev              *int64        `protobuf:"varint,9,opt,name=rev" json:"rev,omitempty"`
+	Ttl              *int64        `protobuf:"varint,10,opt,name=ttl" json:"ttl,omitempty"`
+	Delta            *int64        `protobuf:"varint,12,opt,name=delta" json:"delta,omitempty"`
+	Gzip             *bool         `protobuf:"varint,13,opt,name=gzip" json:"gzip,omitempty"`
+	Trace            *string       `protobuf:"bytes,14,opt,name=trace" json:"trace,omitempty"`
+	Session          *bool         `protobuf:"varint,15,opt,name=session" json:"session,omitempty"`
+	MinRev           *int64        `protobuf:"varint,16,opt,name=min_rev" json:"min_rev,omitempty"`
+	MaxStaleness     *int64        `protobuf:"varint,17,opt,name=max_staleness" json:"max_staleness,omitempty"`
+	Paths            []string      `protobuf:"bytes,18,rep,name=paths" json:"paths,omitempty"`
+	OpId             *string       `protobuf:"bytes,19,opt,name=op_id" json:"op_id,omitempty"`
+	Token            *string       `protobuf:"bytes,20,opt,name=token" json:"token,omitempty"`
+	Stream           *bool         `protobuf:"varint,21,opt,name=stream" json:"stream,omitempty"`
+	ContentType      *string       `protobuf:"bytes,22,opt,name=content_type" json:"content_type,omitempty"`
 	XXX_unrecognized []byte        `json:"-"`
 }
 
@@ -199,6 +284,13 @@ func (this *request) GetOffset() int32 {
 	return 0
 }
 
+func (this *request) GetLimit() int32 {
+	if this != nil && this.Limit != nil {
+		return *this.Limit
+	}
+	return 0
+}
+
 func (this *request) GetRev() int64 {
 	if this != nil && this.Rev != nil {
 		return *this.Rev
@@ -206,6 +298,83 @@ func (this *request) GetRev() int64 {
 	return 0
 }
 
+func (this *request) GetTtl() int64 {
+	if this != nil && this.Ttl != nil {
+		return *this.Ttl
+	}
+	return 0
+}
+
+func (this *request) GetDelta() int64 {
+	if this != nil && this.Delta != nil {
+		return *this.Delta
+	}
+	return 0
+}
+
+func (this *request) GetGzip() bool {
+	if this != nil && this.Gzip != nil {
+		return *this.Gzip
+	}
+	return false
+}
+
+func (this *request) GetTrace() string {
+	if this != nil && this.Trace != nil {
+		return *this.Trace
+	}
+	return ""
+}
+
+func (this *request) GetSession() bool {
+	if this != nil && this.Session != nil {
+		return *this.Session
+	}
+	return false
+}
+
+func (this *request) GetMinRev() int64 {
+	if this != nil && this.MinRev != nil {
+		return *this.MinRev
+	}
+	return 0
+}
+
+func (this *request) GetMaxStaleness() int64 {
+	if this != nil && this.MaxStaleness != nil {
+		return *this.MaxStaleness
+	}
+	return 0
+}
+
+func (this *request) GetOpId() string {
+	if this != nil && this.OpId != nil {
+		return *this.OpId
+	}
+	return ""
+}
+
+func (this *request) GetToken() string {
+	if this != nil && this.Token != nil {
+		return *this.Token
+	}
+	return ""
+}
+
+func (this *request) GetStream() bool {
+	if this != nil && this.Stream != nil {
+		return *this.Stream
+	}
+	return false
+}
+
+func (this *request) GetContentType() string {
+	if this != nil && this.ContentType != nil {
+		return *this.ContentType
+	}
+	return ""
+}
+
 type response struct {
 	Tag              *int32        `protobuf:"varint,1,opt,name=tag" json:"tag,omitempty"`
 	Flags            *int32        `protobuf:"varint,2,opt,name=flags" json:"flags,omitempty"`
@@ -213,6 +382,13 @@ type response struct {
 	Path             *string       `protobuf:"bytes,5,opt,name=path" json:"path,omitempty"`
 	Value            []byte        `protobuf:"bytes,6,opt,name=value" json:"value,omitempty"`
 	Len              *int32        `protobuf:"varint,8,opt,name=len" json:"len,omitempty"`
+	Names            []string      `protobuf:"bytes,9,rep,name=names" json:"names,omitempty"`
+	Revs             []int64       `protobuf:"varint,10,rep,name=revs" json:"revs,omitempty"`
+	Lens             []int32       `protobuf:"varint,11,rep,name=lens" json:"lens,omitempty"`
+	Trace            *string       `protobuf:"bytes,12,opt,name=trace" json:"trace,omitempty"`
+	Values           [][]byte      `protobuf:"bytes,13,rep,name=values" json:"values,omitempty"`
+	Token            *string       `protobuf:"bytes,14,opt,name=token" json:"token,omitempty"`
+	ContentType      *string       `protobuf:"bytes,15,opt,name=content_type" json:"content_type,omitempty"`
 	ErrCode          *response_Err `protobuf:"varint,100,opt,name=err_code,enum=server.response_Err" json:"err_code,omitempty"`
 	ErrDetail        *string       `protobuf:"bytes,101,opt,name=err_detail" json:"err_detail,omitempty"`
 	XXX_unrecognized []byte        `json:"-"`
@@ -264,6 +440,27 @@ func (this *response) GetLen() int32 {
 	return 0
 }
 
+func (this *response) GetTrace() string {
+	if this != nil && this.Trace != nil {
+		return *this.Trace
+	}
+	return ""
+}
+
+func (this *response) GetToken() string {
+	if this != nil && this.Token != nil {
+		return *this.Token
+	}
+	return ""
+}
+
+func (this *response) GetContentType() string {
+	if this != nil && this.ContentType != nil {
+		return *this.ContentType
+	}
+	return ""
+}
+
 func (this *response) GetErrCode() response_Err {
 	if this != nil && this.ErrCode != nil {
 		return *this.ErrCode
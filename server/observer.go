@@ -0,0 +1,71 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ConnInfo describes a client connection.
+type ConnInfo struct {
+	Addr     string        // the client's address
+	ID       string        // its identity, for the ACL, if it has one
+	Start    time.Time     // when the server began serving it
+	Duration time.Duration // how long it was served; zero on connect
+	Requests int64         // requests read from it; zero on connect
+}
+
+// An Observer is told when a Server begins and stops serving each
+// client connection. Its methods are called from the connection's own
+// goroutine, so they must be safe to call concurrently, and should be
+// quick.
+type Observer interface {
+	OnConnect(info ConnInfo)
+
+	// Err is why the connection ended, or nil if the client closed
+	// it or the server shut down.
+	OnDisconnect(info ConnInfo, err error)
+}
+
+// A ConnCounter is an Observer that counts connections.
+type ConnCounter struct {
+	opened, closed, failed int64
+}
+
+// ConnCount counts the connections of any Server whose Observer it is.
+// The web server reports it as metrics.
+var ConnCount = new(ConnCounter)
+
+func (cc *ConnCounter) OnConnect(info ConnInfo) {
+	atomic.AddInt64(&cc.opened, 1)
+}
+
+func (cc *ConnCounter) OnDisconnect(info ConnInfo, err error) {
+	atomic.AddInt64(&cc.closed, 1)
+	if err != nil {
+		atomic.AddInt64(&cc.failed, 1)
+	}
+}
+
+// Opened returns the number of connections served so far.
+func (cc *ConnCounter) Opened() int64 {
+	return atomic.LoadInt64(&cc.opened)
+}
+
+// Closed returns the number of connections that have ended.
+func (cc *ConnCounter) Closed() int64 {
+	return atomic.LoadInt64(&cc.closed)
+}
+
+// Failed returns the number of connections that ended with an error.
+func (cc *ConnCounter) Failed() int64 {
+	return atomic.LoadInt64(&cc.failed)
+}
+
+func (c *conn) info(start time.Time) ConnInfo {
+	return ConnInfo{
+		Addr:     c.addr,
+		ID:       c.id,
+		Start:    start,
+		Requests: atomic.LoadInt64(&c.served),
+	}
+}
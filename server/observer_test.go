@@ -0,0 +1,80 @@
+package server
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"net"
+	"testing"
+)
+
+type fakeObserver struct {
+	connect    chan ConnInfo
+	disconnect chan ConnInfo
+	errs       chan error
+}
+
+func (o *fakeObserver) OnConnect(info ConnInfo) {
+	o.connect <- info
+}
+
+func (o *fakeObserver) OnDisconnect(info ConnInfo, err error) {
+	o.disconnect <- info
+	o.errs <- err
+}
+
+func TestObserver(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	s := NewServer(l, make(chan bool), st, nil, "", "", "a")
+	o := &fakeObserver{make(chan ConnInfo, 1), make(chan ConnInfo, 1), make(chan error, 1)}
+	cc := new(ConnCounter)
+	s.Observer = observers{o, cc}
+	go s.Serve()
+	defer s.Shutdown(0)
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	assert.Equal(t, nil, err)
+
+	info := <-o.connect
+	assert.Equal(t, c.LocalAddr().String(), info.Addr)
+	assert.Equal(t, int64(0), info.Requests)
+	assert.Equal(t, int64(0), int64(info.Duration))
+
+	for i := 0; i < 2; i++ {
+		writeRequest(c, &request{Tag: proto.Int32(1), Verb: request_REV.Enum()})
+		readResponse(c)
+	}
+	writeRequest(c, &request{Tag: proto.Int32(1), Verb: request_ACCESS.Enum()})
+	readResponse(c)
+	c.Close()
+
+	end := <-o.disconnect
+	assert.Equal(t, nil, <-o.errs)
+	assert.Equal(t, info.Addr, end.Addr)
+	assert.Equal(t, info.Start, end.Start)
+	assert.Equal(t, int64(3), end.Requests)
+	assert.Equal(t, "rw", end.ID)
+	assert.T(t, end.Duration > 0)
+
+	assert.Equal(t, int64(1), cc.Opened())
+	assert.Equal(t, int64(1), cc.Closed())
+	assert.Equal(t, int64(0), cc.Failed())
+}
+
+// Tells each observer in turn.
+type observers []Observer
+
+func (obs observers) OnConnect(info ConnInfo) {
+	for _, o := range obs {
+		o.OnConnect(info)
+	}
+}
+
+func (obs observers) OnDisconnect(info ConnInfo, err error) {
+	for _, o := range obs {
+		o.OnDisconnect(info, err)
+	}
+}
@@ -2,53 +2,228 @@ package server
 
 import (
 	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/store"
-	"log"
 	"net"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
+// Timeouts, in ns, for each connection: how long to wait for a client
+// to send a request, unless it has one outstanding, and to drain a
+// response. Zero means no timeout.
+var ReadTimeout, WriteTimeout int64
+
+// How long, in ns, to wait for a request from a client that has sent
+// a PING, before closing its connection. Such a client promises to
+// keep sending, so unlike ReadTimeout this holds even while it has a
+// WAIT outstanding, and a peer that has gone away without closing the
+// connection is noticed. Zero means no timeout.
+var KeepaliveTimeout int64
+
+// How long, in ns, a read with a min_rev or max_staleness waits for
+// this server to reach the revision it needs before failing with
+// BEHIND.
+var MinRevWait int64 = 1e9
+
+// How long, in ns, the cluster remembers a write made with an op_id,
+// so that a retry of it is not applied again.
+var OpWindow int64 = 600e9
+
+// The number of WAITs each connection may have outstanding at once.
+// Zero means no limit.
+var MaxWaits = 1000
+
+// The detail given to a WAIT cut short by Shutdown.
+const errShutdown = "server is shutting down"
+
+// A Server handles the doozer protocol on the connections it accepts
+// from a listener, until it is shut down.
+type Server struct {
+	l        net.Listener
+	canWrite chan bool
+	st       *store.Store
+	p        consensus.Proposer
+	rwsk     string
+	rosk     string
+	self     string
+
+	// Health, if set, answers HEALTH requests.
+	Health func() Health
+
+	// Observer, if set, is told of each connection served.
+	Observer Observer
+
+	mu    sync.Mutex
+	conns map[*conn]net.Conn
+	quit  chan bool // closed when shutting down
+}
+
+func NewServer(l net.Listener, canWrite chan bool, st *store.Store, p consensus.Proposer, rwsk, rosk string, self string) *Server {
+	return &Server{
+		l:        l,
+		canWrite: canWrite,
+		st:       st,
+		p:        p,
+		rwsk:     rwsk,
+		rosk:     rosk,
+		self:     self,
+		conns:    make(map[*conn]net.Conn),
+		quit:     make(chan bool),
+	}
+}
+
 // ListenAndServe listens on l, accepts network connections, and
 // handles requests according to the doozer protocol.
 func ListenAndServe(l net.Listener, canWrite chan bool, st *store.Store, p consensus.Proposer, rwsk, rosk string, self string) {
+	NewServer(l, canWrite, st, p, rwsk, rosk, self).Serve()
+}
+
+// Serve accepts connections until s is shut down.
+func (s *Server) Serve() {
 	var w bool
 	for {
-		c, err := l.Accept()
+		c, err := s.l.Accept()
 		if err != nil {
+			if s.quitting() {
+				break
+			}
 			if err == syscall.EINVAL {
 				break
 			}
 			if e, ok := err.(*net.OpError); ok && e.Err == syscall.EINVAL {
 				break
 			}
-			log.Println(err)
+			logging.Error("accept", "err", err)
 			continue
 		}
 
 		// has this server become writable?
 		select {
-		case w = <-canWrite:
-			canWrite = nil
+		case w = <-s.canWrite:
+			s.canWrite = nil
 		default:
 		}
 
-		go serve(c, st, p, w, rwsk, rosk, self)
+		go s.serve(c, w)
+	}
+}
+
+func (s *Server) quitting() bool {
+	select {
+	case <-s.quit:
+		return true
+	default:
 	}
+	return false
 }
 
-func serve(nc net.Conn, st *store.Store, p consensus.Proposer, w bool, rwsk, rosk string, self string) {
+func (s *Server) serve(nc net.Conn, w bool) {
+	verified, name, err := handshake(nc)
+	if err != nil {
+		logging.Warn("handshake", "addr", nc.RemoteAddr(), "err", err)
+		nc.Close()
+		return
+	}
+
+	addr := nc.RemoteAddr().String()
+	if addr == "" {
+		// A Unix socket client has no name of its own; use the
+		// socket's.
+		addr = "unix:" + nc.LocalAddr().String()
+	}
+
 	c := &conn{
 		c:        nc,
-		addr:     nc.RemoteAddr().String(),
-		st:       st,
-		p:        p,
+		addr:     addr,
+		st:       s.st,
+		p:        s.p,
 		canWrite: w,
-		rwsk:     rwsk,
-		rosk:     rosk,
-		self:     self,
+		rwsk:     s.rwsk,
+		rosk:     s.rosk,
+		self:     s.self,
+		quit:     s.quit,
+		health:   s.Health,
 	}
 
 	c.grant("") // start as if the client supplied a blank password
-	c.serve()
-	nc.Close()
+	if verified {
+		// A verified client certificate counts as the rw secret,
+		// and its common name is the client's identity.
+		c.waccess, c.raccess = true, true
+		c.id = name
+	}
+	c.rtimeout, c.wtimeout = ReadTimeout, WriteTimeout
+	c.ktimeout = KeepaliveTimeout
+	c.maxWaits = MaxWaits
+	c.limitIdentity()
+
+	s.mu.Lock()
+	if s.quitting() {
+		s.mu.Unlock()
+		nc.Close()
+		return
+	}
+	s.conns[c] = nc
+	s.mu.Unlock()
+
+	start := time.Now()
+	if s.Observer != nil {
+		s.Observer.OnConnect(c.info(start))
+	}
+	atomic.AddInt64(&conns, 1)
+	err = c.serve()
+	atomic.AddInt64(&conns, -1)
+
+	// While shutting down, Shutdown closes each connection once its
+	// last response is written.
+	if !s.quitting() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		nc.Close()
+	}
+	c.endSession()
+
+	if s.Observer != nil {
+		info := c.info(start)
+		info.Duration = time.Since(start)
+		s.Observer.OnDisconnect(info, err)
+	}
+}
+
+// Shutdown stops s from accepting connections, and from reading new
+// requests on those it has. Each outstanding WAIT gets an error
+// response, and other requests already read are finished. A connection
+// is closed once it has no more responses to send, or after timeout
+// ns, whichever is first. Shutdown returns when every connection is
+// closed.
+func (s *Server) Shutdown(timeout int64) {
+	s.mu.Lock()
+	s.l.Close()
+	close(s.quit)
+	for c, nc := range s.conns {
+		nc.SetReadDeadline(time.Now())
+		c.cancelWaits()
+	}
+	s.mu.Unlock()
+
+	deadline := time.Now().Add(time.Duration(timeout))
+	for {
+		s.mu.Lock()
+		for c, nc := range s.conns {
+			if atomic.LoadInt64(&c.pending) <= 0 || time.Now().After(deadline) {
+				nc.Close()
+				delete(s.conns, c)
+			}
+		}
+		n := len(s.conns)
+		s.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 }
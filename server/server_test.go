@@ -3,11 +3,20 @@ package server
 import (
 	"bytes"
 	"code.google.com/p/goprotobuf/proto"
+	"encoding/json"
 	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/member"
 	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
 	"io"
-
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var (
@@ -40,6 +49,34 @@ func assertResponseErrCode(t *testing.T, exp response_Err, c *conn) {
 	assert.Equal(t, &exp, mustUnmarshal(b[4:]).ErrCode)
 }
 
+func TestAppendNilFields(t *testing.T) {
+	c := &conn{
+		c:        &bytes.Buffer{},
+		canWrite: true,
+		waccess:  true,
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.append()
+	assertResponseErrCode(t, response_MISSING_ARG, c)
+}
+
+func TestCadNilFields(t *testing.T) {
+	c := &conn{
+		c:        &bytes.Buffer{},
+		canWrite: true,
+		waccess:  true,
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.cad()
+	assertResponseErrCode(t, response_MISSING_ARG, c)
+}
+
 func TestDelNilFields(t *testing.T) {
 	c := &conn{
 		c:        &bytes.Buffer{},
@@ -68,6 +105,73 @@ func TestSetNilFields(t *testing.T) {
 	assertResponseErrCode(t, response_MISSING_ARG, c)
 }
 
+func TestGetdirStatNilFields(t *testing.T) {
+	c := &conn{
+		c:       &bytes.Buffer{},
+		raccess: true,
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.getdirStat()
+	assertResponseErrCode(t, response_MISSING_ARG, c)
+}
+
+func TestGetAllNilFields(t *testing.T) {
+	c := &conn{
+		c:       &bytes.Buffer{},
+		raccess: true,
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.getAll()
+	assertResponseErrCode(t, response_MISSING_ARG, c)
+}
+
+func TestHistoryNilFields(t *testing.T) {
+	c := &conn{
+		c:       &bytes.Buffer{},
+		raccess: true,
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.history()
+	assertResponseErrCode(t, response_MISSING_ARG, c)
+}
+
+func TestIncrNilFields(t *testing.T) {
+	c := &conn{
+		c:        &bytes.Buffer{},
+		canWrite: true,
+		waccess:  true,
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.incr()
+	assertResponseErrCode(t, response_MISSING_ARG, c)
+}
+
+func TestRefreshNilFields(t *testing.T) {
+	c := &conn{
+		c:        &bytes.Buffer{},
+		canWrite: true,
+		waccess:  true,
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.refresh()
+	assertResponseErrCode(t, response_MISSING_ARG, c)
+}
+
 func TestServerNoAccess(t *testing.T) {
 	b := make(bchan, 2)
 	c := &conn{
@@ -80,7 +184,16 @@ func TestServerNoAccess(t *testing.T) {
 		req: request{Tag: proto.Int32(1)},
 	}
 
-	for i, op := range ops {
+	// REV and SELF need no access, and reuse the error code set by an
+	// earlier verb; so visit the verbs in a fixed order, DEL first.
+	var verbs []int
+	for i := range ops {
+		verbs = append(verbs, int(i))
+	}
+	sort.Ints(verbs)
+
+	for _, v := range verbs {
+		i, op := int32(v), ops[int32(v)]
 		if i != int32(request_ACCESS) {
 			op(tx)
 			var exp response_Err = response_OTHER
@@ -112,3 +225,1023 @@ func TestServerRo(t *testing.T) {
 		assert.Equal(t, &exp, mustUnmarshal(<-b).ErrCode, request_Verb_name[i])
 	}
 }
+
+func TestSync(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	fp := &test.FakeProposer{Store: st}
+	fp.Propose([]byte(store.MustEncodeSet("/x", "a", store.Clobber)))
+
+	b := make(bchan, 2)
+	c := &conn{
+		c:        b,
+		canWrite: true,
+		raccess:  true,
+		st:       st,
+		p:        fp,
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.sync()
+	assert.Equal(t, 4, len(<-b))
+	resp := mustUnmarshal(<-b)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, int64(2), resp.GetRev())
+}
+
+func TestSetTooLong(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.MaxValueLen = 4
+
+	c := &conn{
+		c:        &bytes.Buffer{},
+		canWrite: true,
+		waccess:  true,
+		st:       st,
+	}
+	tx := &txn{
+		c: c,
+		req: request{
+			Tag:   proto.Int32(1),
+			Path:  proto.String("/x"),
+			Rev:   proto.Int64(store.Clobber),
+			Value: []byte("12345"),
+		},
+	}
+	tx.set()
+	assertResponseErrCode(t, response_TOO_LONG, c)
+}
+
+func TestLimitsReadOnly(t *testing.T) {
+	c := &conn{
+		c:        &bytes.Buffer{},
+		canWrite: true,
+		waccess:  true,
+	}
+	tx := &txn{
+		c: c,
+		req: request{
+			Tag:  proto.Int32(1),
+			Verb: request_SET.Enum(),
+			Path: proto.String("/ctl/limits/maxvalue"),
+			Rev:  proto.Int64(store.Clobber),
+		},
+	}
+	tx.run()
+	assertResponseErrCode(t, response_READONLY, c)
+}
+
+func TestStatsFile(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/a/b", "", store.Clobber)}
+	<-st.Seqns
+
+	c := &conn{st: st}
+	tx := &txn{c: c}
+	for path, exp := range map[string]string{
+		"/ctl/stats/nodes":     "2",
+		"/ctl/stats/depth":     "2",
+		"/ctl/stats/rev":       "1",
+		"/ctl/stats/watches":   "0",
+		"/ctl/limits/maxvalue": "65536",
+	} {
+		v, ok := tx.virtual(path)
+		assert.T(t, ok, path)
+		assert.Equal(t, exp, v, path)
+	}
+
+	wt := st.Watch(store.MustCompileGlob("/a/**"))
+	defer wt.Stop()
+	v, ok := tx.virtual(WatchesFile)
+	assert.T(t, ok)
+	assert.Equal(t, "1 0 /a/**\n", v)
+
+	_, ok = tx.virtual("/ctl/stats/nope")
+	assert.T(t, !ok)
+	_, ok = tx.virtual("/a/b")
+	assert.T(t, !ok)
+}
+
+func TestSnapshot(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/x", "a", store.Clobber)}
+	<-st.Seqns
+
+	b := make(bchan, 2)
+	c := &conn{
+		c:       b,
+		raccess: true,
+		st:      st,
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.snapshot()
+	assert.Equal(t, 4, len(<-b))
+	resp := mustUnmarshal(<-b)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+
+	got, rev, err := store.ReadSnapshot(bytes.NewReader(resp.Value))
+	assert.Equal(t, nil, err)
+	defer close(got.Ops)
+	assert.Equal(t, int64(1), rev)
+	assert.Equal(t, "a", store.GetString(got, "/x"))
+}
+
+func TestStat(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/d/a", "", store.Clobber)}
+	st.Ops <- store.Op{2, store.MustEncodeSet("/d/b", "", store.Clobber)}
+	st.Ops <- store.Op{3, store.MustEncodeSet("/f", "abc", store.Clobber)}
+	for <-st.Seqns < 3 {
+	}
+
+	for _, x := range []struct {
+		path  string
+		len   int32
+		rev   int64
+		flags int32
+	}{
+		{"/", 2, store.Dir, dir},
+		{"/d", 2, store.Dir, dir},
+		{"/f", 3, 3, 0},
+		{"/g", 0, store.Missing, 0},
+	} {
+		b := make(bchan, 2)
+		c := &conn{
+			c:       b,
+			raccess: true,
+			st:      st,
+		}
+		tx := &txn{
+			c:   c,
+			req: request{Tag: proto.Int32(1), Path: proto.String(x.path)},
+		}
+		tx.stat()
+		<-b
+		resp := mustUnmarshal(<-b)
+		assert.Equal(t, (*response_Err)(nil), resp.ErrCode, x.path)
+		assert.Equal(t, x.len, resp.GetLen(), x.path)
+		assert.Equal(t, x.rev, resp.GetRev(), x.path)
+		assert.Equal(t, x.flags, resp.GetFlags(), x.path)
+	}
+}
+
+func TestGetMinRev(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/x", "a", store.Clobber)}
+	for <-st.Seqns < 1 {
+	}
+
+	b := make(bchan, 2)
+	c := &conn{
+		c:       b,
+		raccess: true,
+		st:      st,
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1), Path: proto.String("/x"), MinRev: proto.Int64(2)},
+	}
+	go tx.get()
+
+	select {
+	case <-b:
+		t.Fatal("answered before reaching min_rev")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	st.Ops <- store.Op{2, store.MustEncodeSet("/x", "b", store.Clobber)}
+	<-b
+	resp := mustUnmarshal(<-b)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, "b", string(resp.Value))
+	assert.Equal(t, int64(2), resp.GetRev())
+}
+
+func TestGetMinRevBehind(t *testing.T) {
+	defer func(n int64) { MinRevWait = n }(MinRevWait)
+	MinRevWait = 1e6
+
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/x", "a", store.Clobber)}
+	for <-st.Seqns < 1 {
+	}
+
+	b := make(bchan, 2)
+	c := &conn{
+		c:       b,
+		raccess: true,
+		st:      st,
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1), Path: proto.String("/x"), MinRev: proto.Int64(5)},
+	}
+	tx.get()
+	<-b
+	resp := mustUnmarshal(<-b)
+	assert.Equal(t, response_BEHIND, resp.GetErrCode())
+}
+
+func TestGetMaxStaleness(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/x", "a", store.Clobber)}
+	for <-st.Seqns < 1 {
+	}
+
+	var h Health
+	get := func() chan []byte {
+		b := make(bchan, 2)
+		c := &conn{
+			c:       b,
+			raccess: true,
+			st:      st,
+			health:  func() Health { return h },
+		}
+		tx := &txn{
+			c:   c,
+			req: request{Tag: proto.Int32(1), Path: proto.String("/x"), MaxStaleness: proto.Int64(1e9)},
+		}
+		tx.get()
+		return b
+	}
+
+	// Fresh enough, so answered here even though the cluster is ahead.
+	h = Health{Rev: 1, Latest: 2, Staleness: 5e8}
+	b := get()
+	<-b
+	resp := mustUnmarshal(<-b)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, "a", string(resp.Value))
+
+	// Too stale, so it waits for the cluster's latest revision.
+	h = Health{Rev: 1, Latest: 2, Staleness: 2e9}
+	b = get()
+	select {
+	case <-b:
+		t.Fatal("answered from stale store")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	st.Ops <- store.Op{2, store.MustEncodeSet("/x", "b", store.Clobber)}
+	<-b
+	resp = mustUnmarshal(<-b)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, "b", string(resp.Value))
+}
+
+func getAll(st *store.Store, req request) *response {
+	b := make(bchan, 2)
+	c := &conn{
+		c:       b,
+		raccess: true,
+		st:      st,
+	}
+	req.Tag = proto.Int32(1)
+	tx := &txn{c: c, req: req}
+	tx.getAll()
+	<-b
+	return mustUnmarshal(<-b)
+}
+
+func TestGetAll(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/a", "1", store.Clobber)}
+	st.Ops <- store.Op{2, store.MustEncodeSet("/b", "2", store.Clobber)}
+	st.Ops <- store.Op{3, store.MustEncodeSet("/a", "3", store.Clobber)}
+	st.Ops <- store.Op{4, store.MustEncodeSet("/d/x", "", store.Clobber)}
+	for <-st.Seqns < 4 {
+	}
+
+	paths := []string{"/a", "/b", "/c"}
+	resp := getAll(st, request{Paths: paths})
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, int64(4), resp.GetRev())
+	assert.Equal(t, paths, resp.Names)
+	assert.Equal(t, []int64{3, 2, 0}, resp.Revs)
+	assert.Equal(t, 3, len(resp.Values))
+	assert.Equal(t, "3", string(resp.Values[0]))
+	assert.Equal(t, "2", string(resp.Values[1]))
+	assert.Equal(t, "", string(resp.Values[2]))
+
+	resp = getAll(st, request{Paths: paths, Rev: proto.Int64(2)})
+	assert.Equal(t, int64(2), resp.GetRev())
+	assert.Equal(t, []int64{1, 2, 0}, resp.Revs)
+	assert.Equal(t, "1", string(resp.Values[0]))
+
+	resp = getAll(st, request{Paths: []string{"/a", "/d"}})
+	assert.Equal(t, response_ISDIR, resp.GetErrCode())
+	assert.Equal(t, "/d", resp.GetErrDetail())
+	assert.Equal(t, []string(nil), resp.Names)
+}
+
+func TestGetAllConsistent(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+
+	// Each change sets both files to the same value at once.
+	const n = 200
+	go func() {
+		for i := int64(1); i <= n; i++ {
+			v := strconv.FormatInt(i, 10)
+			mut, err := store.EncodeTxn(
+				store.MustEncodeSet("/cfg/host", v, store.Clobber),
+				store.MustEncodeSet("/cfg/port", v, store.Clobber),
+			)
+			if err != nil {
+				panic(err)
+			}
+			st.Ops <- store.Op{i, mut}
+		}
+	}()
+
+	for {
+		resp := getAll(st, request{Paths: []string{"/cfg/host", "/cfg/port"}})
+		assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+		assert.Equal(t, string(resp.Values[0]), string(resp.Values[1]), resp.GetRev())
+		if resp.GetRev() == n {
+			break
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	b := make(bchan, 2)
+	c := &conn{
+		c: b,
+		health: func() Health {
+			return Health{Role: "member", Rev: 7, Latest: 9, CaughtUp: true, Uptime: 3e9}
+		},
+	}
+	tx := &txn{
+		c:   c,
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.health()
+	assert.Equal(t, 4, len(<-b))
+	resp := mustUnmarshal(<-b)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, int64(7), *resp.Rev)
+
+	var h Health
+	assert.Equal(t, nil, json.Unmarshal(resp.Value, &h))
+	assert.Equal(t, Health{"member", 7, 9, true, 0, 3e9}, h)
+}
+
+func TestHealthMissing(t *testing.T) {
+	b := make(bchan, 2)
+	tx := &txn{
+		c:   &conn{c: b},
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.health()
+	assert.Equal(t, 4, len(<-b))
+	resp := mustUnmarshal(<-b)
+	assert.Equal(t, response_OTHER, *resp.ErrCode)
+}
+
+func TestMembers(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/ctl/cal/0", "a", store.Missing)}
+	st.Ops <- store.Op{2, store.MustEncodeSet("/ctl/node/a/addr", "1.2.3.4:5", store.Clobber)}
+	st.Ops <- store.Op{3, store.MustEncodeSet("/ctl/node/r/role", "replica", store.Clobber)}
+	for <-st.Seqns < 3 {
+	}
+
+	b := make(bchan, 2)
+	tx := &txn{
+		c:   &conn{c: b, raccess: true, st: st},
+		req: request{Tag: proto.Int32(1)},
+	}
+	tx.members()
+	<-b
+	resp := mustUnmarshal(<-b)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, int64(3), resp.GetRev())
+
+	var ms []member.Member
+	assert.Equal(t, nil, json.Unmarshal(resp.Value, &ms))
+	exp := []member.Member{
+		{ID: "a", Addr: "1.2.3.4:5", Role: "member"},
+		{ID: "r", Role: "replica"},
+	}
+	assert.Equal(t, exp, ms)
+}
+
+func TestFetchSnapshot(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/x", "a", store.Clobber)}
+	<-st.Seqns
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	defer l.Close()
+	go ListenAndServe(l, nil, st, nil, "rw", "ro", "a")
+
+	var buf bytes.Buffer
+	err = FetchSnapshot(l.Addr().String(), "", nil, &buf)
+	assert.NotEqual(t, nil, err)
+
+	buf.Reset()
+	err = FetchSnapshot(l.Addr().String(), "ro", nil, &buf)
+	assert.Equal(t, nil, err)
+	got, rev, err := store.ReadSnapshot(&buf)
+	assert.Equal(t, nil, err)
+	defer close(got.Ops)
+	assert.Equal(t, int64(1), rev)
+	assert.Equal(t, "a", store.GetString(got, "/x"))
+}
+
+func TestFetchSnapshotChunks(t *testing.T) {
+	defer func(n int) { SnapshotChunk = n }(SnapshotChunk)
+	SnapshotChunk = 7
+
+	st := store.New()
+	defer close(st.Ops)
+	v := strings.Repeat("abc", 100)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/x", v, store.Clobber)}
+	<-st.Seqns
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	defer l.Close()
+	go ListenAndServe(l, nil, st, nil, "", "", "a")
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	assert.Equal(t, nil, err)
+	defer c.Close()
+	r := &request{Tag: proto.Int32(1), Verb: request_SNAPSHOT.Enum(), Stream: proto.Bool(true)}
+	assert.Equal(t, nil, writeReq(c, r))
+	var buf bytes.Buffer
+	frames := 0
+	for {
+		resp, err := readResp(c)
+		assert.Equal(t, nil, err)
+		assert.T(t, len(resp.Value) <= SnapshotChunk)
+		buf.Write(resp.Value)
+		frames++
+		if resp.GetFlags()&more == 0 {
+			break
+		}
+	}
+	assert.T(t, frames > 1)
+
+	got, rev, err := store.ReadSnapshot(&buf)
+	assert.Equal(t, nil, err)
+	defer close(got.Ops)
+	assert.Equal(t, int64(1), rev)
+	assert.Equal(t, v, store.GetString(got, "/x"))
+}
+
+func TestFetchSnapshotFrameLimit(t *testing.T) {
+	defer func(n int32) { MaxFetchFrame = n }(MaxFetchFrame)
+	MaxFetchFrame = 10
+
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/x", strings.Repeat("a", 100), store.Clobber)}
+	<-st.Seqns
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	defer l.Close()
+	go ListenAndServe(l, nil, st, nil, "", "", "a")
+
+	var buf bytes.Buffer
+	err = FetchSnapshot(l.Addr().String(), "", nil, &buf)
+	assert.Equal(t, errFrameTooBig, err)
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestRequestCounts(t *testing.T) {
+	before := Requests()["REV"]
+	st := store.New()
+	defer close(st.Ops)
+	c := &conn{c: &bytes.Buffer{}, st: st}
+	tx := &txn{c: c, req: request{Verb: request_REV.Enum()}}
+	tx.run()
+	tx.run()
+	assert.Equal(t, before+2, Requests()["REV"])
+
+	// an unknown verb isn't counted
+	n := len(Requests())
+	tx = &txn{c: c, req: request{Verb: request_Verb(4).Enum()}}
+	tx.run()
+	assert.Equal(t, n, len(Requests()))
+}
+
+// Proposes nothing until told to.
+type gatedProposer struct {
+	gate chan bool
+	p    consensus.Proposer
+}
+
+func (gp *gatedProposer) Propose(v []byte) store.Event {
+	<-gp.gate
+	return gp.p.Propose(v)
+}
+
+func startServer(st *store.Store, p consensus.Proposer) (*Server, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	canWrite := make(chan bool, 1)
+	canWrite <- true
+	s := NewServer(l, canWrite, st, p, "", "", "a")
+	go s.Serve()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	return s, c
+}
+
+// Waits until the server has read n requests it hasn't answered.
+func waitPending(s *Server, n int64) {
+	for {
+		s.mu.Lock()
+		var m int64
+		for c := range s.conns {
+			m += atomic.LoadInt64(&c.pending)
+		}
+		s.mu.Unlock()
+		if m == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func shutdownBg(s *Server, timeout int64) (done chan bool) {
+	done = make(chan bool)
+	go func() {
+		s.Shutdown(timeout)
+		close(done)
+	}()
+	for !s.quitting() {
+		time.Sleep(time.Millisecond)
+	}
+	return done
+}
+
+func assertClosed(t *testing.T, c net.Conn) {
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := c.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestBadGlob(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s, c := startServer(st, nil)
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	for _, pat := range []string{"/a/[", "/a/***/b"} {
+		for i, v := range []request_Verb{request_WALK, request_WAIT} {
+			writeRequest(c, &request{
+				Tag:    proto.Int32(int32(i)),
+				Verb:   v.Enum(),
+				Path:   proto.String(pat),
+				Rev:    proto.Int64(1),
+				Offset: proto.Int32(0),
+			})
+			resp := readResponse(c)
+			assert.Equal(t, response_BAD_GLOB, resp.GetErrCode(), v, pat)
+			assert.Equal(t, pat, resp.GetErrDetail(), v, pat)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/d/a", "1", store.Clobber)}
+	st.Ops <- store.Op{2, store.MustEncodeSet("/d/b/c", "22", store.Clobber)}
+	st.Ops <- store.Op{3, store.MustEncodeSet("/d/d", "3", store.Clobber)}
+	for <-st.Seqns < 3 {
+	}
+	s, c := startServer(st, nil)
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	scan := func(token *string) *response {
+		writeRequest(c, &request{
+			Tag:   proto.Int32(1),
+			Verb:  request_SCAN.Enum(),
+			Path:  proto.String("/d"),
+			Limit: proto.Int32(2),
+			Token: token,
+		})
+		return readResponse(c)
+	}
+
+	resp := scan(nil)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, []string{"/d/a", "/d/b/c"}, resp.Names)
+	assert.Equal(t, []int64{1, 2}, resp.Revs)
+	assert.Equal(t, []int32{1, 2}, resp.Lens)
+	assert.NotEqual(t, (*string)(nil), resp.Token)
+
+	st.Ops <- store.Op{4, store.MustEncodeSet("/d/c", "", store.Clobber)}
+	resp = scan(resp.Token)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, []string{"/d/d"}, resp.Names)
+	assert.Equal(t, (*string)(nil), resp.Token)
+
+	resp = scan(proto.String("x"))
+	assert.Equal(t, response_OTHER, resp.GetErrCode())
+	assert.Equal(t, store.ErrBadToken.Error(), resp.GetErrDetail())
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	fp := &test.FakeProposer{Store: st}
+	fp.Propose([]byte(store.MustEncodeSet("/lock", "me", store.Clobber)))
+	s, c := startServer(st, fp)
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	cad := func(path, value string) *response {
+		writeRequest(c, &request{
+			Tag:   proto.Int32(1),
+			Verb:  request_CAD.Enum(),
+			Path:  proto.String(path),
+			Value: []byte(value),
+		})
+		return readResponse(c)
+	}
+
+	resp := cad("/lock", "you")
+	assert.Equal(t, response_VALUE_MISMATCH, resp.GetErrCode())
+	v, rev := st.Get("/lock")
+	assert.Equal(t, []string{"me"}, v)
+	assert.Equal(t, int64(1), rev)
+
+	resp = cad("/lock", "me")
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, int64(3), resp.GetRev()) // the mismatch took rev 2
+	_, rev = st.Get("/lock")
+	assert.Equal(t, store.Missing, rev)
+
+	resp = cad("/lock", "me")
+	assert.Equal(t, response_NOENT, resp.GetErrCode())
+}
+
+func TestQuota(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	fp := &test.FakeProposer{Store: st}
+	fp.Propose([]byte(store.MustEncodeSet(store.QuotaDir+"/q", "/q/* 1", store.Clobber)))
+	fp.Propose([]byte(store.MustEncodeSet("/q/a/1", "", store.Clobber)))
+	s, c := startServer(st, fp)
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	set := func(path string) *response {
+		writeRequest(c, &request{
+			Tag:   proto.Int32(1),
+			Verb:  request_SET.Enum(),
+			Path:  proto.String(path),
+			Rev:   proto.Int64(store.Clobber),
+			Value: []byte("x"),
+		})
+		return readResponse(c)
+	}
+
+	resp := set("/q/a/2")
+	assert.Equal(t, response_QUOTA_EXCEEDED, resp.GetErrCode())
+	assert.Equal(t, "/q/a", resp.GetErrDetail())
+
+	resp = set("/q/a/1")
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+}
+
+func TestOpID(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	fp := &test.FakeProposer{Store: st}
+	s1, c1 := startServer(st, fp)
+	defer s1.Shutdown(0)
+	defer c1.Close()
+	s2, c2 := startServer(st, fp) // as if another node
+	defer s2.Shutdown(0)
+	defer c2.Close()
+
+	do := func(c net.Conn, req *request) *response {
+		req.Tag = proto.Int32(1)
+		writeRequest(c, req)
+		return readResponse(c)
+	}
+	incr := &request{
+		Verb:  request_INCR.Enum(),
+		Path:  proto.String("/n"),
+		Delta: proto.Int64(1),
+		OpId:  proto.String("i1"),
+	}
+	appnd := &request{
+		Verb:  request_APPEND.Enum(),
+		Path:  proto.String("/log"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte("x"),
+		OpId:  proto.String("a1"),
+	}
+
+	resp := do(c1, incr)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, "1", string(resp.Value))
+	rev := resp.GetRev()
+
+	// A retry, to either server, gets the first answer.
+	for _, c := range []net.Conn{c1, c2} {
+		resp = do(c, incr)
+		assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+		assert.Equal(t, "1", string(resp.Value))
+		assert.Equal(t, rev, resp.GetRev())
+	}
+	v, _ := st.Get("/n")
+	assert.Equal(t, []string{"1"}, v)
+
+	resp = do(c1, appnd)
+	rev = resp.GetRev()
+	resp = do(c2, appnd)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, rev, resp.GetRev())
+	v, _ = st.Get("/log")
+	assert.Equal(t, []string{"x"}, v)
+
+	// A new ID is a new write.
+	incr.OpId = proto.String("i2")
+	assert.Equal(t, "2", string(do(c2, incr).Value))
+
+	incr.OpId = proto.String("a b")
+	assert.Equal(t, response_OTHER, do(c1, incr).GetErrCode())
+}
+
+func TestShutdownFinishesRequest(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	gp := &gatedProposer{make(chan bool), &test.FakeProposer{Store: st}}
+	s, c := startServer(st, gp)
+	defer c.Close()
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(1),
+		Verb:  request_SET.Enum(),
+		Path:  proto.String("/x"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte("a"),
+	})
+	waitPending(s, 1)
+	done := shutdownBg(s, 10e9)
+
+	_, err := net.Dial("tcp", s.l.Addr().String())
+	assert.NotEqual(t, nil, err)
+
+	gp.gate <- true
+	resp := readResponse(c)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, int64(1), resp.GetRev())
+	assertClosed(t, c)
+	<-done
+}
+
+func TestShutdownEndsWait(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s, c := startServer(st, nil)
+	defer c.Close()
+
+	writeRequest(c, &request{
+		Tag:  proto.Int32(1),
+		Verb: request_WAIT.Enum(),
+		Path: proto.String("/x"),
+		Rev:  proto.Int64(1),
+	})
+	waitPending(s, 1)
+	done := shutdownBg(s, 10e9)
+
+	resp := readResponse(c)
+	assert.Equal(t, response_OTHER, resp.GetErrCode())
+	assert.Equal(t, errShutdown, resp.GetErrDetail())
+	assertClosed(t, c)
+	<-done
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	gp := &gatedProposer{make(chan bool), &test.FakeProposer{Store: st}}
+	s, c := startServer(st, gp)
+	defer c.Close()
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(1),
+		Verb:  request_SET.Enum(),
+		Path:  proto.String("/x"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte("a"),
+	})
+	waitPending(s, 1)
+	done := shutdownBg(s, 50e6)
+
+	assertClosed(t, c)
+	<-done
+	close(gp.gate)
+}
+
+// A directory, /d, of n files, without the cost of making them in a
+// store.
+type bigDir int
+
+func (n bigDir) Get(path string) ([]string, int64) {
+	if path != "/d" {
+		return []string{""}, 1
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = strconv.Itoa(i)
+	}
+	return names, store.Dir
+}
+
+func (n bigDir) Stat(path string) (int32, int64) {
+	return 1, 1
+}
+
+// Reads the responses to a streamed request, and returns their names.
+func readChunks(t *testing.T, r io.Reader) (names []string) {
+	for {
+		resp := readResponse(r)
+		assert.T(t, len(resp.Names) <= DirChunk, len(resp.Names))
+		names = append(names, resp.Names...)
+		if resp.GetFlags()&more == 0 {
+			return names
+		}
+		assert.Equal(t, DirChunk, len(resp.Names))
+	}
+}
+
+func TestGetdirStream(t *testing.T) {
+	const n = 200000
+	buf := &bytes.Buffer{}
+	tx := &txn{
+		c: &conn{c: buf},
+		req: request{
+			Tag:    proto.Int32(1),
+			Path:   proto.String("/d"),
+			Offset: proto.Int32(0),
+			Limit:  proto.Int32(-1),
+			Stream: proto.Bool(true),
+		},
+	}
+	tx.getdirRange(bigDir(n))
+	names := readChunks(t, buf)
+	assert.Equal(t, n, len(names))
+	assert.T(t, sort.StringsAreSorted(names))
+	assert.Equal(t, 0, buf.Len())
+
+	tx.req.Stream = nil
+	tx.getdirRange(bigDir(n))
+	resp := readResponse(buf)
+	assert.Equal(t, int32(0), resp.GetFlags())
+	assert.Equal(t, n, len(resp.Names))
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestGetdirStatStream(t *testing.T) {
+	const n = 200000
+	buf := &bytes.Buffer{}
+	tx := &txn{
+		c: &conn{c: buf},
+		req: request{
+			Tag:    proto.Int32(1),
+			Path:   proto.String("/d"),
+			Stream: proto.Bool(true),
+		},
+	}
+	tx.getdirStatOf(bigDir(n))
+	names := readChunks(t, buf)
+	assert.Equal(t, n, len(names))
+	assert.T(t, sort.StringsAreSorted(names))
+
+	// A small directory fits in one response.
+	tx.getdirStatOf(bigDir(3))
+	resp := readResponse(buf)
+	assert.Equal(t, int32(0), resp.GetFlags())
+	assert.Equal(t, []string{"0", "1", "2"}, resp.Names)
+	assert.Equal(t, []int64{1, 1, 1}, resp.Revs)
+
+	tx.req.Path = proto.String("/x")
+	tx.getdirStatOf(bigDir(n))
+	resp = readResponse(buf)
+	assert.Equal(t, int32(0), resp.GetFlags())
+	assert.Equal(t, response_NOTDIR, resp.GetErrCode())
+}
+
+func TestContentType(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	fp := &test.FakeProposer{Store: st}
+	s, c := startServer(st, fp)
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	set := func(ct *string, ttl *int64) *response {
+		writeRequest(c, &request{
+			Tag:         proto.Int32(1),
+			Verb:        request_SET.Enum(),
+			Path:        proto.String("/x"),
+			Rev:         proto.Int64(store.Clobber),
+			Value:       []byte(`{"a":1}`),
+			ContentType: ct,
+			Ttl:         ttl,
+		})
+		return readResponse(c)
+	}
+	get := func() *response {
+		writeRequest(c, &request{
+			Tag:  proto.Int32(1),
+			Verb: request_GET.Enum(),
+			Path: proto.String("/x"),
+		})
+		return readResponse(c)
+	}
+
+	resp := set(proto.String("application/json"), nil)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	resp = get()
+	assert.Equal(t, `{"a":1}`, string(resp.Value))
+	assert.Equal(t, "application/json", resp.GetContentType())
+
+	resp = set(nil, nil)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, (*string)(nil), get().ContentType)
+
+	resp = set(proto.String("text/plain"), proto.Int64(60e9))
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, "text/plain", get().GetContentType())
+	_, rev := st.Get(store.TTLPath("/x"))
+	assert.Equal(t, resp.GetRev(), rev)
+
+	writeRequest(c, &request{
+		Tag:         proto.Int32(1),
+		Verb:        request_SET.Enum(),
+		Path:        proto.String("/x"),
+		Rev:         proto.Int64(1),
+		ContentType: proto.String("text/plain"),
+	})
+	assert.Equal(t, response_REV_MISMATCH, readResponse(c).GetErrCode())
+}
+
+func TestServePipe(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	l := test.NewPipeListener("127.0.0.1:8046")
+	canWrite := make(chan bool, 1)
+	canWrite <- true
+	s := NewServer(l, canWrite, st, &test.FakeProposer{Store: st}, "", "", "a")
+	go s.Serve()
+	defer s.Shutdown(10e9)
+
+	c, err := l.Dial()
+	assert.Equal(t, nil, err)
+	defer c.Close()
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(1),
+		Verb:  request_SET.Enum(),
+		Path:  proto.String("/x"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte("a"),
+	})
+	resp := readResponse(c)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, int64(1), resp.GetRev())
+
+	writeRequest(c, &request{
+		Tag:  proto.Int32(2),
+		Verb: request_GET.Enum(),
+		Path: proto.String("/x"),
+	})
+	resp = readResponse(c)
+	assert.Equal(t, []byte("a"), resp.Value)
+	assert.Equal(t, int64(1), resp.GetRev())
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/member"
+	"github.com/madebymany/doozerd/store"
+	"strconv"
+	"sync/atomic"
+)
+
+var sessionCount int64
+
+// Sets the file for a SET with session set, recording it under
+// member.SessionDir in the same mutation so that it is deleted when
+// the connection closes, or, if this node goes away first, when the
+// cluster notices.
+func (t *txn) setSession() {
+	if t.req.Ttl != nil {
+		t.resp.ErrDetail = proto.String("a session set can't have a ttl")
+		t.respondErrCode(response_OTHER)
+		return
+	}
+
+	c := t.c
+	if c.sid == "" {
+		c.sid = strconv.FormatInt(atomic.AddInt64(&sessionCount, 1), 10)
+	}
+
+	var tx store.Txn
+	err := tx.Set(*t.req.Path, string(t.req.Value), *t.req.Rev)
+	if err == nil && t.req.GetContentType() != "" {
+		err = tx.SetType(*t.req.Path, *t.req.ContentType)
+	}
+	if err == nil {
+		err = tx.Set(member.SessionPath(c.self, c.sid, *t.req.Path), "", store.Clobber)
+	}
+	if err != nil {
+		t.respondOsError(err)
+		return
+	}
+
+	c.sets.Add(1)
+	go func() {
+		defer c.sets.Done()
+		ev := consensus.Txn(t.proposer(), &tx)
+		if ev.Err != nil {
+			t.respondOsError(ev.Err)
+			return
+		}
+		t.resp.Rev = &ev.Seqn
+		t.respond()
+	}()
+}
+
+// Deletes the files c's session set, if it has one.
+func (c *conn) endSession() {
+	if c.sid == "" {
+		return
+	}
+	c.sets.Wait()
+	_, g := c.st.Snap()
+	member.EndSession(c.p, g, c.self, c.sid)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/member"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"testing"
+)
+
+func sessionSetReq(path string) *request {
+	return &request{
+		Tag:     proto.Int32(1),
+		Verb:    request_SET.Enum(),
+		Path:    proto.String(path),
+		Rev:     proto.Int64(store.Clobber),
+		Value:   []byte("a"),
+		Session: proto.Bool(true),
+	}
+}
+
+func TestSessionEndsOnClose(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s, c := startServer(st, &test.FakeProposer{Store: st})
+	defer s.Shutdown(0)
+
+	writeRequest(c, sessionSetReq("/app/leader"))
+	resp := readResponse(c)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	writeRequest(c, &request{
+		Tag:   proto.Int32(1),
+		Verb:  request_SET.Enum(),
+		Path:  proto.String("/app/config"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte("b"),
+	})
+	readResponse(c)
+
+	v, rev := st.Get("/app/leader")
+	assert.Equal(t, []string{"a"}, v)
+	assert.Equal(t, resp.GetRev(), rev)
+	dirs := store.Getdir(st, member.SessionDir+"/a")
+	assert.Equal(t, 1, len(dirs))
+	_, rev = st.Get(member.SessionPath("a", dirs[0], "/app/leader"))
+	assert.Equal(t, resp.GetRev(), rev)
+
+	ch, err := st.Wait(store.MustCompileGlob("/app/leader"), resp.GetRev()+1)
+	assert.Equal(t, nil, err)
+	c.Close()
+	ev := <-ch
+	assert.T(t, ev.IsDel())
+
+	_, rev = st.Get("/app/config")
+	assert.NotEqual(t, store.Missing, rev)
+}
+
+func TestSessionTtl(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s, c := startServer(st, &test.FakeProposer{Store: st})
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	req := sessionSetReq("/app/leader")
+	req.Ttl = proto.Int64(1e9)
+	writeRequest(c, req)
+	assert.Equal(t, response_OTHER, readResponse(c).GetErrCode())
+}
+
+func TestSessionContentType(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s, c := startServer(st, &test.FakeProposer{Store: st})
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	req := sessionSetReq("/app/leader")
+	req.ContentType = proto.String("text/plain")
+	writeRequest(c, req)
+	resp := readResponse(c)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, "text/plain", store.GetType(st, "/app/leader"))
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// Finishes the TLS handshake, if nc is a TLS connection, within the
+// read timeout, and reports whether the client presented a certificate
+// the server verified, and the certificate's common name. A plaintext
+// client talking to a TLS listener fails here, and its connection is
+// closed without a response.
+func handshake(nc net.Conn) (verified bool, name string, err error) {
+	tc, ok := nc.(*tls.Conn)
+	if !ok {
+		return false, "", nil
+	}
+
+	if ReadTimeout > 0 {
+		tc.SetDeadline(time.Now().Add(time.Duration(ReadTimeout)))
+		defer tc.SetDeadline(time.Time{})
+	}
+	if err := tc.Handshake(); err != nil {
+		return false, "", err
+	}
+	cs := tc.ConnectionState()
+	if len(cs.VerifiedChains) == 0 {
+		return false, "", nil
+	}
+	return true, cs.PeerCertificates[0].Subject.CommonName, nil
+}
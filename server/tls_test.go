@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"code.google.com/p/goprotobuf/proto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// Makes a certificate for name, signed by parent, or self-signed if
+// parent is nil.
+func mustCert(name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	signer, signKey := tmpl, interface{}(key)
+	if parent != nil {
+		signer, signKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signKey)
+	if err != nil {
+		panic(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// Starts a server with rw secret "rw", listening with TLS, that
+// verifies client certificates signed by ca if they are given.
+func startTLSServer(st *store.Store, ca tls.Certificate) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	tc := &tls.Config{
+		Certificates: []tls.Certificate{mustCert("127.0.0.1", &ca)},
+		ClientCAs:    x509.NewCertPool(),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+	tc.ClientCAs.AddCert(ca.Leaf)
+	canWrite := make(chan bool, 1)
+	canWrite <- true
+	s := NewServer(tls.NewListener(l, tc), canWrite, st, &test.FakeProposer{Store: st}, "rw", "", "a")
+	go s.Serve()
+	return s
+}
+
+func dialTLS(s *Server, ca tls.Certificate, certs ...tls.Certificate) *tls.Conn {
+	tc := &tls.Config{RootCAs: x509.NewCertPool(), Certificates: certs}
+	tc.RootCAs.AddCert(ca.Leaf)
+	c, err := tls.Dial("tcp", s.l.Addr().String(), tc)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func setX(c net.Conn) *response {
+	writeRequest(c, &request{
+		Tag:   proto.Int32(1),
+		Verb:  request_SET.Enum(),
+		Path:  proto.String("/x"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte("a"),
+	})
+	return readResponse(c)
+}
+
+func TestTLSRejectsPlaintext(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s := startTLSServer(st, mustCert("ca", nil))
+	defer s.Shutdown(0)
+
+	c, err := net.Dial("tcp", s.l.Addr().String())
+	assert.Equal(t, nil, err)
+	defer c.Close()
+	writeRequest(c, &request{Tag: proto.Int32(1), Verb: request_REV.Enum()})
+
+	// The server gives up on the handshake and hangs up, perhaps
+	// after a TLS alert; it never answers the request.
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	buf, err := ioutil.ReadAll(c)
+	if e, ok := err.(net.Error); ok {
+		assert.T(t, !e.Timeout(), err)
+	}
+	assert.T(t, len(buf) == 0 || buf[0] == 0x15, buf) // 0x15 is an alert
+}
+
+func TestTLSClientCert(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	ca := mustCert("ca", nil)
+	s := startTLSServer(st, ca)
+	defer s.Shutdown(0)
+
+	c := dialTLS(s, ca, mustCert("client", &ca))
+	defer c.Close()
+	resp := setX(c)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, int64(1), resp.GetRev())
+}
+
+func TestTLSNoClientCert(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	ca := mustCert("ca", nil)
+	s := startTLSServer(st, ca)
+	defer s.Shutdown(0)
+
+	c := dialTLS(s, ca)
+	defer c.Close()
+	resp := setX(c)
+	assert.Equal(t, response_OTHER, resp.GetErrCode())
+	assert.Equal(t, "permission denied", resp.GetErrDetail())
+}
+
+func TestTLSClientCertIdentity(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	ca := mustCert("ca", nil)
+	s := startTLSServer(st, ca)
+	defer s.Shutdown(0)
+	s.p.Propose([]byte(store.MustEncodeSet("/ctl/acl/client/0", "/app/** SET", store.Clobber)))
+
+	c := dialTLS(s, ca, mustCert("client", &ca))
+	defer c.Close()
+	resp := setX(c)
+	assert.Equal(t, response_PERMISSION_DENIED, resp.GetErrCode())
+}
+
+func TestTLSFetchSnapshot(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	st.Ops <- store.Op{1, store.MustEncodeSet("/x", "a", store.Clobber)}
+	<-st.Seqns
+	ca := mustCert("ca", nil)
+	s := startTLSServer(st, ca)
+	defer s.Shutdown(0)
+
+	tc := &tls.Config{RootCAs: x509.NewCertPool()}
+	tc.RootCAs.AddCert(ca.Leaf)
+	var buf bytes.Buffer
+	err := FetchSnapshot(s.l.Addr().String(), "rw", tc, &buf)
+	assert.Equal(t, nil, err)
+	got, rev, err := store.ReadSnapshot(&buf)
+	assert.Equal(t, nil, err)
+	defer close(got.Ops)
+	assert.Equal(t, int64(1), rev)
+	assert.Equal(t, "a", store.GetString(got, "/x"))
+
+	buf.Reset()
+	err = FetchSnapshot(s.l.Addr().String(), "rw", nil, &buf)
+	assert.NotEqual(t, nil, err)
+}
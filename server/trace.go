@@ -0,0 +1,47 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/logging"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Trace IDs made here are this prefix, which is random so that two
+// servers are unlikely to make the same ones, then a count.
+var (
+	tracePrefix = randHex(4)
+	traceCount  int64
+)
+
+func randHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func newTrace() string {
+	n := atomic.AddInt64(&traceCount, 1)
+	return tracePrefix + "-" + strconv.FormatInt(n, 36)
+}
+
+// Returns the proposer for t's changes, which marks each of them with
+// t's trace ID so that every node logs the ID when it learns the
+// change, and logs the ID here first. A write with an op_id is made
+// at most once, however often the client sends it.
+func (t *txn) proposer() consensus.Proposer {
+	p := t.c.p
+	if t.trace != "" {
+		logging.Debug("propose", "trace", t.trace, "verb", t.req.GetVerb(), "path", t.req.GetPath())
+		p = consensus.Traced(p, t.trace)
+	}
+	if id := t.req.GetOpId(); id != "" && writes[int32(t.req.GetVerb())] {
+		p = consensus.Once(p, id, time.Now().UnixNano()+OpWindow)
+	}
+	return p
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/logging"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTraceRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	logging.SetLevel(logging.LevelDebug)
+	defer logging.SetLevel(logging.LevelInfo)
+
+	st := store.New()
+	defer close(st.Ops)
+	s, c := startServer(st, &test.FakeProposer{Store: st})
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(1),
+		Verb:  request_SET.Enum(),
+		Path:  proto.String("/x"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte("a"),
+		Trace: proto.String("abc"),
+	})
+	resp := readResponse(c)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, "abc", resp.GetTrace())
+	assert.T(t, strings.Contains(buf.String(), `trace=abc verb=SET path=/x`), buf.String())
+
+	ch, err := st.Wait(store.Any, resp.GetRev())
+	assert.Equal(t, nil, err)
+	id, ok := store.TraceID((<-ch).Mut)
+	assert.T(t, ok)
+	assert.Equal(t, "abc", id)
+}
+
+func TestTraceMadeUp(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s, c := startServer(st, &test.FakeProposer{Store: st})
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	writeRequest(c, &request{Tag: proto.Int32(1), Verb: request_REV.Enum()})
+	a := readResponse(c).GetTrace()
+	writeRequest(c, &request{Tag: proto.Int32(1), Verb: request_REV.Enum()})
+	b := readResponse(c).GetTrace()
+	assert.T(t, store.TraceRe.MatchString(a), a)
+	assert.T(t, store.TraceRe.MatchString(b), b)
+	assert.NotEqual(t, a, b)
+}
+
+func TestTraceBad(t *testing.T) {
+	st := store.New()
+	defer close(st.Ops)
+	s, c := startServer(st, &test.FakeProposer{Store: st})
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(1),
+		Verb:  request_REV.Enum(),
+		Trace: proto.String("a b"),
+	})
+	resp := readResponse(c)
+	assert.Equal(t, response_OTHER, resp.GetErrCode())
+	assert.Equal(t, "bad trace id", resp.GetErrDetail())
+	assert.Equal(t, "", resp.GetTrace())
+}
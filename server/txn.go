@@ -1,33 +1,74 @@
 package server
 
 import (
+	"bytes"
 	"code.google.com/p/goprotobuf/proto"
+	"fmt"
 	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/store"
 	"io"
-	"log"
 	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 type txn struct {
-	c    *conn
-	req  request
-	resp response
+	c     *conn
+	req   request
+	resp  response
+	trace string // given by the client, or made up for it
 }
 
 var ops = map[int32]func(*txn){
-	int32(request_DEL):    (*txn).del,
-	int32(request_GET):    (*txn).get,
-	int32(request_GETDIR): (*txn).getdir,
-	int32(request_NOP):    (*txn).nop,
-	int32(request_REV):    (*txn).rev,
-	int32(request_SET):    (*txn).set,
-	int32(request_STAT):   (*txn).stat,
-	int32(request_SELF):   (*txn).self,
-	int32(request_WAIT):   (*txn).wait,
-	int32(request_WALK):   (*txn).walk,
-	int32(request_ACCESS): (*txn).access,
+	int32(request_APPEND):     (*txn).append,
+	int32(request_CAD):        (*txn).cad,
+	int32(request_CANCEL):     (*txn).cancel,
+	int32(request_DEL):        (*txn).del,
+	int32(request_GET):        (*txn).get,
+	int32(request_GETDIR):     (*txn).getdir,
+	int32(request_GETALL):     (*txn).getAll,
+	int32(request_GETDIRSTAT): (*txn).getdirStat,
+	int32(request_HEALTH):     (*txn).health,
+	int32(request_HISTORY):    (*txn).history,
+	int32(request_INCR):       (*txn).incr,
+	int32(request_MEMBERS):    (*txn).members,
+	int32(request_NOP):        (*txn).nop,
+	int32(request_PING):       (*txn).ping,
+	int32(request_REFRESH):    (*txn).refresh,
+	int32(request_REV):        (*txn).rev,
+	int32(request_SCAN):       (*txn).scan,
+	int32(request_SET):        (*txn).set,
+	int32(request_SNAPSHOT):   (*txn).snapshot,
+	int32(request_STAT):       (*txn).stat,
+	int32(request_SYNC):       (*txn).sync,
+	int32(request_SELF):       (*txn).self,
+	int32(request_WAIT):       (*txn).wait,
+	int32(request_WALK):       (*txn).walk,
+	int32(request_ACCESS):     (*txn).access,
+}
+
+// Files under these directories, and the file WatchesFile, are not in
+// the store; they report on this node, and can't be written.
+var virtualDirs = []string{"/ctl/limits/", "/ctl/stats/"}
+
+// WatchesFile lists the glob patterns watched on this node, a line for
+// each: the number of watches and waits on it, the number of events
+// sent to them, and the pattern, separated by spaces. The patterns
+// with the most watches come first.
+const WatchesFile = "/ctl/watches"
+
+// verbs that write to the file at the request's path
+var writes = map[int32]bool{
+	int32(request_APPEND):  true,
+	int32(request_CAD):     true,
+	int32(request_DEL):     true,
+	int32(request_INCR):    true,
+	int32(request_REFRESH): true,
+	int32(request_SET):     true,
 }
 
 // response flags
@@ -36,10 +77,37 @@ const (
 	_
 	set
 	del
+	dir
+	more
 )
 
+// DirChunk is the most entries in each response to a GETDIR or
+// GETDIRSTAT that asks for them to be streamed.
+var DirChunk = 1000
+
+// SnapshotChunk is the most bytes in each response to a SNAPSHOT that
+// asks for it to be streamed.
+var SnapshotChunk = 64 << 10
+
 func (t *txn) run() {
 	verb := int32(t.req.GetVerb())
+	countRequest(verb)
+	if t.req.Trace == nil {
+		t.trace = newTrace()
+	} else if t.trace = t.req.GetTrace(); !store.TraceRe.MatchString(t.trace) {
+		t.trace = ""
+		t.respondOsError(store.ErrBadTrace)
+		return
+	}
+	if t.req.OpId != nil && !store.OpIDRe.MatchString(t.req.GetOpId()) {
+		t.respondOsError(store.ErrBadOpID)
+		return
+	}
+	if writes[verb] && IsVirtual(t.req.GetPath()) {
+		t.respondErrCode(response_READONLY)
+		return
+	}
+
 	if f, ok := ops[verb]; ok {
 		f(t)
 	} else {
@@ -47,6 +115,52 @@ func (t *txn) run() {
 	}
 }
 
+// IsVirtual reports whether path is one of this node's virtual files.
+func IsVirtual(path string) bool {
+	if path == WatchesFile {
+		return true
+	}
+	for _, dir := range virtualDirs {
+		if strings.HasPrefix(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the contents of the virtual file at path, if there is one.
+func (t *txn) virtual(path string) (string, bool) {
+	if !IsVirtual(path) {
+		return "", false
+	}
+
+	switch path {
+	case "/ctl/limits/maxvalue":
+		return strconv.Itoa(t.c.st.MaxValueLen), true
+	case WatchesFile:
+		var b bytes.Buffer
+		for _, p := range t.c.st.WatchStats() {
+			fmt.Fprintf(&b, "%d %d %s\n", p.Watches, p.Events, p.Pattern)
+		}
+		return b.String(), true
+	}
+
+	s := t.c.st.Stats()
+	switch path {
+	case "/ctl/stats/nodes":
+		return strconv.Itoa(s.Nodes), true
+	case "/ctl/stats/depth":
+		return strconv.Itoa(s.MaxDepth), true
+	case "/ctl/stats/rev":
+		return strconv.FormatInt(s.Rev, 10), true
+	case "/ctl/stats/watches":
+		return strconv.Itoa(s.Watches), true
+	case "/ctl/stats/waiters":
+		return strconv.Itoa(s.Waiters), true
+	}
+	return "", false
+}
+
 func (t *txn) get() {
 	if !t.c.raccess {
 		t.respondOsError(syscall.EACCES)
@@ -58,6 +172,14 @@ func (t *txn) get() {
 		return
 	}
 
+	if v, ok := t.virtual(*t.req.Path); ok {
+		rev := <-t.c.st.Seqns
+		t.resp.Rev = &rev
+		t.resp.Value = []byte(v)
+		t.respond()
+		return
+	}
+
 	go func() {
 		g, err := t.getter()
 		if err != nil {
@@ -75,6 +197,9 @@ func (t *txn) get() {
 		if len(v) == 1 { // not missing
 			t.resp.Value = []byte(v[0])
 		}
+		if ct := store.GetType(g, *t.req.Path); ct != "" {
+			t.resp.ContentType = &ct
+		}
 		t.respond()
 	}()
 }
@@ -95,8 +220,95 @@ func (t *txn) set() {
 		return
 	}
 
+	if !t.c.permitted(t.req.GetVerb(), *t.req.Path) {
+		t.respondErrCode(response_PERMISSION_DENIED)
+		return
+	}
+
+	if len(t.req.Value) > t.c.st.MaxValueLen {
+		t.respondOsError(store.ErrValueTooLong)
+		return
+	}
+
+	if err := Validate(*t.req.Path, t.req.Value); err != nil {
+		t.respondOsError(err)
+		return
+	}
+
+	if t.req.GetSession() {
+		t.setSession()
+		return
+	}
+
 	go func() {
-		ev := consensus.Set(t.c.p, *t.req.Path, t.req.Value, *t.req.Rev)
+		var ev store.Event
+		switch {
+		case t.req.GetContentType() != "":
+			ev = t.setTyped()
+		case t.req.Ttl != nil:
+			deadline := time.Now().UnixNano() + *t.req.Ttl
+			ev = consensus.SetTTL(t.proposer(), *t.req.Path, t.req.Value, *t.req.Rev, deadline)
+		default:
+			ev = consensus.Set(t.proposer(), *t.req.Path, t.req.Value, *t.req.Rev)
+		}
+		if ev.Err != nil {
+			t.respondOsError(ev.Err)
+			return
+		}
+		t.resp.Rev = &ev.Seqn
+		t.respond()
+	}()
+}
+
+// Sets the file for a SET with a content_type, recording the type, and
+// the deadline if there is a ttl, in the same mutation.
+func (t *txn) setTyped() store.Event {
+	var tx store.Txn
+	path := *t.req.Path
+	err := tx.Set(path, string(t.req.Value), *t.req.Rev)
+	if err == nil && t.req.Ttl != nil {
+		err = tx.Expire(path, time.Now().UnixNano()+*t.req.Ttl)
+	}
+	if err == nil {
+		err = tx.SetType(path, *t.req.ContentType)
+	}
+	if err != nil {
+		return store.Event{Err: err}
+	}
+	return consensus.Txn(t.proposer(), &tx)
+}
+
+func (t *txn) append() {
+	if !t.c.waccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	if !t.c.canWrite {
+		t.respondErrCode(response_READONLY)
+		return
+	}
+
+	if t.req.Path == nil || t.req.Rev == nil {
+		t.respondErrCode(response_MISSING_ARG)
+		return
+	}
+
+	if !t.c.permitted(t.req.GetVerb(), *t.req.Path) {
+		t.respondErrCode(response_PERMISSION_DENIED)
+		return
+	}
+
+	go func() {
+		var ev store.Event
+		if validated(*t.req.Path) {
+			ev.Mut, ev.Err = store.EncodeAppend(*t.req.Path, string(t.req.Value), *t.req.Rev, t.c.st.MaxValueLen)
+			if ev.Err == nil {
+				ev = t.proposeValidated(*t.req.Path, ev.Mut, *t.req.Rev)
+			}
+		} else {
+			ev = consensus.Append(t.proposer(), *t.req.Path, t.req.Value, *t.req.Rev, t.c.st.MaxValueLen)
+		}
 		if ev.Err != nil {
 			t.respondOsError(ev.Err)
 			return
@@ -122,8 +334,144 @@ func (t *txn) del() {
 		return
 	}
 
+	if !t.c.permitted(t.req.GetVerb(), *t.req.Path) {
+		t.respondErrCode(response_PERMISSION_DENIED)
+		return
+	}
+
 	go func() {
-		ev := consensus.Del(t.c.p, *t.req.Path, *t.req.Rev)
+		ev := consensus.Del(t.proposer(), *t.req.Path, *t.req.Rev)
+		if ev.Err != nil {
+			t.respondOsError(ev.Err)
+			return
+		}
+		t.respond()
+	}()
+}
+
+func (t *txn) cad() {
+	if !t.c.waccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	if !t.c.canWrite {
+		t.respondErrCode(response_READONLY)
+		return
+	}
+
+	if t.req.Path == nil {
+		t.respondErrCode(response_MISSING_ARG)
+		return
+	}
+
+	if !t.c.permitted(t.req.GetVerb(), *t.req.Path) {
+		t.respondErrCode(response_PERMISSION_DENIED)
+		return
+	}
+
+	go func() {
+		ev := consensus.CompareAndDelete(t.proposer(), *t.req.Path, t.req.Value)
+		if ev.Err != nil {
+			t.respondOsError(ev.Err)
+			return
+		}
+		t.resp.Rev = &ev.Seqn
+		t.respond()
+	}()
+}
+
+func (t *txn) incr() {
+	if !t.c.waccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	if !t.c.canWrite {
+		t.respondErrCode(response_READONLY)
+		return
+	}
+
+	if t.req.Path == nil || t.req.Delta == nil {
+		t.respondErrCode(response_MISSING_ARG)
+		return
+	}
+
+	if !t.c.permitted(t.req.GetVerb(), *t.req.Path) {
+		t.respondErrCode(response_PERMISSION_DENIED)
+		return
+	}
+
+	go func() {
+		var ev store.Event
+		if validated(*t.req.Path) {
+			ev.Mut, ev.Err = store.EncodeIncr(*t.req.Path, *t.req.Delta)
+			if ev.Err == nil {
+				ev = t.proposeValidated(*t.req.Path, ev.Mut, store.Clobber)
+			}
+		} else {
+			ev = consensus.Incr(t.proposer(), *t.req.Path, *t.req.Delta)
+		}
+		if ev.Err != nil {
+			t.respondOsError(ev.Err)
+			return
+		}
+		t.resp.Rev = &ev.Seqn
+		t.resp.Value = []byte(ev.Body)
+		t.respond()
+	}()
+}
+
+// Proposes mut, an APPEND or INCR of path, as the set it comes to, if
+// Validate passes the body that set would make. The set is conditional
+// on the file being unchanged since the body was worked out; if the
+// file has changed, the body is worked out and checked again. rev is
+// the request's revision, or Clobber.
+func (t *txn) proposeValidated(path, mut string, rev int64) store.Event {
+	for {
+		_, g := t.c.st.Snap()
+		_, cur := g.Get(path)
+		if rev != store.Clobber && rev < cur {
+			return store.Event{Err: store.ErrRevMismatch}
+		}
+		body, err := store.Result(g, mut)
+		if err == nil {
+			err = Validate(path, []byte(body))
+		}
+		if err != nil {
+			return store.Event{Err: err}
+		}
+		ev := consensus.Set(t.proposer(), path, []byte(body), cur)
+		if ev.Err != store.ErrRevMismatch {
+			return ev
+		}
+	}
+}
+
+func (t *txn) refresh() {
+	if !t.c.waccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	if !t.c.canWrite {
+		t.respondErrCode(response_READONLY)
+		return
+	}
+
+	if t.req.Path == nil || t.req.Ttl == nil {
+		t.respondErrCode(response_MISSING_ARG)
+		return
+	}
+
+	if !t.c.permitted(t.req.GetVerb(), *t.req.Path) {
+		t.respondErrCode(response_PERMISSION_DENIED)
+		return
+	}
+
+	go func() {
+		deadline := time.Now().UnixNano() + *t.req.Ttl
+		ev := consensus.Refresh(t.proposer(), *t.req.Path, deadline)
 		if ev.Err != nil {
 			t.respondOsError(ev.Err)
 			return
@@ -144,11 +492,95 @@ func (t *txn) nop() {
 	}
 
 	go func() {
-		t.c.p.Propose([]byte(store.Nop))
+		t.proposer().Propose([]byte(store.Nop))
+		t.respond()
+	}()
+}
+
+func (t *txn) sync() {
+	if !t.c.raccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	if !t.c.canWrite {
+		t.respondErrCode(response_READONLY)
+		return
+	}
+
+	go func() {
+		ev := consensus.Sync(t.proposer())
+		if ev.Err != nil {
+			t.respondOsError(ev.Err)
+			return
+		}
+		t.resp.Rev = &ev.Seqn
+		t.respond()
+	}()
+}
+
+func (t *txn) snapshot() {
+	if !t.c.raccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	go func() {
+		if t.req.GetStream() {
+			sw := &snapshotWriter{t: t, buf: make([]byte, 0, SnapshotChunk)}
+			if err := t.c.st.WriteSnapshot(0, sw); err != nil {
+				if !sw.gone {
+					t.respondOsError(err)
+				}
+				return
+			}
+			t.resp.Value = sw.buf
+			t.respond()
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := t.c.st.WriteSnapshot(0, &buf); err != nil {
+			t.respondOsError(err)
+			return
+		}
+		t.resp.Value = buf.Bytes()
 		t.respond()
 	}()
 }
 
+// Sends a snapshot, as it is written, in responses of SnapshotChunk
+// bytes, each flagged more. What is left when the snapshot is done goes
+// in t's last response, which the writer doesn't send.
+type snapshotWriter struct {
+	t    *txn
+	buf  []byte
+	gone bool // a response failed, and t is finished
+}
+
+func (sw *snapshotWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(sw.buf)+len(p) >= SnapshotChunk {
+		k := SnapshotChunk - len(sw.buf)
+		sw.buf, p = append(sw.buf, p[:k]...), p[k:]
+		sw.t.resp.Value = sw.buf
+		if !sw.t.respondMore() {
+			sw.gone = true
+			return 0, io.ErrClosedPipe
+		}
+		sw.buf = sw.buf[:0]
+	}
+	sw.buf = append(sw.buf, p...)
+	return n, nil
+}
+
+// Answers at once, so a client can tell the connection is alive. From
+// now on the client must keep it so: see KeepaliveTimeout.
+func (t *txn) ping() {
+	t.c.pinging = true
+	t.respond()
+}
+
 func (t *txn) rev() {
 	rev := <-t.c.st.Seqns
 	t.resp.Rev = &rev
@@ -173,9 +605,19 @@ func (t *txn) stat() {
 			return
 		}
 
-		len, rev := g.Stat(t.req.GetPath())
-		t.resp.Len = &len
-		t.resp.Rev = &rev
+		si, err := store.StatEx(g, t.req.GetPath())
+		if err != nil {
+			// A missing file has revision 0 and length 0, as
+			// it always has.
+			si.Rev = store.Missing
+		}
+		t.resp.Len = &si.Len
+		t.resp.Rev = &si.Rev
+		if si.IsDir {
+			t.resp.Flags = proto.Int32(dir)
+		} else {
+			t.resp.Flags = proto.Int32(0)
+		}
 		t.respond()
 	}()
 }
@@ -198,6 +640,11 @@ func (t *txn) getdir() {
 			return
 		}
 
+		if t.req.Limit != nil {
+			t.getdirRange(g)
+			return
+		}
+
 		ents, rev := g.Get(*t.req.Path)
 		if rev == store.Missing {
 			t.respondErrCode(response_NOENT)
@@ -220,6 +667,133 @@ func (t *txn) getdir() {
 	}()
 }
 
+func (t *txn) getdirRange(g store.Getter) {
+	ents, total, err := store.GetdirRange(g, *t.req.Path, int(*t.req.Offset), int(*t.req.Limit))
+	switch err {
+	case nil:
+	case syscall.ENOENT:
+		t.respondErrCode(response_NOENT)
+		return
+	case syscall.EINVAL:
+		t.respondErrCode(response_RANGE)
+		return
+	default:
+		t.respondOsError(err)
+		return
+	}
+
+	for t.req.GetStream() && len(ents) > DirChunk {
+		t.resp.Names = ents[:DirChunk]
+		t.resp.Len = proto.Int32(int32(total))
+		if !t.respondMore() {
+			return
+		}
+		ents = ents[DirChunk:]
+	}
+	t.resp.Names = ents
+	t.resp.Len = proto.Int32(int32(total))
+	t.respond()
+}
+
+// Reads every one of the request's paths as of a single revision, so
+// that files which change together are seen together.
+func (t *txn) getAll() {
+	if !t.c.raccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	if len(t.req.Paths) == 0 {
+		t.respondErrCode(response_MISSING_ARG)
+		return
+	}
+
+	go func() {
+		rev, g, err := t.revGetter()
+		if err != nil {
+			t.respondOsError(err)
+			return
+		}
+
+		revs := make([]int64, len(t.req.Paths))
+		values := make([][]byte, len(t.req.Paths))
+		for i, path := range t.req.Paths {
+			v, frev := g.Get(path)
+			if frev == store.Dir {
+				t.resp.ErrDetail = proto.String(path)
+				t.respondErrCode(response_ISDIR)
+				return
+			}
+
+			revs[i] = frev
+			if len(v) == 1 { // not missing
+				values[i] = []byte(v[0])
+			}
+		}
+
+		t.resp.Rev = &rev
+		t.resp.Names = t.req.Paths
+		t.resp.Revs = revs
+		t.resp.Values = values
+		t.respond()
+	}()
+}
+
+func (t *txn) getdirStat() {
+	if !t.c.raccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	if t.req.Path == nil {
+		t.respondErrCode(response_MISSING_ARG)
+		return
+	}
+
+	go func() {
+		g, err := t.getter()
+		if err != nil {
+			t.respondOsError(err)
+			return
+		}
+		t.getdirStatOf(g)
+	}()
+}
+
+func (t *txn) getdirStatOf(g store.Getter) {
+	ents, err := store.GetdirStat(g, *t.req.Path)
+	switch err {
+	case nil:
+	case syscall.ENOENT:
+		t.respondErrCode(response_NOENT)
+		return
+	default:
+		t.respondOsError(err)
+		return
+	}
+
+	for t.req.GetStream() && len(ents) > DirChunk {
+		t.setEntries(ents[:DirChunk])
+		if !t.respondMore() {
+			return
+		}
+		ents = ents[DirChunk:]
+	}
+	t.setEntries(ents)
+	t.respond()
+}
+
+func (t *txn) setEntries(ents []store.DirEntry) {
+	t.resp.Names = make([]string, len(ents))
+	t.resp.Revs = make([]int64, len(ents))
+	t.resp.Lens = make([]int32, len(ents))
+	for i, e := range ents {
+		t.resp.Names[i] = e.Name
+		t.resp.Revs[i] = e.Rev
+		t.resp.Lens[i] = e.Len
+	}
+}
+
 func (t *txn) wait() {
 	if !t.c.raccess {
 		t.respondOsError(syscall.EACCES)
@@ -231,20 +805,35 @@ func (t *txn) wait() {
 		return
 	}
 
-	glob, err := store.CompileGlob(*t.req.Path)
+	glob, err := store.CompileGlobCached(*t.req.Path)
 	if err != nil {
 		t.respondOsError(err)
 		return
 	}
 
-	ch, err := t.c.st.Wait(glob, *t.req.Rev)
-	if err != nil {
-		t.respondOsError(err)
+	tag := t.req.GetTag()
+	cancel, code := t.c.addWait(tag)
+	if code != 0 {
+		t.respondErrCode(code)
 		return
 	}
 
 	go func() {
-		ev := <-ch
+		ev, err := t.c.st.WaitCancel(glob, *t.req.Rev, cancel)
+		t.c.delWait(tag, cancel)
+		switch {
+		case err == store.ErrCanceled && t.c.quitting():
+			t.resp.ErrDetail = proto.String(errShutdown)
+			t.respondErrCode(response_OTHER)
+			return
+		case err == store.ErrCanceled:
+			// The client asked for no response.
+			atomic.AddInt64(&t.c.pending, -1)
+			return
+		case err != nil:
+			t.respondOsError(err)
+			return
+		}
 		t.resp.Path = &ev.Path
 		t.resp.Value = []byte(ev.Body)
 		t.resp.Rev = &ev.Seqn
@@ -260,6 +849,62 @@ func (t *txn) wait() {
 	}()
 }
 
+func (t *txn) cancel() {
+	if !t.c.raccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	if t.req.OtherTag == nil {
+		t.respondErrCode(response_MISSING_ARG)
+		return
+	}
+	t.c.cancelWait(*t.req.OtherTag)
+	t.respond()
+}
+
+func (t *txn) history() {
+	if !t.c.raccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	if t.req.Path == nil || t.req.Rev == nil || t.req.Offset == nil {
+		t.respondErrCode(response_MISSING_ARG)
+		return
+	}
+
+	offset := int(*t.req.Offset)
+	if offset < 0 {
+		t.respondErrCode(response_RANGE)
+		return
+	}
+
+	go func() {
+		to := <-t.c.st.Seqns
+		h, err := t.c.st.History(*t.req.Path, *t.req.Rev, to)
+		if err != nil {
+			t.respondOsError(err)
+			return
+		}
+
+		if offset >= len(h) {
+			t.respondErrCode(response_RANGE)
+			return
+		}
+
+		ev := h[offset]
+		t.resp.Rev = &ev.Seqn
+		t.resp.Value = []byte(ev.Body)
+		if ev.IsSet() {
+			t.resp.Flags = proto.Int32(set)
+		} else {
+			t.resp.Flags = proto.Int32(del)
+		}
+		t.respond()
+	}()
+}
+
 func (t *txn) walk() {
 	if !t.c.raccess {
 		t.respondOsError(syscall.EACCES)
@@ -271,7 +916,7 @@ func (t *txn) walk() {
 		return
 	}
 
-	glob, err := store.CompileGlob(*t.req.Path)
+	glob, err := store.CompileGlobCached(*t.req.Path)
 	if err != nil {
 		t.respondOsError(err)
 		return
@@ -308,8 +953,61 @@ func (t *txn) walk() {
 	}()
 }
 
+// Lists the files under a directory a window at a time, all of them
+// as of the revision of the first window.
+func (t *txn) scan() {
+	if !t.c.raccess {
+		t.respondOsError(syscall.EACCES)
+		return
+	}
+
+	if t.req.Path == nil {
+		t.respondErrCode(response_MISSING_ARG)
+		return
+	}
+
+	limit := -1
+	if t.req.Limit != nil {
+		limit = int(*t.req.Limit)
+	}
+
+	go func() {
+		if t.req.Rev == nil && t.req.Token == nil {
+			if err := t.waitRev(t.minRev()); err != nil {
+				t.respondOsError(err)
+				return
+			}
+		}
+
+		ents, next, err := t.c.st.Scan(*t.req.Path, t.req.GetRev(), t.req.GetToken(), limit)
+		switch err {
+		case nil:
+		case syscall.EINVAL:
+			t.respondErrCode(response_RANGE)
+			return
+		default:
+			t.respondOsError(err)
+			return
+		}
+
+		t.resp.Names = make([]string, len(ents))
+		t.resp.Revs = make([]int64, len(ents))
+		t.resp.Lens = make([]int32, len(ents))
+		for i, e := range ents {
+			t.resp.Names[i] = e.Name
+			t.resp.Revs[i] = e.Rev
+			t.resp.Lens[i] = e.Len
+		}
+		if next != "" {
+			t.resp.Token = &next
+		}
+		t.respond()
+	}()
+}
+
 func (t *txn) access() {
 	if t.c.grant(string(t.req.Value)) {
+		t.c.limitIdentity()
 		t.respond()
 	} else {
 		t.respondOsError(syscall.EACCES)
@@ -317,13 +1015,45 @@ func (t *txn) access() {
 }
 
 func (t *txn) respondOsError(err error) {
+	if te, ok := err.(*store.TxnError); ok {
+		err = te.Err
+	}
+	switch ge := err.(type) {
+	case store.GlobError:
+		t.resp.ErrDetail = proto.String(string(ge))
+		t.respondErrCode(response_BAD_GLOB)
+		return
+	case *store.GlobStarsError:
+		t.resp.ErrDetail = proto.String(ge.Pattern)
+		t.respondErrCode(response_BAD_GLOB)
+		return
+	case *ValidationError:
+		t.resp.ErrDetail = proto.String(ge.Err.Error())
+		t.respondErrCode(response_VALIDATION_FAILED)
+		return
+	case *store.QuotaError:
+		t.resp.ErrDetail = proto.String(ge.Dir)
+		t.respondErrCode(response_QUOTA_EXCEEDED)
+		return
+	}
+
 	switch err {
 	case store.ErrBadPath:
 		t.respondErrCode(response_BAD_PATH)
 	case store.ErrRevMismatch:
 		t.respondErrCode(response_REV_MISMATCH)
+	case store.ErrValueMismatch:
+		t.respondErrCode(response_VALUE_MISMATCH)
+	case syscall.ENOENT:
+		t.respondErrCode(response_NOENT)
 	case store.ErrTooLate:
 		t.respondErrCode(response_TOO_LATE)
+	case store.ErrTimeout:
+		t.respondErrCode(response_BEHIND)
+	case consensus.ErrNoQuorum:
+		t.respondErrCode(response_NO_QUORUM)
+	case store.ErrValueTooLong:
+		t.respondErrCode(response_TOO_LONG)
 	case syscall.EISDIR:
 		t.respondErrCode(response_ISDIR)
 	case syscall.ENOTDIR:
@@ -334,28 +1064,90 @@ func (t *txn) respondOsError(err error) {
 	}
 }
 
+// Sends t.resp as one of several responses to t, with the more flag
+// set, and starts on the next. T stays pending until respond sends
+// the last. Reports whether the client got it; if not, t is done.
+func (t *txn) respondMore() bool {
+	t.resp.Tag = t.req.Tag
+	t.resp.Flags = proto.Int32(more)
+	if t.trace != "" {
+		t.resp.Trace = &t.trace
+	}
+	err := t.c.write(&t.resp)
+	t.resp = response{}
+	if err != nil {
+		if err != io.EOF {
+			logging.Warn("write", "addr", t.c.addr, "err", err)
+		}
+		atomic.AddInt64(&t.c.pending, -1)
+		return false
+	}
+	return true
+}
+
 func (t *txn) respondErrCode(e response_Err) {
 	t.resp.ErrCode = &e
 	t.respond()
 }
 
 func (t *txn) respond() {
+	atomic.AddInt64(&t.c.pending, -1)
 	t.resp.Tag = t.req.Tag
+	if t.trace != "" {
+		t.resp.Trace = &t.trace
+	}
 	err := t.c.write(&t.resp)
 	if err != nil && err != io.EOF {
-		log.Println(err)
+		logging.Warn("write", "addr", t.c.addr, "err", err)
 	}
 }
 
 func (t *txn) getter() (store.Getter, error) {
+	_, g, err := t.revGetter()
+	return g, err
+}
+
+// Like getter, but also returns the revision g reads.
+func (t *txn) revGetter() (int64, store.Getter, error) {
 	if t.req.Rev == nil {
-		_, g := t.c.st.Snap()
-		return g, nil
+		if err := t.waitRev(t.minRev()); err != nil {
+			return 0, nil, err
+		}
+		ver, g := t.c.st.Snap()
+		return ver, g, nil
 	}
 
 	ch, err := t.c.st.Wait(store.Any, *t.req.Rev)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
+	}
+	ev := <-ch
+	return ev.Seqn, ev, nil
+}
+
+// Returns the revision the store must reach before t may read it: the
+// request's min_rev, so that a client reading from a server that lags
+// behind the one it wrote to still reads its own writes, or, if this
+// server has been behind the cluster for longer than the request's
+// max_staleness, the cluster's latest revision. A server that can't
+// tell how stale it is answers as if it were fresh.
+func (t *txn) minRev() int64 {
+	min := t.req.GetMinRev()
+	if max := t.req.GetMaxStaleness(); max > 0 && t.c.health != nil {
+		if h := t.c.health(); h.Staleness > max && h.Latest > min {
+			min = h.Latest
+		}
+	}
+	return min
+}
+
+// Waits, for up to MinRevWait, until the store has reached min.
+// Returns store.ErrTimeout if it is still behind.
+func (t *txn) waitRev(min int64) error {
+	if ver, _ := t.c.st.Snap(); ver >= min {
+		return nil
 	}
-	return <-ch, nil
+	deadline := time.Now().Add(time.Duration(MinRevWait))
+	_, err := t.c.st.WaitDeadline(store.Any, min, deadline)
+	return err
 }
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"github.com/madebymany/doozerd/store"
+	"sync"
+)
+
+// A Validator checks the body of a file about to be set, and returns
+// an error if the body is not fit for the file.
+type Validator func(body []byte) error
+
+// A ValidationError is the error for a set rejected by a Validator.
+type ValidationError struct {
+	Path string
+	Err  error // as returned by the validator
+}
+
+func (e *ValidationError) Error() string {
+	return "validation failed: " + e.Path + ": " + e.Err.Error()
+}
+
+// The registered validators, and their globs compiled as one set.
+var validators struct {
+	sync.RWMutex
+	pats []string
+	set  *store.GlobSet
+	fs   []Validator
+}
+
+// RegisterValidator makes each SET of a file whose path matches pat
+// run f on the new body first, and fail with VALIDATION_FAILED if f
+// returns an error. A path matching several globs must pass all their
+// validators, in order of registration. Register validators before
+// serving; the same ones should be registered on every node.
+//
+// An APPEND or INCR of such a file is checked on the body it would
+// make, and is then carried out as a SET of that body, made only if
+// the file is unchanged since.
+func RegisterValidator(pat string, f Validator) error {
+	validators.Lock()
+	defer validators.Unlock()
+	pats := append(validators.pats[:len(validators.pats):len(validators.pats)], pat)
+	set, err := store.CompileGlobSet(pats)
+	if err != nil {
+		return err
+	}
+	validators.pats = pats
+	validators.set = set
+	validators.fs = append(validators.fs, f)
+	return nil
+}
+
+// Reports whether any validator is registered for path.
+func validated(path string) bool {
+	validators.RLock()
+	defer validators.RUnlock()
+	return validators.set != nil && validators.set.Match(path)
+}
+
+// Validate runs the validators registered for path on body, and
+// returns a *ValidationError for the first that rejects it.
+func Validate(path string, body []byte) error {
+	validators.RLock()
+	defer validators.RUnlock()
+	if validators.set == nil || !validators.set.Match(path) {
+		return nil
+	}
+	for i, g := range validators.set.Globs {
+		if !g.Match(path) {
+			continue
+		}
+		if err := validators.fs[i](body); err != nil {
+			return &ValidationError{path, err}
+		}
+	}
+	return nil
+}
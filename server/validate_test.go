@@ -0,0 +1,173 @@
+package server
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"encoding/json"
+	"errors"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"strconv"
+	"testing"
+)
+
+func validJSON(b []byte) error {
+	var v interface{}
+	return json.Unmarshal(b, &v)
+}
+
+func smallInt(b []byte) error {
+	n, err := strconv.Atoi(string(b))
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > 10 {
+		return errors.New("out of range")
+	}
+	return nil
+}
+
+// Registers the validators for the test, and forgets them when the
+// returned func is called.
+func withValidators(t *testing.T) func() {
+	assert.Equal(t, nil, RegisterValidator("/cfg/**", validJSON))
+	assert.Equal(t, nil, RegisterValidator("/cfg/n", smallInt))
+	return func() {
+		validators.pats, validators.set, validators.fs = nil, nil, nil
+	}
+}
+
+func TestValidate(t *testing.T) {
+	defer withValidators(t)()
+
+	assert.Equal(t, nil, Validate("/cfg/a", []byte(`{"a":1}`)))
+	assert.Equal(t, nil, Validate("/cfg/n", []byte("3")))
+	assert.Equal(t, nil, Validate("/other", []byte("{")))
+
+	err := Validate("/cfg/a", []byte("{"))
+	ve, ok := err.(*ValidationError)
+	assert.T(t, ok, err)
+	assert.Equal(t, "/cfg/a", ve.Path)
+
+	err = Validate("/cfg/n", []byte("11"))
+	assert.Equal(t, &ValidationError{"/cfg/n", errors.New("out of range")}, err)
+}
+
+func TestRegisterValidatorBadGlob(t *testing.T) {
+	defer withValidators(t)()
+	assert.Equal(t, store.GlobError("/x["), RegisterValidator("/x[", validJSON))
+	assert.Equal(t, 2, len(validators.fs))
+}
+
+func TestSetValidated(t *testing.T) {
+	defer withValidators(t)()
+
+	st := store.New()
+	defer close(st.Ops)
+	s, c := startServer(st, &test.FakeProposer{Store: st})
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(1),
+		Verb:  request_SET.Enum(),
+		Path:  proto.String("/cfg/n"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte("12"),
+	})
+	resp := readResponse(c)
+	assert.Equal(t, response_VALIDATION_FAILED, resp.GetErrCode())
+	assert.Equal(t, "out of range", resp.GetErrDetail())
+	_, rev := st.Get("/cfg/n")
+	assert.Equal(t, store.Missing, rev)
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(2),
+		Verb:  request_SET.Enum(),
+		Path:  proto.String("/cfg/n"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte("7"),
+	})
+	resp = readResponse(c)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, "7", store.GetString(st, "/cfg/n"))
+}
+
+func TestAppendValidated(t *testing.T) {
+	defer withValidators(t)()
+
+	st := store.New()
+	defer close(st.Ops)
+	fp := &test.FakeProposer{Store: st}
+	fp.Propose([]byte(store.MustEncodeSet("/cfg/a", `{"a":[1`, store.Clobber)))
+	s, c := startServer(st, fp)
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(1),
+		Verb:  request_APPEND.Enum(),
+		Path:  proto.String("/cfg/a"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte(",2"),
+	})
+	resp := readResponse(c)
+	assert.Equal(t, response_VALIDATION_FAILED, resp.GetErrCode())
+	assert.Equal(t, `{"a":[1`, store.GetString(st, "/cfg/a"))
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(2),
+		Verb:  request_APPEND.Enum(),
+		Path:  proto.String("/cfg/a"),
+		Rev:   proto.Int64(store.Clobber),
+		Value: []byte(",2]}"),
+	})
+	resp = readResponse(c)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, int64(2), resp.GetRev())
+	assert.Equal(t, `{"a":[1,2]}`, store.GetString(st, "/cfg/a"))
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(3),
+		Verb:  request_APPEND.Enum(),
+		Path:  proto.String("/cfg/a"),
+		Rev:   proto.Int64(1),
+		Value: []byte(" "),
+	})
+	resp = readResponse(c)
+	assert.Equal(t, response_REV_MISMATCH, resp.GetErrCode())
+}
+
+func TestIncrValidated(t *testing.T) {
+	defer withValidators(t)()
+
+	st := store.New()
+	defer close(st.Ops)
+	fp := &test.FakeProposer{Store: st}
+	fp.Propose([]byte(store.MustEncodeSet("/cfg/n", "9", store.Clobber)))
+	s, c := startServer(st, fp)
+	defer s.Shutdown(0)
+	defer c.Close()
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(1),
+		Verb:  request_INCR.Enum(),
+		Path:  proto.String("/cfg/n"),
+		Delta: proto.Int64(2),
+	})
+	resp := readResponse(c)
+	assert.Equal(t, response_VALIDATION_FAILED, resp.GetErrCode())
+	assert.Equal(t, "out of range", resp.GetErrDetail())
+	assert.Equal(t, "9", store.GetString(st, "/cfg/n"))
+
+	writeRequest(c, &request{
+		Tag:   proto.Int32(2),
+		Verb:  request_INCR.Enum(),
+		Path:  proto.String("/cfg/n"),
+		Delta: proto.Int64(1),
+	})
+	resp = readResponse(c)
+	assert.Equal(t, (*response_Err)(nil), resp.ErrCode)
+	assert.Equal(t, "10", string(resp.Value))
+	assert.Equal(t, "10", store.GetString(st, "/cfg/n"))
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const appendPrefix = "append:"
+
+// EncodeAppend returns a mutation that appends suffix to the body of
+// the file at path, creating the file if it is missing, if the current
+// revision of path is no greater than rev. The mutation fails with
+// ErrValueTooLong if the result would be longer than maxLen bytes; the
+// limit travels with the mutation, so every replica applies the same
+// one. A negative maxLen means no limit.
+func EncodeAppend(path, suffix string, rev int64, maxLen int) (mutation string, err error) {
+	if mutation, err = EncodeSet(path, suffix, rev); err != nil {
+		return "", err
+	}
+	return appendPrefix + strconv.Itoa(maxLen) + ":" + mutation, nil
+}
+
+func MustEncodeAppend(path, suffix string, rev int64, maxLen int) (mutation string) {
+	m, err := EncodeAppend(path, suffix, rev, maxLen)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func isAppend(mut string) bool {
+	return strings.HasPrefix(mut, appendPrefix)
+}
+
+// Rewrites an append as the set it amounts to in g.
+func appendToSet(g Getter, mut string) (set string, err error) {
+	ms := strings.SplitN(mut[len(appendPrefix):], ":", 2)
+	if len(ms) != 2 {
+		return "", ErrBadMutation
+	}
+
+	maxLen, err := strconv.Atoi(ms[0])
+	if err != nil {
+		return "", ErrBadMutation
+	}
+
+	path, suffix, rev, keep, err := decode(ms[1])
+	if err != nil {
+		return "", err
+	}
+	if !keep {
+		return "", ErrBadMutation
+	}
+
+	v, curRev := g.Get(path)
+	if curRev == Dir {
+		return "", syscall.EISDIR
+	}
+
+	body := v[0] + suffix
+	if maxLen >= 0 && len(body) > maxLen {
+		return "", ErrValueTooLong
+	}
+	return EncodeSet(path, body, rev)
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestNodeApplyAppend(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/x", "ab", Clobber))
+	m := MustEncodeAppend("/x", "c=d", 1, -1)
+	n, e := r.apply(2, m)
+	assert.Equal(t, Event{2, "/x", "abc=d", 2, m, nil, n}, e)
+	assert.T(t, e.IsSet())
+}
+
+func TestNodeApplyAppendCreates(t *testing.T) {
+	m := MustEncodeAppend("/x", "a", Missing, -1)
+	n, e := emptyDir.apply(1, m)
+	assert.Equal(t, Event{1, "/x", "a", 1, m, nil, n}, e)
+}
+
+func TestNodeApplyAppendMaxLen(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/x", "abc", Clobber))
+
+	_, e := r.apply(2, MustEncodeAppend("/x", "de", Clobber, 5))
+	assert.Equal(t, nil, e.Err)
+	assert.Equal(t, "abcde", e.Body)
+
+	m := MustEncodeAppend("/x", "def", Clobber, 5)
+	n, e := r.apply(2, m)
+	err := ErrValueTooLong
+	exp, _ := r.apply(2, MustEncodeSet(ErrorPath, err.Error(), Clobber))
+	assert.Equal(t, exp, n)
+	assert.Equal(t, Event{2, ErrorPath, err.Error(), 2, m, err, n}, e)
+
+	big := strings.Repeat("x", DefaultMaxValueLen)
+	_, e = emptyDir.apply(1, MustEncodeAppend("/x", big, Clobber, DefaultMaxValueLen))
+	assert.Equal(t, nil, e.Err)
+	_, e = emptyDir.apply(1, MustEncodeAppend("/x", big+"x", Clobber, DefaultMaxValueLen))
+	assert.Equal(t, ErrValueTooLong, e.Err)
+}
+
+func TestNodeApplyAppendErrors(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/x", "a", Clobber))
+	r, _ = r.apply(2, MustEncodeSet("/d/e", "1", Clobber))
+
+	for _, c := range []struct {
+		m   string
+		err error
+	}{
+		{MustEncodeAppend("/x", "b", 0, -1), ErrRevMismatch},
+		{MustEncodeAppend("/d", "b", Clobber, -1), syscall.EISDIR},
+		{MustEncodeAppend("/x/y", "b", Clobber, -1), syscall.ENOTDIR},
+		{"append:-1", ErrBadMutation},
+		{"append:x:-1:/x=a", ErrBadMutation},
+		{"append:-1:-1:/x", ErrBadMutation},
+		{"append:-1:-1:x=a", ErrBadPath},
+	} {
+		n, e := r.apply(3, c.m)
+		exp, _ := r.apply(3, MustEncodeSet(ErrorPath, c.err.Error(), Clobber))
+		assert.Equalf(t, exp, n, "%q", c.m)
+		assert.Equalf(t, Event{3, ErrorPath, c.err.Error(), 3, c.m, c.err, n}, e, "%q", c.m)
+	}
+}
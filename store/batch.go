@@ -0,0 +1,73 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+)
+
+const batchPrefix = "batch:"
+
+// CanBatch reports whether mutation may go in a batch. A batch may hold
+// any mutation that makes exactly one event: a set, delete, incr,
+// append, or nop, or any of these marked with a trace ID, but not one
+// made with an operation ID.
+func CanBatch(mutation string) bool {
+	mutation = Untrace(mutation)
+	return !isTxn(mutation) && !isDeltree(mutation) && !isDelGlob(mutation) && !isCopy(mutation) && !isBatch(mutation) && !isOnce(mutation)
+}
+
+// EncodeBatch combines muts into one mutation, to be decided in one
+// round of consensus. Unlike a txn, each mutation in a batch is applied
+// on its own, in order, and succeeds or fails on its own; the batch
+// makes the same events, at one revision, as its mutations would have
+// made one after another. See CanBatch for what a batch may hold.
+func EncodeBatch(muts ...string) (mutation string, err error) {
+	if len(muts) == 0 {
+		return "", ErrBadMutation
+	}
+
+	parts := []string{batchPrefix}
+	for _, m := range muts {
+		if !CanBatch(m) {
+			return "", ErrBadMutation
+		}
+		parts = append(parts, strconv.Itoa(len(m)), ":", m)
+	}
+	return strings.Join(parts, ""), nil
+}
+
+func isBatch(mut string) bool {
+	return strings.HasPrefix(mut, batchPrefix)
+}
+
+// Each event carries the whole batch as its Mut, so that a proposer
+// can tell its batch from any other mutation at that revision.
+func (n node) applyBatch(seqn int64, mut string) (rep node, evs []Event) {
+	muts, err := decodeList(mut[len(batchPrefix):])
+	if err == nil {
+		for _, m := range muts {
+			if !CanBatch(m) {
+				err = ErrBadMutation
+			}
+		}
+	}
+	if err != nil {
+		ev := Event{seqn, ErrorPath, err.Error(), seqn, mut, err, nil}
+		rep = n.setp(ev.Path, ev.Body, ev.Rev, true)
+		ev.Getter = rep
+		return rep, []Event{ev}
+	}
+
+	rep = n
+	for _, m := range muts {
+		var ev Event
+		rep, ev = rep.apply(seqn, m)
+		ev.Mut = mut
+		evs = append(evs, ev)
+	}
+
+	for i := range evs {
+		evs[i].Getter = rep
+	}
+	return rep, evs
+}
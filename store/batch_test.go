@@ -0,0 +1,93 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestBatchEncodeErrors(t *testing.T) {
+	_, err := EncodeBatch()
+	assert.Equal(t, ErrBadMutation, err)
+
+	txn, _ := EncodeTxn(MustEncodeSet("/a", "", Clobber))
+	_, err = EncodeBatch(MustEncodeSet("/a", "", Clobber), txn)
+	assert.Equal(t, ErrBadMutation, err)
+
+	b, _ := EncodeBatch(MustEncodeSet("/a", "", Clobber))
+	_, err = EncodeBatch(b)
+	assert.Equal(t, ErrBadMutation, err)
+}
+
+func TestCanBatch(t *testing.T) {
+	assert.T(t, CanBatch(MustEncodeSet("/a", "", Clobber)))
+	assert.T(t, CanBatch(MustEncodeDel("/a", Clobber)))
+	assert.T(t, CanBatch(MustEncodeIncr("/a", 1)))
+	assert.T(t, CanBatch(Nop))
+	assert.T(t, !CanBatch(MustEncodeDeltree("/a", Clobber)))
+	assert.T(t, !CanBatch(MustEncodeDelGlob(Any, Clobber)))
+	assert.T(t, !CanBatch(MustEncodeMove("/a", "/b", Clobber)))
+}
+
+func TestNodeApplyBatch(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/b", "old", Clobber))
+
+	a := MustEncodeSet("/a", "x", Clobber)
+	b := MustEncodeSet("/b", "new", 0) // fails; /b is at 1
+	c := MustEncodeDel("/b", Clobber)
+	m, err := EncodeBatch(a, b, c)
+	assert.Equal(t, nil, err)
+
+	n, evs := r.applyAll(2, m)
+	assert.Equal(t, 3, len(evs))
+	for _, ev := range evs {
+		assert.Equal(t, int64(2), ev.Seqn)
+		assert.Equal(t, m, ev.Mut)
+		assert.Equal(t, n, ev.Getter)
+	}
+
+	assert.Equal(t, "/a", evs[0].Path)
+	assert.T(t, evs[0].IsSet())
+	assert.Equal(t, ErrorPath, evs[1].Path)
+	assert.Equal(t, ErrRevMismatch, evs[1].Err)
+	assert.Equal(t, "/b", evs[2].Path)
+	assert.T(t, evs[2].IsDel())
+
+	assert.Equal(t, "x", GetString(n, "/a"))
+	_, rev := n.Get("/b")
+	assert.Equal(t, Missing, rev)
+}
+
+func TestNodeApplyBatchBad(t *testing.T) {
+	for _, m := range []string{"batch:", "batch:5", "batch:8:txn:2:-1"} {
+		_, evs := emptyDir.applyAll(1, m)
+		assert.Equalf(t, 1, len(evs), "%q", m)
+		assert.Equalf(t, ErrBadMutation, evs[0].Err, "%q", m)
+	}
+}
+
+func TestStoreEvents(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+	m, _ := EncodeBatch(MustEncodeSet("/a", "1", Clobber), MustEncodeSet("/b", "2", Clobber))
+	st.Ops <- Op{1, MustEncodeSet("/a", "0", Clobber)}
+	st.Ops <- Op{2, m}
+	sync(st, 2)
+
+	evs, err := st.Events(1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(evs))
+
+	evs, err = st.Events(2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(evs))
+	assert.Equal(t, "/a", evs[0].Path)
+	assert.Equal(t, "/b", evs[1].Path)
+
+	evs, err = st.Events(3)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(evs))
+
+	st.Clean(2)
+	_, err = st.Events(1)
+	assert.Equal(t, ErrTooLate, err)
+}
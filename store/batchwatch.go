@@ -0,0 +1,38 @@
+package store
+
+// A BatchWatch is like a Watch, but each receive from C gives all the
+// events for matching files made by a single change, in the order the
+// change made them. So a transaction, or a Deltree, comes as one
+// batch, and the watcher sees it whole.
+type BatchWatch struct {
+	C  <-chan []Event
+	st *Store
+	w  *watch
+}
+
+// WatchBatches returns a BatchWatch for glob, starting with the next
+// revision to be applied to st. Events for paths matching any glob in
+// excludes are left out, as for WatchExcept; a change that leaves
+// nothing sends no batch.
+func (st *Store) WatchBatches(glob *Glob, excludes []*Glob) *BatchWatch {
+	ch := make(chan []Event)
+	w := &watch{
+		glob: glob,
+		excl: excludes,
+		rev:  <-st.Seqns + 1,
+		keep: true,
+		bc:   ch,
+	}
+	st.watchCh <- w
+	return &BatchWatch{C: ch, st: st, w: w}
+}
+
+// Stop is as for Watch.
+func (wt *BatchWatch) Stop() {
+	go func() {
+		for _ = range wt.C {
+		}
+	}()
+
+	wt.st.cancelWatch(wt.w)
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func batchPaths(evs []Event) (paths []string) {
+	for _, e := range evs {
+		paths = append(paths, e.Path)
+	}
+	return paths
+}
+
+func TestWatchBatchesTxn(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.WatchBatches(MustCompileGlob("/x/**"), nil)
+	defer wt.Stop()
+
+	var tx Txn
+	tx.Set("/x/c", "1", Clobber)
+	tx.Set("/y", "2", Clobber)
+	tx.Set("/x/a", "3", Clobber)
+	tx.Del("/x/c", Clobber)
+	m, _ := tx.Mutation()
+	st.Ops <- Op{1, m}
+
+	evs := <-wt.C
+	assert.Equal(t, []string{"/x/c", "/x/a", "/x/c"}, batchPaths(evs))
+	for _, e := range evs {
+		assert.Equal(t, int64(1), e.Seqn)
+	}
+	assert.T(t, evs[0].IsSet())
+	assert.T(t, evs[2].IsDel())
+
+	// A change with nothing for the watch sends no batch.
+	st.Ops <- Op{2, MustEncodeSet("/y", "4", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/x/b", "5", Clobber)}
+	evs = <-wt.C
+	assert.Equal(t, []string{"/x/b"}, batchPaths(evs))
+	assert.Equal(t, int64(3), evs[0].Seqn)
+}
+
+func TestWatchBatchesDeltree(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, MustEncodeSet("/x/a", "", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/x/b/c", "", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/x/d", "", Clobber)}
+	sync(st, 3)
+
+	wt := st.WatchBatches(Any, []*Glob{MustCompileGlob("/x/d")})
+	defer wt.Stop()
+
+	st.Ops <- Op{4, MustEncodeDeltree("/x", Clobber)}
+	evs := <-wt.C
+	assert.Equal(t, []string{"/x/a", "/x/b/c"}, batchPaths(evs))
+}
+
+func TestWatchBatchesStop(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.WatchBatches(Any, nil)
+	st.Ops <- Op{1, MustEncodeSet("/x", "", Clobber)}
+	wt.Stop()
+	st.Ops <- Op{2, MustEncodeSet("/x", "", Clobber)}
+	sync(st, 2)
+
+	for _ = range wt.C {
+	}
+}
+
+func TestWatchBatchesStoreClose(t *testing.T) {
+	st := New()
+	wt := st.WatchBatches(Any, nil)
+	close(st.Ops)
+	_, ok := <-wt.C
+	assert.T(t, !ok)
+}
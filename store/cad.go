@@ -0,0 +1,58 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+)
+
+const cadPrefix = "cad:"
+
+// ErrValueMismatch is the error for a compare-and-delete of a file
+// whose body is not the one given.
+var ErrValueMismatch = errors.New("value mismatch")
+
+// EncodeCompareAndDelete returns a mutation that deletes the file at
+// path if its body is exactly value, whatever its revision. Otherwise
+// the mutation fails, with ErrValueMismatch, or syscall.ENOENT if the
+// file is missing, and the file is left alone.
+func EncodeCompareAndDelete(path, value string) (mutation string, err error) {
+	if mutation, err = EncodeSet(path, value, Clobber); err != nil {
+		return "", err
+	}
+	return cadPrefix + mutation, nil
+}
+
+func MustEncodeCompareAndDelete(path, value string) (mutation string) {
+	m, err := EncodeCompareAndDelete(path, value)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func isCad(mut string) bool {
+	return strings.HasPrefix(mut, cadPrefix)
+}
+
+// Rewrites a compare-and-delete as the delete it amounts to in n.
+func (n node) cadToDel(mut string) (del string, err error) {
+	path, value, _, keep, err := decode(mut[len(cadPrefix):])
+	if err != nil {
+		return "", err
+	}
+	if !keep {
+		return "", ErrBadMutation
+	}
+
+	v, rev := n.Get(path)
+	switch {
+	case rev == Dir:
+		return "", syscall.EISDIR
+	case rev == Missing:
+		return "", syscall.ENOENT
+	case v[0] != value:
+		return "", ErrValueMismatch
+	}
+	return EncodeDel(path, rev)
+}
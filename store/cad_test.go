@@ -0,0 +1,52 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"syscall"
+	"testing"
+)
+
+func TestNodeApplyCompareAndDelete(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/x", "token", Clobber))
+	m := MustEncodeCompareAndDelete("/x", "token")
+	n, e := r.apply(2, m)
+	assert.Equal(t, Event{2, "/x", "", Missing, m, nil, n}, e)
+	assert.T(t, e.IsDel())
+	_, rev := n.Get("/x")
+	assert.Equal(t, Missing, rev)
+}
+
+func TestNodeApplyCompareAndDeleteErrors(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/x", "token", Clobber))
+	r, _ = r.apply(2, MustEncodeSet("/d/y", "", Clobber))
+
+	for _, c := range []struct {
+		m   string
+		err error
+	}{
+		{MustEncodeCompareAndDelete("/x", "other"), ErrValueMismatch},
+		{MustEncodeCompareAndDelete("/x", "toke"), ErrValueMismatch},
+		{MustEncodeCompareAndDelete("/x", ""), ErrValueMismatch},
+		{MustEncodeCompareAndDelete("/z", ""), syscall.ENOENT},
+		{MustEncodeCompareAndDelete("/d", ""), syscall.EISDIR},
+		{cadPrefix + MustEncodeDel("/x", Clobber), ErrBadMutation},
+	} {
+		n, e := r.apply(3, c.m)
+		exp, _ := r.apply(3, MustEncodeSet(ErrorPath, c.err.Error(), Clobber))
+		assert.Equalf(t, exp, n, "%q", c.m)
+		assert.Equalf(t, Event{3, ErrorPath, c.err.Error(), 3, c.m, c.err, n}, e, "%q", c.m)
+
+		v, rev := n.Get("/x")
+		assert.Equalf(t, []string{"token"}, v, "%q", c.m)
+		assert.Equalf(t, int64(1), rev, "%q", c.m)
+	}
+}
+
+func TestEncodeCompareAndDeleteBadPath(t *testing.T) {
+	_, err := EncodeCompareAndDelete("x", "")
+	assert.Equal(t, ErrBadPath, err)
+}
+
+func TestCanBatchCompareAndDelete(t *testing.T) {
+	assert.T(t, CanBatch(MustEncodeCompareAndDelete("/x", "a")))
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"encoding/hex"
+)
+
+// TypeDir holds the content types of files set with one. The type of
+// the file at path p, such as "application/json", is stored in a file
+// in TypeDir named for p in hex, so that no file's type is in the way
+// of another's, however paths come and go. A type counts only if it
+// was written at or after the file's own last change, so a set without
+// one, or an append, leaves the file untyped again, and a type left
+// behind by a deleted file doesn't apply to one made later at the same
+// path.
+const TypeDir = "/ctl/type"
+
+// TypePath returns the path of the file holding the content type for
+// path.
+func TypePath(path string) string {
+	return TypeDir + "/" + hex.EncodeToString([]byte(path))
+}
+
+// SetType adds an operation to record ctype as the content type of the
+// file at path. It belongs after the operation that sets path, in the
+// same Txn.
+func (t *Txn) SetType(path, ctype string) error {
+	if err := checkPath(path); err != nil {
+		return err
+	}
+	return t.Set(TypePath(path), ctype, Clobber)
+}
+
+// GetType returns the content type of the file at path in g, or the
+// empty string if it has none.
+func GetType(g Getter, path string) string {
+	_, rev := g.Stat(path)
+	if rev <= 0 {
+		return ""
+	}
+	v, trev := g.Get(TypePath(path))
+	if trev < rev {
+		return ""
+	}
+	return v[0]
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"bytes"
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func typedSet(path, body, ctype string) string {
+	var t Txn
+	t.Set(path, body, Clobber)
+	t.SetType(path, ctype)
+	return mustMutation(&t)
+}
+
+func TestTypePath(t *testing.T) {
+	assert.Equal(t, "/ctl/type/2f61", TypePath("/a"))
+	assert.Equal(t, "/ctl/type/2f612f62", TypePath("/a/b"))
+}
+
+func TestGetType(t *testing.T) {
+	n, _ := emptyDir.applyAll(1, typedSet("/a", "{}", "application/json"))
+	assert.Equal(t, "application/json", GetType(n, "/a"))
+	assert.Equal(t, "{}", GetString(n, "/a"))
+	assert.Equal(t, "", GetType(n, "/b"))
+	assert.Equal(t, "", GetType(n, "/"))
+
+	n, _ = n.applyAll(2, typedSet("/a", "x", "text/plain"))
+	assert.Equal(t, "text/plain", GetType(n, "/a"))
+
+	// A change without a type leaves the file untyped.
+	n, _ = n.apply(3, MustEncodeSet("/a", "\x00", Clobber))
+	assert.Equal(t, "", GetType(n, "/a"))
+
+	n, _ = n.applyAll(4, typedSet("/a", "x", "text/plain"))
+	n, _ = n.apply(5, MustEncodeDel("/a", Clobber))
+	assert.Equal(t, "", GetType(n, "/a"))
+	n, _ = n.apply(6, MustEncodeSet("/a", "y", Clobber))
+	assert.Equal(t, "", GetType(n, "/a"))
+}
+
+func TestSetTypeAcrossDirs(t *testing.T) {
+	n, _ := emptyDir.applyAll(1, typedSet("/a/b", "x", "text/plain"))
+	n, _ = n.apply(2, MustEncodeDel("/a/b", Clobber))
+
+	// The stale type of /a/b is no hindrance to one for /a.
+	n, evs := n.applyAll(3, typedSet("/a", "y", "text/plain"))
+	assert.Equal(t, nil, evs[0].Err)
+	assert.Equal(t, "text/plain", GetType(n, "/a"))
+}
+
+func TestSetTypeBadPath(t *testing.T) {
+	var tx Txn
+	assert.Equal(t, ErrBadPath, tx.SetType("a", "text/plain"))
+	assert.Equal(t, 0, tx.Len())
+}
+
+func TestTypeSnapshot(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, typedSet("/a", "\x01\x02", "application/octet-stream")}
+	st.Ops <- Op{2, MustEncodeSet("/b", "plain", Clobber)}
+	sync(st, 2)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, st.WriteSnapshot(0, &buf))
+	rs, _, err := ReadSnapshot(&buf)
+	assert.Equal(t, nil, err)
+	defer close(rs.Ops)
+
+	assert.Equal(t, "application/octet-stream", GetType(rs, "/a"))
+	assert.Equal(t, "\x01\x02", GetString(rs, "/a"))
+	assert.Equal(t, "", GetType(rs, "/b"))
+}
+
+func TestExpiredType(t *testing.T) {
+	var tx Txn
+	tx.Set("/a", "1", Clobber)
+	tx.Expire("/a", 100)
+	tx.SetType("/a", "text/plain")
+	r, _ := emptyDir.applyAll(1, mustMutation(&tx))
+
+	x := Expired(r, 100)
+	exp, _ := EncodeTxn(
+		MustEncodeDel("/a", 1),
+		MustEncodeDel(TypePath("/a"), 1),
+		MustEncodeDel("/ctl/ttl/a", 1),
+	)
+	assert.Equal(t, exp, mustMutation(x))
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+)
+
+const delglobPrefix = "delglob:"
+
+// EncodeDelGlob returns a mutation that deletes every file matching
+// glob, in one change, as long as none of them has a revision greater
+// than rev. If any has, because it was changed or created after rev,
+// the mutation fails with ErrRevMismatch and deletes nothing. Use
+// Clobber to delete whatever matches.
+func EncodeDelGlob(glob *Glob, rev int64) (mutation string, err error) {
+	if glob == nil {
+		return "", ErrBadMutation
+	}
+	return delglobPrefix + strconv.FormatInt(rev, 10) + ":" + glob.String(), nil
+}
+
+func MustEncodeDelGlob(glob *Glob, rev int64) (mutation string) {
+	m, err := EncodeDelGlob(glob, rev)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func isDelGlob(mut string) bool {
+	return strings.HasPrefix(mut, delglobPrefix)
+}
+
+func decodeDelGlob(mut string) (glob *Glob, rev int64, err error) {
+	rp := strings.SplitN(mut[len(delglobPrefix):], ":", 2)
+	if len(rp) != 2 {
+		return nil, 0, ErrBadMutation
+	}
+	rev, err = strconv.ParseInt(rp[0], 10, 64)
+	if err != nil {
+		return nil, 0, ErrBadMutation
+	}
+	glob, err = CompileGlob(rp[1])
+	if err != nil {
+		return nil, 0, ErrBadMutation
+	}
+	return glob, rev, nil
+}
+
+// Deletes each file matching the glob in mut, one event per file, in
+// sorted order. If nothing matches, the one event is a nop.
+func (n node) applyDelGlob(seqn int64, mut string) (rep node, evs []Event) {
+	glob, rev, err := decodeDelGlob(mut)
+
+	var paths []string
+	if err == nil {
+		Walk(n, glob, func(p, body string, frev int64) bool {
+			if rev != Clobber && rev < frev {
+				err = ErrRevMismatch
+				return true
+			}
+			paths = append(paths, p)
+			return false
+		})
+	}
+
+	if err != nil {
+		ev := Event{seqn, ErrorPath, err.Error(), seqn, mut, err, nil}
+		rep = n.setp(ev.Path, ev.Body, ev.Rev, true)
+		ev.Getter = rep
+		return rep, []Event{ev}
+	}
+
+	if len(paths) == 0 {
+		return n, []Event{{seqn, "/", "", nop, mut, nil, n}}
+	}
+
+	rep = n
+	for _, p := range paths {
+		rep = rep.setp(p, "", Missing, false)
+		evs = append(evs, Event{seqn, p, "", Missing, mut, nil, nil})
+	}
+	for i := range evs {
+		evs[i].Getter = rep
+	}
+	return rep, evs
+}
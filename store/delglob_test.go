@@ -0,0 +1,82 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestEncodeDelGlobNil(t *testing.T) {
+	_, err := EncodeDelGlob(nil, Clobber)
+	assert.Equal(t, ErrBadMutation, err)
+}
+
+func TestNodeApplyDelGlob(t *testing.T) {
+	r := emptyDir
+	for i, p := range []string{"/tmp/session-1", "/tmp/session-2", "/tmp/other", "/tmp/session-3/x"} {
+		r, _ = r.apply(int64(i+1), MustEncodeSet(p, "x", Clobber))
+	}
+
+	m := MustEncodeDelGlob(MustCompileGlob("/tmp/session-*"), Clobber)
+	n, evs := r.applyAll(5, m)
+
+	assert.Equal(t, []Event{
+		{5, "/tmp/session-1", "", Missing, m, nil, n},
+		{5, "/tmp/session-2", "", Missing, m, nil, n},
+	}, evs)
+	assert.Equal(t, []string{"x"}, Getdir(n, "/tmp/session-3"))
+	_, rev := n.Get("/tmp/other")
+	assert.Equal(t, int64(3), rev)
+}
+
+func TestNodeApplyDelGlobNone(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/x", "a", Clobber))
+	m := MustEncodeDelGlob(MustCompileGlob("/y/*"), Clobber)
+	n, evs := r.applyAll(2, m)
+	assert.Equal(t, r, n)
+	assert.Equal(t, 1, len(evs))
+	assert.T(t, evs[0].IsNop())
+	assert.Equal(t, nil, evs[0].Err)
+}
+
+func TestNodeApplyDelGlobRevMismatch(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/a/x", "1", Clobber))
+	r, _ = r.apply(2, MustEncodeSet("/a/y", "2", Clobber))
+	m := MustEncodeDelGlob(MustCompileGlob("/a/*"), 1)
+	n, evs := r.applyAll(3, m)
+
+	err := ErrRevMismatch
+	exp, _ := r.apply(3, MustEncodeSet(ErrorPath, err.Error(), Clobber))
+	assert.Equal(t, exp, n)
+	assert.Equal(t, []Event{{3, ErrorPath, err.Error(), 3, m, err, n}}, evs)
+
+	_, evs = r.applyAll(3, MustEncodeDelGlob(MustCompileGlob("/a/*"), 2))
+	assert.Equal(t, 2, len(evs))
+}
+
+func TestNodeApplyDelGlobBadMutation(t *testing.T) {
+	for _, m := range []string{"delglob:", "delglob:x:/a", "delglob:-1:/a/["} {
+		_, ev := emptyDir.apply(1, m)
+		assert.Equalf(t, ErrBadMutation, ev.Err, "%q", m)
+	}
+}
+
+func TestStoreDelGlob(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/a/x", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/a/y", "2", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/b/x", "3", Clobber)}
+	st.Ops <- Op{4, MustEncodeDelGlob(MustCompileGlob("(?i)/*/X"), Clobber)}
+	sync(st, 4)
+
+	evs, err := st.Events(4)
+	assert.Equal(t, nil, err)
+	var paths []string
+	for _, ev := range evs {
+		assert.T(t, ev.IsDel())
+		paths = append(paths, ev.Path)
+	}
+	assert.Equal(t, []string{"/a/x", "/b/x"}, paths)
+	assert.Equal(t, []string{"y"}, Getdir(st, "/a"))
+}
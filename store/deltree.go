@@ -0,0 +1,77 @@
+package store
+
+import (
+	"strings"
+)
+
+const deltreePrefix = "deltree:"
+
+// EncodeDeltree returns a mutation that deletes path and everything
+// beneath it, if the current revision of path is no greater than rev.
+// A directory has no revision of its own (its Rev is Dir), so rev
+// can only guard the removal of a file.
+func EncodeDeltree(path string, rev int64) (mutation string, err error) {
+	if mutation, err = EncodeDel(path, rev); err != nil {
+		return "", err
+	}
+	return deltreePrefix + mutation, nil
+}
+
+func MustEncodeDeltree(path string, rev int64) (mutation string) {
+	m, err := EncodeDeltree(path, rev)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func isDeltree(mut string) bool {
+	return strings.HasPrefix(mut, deltreePrefix)
+}
+
+// Deletes each file beneath the path in mut, one event per file, in
+// sorted order. Directories go away with their last entry, as usual.
+func (n node) applyDeltree(seqn int64, mut string) (rep node, evs []Event) {
+	path, _, rev, keep, err := decode(mut[len(deltreePrefix):])
+	if err == nil && keep {
+		err = ErrBadMutation
+	}
+
+	if err == nil {
+		_, curRev := n.Get(path)
+		if rev != Clobber && rev < curRev {
+			err = ErrRevMismatch
+		}
+	}
+
+	if err != nil {
+		ev := Event{seqn, ErrorPath, err.Error(), seqn, mut, err, nil}
+		rep = n.setp(ev.Path, ev.Body, ev.Rev, true)
+		ev.Getter = rep
+		return rep, []Event{ev}
+	}
+
+	paths := n.files(path)
+	if len(paths) == 0 {
+		paths = []string{path} // nothing there; still an ordinary delete
+	}
+
+	rep = n
+	for _, p := range paths {
+		rep = rep.setp(p, "", Missing, false)
+		evs = append(evs, Event{seqn, p, "", Missing, mut, nil, nil})
+	}
+	for i := range evs {
+		evs[i].Getter = rep
+	}
+	return rep, evs
+}
+
+// Returns the paths of all files at or beneath path, in sorted order.
+func (n node) files(path string) (paths []string) {
+	walk(n, path, Any, func(p, body string, rev int64) bool {
+		paths = append(paths, p)
+		return false
+	})
+	return paths
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestEncodeDeltreeBadPath(t *testing.T) {
+	_, err := EncodeDeltree("x", Clobber)
+	assert.Equal(t, ErrBadPath, err)
+}
+
+func TestNodeApplyDeltree(t *testing.T) {
+	r := emptyDir
+	for i, p := range []string{"/a/b/c/d", "/a/b/e", "/a/f", "/g"} {
+		r, _ = r.apply(int64(i+1), MustEncodeSet(p, "x", Clobber))
+	}
+
+	m := MustEncodeDeltree("/a", Clobber)
+	n, evs := r.applyAll(5, m)
+
+	exp, _ := emptyDir.apply(1, MustEncodeSet("/g", "x", Clobber))
+	g := exp.Ds["g"]
+	g.Rev = 4
+	exp.Ds["g"] = g
+	assert.Equal(t, exp, n)
+
+	assert.Equal(t, []Event{
+		{5, "/a/b/c/d", "", Missing, m, nil, n},
+		{5, "/a/b/e", "", Missing, m, nil, n},
+		{5, "/a/f", "", Missing, m, nil, n},
+	}, evs)
+}
+
+func TestNodeApplyDeltreeFile(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/x", "a", Clobber))
+	m := MustEncodeDeltree("/x", 1)
+	n, evs := r.applyAll(2, m)
+	assert.Equal(t, emptyDir, n)
+	assert.Equal(t, []Event{{2, "/x", "", Missing, m, nil, n}}, evs)
+}
+
+func TestNodeApplyDeltreeMissing(t *testing.T) {
+	m := MustEncodeDeltree("/x", Clobber)
+	n, ev := emptyDir.apply(1, m)
+	assert.Equal(t, emptyDir, n)
+	assert.Equal(t, Event{1, "/x", "", Missing, m, nil, n}, ev)
+}
+
+func TestNodeApplyDeltreeRevMismatch(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/x", "a", Clobber))
+	m := MustEncodeDeltree("/x", 0)
+	n, evs := r.applyAll(2, m)
+
+	err := ErrRevMismatch
+	exp, _ := r.apply(2, MustEncodeSet(ErrorPath, err.Error(), Clobber))
+	assert.Equal(t, exp, n)
+	assert.Equal(t, []Event{{2, ErrorPath, err.Error(), 2, m, err, n}}, evs)
+}
+
+func TestNodeApplyDeltreeBadMutation(t *testing.T) {
+	_, ev := emptyDir.apply(1, "deltree:-1:/x=a")
+	assert.Equal(t, ErrBadMutation, ev.Err)
+
+	_, ev = emptyDir.apply(1, "deltree:-1:x")
+	assert.Equal(t, ErrBadPath, ev.Err)
+}
+
+func TestStoreDeltree(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/a/b/c", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/a/b/d", "2", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/a/e", "3", Clobber)}
+	sync(st, 3)
+
+	wt := st.Watch(Any)
+	defer wt.Stop()
+	st.Ops <- Op{4, MustEncodeDeltree("/a", Clobber)}
+
+	for _, p := range []string{"/a/b/c", "/a/b/d", "/a/e"} {
+		ev := <-wt.C
+		assert.Equal(t, int64(4), ev.Seqn)
+		assert.Equal(t, p, ev.Path)
+		assert.T(t, ev.IsDel())
+		_, rev := ev.Get("/a")
+		assert.Equal(t, Missing, rev) // all gone at once
+	}
+
+	st.Ops <- Op{5, MustEncodeSet("/a", "x", Clobber)}
+	ev := <-wt.C
+	assert.Equal(t, "/a", ev.Path)
+	assert.Equal(t, nil, ev.Err)
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"sort"
+)
+
+// WatchDirs is like Watch, but also sends a directory event (see
+// Event.IsDir) whenever a directory matching glob comes into being,
+// because a file was set beneath it, or goes away with its last entry.
+//
+// The events for directories created by a change come before the
+// change's own events, outermost first; those for directories removed
+// come after them, innermost first.
+func (st *Store) WatchDirs(glob *Glob) *Watch {
+	ch := make(chan Event)
+	w := &watch{
+		glob: glob,
+		rev:  <-st.Seqns + 1,
+		c:    ch,
+		keep: true,
+		dirs: true,
+	}
+	st.watchCh <- w
+	return &Watch{C: ch, st: st, w: w}
+}
+
+// Returns evs, made by changing old to new, with directory events for
+// the directories created and removed added around them.
+func withDirEvents(old, new node, evs []Event) []Event {
+	var created, removed []Event
+	seen := map[string]bool{}
+	for _, ev := range evs {
+		if !ev.IsSet() && !ev.IsDel() {
+			continue
+		}
+
+		parts := split(ev.Path)
+		for i := 1; i < len(parts); i++ {
+			p := join(parts[:i])
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+
+			_, was := old.get(parts[:i])
+			_, is := new.get(parts[:i])
+			switch {
+			case was != Dir && is == Dir:
+				created = append(created, Event{ev.Seqn, p, "", dirCreated, ev.Mut, nil, ev.Getter})
+			case was == Dir && is != Dir:
+				removed = append(removed, Event{ev.Seqn, p, "", dirRemoved, ev.Mut, nil, ev.Getter})
+			}
+		}
+	}
+
+	if created == nil && removed == nil {
+		return evs
+	}
+
+	sort.Stable(byDepth(created))
+	sort.Stable(sort.Reverse(byDepth(removed)))
+	all := make([]Event, 0, len(created)+len(evs)+len(removed))
+	all = append(all, created...)
+	all = append(all, evs...)
+	return append(all, removed...)
+}
+
+type byDepth []Event
+
+func (a byDepth) Len() int           { return len(a) }
+func (a byDepth) Less(i, j int) bool { return len(split(a[i].Path)) < len(split(a[j].Path)) }
+func (a byDepth) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
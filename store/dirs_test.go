@@ -0,0 +1,70 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestWatchDirsSoleChild(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.WatchDirs(MustCompileGlob("/a/**"))
+	defer wt.Stop()
+
+	st.Ops <- Op{1, MustEncodeSet("/a/b/c", "x", Clobber)}
+	for _, exp := range []string{"mkdir /a", "mkdir /a/b", "set /a/b/c"} {
+		ev := <-wt.C
+		assert.Equal(t, int64(1), ev.Seqn)
+		assert.Equal(t, exp, ev.Desc()+" "+ev.Path)
+	}
+
+	st.Ops <- Op{2, MustEncodeDel("/a/b/c", Clobber)}
+	for _, exp := range []string{"del /a/b/c", "rmdir /a/b", "rmdir /a"} {
+		ev := <-wt.C
+		assert.Equal(t, int64(2), ev.Seqn)
+		assert.Equal(t, exp, ev.Desc()+" "+ev.Path)
+		assert.T(t, !ev.IsNop())
+	}
+}
+
+func TestWatchDirsExisting(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, MustEncodeSet("/a/x", "1", Clobber)}
+	sync(st, 1)
+
+	wt := st.WatchDirs(Any)
+	defer wt.Stop()
+
+	st.Ops <- Op{2, MustEncodeSet("/a/y", "2", Clobber)}
+	assert.Equal(t, "/a/y", (<-wt.C).Path)
+	st.Ops <- Op{3, MustEncodeDel("/a/x", Clobber)}
+	assert.Equal(t, "/a/x", (<-wt.C).Path)
+	st.Ops <- Op{4, MustEncodeDeltree("/a", Clobber)}
+	assert.Equal(t, "/a/y", (<-wt.C).Path)
+	ev := <-wt.C
+	assert.T(t, ev.IsDirRemoved())
+	assert.Equal(t, "/a", ev.Path)
+}
+
+func TestWatchSkipsDirEvents(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.Watch(Any)
+	defer wt.Stop()
+
+	st.Ops <- Op{1, MustEncodeSet("/a/b", "x", Clobber)}
+	ev := <-wt.C
+	assert.T(t, ev.IsSet())
+	assert.Equal(t, "/a/b", ev.Path)
+	st.Ops <- Op{2, MustEncodeDel("/a/b", Clobber)}
+	ev = <-wt.C
+	assert.Equal(t, int64(2), ev.Seqn)
+	assert.T(t, ev.IsDel())
+
+	evs, err := st.Events(1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(evs))
+}
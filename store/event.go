@@ -6,7 +6,8 @@ type Event struct {
 	Body string
 
 	// the revision for `Path` as of this event. 0 for a delete event.
-	// undefined if the event does not represent a path operation.
+	// undefined if the event does not represent a path operation or
+	// is a directory event.
 	Rev int64
 
 	// the mutation that caused this event
@@ -24,6 +25,10 @@ func (e Event) Desc() string {
 		return "set"
 	case e.IsDel():
 		return "del"
+	case e.IsDirCreated():
+		return "mkdir"
+	case e.IsDirRemoved():
+		return "rmdir"
 	case e.IsNop():
 		return "nop"
 	}
@@ -46,7 +51,28 @@ func (e Event) IsDel() bool {
 
 // Returns true iff `e` does not represent a path operation.
 //
-// Mutually exclusive with `IsSet` and `IsDel`.
+// Mutually exclusive with `IsSet`, `IsDel`, and `IsDir`.
 func (e Event) IsNop() bool {
-	return e.Rev < Missing
+	return e.Rev < Missing && !e.IsDir()
+}
+
+// Returns true iff `e` is a directory event, made for a watch from
+// WatchDirs: the directory at `Path` came into or went out of being.
+// The change to the file that caused it has an event of its own.
+//
+// Mutually exclusive with `IsSet`, `IsDel`, and `IsNop`.
+func (e Event) IsDir() bool {
+	return e.IsDirCreated() || e.IsDirRemoved()
+}
+
+// Returns true iff `e` is the directory event for the creation of
+// the directory at `Path`.
+func (e Event) IsDirCreated() bool {
+	return e.Rev == dirCreated
+}
+
+// Returns true iff `e` is the directory event for the removal of
+// the directory at `Path`.
+func (e Event) IsDirRemoved() bool {
+	return e.Rev == dirRemoved
 }
@@ -2,6 +2,7 @@ package store
 
 import (
 	"sort"
+	"syscall"
 )
 
 type Getter interface {
@@ -40,6 +41,95 @@ func Getdir(g Getter, path string) (entries []string) {
 	return v
 }
 
+// Returns up to limit entries of the directory at path in g, starting
+// at offset, along with the total number of entries. Entries are in
+// sorted order, so the same window of the same revision is always the
+// same. A negative limit means no limit. An offset at or past the end
+// gives no entries.
+//
+// Returns ENOENT if path does not exist, ENOTDIR if it is a file, and
+// EINVAL if offset is negative.
+func GetdirRange(g Getter, path string, offset, limit int) (entries []string, total int, err error) {
+	v, rev := g.Get(path)
+	switch {
+	case rev == Missing:
+		return nil, 0, syscall.ENOENT
+	case rev != Dir:
+		return nil, 0, syscall.ENOTDIR
+	case offset < 0:
+		return nil, 0, syscall.EINVAL
+	}
+
+	total = len(v)
+	if offset >= total {
+		return []string{}, total, nil
+	}
+
+	sort.Strings(v)
+	v = v[offset:]
+	if limit >= 0 && limit < len(v) {
+		v = v[:limit]
+	}
+	return v, total, nil
+}
+
+// A DirEntry describes one entry of a directory.
+type DirEntry struct {
+	Name  string
+	Rev   int64 // Dir if the entry is a directory
+	Len   int32 // number of bytes in a file, or entries in a directory
+	IsDir bool
+}
+
+// Returns the entries of the directory at path in g, in sorted order,
+// each with its revision and length as given by g.Stat.
+//
+// Returns ENOENT if path does not exist and ENOTDIR if it is a file.
+func GetdirStat(g Getter, path string) ([]DirEntry, error) {
+	v, rev := g.Get(path)
+	switch {
+	case rev == Missing:
+		return nil, syscall.ENOENT
+	case rev != Dir:
+		return nil, syscall.ENOTDIR
+	}
+
+	prefix := path
+	if prefix == "/" {
+		prefix = ""
+	}
+
+	sort.Strings(v)
+	ents := make([]DirEntry, 0, len(v))
+	for _, name := range v {
+		if name == "" {
+			continue // an empty directory reads as one empty name
+		}
+		ln, rev := g.Stat(prefix + "/" + name)
+		ents = append(ents, DirEntry{name, rev, ln, rev == Dir})
+	}
+	return ents, nil
+}
+
+// A StatInfo describes a single file or directory.
+type StatInfo struct {
+	Rev   int64 // Dir if the node is a directory
+	IsDir bool
+	Len   int32 // number of bytes in a file, or entries in a directory
+}
+
+// Returns what g.Stat says of path, along with whether it is a
+// directory.
+//
+// Returns ENOENT if path does not exist.
+func StatEx(g Getter, path string) (StatInfo, error) {
+	ln, rev := g.Stat(path)
+	if rev == Missing {
+		return StatInfo{}, syscall.ENOENT
+	}
+	return StatInfo{rev, rev == Dir, ln}, nil
+}
+
 type Visitor func(path, body string, rev int64) (stop bool)
 
 func walk(g Getter, path string, glob *Glob, f Visitor) (stopped bool) {
@@ -58,6 +148,9 @@ func walk(g Getter, path string, glob *Glob, f Visitor) (stopped bool) {
 
 	sort.Strings(v)
 	for _, ent := range v {
+		if ent == "" {
+			continue // an empty directory reads as one empty name
+		}
 		stopped = walk(g, path+"/"+ent, glob, f)
 		if stopped {
 			return
@@ -72,6 +165,6 @@ func walk(g Getter, path string, glob *Glob, f Visitor) (stopped bool) {
 // Walk won't call f again.
 // Walk returns true if f returned true.
 func Walk(g Getter, glob *Glob, f Visitor) (stopped bool) {
-	// TODO find the longest non-glob prefix of glob.Pattern and start there
-	return walk(g, "/", glob, f)
+	prefix, _ := glob.Prefix()
+	return walk(g, prefix, glob, f)
 }
@@ -3,6 +3,7 @@ package store
 import (
 	"github.com/bmizerany/assert"
 	"sort"
+	"syscall"
 	"testing"
 )
 
@@ -44,6 +45,106 @@ func TestGetdirString(t *testing.T) {
 	assert.Equal(t, []string(nil), Getdir(st, "/x"))
 }
 
+func TestGetdirRange(t *testing.T) {
+	st := New()
+	for i, name := range []string{"d", "b", "e", "a", "c"} {
+		st.Ops <- Op{int64(i + 1), MustEncodeSet("/x/"+name, "", Clobber)}
+	}
+	sync(st, 5)
+
+	for _, c := range []struct {
+		offset, limit int
+		exp           []string
+	}{
+		{0, -1, []string{"a", "b", "c", "d", "e"}},
+		{0, 2, []string{"a", "b"}},
+		{2, 2, []string{"c", "d"}},
+		{4, 2, []string{"e"}},
+		{3, 100, []string{"d", "e"}},
+		{5, 2, []string{}},
+		{99, -1, []string{}},
+		{1, 0, []string{}},
+	} {
+		ents, total, err := GetdirRange(st, "/x", c.offset, c.limit)
+		assert.Equalf(t, nil, err, "%d,%d", c.offset, c.limit)
+		assert.Equalf(t, 5, total, "%d,%d", c.offset, c.limit)
+		assert.Equalf(t, c.exp, ents, "%d,%d", c.offset, c.limit)
+	}
+}
+
+func TestGetdirRangeErrors(t *testing.T) {
+	st := New()
+	st.Ops <- Op{1, MustEncodeSet("/x", "a", Clobber)}
+	sync(st, 1)
+
+	_, _, err := GetdirRange(st, "/y", 0, -1)
+	assert.Equal(t, syscall.ENOENT, err)
+	_, _, err = GetdirRange(st, "/x", 0, -1)
+	assert.Equal(t, syscall.ENOTDIR, err)
+	_, _, err = GetdirRange(st, "/", -1, -1)
+	assert.Equal(t, syscall.EINVAL, err)
+}
+
+func TestGetdirStat(t *testing.T) {
+	st := New()
+	st.Ops <- Op{1, MustEncodeSet("/x/b", "abc", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/x/a/1", "", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/x/a/2", "", Clobber)}
+	st.Ops <- Op{4, MustEncodeSet("/x/c", "", Clobber)}
+	sync(st, 4)
+
+	exp := []DirEntry{
+		{"a", Dir, 2, true},
+		{"b", 1, 3, false},
+		{"c", 4, 0, false},
+	}
+	ents, err := GetdirStat(st, "/x")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, exp, ents)
+
+	ents, err = GetdirStat(st, "/")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []DirEntry{{"x", Dir, 3, true}}, ents)
+}
+
+func TestGetdirStatErrors(t *testing.T) {
+	st := New()
+	st.Ops <- Op{1, MustEncodeSet("/x", "a", Clobber)}
+	sync(st, 1)
+
+	_, err := GetdirStat(st, "/y")
+	assert.Equal(t, syscall.ENOENT, err)
+	_, err = GetdirStat(st, "/x")
+	assert.Equal(t, syscall.ENOTDIR, err)
+}
+
+func TestStatEx(t *testing.T) {
+	st := New()
+	si, err := StatEx(st, "/")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, StatInfo{Dir, true, 0}, si)
+
+	st.Ops <- Op{1, MustEncodeSet("/x/a", "", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/x/b/c", "", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/y", "abc", Clobber)}
+	sync(st, 3)
+
+	si, err = StatEx(st, "/x")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, StatInfo{Dir, true, 2}, si)
+
+	si, err = StatEx(st, "/y")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, StatInfo{3, false, 3}, si)
+
+	si, err = StatEx(st, "/x/a")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, StatInfo{1, false, 0}, si)
+
+	_, err = StatEx(st, "/z")
+	assert.Equal(t, syscall.ENOENT, err)
+}
+
 func TestWalk(t *testing.T) {
 	exp := map[string]string{
 		"/d/x":   "1",
@@ -76,6 +177,40 @@ func TestWalk(t *testing.T) {
 	assert.Equal(t, 3, c)
 }
 
+func TestWalkAlternation(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, MustEncodeSet("/x/y", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/z", "2", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/x/w", "3", Clobber)}
+	sync(st, 3)
+
+	for _, pat := range []string{"/x/y|/z", "/z|/x/y"} {
+		var got []string
+		Walk(st, MustCompileGlob(pat), func(path, body string, rev int64) bool {
+			got = append(got, path)
+			return false
+		})
+		assert.Equal(t, []string{"/x/y", "/z"}, got, pat)
+	}
+}
+
+func TestWalkEmpty(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "a", Clobber)}
+	st.Ops <- Op{2, MustEncodeDel("/x", Clobber)}
+	sync(st, 2)
+
+	f := func(path, body string, rev int64) bool {
+		t.Fatalf("unexpected file %q", path)
+		return true
+	}
+	assert.T(t, !Walk(st, Any, f))
+	assert.T(t, !Walk(emptyDir, Any, f))
+}
+
 func TestWalkOneLevel(t *testing.T) {
 	exp := [][2]string{
 		{"/d/a/z", "3"},
@@ -94,6 +229,55 @@ func TestWalkOneLevel(t *testing.T) {
 	assert.Equal(t, exp, got)
 }
 
+type getRecorder struct {
+	Getter
+	paths []string
+}
+
+func (g *getRecorder) Get(path string) ([]string, int64) {
+	g.paths = append(g.paths, path)
+	return g.Getter.Get(path)
+}
+
+func TestWalkPrunesToPrefix(t *testing.T) {
+	st := New()
+	st.Ops <- Op{1, MustEncodeSet("/d/x", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/d/z/a", "3", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/m/y", "", Clobber)}
+	sync(st, 3)
+
+	_, g := st.Snap()
+	rg := &getRecorder{Getter: g}
+	var got []string
+	Walk(rg, MustCompileGlob("/d/z/*"), func(path, body string, rev int64) bool {
+		got = append(got, path)
+		return false
+	})
+	assert.Equal(t, []string{"/d/z/a"}, got)
+	assert.Equal(t, []string{"/d/z", "/d/z/a"}, rg.paths)
+}
+
+func TestWalkCompletePattern(t *testing.T) {
+	st := New()
+	st.Ops <- Op{1, MustEncodeSet("/d/x", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/d/y", "2", Clobber)}
+	sync(st, 2)
+
+	var got []string
+	Walk(st, MustCompileGlob("/d/y"), func(path, body string, rev int64) bool {
+		got = append(got, path)
+		return false
+	})
+	assert.Equal(t, []string{"/d/y"}, got)
+
+	got = nil
+	Walk(st, MustCompileGlob("/d/q"), func(path, body string, rev int64) bool {
+		got = append(got, path)
+		return false
+	})
+	assert.Equal(t, []string(nil), got)
+}
+
 func TestWalkStop(t *testing.T) {
 	exp := map[string]string{
 		"/d/x":   "1",
@@ -1,7 +1,9 @@
 package store
 
 import (
+	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -11,79 +13,535 @@ import (
 // Glob notation:
 //  - `?` matches a single char in a single path component
 //  - `*` matches zero or more chars in a single path component
-//  - `**` matches zero or more chars in zero or more components
+//  - `**` matches zero or more chars in zero or more components; where
+//    it makes up a whole component, as in `/a/**` or `/a/**/b`, the
+//    component may be left out, so these match `/a` and `/a/b`
+//  - `[abc]` matches one of the listed chars in a single path component;
+//    ranges such as `[a-z]` are allowed
+//  - `[!abc]` (or `[^abc]`) matches any char not listed, other than `/`
+//  - `{a,b,c}` matches any of the comma-separated alternatives, which may
+//    themselves be empty or contain further braces
+//  - `**{m,n}` is like `**`, but matches a span of at least m and at most
+//    n components; m may be omitted and defaults to zero, and where it
+//    is zero a whole component may be left out, as with `**`
+//  - `\*`, `\?` and `\\` match a literal `*`, `?` and `\` respectively
 //  - any other sequence matches itself
+//
+// Three or more `*` in a row are an error, a GlobStarsError.
+//
+// A pattern may begin with a flag group such as `(?i)`, which is
+// equivalent to compiling the rest of the pattern with the matching
+// GlobFlag. The only flag letter is `i`, for GlobCaseInsensitive.
 type Glob struct {
-	Pattern string         // original glob pattern
+	Pattern string         // original glob pattern, less any flag group
 	s       string         // translated to regexp pattern
 	r       *regexp.Regexp // compiled regexp
+	n       int            // number of wildcards in Pattern
+	groups  []int          // the wildcard each group of r captures
+	flags   GlobFlag       // flags given to CompileGlobFlags
+	literal bool           // Pattern has no wildcards; match by comparison
 }
 
-var globRePart = `/(` + charPat + `|[\*\?])+`
+// GlobFlag modifies how a pattern is compiled by CompileGlobFlags.
+type GlobFlag int
+
+const (
+	// GlobCaseInsensitive makes letters in the pattern match paths
+	// without regard to case.
+	GlobCaseInsensitive GlobFlag = 1 << iota
+)
+
+// String returns the flag group that CompileGlob accepts in place of f,
+// or "" if f is zero.
+func (f GlobFlag) String() string {
+	if f&GlobCaseInsensitive == 0 {
+		return ""
+	}
+	return "(?i)"
+}
+
+// parseGlobFlags splits a leading flag group off pat.
+func parseGlobFlags(pat string) (rest string, flags GlobFlag, err error) {
+	if !strings.HasPrefix(pat, "(?") {
+		return pat, 0, nil
+	}
+
+	end := strings.IndexRune(pat, ')')
+	if end < 0 {
+		return "", 0, GlobError(pat)
+	}
+
+	for _, c := range pat[2:end] {
+		switch c {
+		case 'i':
+			flags |= GlobCaseInsensitive
+		default:
+			return "", 0, GlobError(pat)
+		}
+	}
+	return pat[end+1:], flags, nil
+}
+
+// globMeta holds the chars that give a pattern meaning beyond a literal
+// path.
+const globMeta = "*?[{|\\"
+
+var globClassPat = `\[[!^]?` + charPat + `+\]`
+var globEscPat = `\\[\*\?\\]`
+var globBoundPat = `\*\*\{[0-9]*,[0-9]+\}`
+var globRePart = `/(` + charPat + `|` + globClassPat + `|` + globEscPat + `|` + globBoundPat + `|[\*\?,])+`
+
+// maxGlobBound is the largest n allowed in `**{m,n}`; it keeps the
+// translated repetition within what package regexp accepts.
+const maxGlobBound = 1000
+
 var globRe = regexp.MustCompile(`^/$|^((` + globRePart + `)+\|)*(` + globRePart + `)+$`)
 
 // Supports unix/ruby-style glob patterns:
 //  - `?` matches a single char in a single path component
 //  - `*` matches zero or more chars in a single path component
 //  - `**` matches zero or more chars in zero or more components
+//  - `**{m,n}` matches between m and n components
+//  - `[...]` matches a single char from a class in a single path component
+//  - `[!...]` and `[^...]` match a single char not in the class
+//  - `\` escapes a following `*`, `?` or `\`
 //  - `|` allows for alternate paths to be matched
+//  - `,` outside braces stands for itself
+//
+// Each branch of an alternation is translated and anchored on its own,
+// so that every branch must match the whole path by itself.
 func translateGlob(pat string) (string, error) {
 	if !globRe.MatchString(pat) {
 		return "", GlobError(pat)
 	}
 
-	outs := make([]string, len(pat))
-	groupPattern := false
-	i, double := 0, false
-	for _, c := range pat {
+	var b strings.Builder
+	b.Grow(2 * len(pat))
+	for i, br := range strings.Split(pat, "|") {
+		if i > 0 {
+			b.WriteByte('|')
+		}
+		b.WriteByte('^')
+		if err := translateBranch(&b, br); err != nil {
+			return "", GlobError(pat)
+		}
+		b.WriteByte('$')
+	}
+	return b.String(), nil
+}
+
+// Chars that stand for themselves in a pattern, but not in a regexp,
+// and the same chars quoted, two bytes each.
+const (
+	regexpSpecials = `.+-^$]()*?\`
+	quotedSpecials = `\.\+\-\^\$\]\(\)\*\?\\`
+)
+
+func quoteSpecial(c rune) string {
+	j := strings.IndexRune(regexpSpecials, c)
+	return quotedSpecials[2*j : 2*j+2]
+}
+
+// Translates one branch of a pattern that globRe has matched into b,
+// as an unanchored regexp.
+//
+// Each char of pat gives one piece of the regexp, perhaps empty. A
+// `**`, and the bound after one, rewrite the pieces of the two chars
+// before them, so those two are held back from b until the next.
+func translateBranch(b *strings.Builder, pat string) error {
+	var prev [2]string // the pieces of the two chars before this one
+	put := func(piece string) {
+		b.WriteString(prev[0])
+		prev[0], prev[1] = prev[1], piece
+	}
+
+	double, class, escaped, whole, skip := false, false, false, false, 0
+	stars := 0 // in the run of them ending here
+	for k, c := range pat {
+		if skip > 0 {
+			skip--
+			put("")
+			continue
+		}
+
+		// globRe admits only ASCII, so c is pat[k].
+		lit := pat[k : k+1]
+
+		if escaped {
+			put(quoteSpecial(c))
+			escaped = false
+			continue
+		}
+
+		if class {
+			// globRe guarantees the class holds only path chars, so it
+			// can be copied verbatim and will never match a slash.
+			// A negated class must exclude the slash explicitly.
+			switch c {
+			case '!', '^':
+				put(`^/`)
+			default:
+				put(lit)
+			}
+			class = c != ']'
+			continue
+		}
+
+		if c == '*' {
+			stars++
+		} else {
+			stars = 0
+		}
+		if stars > 2 {
+			return GlobError(pat)
+		}
+
 		switch c {
-		case '|':
-			groupPattern = true
-			fallthrough
 		default:
-			outs[i] = string(c)
+			put(lit)
 			double = false
-		case '.', '+', '-', '^', '$', '[', ']', '(', ')':
-			outs[i] = `\` + string(c)
+		case '.', '+', '-', '^', '$', ']', '(', ')':
+			put(quoteSpecial(c))
 			double = false
+		case '[':
+			body := pat[k+1 : k+strings.IndexRune(pat[k:], ']')]
+			if !validClass(strings.TrimLeft(body, "!^")) {
+				return GlobError(pat)
+			}
+			put(`[`)
+			double, class = false, true
 		case '?':
-			outs[i] = `[^/]`
+			put(`([^/])`)
 			double = false
+		case '\\':
+			put("")
+			double, escaped = false, true
+		case '{':
+			// globRe only lets a brace through as the bound of a `**`,
+			// whose translation sits two places back.
+			end := strings.IndexRune(pat[k:], '}')
+			body := pat[k+1 : k+end]
+			re, ok := translateBound(body)
+			if !ok {
+				return GlobError(pat)
+			}
+			if whole {
+				// As for a bare `**`, a span that may be empty may
+				// leave the component out, slash and all.
+				re = "/" + re
+				if lo, _ := strconv.Atoi(body[:strings.IndexRune(body, ',')]); lo == 0 {
+					re = "(?:" + re + ")?"
+				}
+			}
+			prev[0] = re
+			put("")
+			skip, whole = end, false
 		case '*':
-			if double {
-				outs[i-1] = `.*`
+			if double && wholeDouble(pat, k) {
+				// The component may be left out altogether, slash and
+				// all, so that `/a/**` matches `/a` and `/a/**/b`
+				// matches `/a/b`.
+				prev[0], prev[1] = `(?:/(.*))?`, ""
+				put("")
+			} else if double && wholeBounded(pat, k) {
+				// A whole component, bounded: the slash before is
+				// left for the bound to put back.
+				prev[0], prev[1] = "", `(.*)`
+				put("")
+				whole = true
+			} else if double {
+				prev[1] = `(.*)`
+				put("")
 			} else {
-				outs[i] = `[^/]*`
+				put(`([^/]*)`)
 			}
 			double = !double
 		}
-		i++
 	}
-	outs = outs[0:i]
-	outPat := strings.Join(outs, "")
-	if groupPattern {
-		/* We have to group the entire pattern when using alternation because
-		 * otherwise the pipe matches a literal pipe */
-		outPat = "(" + outPat + ")"
+	b.WriteString(prev[0])
+	b.WriteString(prev[1])
+	return nil
+}
+
+// wholeDouble reports whether the `**` ending at pat[k], a branch,
+// makes up a whole path component, other than the whole branch: it has
+// a slash before it and a slash or the end of pat after it, and is not
+// bounded. A branch that is just `/**` has to match at least `/`.
+func wholeDouble(pat string, k int) bool {
+	if pat[k-2] != '/' {
+		return false
+	}
+	end := k+1 == len(pat)
+	if !end && pat[k+1] != '/' {
+		return false
 	}
+	return !(k == 2 && end)
+}
 
-	return "^" + outPat + "$", nil
+// wholeBounded is like wholeDouble, for a `**` followed by a bound.
+func wholeBounded(pat string, k int) bool {
+	if pat[k-2] != '/' || k+1 == len(pat) || pat[k+1] != '{' {
+		return false
+	}
+	end := k + 1 + strings.IndexRune(pat[k+1:], '}') + 1
+	if end < len(pat) && pat[end] != '/' {
+		return false
+	}
+	return !(k == 2 && end == len(pat))
+}
+
+// translateBound returns a regexp matching a span of path components
+// whose count lies within the bound given by body, of the form "m,n".
+func translateBound(body string) (string, bool) {
+	comma := strings.IndexRune(body, ',')
+	lo, hi := 0, 0
+	var err error
+	if comma > 0 {
+		lo, err = strconv.Atoi(body[:comma])
+		if err != nil {
+			return "", false
+		}
+	}
+	hi, err = strconv.Atoi(body[comma+1:])
+	if err != nil || lo > hi || hi > maxGlobBound {
+		return "", false
+	}
+
+	if hi == 0 {
+		return `()`, true
+	}
+	if lo > 0 {
+		lo--
+	}
+	return fmt.Sprintf(`([^/]*(?:/[^/]*){%d,%d})`, lo, hi-1), true
+}
+
+// validClass reports whether every range in the body of a character
+// class runs from a low char to a high one.
+func validClass(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if i+2 < len(s) && s[i+1] == '-' {
+			if s[i] > s[i+2] {
+				return false
+			}
+			i += 2
+		}
+	}
+	return true
+}
+
+// The most patterns expandBraces may make of one, and the deepest it
+// may find braces nested. Each group of alternatives multiplies the
+// patterns by its size, so without a limit a short pattern could keep
+// the store busy, or exhaust its memory, expanding it.
+const (
+	maxGlobBranches = 1024
+	maxBraceDepth   = 16
+)
+
+// expandBraces expands each `{...}` alternation in pat, returning one
+// pattern per combination of alternatives. Commas outside braces are
+// left alone. More than maxGlobBranches patterns, or braces nested more
+// than maxBraceDepth deep, are a GlobError.
+func expandBraces(pat string) ([]string, error) {
+	pats, _, err := expandBracesAt(pat, nil)
+	return pats, err
+}
+
+// Like expandBraces, but also returns, for each pattern, the offset of
+// each of its bytes in the pattern first given. At holds those offsets
+// for pat, or is nil if pat is the first.
+func expandBracesAt(pat string, at []int) ([]string, [][]int, error) {
+	if at == nil {
+		at = make([]int, len(pat))
+		for i := range at {
+			at[i] = i
+		}
+	}
+
+	open := indexBrace(pat)
+	if open < 0 {
+		return []string{pat}, [][]int{at}, nil
+	}
+	if pat[open] == '}' {
+		return nil, nil, GlobError(pat)
+	}
+
+	var alts [][2]int // start and end of each alternative
+	depth, start := 0, open+1
+	for i := open; i < len(pat); i++ {
+		switch pat[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+			if depth > maxBraceDepth {
+				return nil, nil, GlobError(pat)
+			}
+		case ',':
+			if depth == 1 {
+				alts = append(alts, [2]int{start, i})
+				start = i + 1
+			}
+		case '}':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			alts = append(alts, [2]int{start, i})
+
+			var pats []string
+			var ats [][]int
+			for _, alt := range alts {
+				var altAt []int
+				altAt = append(altAt, at[:open]...)
+				altAt = append(altAt, at[alt[0]:alt[1]]...)
+				altAt = append(altAt, at[i+1:]...)
+				exp, expAt, err := expandBracesAt(pat[:open]+pat[alt[0]:alt[1]]+pat[i+1:], altAt)
+				if err != nil {
+					return nil, nil, GlobError(pat)
+				}
+				pats = append(pats, exp...)
+				ats = append(ats, expAt...)
+				if len(pats) > maxGlobBranches {
+					return nil, nil, GlobError(pat)
+				}
+			}
+			return pats, ats, nil
+		}
+	}
+	return nil, nil, GlobError(pat)
+}
+
+// wildcards returns the offset in pat of each `?`, `*` and `**`, in
+// order. Those in a character class, or escaped, are not wildcards, and
+// neither is the bound after a `**`.
+func wildcards(pat string) (offs []int) {
+	for i := 0; i < len(pat); i++ {
+		switch pat[i] {
+		case '\\':
+			i++
+		case '[':
+			if end := strings.IndexRune(pat[i:], ']'); end > 0 {
+				i += end
+			}
+		case '?':
+			offs = append(offs, i)
+		case '*':
+			offs = append(offs, i)
+			if i+1 < len(pat) && pat[i+1] == '*' {
+				i++
+				if i+1 < len(pat) && pat[i+1] == '{' {
+					if end := strings.IndexRune(pat[i:], '}'); end > 0 {
+						i += end
+					}
+				}
+			}
+		}
+	}
+	return offs
+}
+
+// indexBrace returns the index of the first unescaped brace in pat,
+// or -1 if there is none. The bound of a `**{m,n}` is not an
+// alternation and is passed over.
+func indexBrace(pat string) int {
+	stars := 0
+	for i := 0; i < len(pat); i++ {
+		switch pat[i] {
+		case '\\':
+			i++
+			stars = 0
+		case '*':
+			stars++
+		case '{':
+			if stars == 2 {
+				if end := strings.IndexRune(pat[i:], '}'); end > 0 {
+					i += end
+					stars = 0
+					continue
+				}
+			}
+			return i
+		case '}':
+			return i
+		default:
+			stars = 0
+		}
+	}
+	return -1
 }
 
 // CompileGlob translates pat into a form more convenient for
 // matching against paths in the store.
+//
+// Brace alternations are expanded first, and each resulting branch
+// must be a valid glob on its own. The store holds only absolute
+// paths, so a pattern that doesn't begin with a slash, after any flag
+// group, is a GlobError. This holds even for one like `{/a,/b}`, which
+// can be written `/{a,b}`.
 func CompileGlob(pat string) (*Glob, error) {
-	s, err := translateGlob(pat)
+	return CompileGlobFlags(pat, 0)
+}
+
+// CompileGlobFlags is like CompileGlob, but the returned glob matches
+// according to flags, in addition to any flag group in pat.
+func CompileGlobFlags(pat string, flags GlobFlag) (*Glob, error) {
+	if off, n := starRun(pat); n > 2 {
+		return nil, &GlobStarsError{pat, off, n}
+	}
+
+	pat, f, err := parseGlobFlags(pat)
+	if err != nil {
+		return nil, err
+	}
+	flags |= f
+
+	if !strings.HasPrefix(pat, "/") {
+		return nil, GlobError(pat)
+	}
+
+	pats, ats, err := expandBracesAt(pat, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	// Each wildcard of each expanded pattern is captured by one group,
+	// in order; note which wildcard of pat it came from.
+	wild := map[int]int{}
+	for i, off := range wildcards(pat) {
+		wild[off] = i
+	}
+	var groups []int
+	for j, p := range pats {
+		for _, off := range wildcards(p) {
+			groups = append(groups, wild[ats[j][off]])
+		}
+	}
+
+	s, err := translateGlob(strings.Join(pats, "|"))
+	if err != nil {
+		return nil, GlobError(pat)
+	}
+
+	if flags&GlobCaseInsensitive != 0 {
+		s = "(?i)" + s
+	}
+
 	r, err := regexp.Compile(s)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Glob{pat, s, r}, nil
+	return &Glob{
+		Pattern: pat,
+		s:       s,
+		r:       r,
+		n:       len(wild),
+		groups:  groups,
+		flags:   flags,
+		literal: flags&GlobCaseInsensitive == 0 && !strings.ContainsAny(pat, globMeta),
+	}, nil
 }
 
 // MustCompileGlob is like CompileGlob, but it panics if an error occurs,
@@ -97,9 +555,143 @@ func MustCompileGlob(pat string) *Glob {
 }
 
 func (g *Glob) Match(path string) bool {
+	if g.literal {
+		return path == g.Pattern
+	}
 	return g.r.MatchString(path)
 }
 
+// String returns the source text of g, with a flag group in front of
+// the pattern if g was compiled with any flags. Compiling it yields a
+// glob equivalent to g.
+func (g *Glob) String() string {
+	return g.flags.String() + g.Pattern
+}
+
+// IsLiteral reports whether g matches exactly one path, its Pattern.
+func (g *Glob) IsLiteral() bool {
+	return g.literal
+}
+
+// Prefix returns the longest literal directory prefix of g: every path
+// that g matches is prefix itself or lies beneath it. If g contains no
+// wildcards at all, prefix is the whole pattern and complete is true.
+// For an alternation, prefix is the directory common to every branch.
+//
+// A case-insensitive glob has no literal prefix, so Prefix returns "/"
+// for it.
+func (g *Glob) Prefix() (prefix string, complete bool) {
+	if g.flags&GlobCaseInsensitive != 0 {
+		return "/", false
+	}
+	if !strings.ContainsRune(g.Pattern, '|') {
+		return branchPrefix(g.Pattern)
+	}
+
+	// A `|` may sit inside braces, so split the expanded patterns.
+	pats, _ := expandBraces(g.Pattern)
+	prefix = ""
+	for _, br := range strings.Split(strings.Join(pats, "|"), "|") {
+		p, _ := branchPrefix(br)
+		if prefix == "" {
+			prefix = p
+		}
+		for !hasDirPrefix(p, prefix) {
+			prefix = prefix[:strings.LastIndex(prefix, "/")]
+			if prefix == "" {
+				prefix = "/"
+			}
+		}
+	}
+	return prefix, false
+}
+
+// Like Prefix, for one branch of a pattern.
+func branchPrefix(pat string) (prefix string, complete bool) {
+	i := strings.IndexAny(pat, globMeta)
+	if i < 0 {
+		return pat, true
+	}
+
+	prefix = pat[:strings.LastIndex(pat[:i], "/")]
+	if prefix == "" {
+		prefix = "/"
+	}
+	return prefix, false
+}
+
+// hasDirPrefix reports whether path is dir or lies beneath it.
+func hasDirPrefix(path, dir string) bool {
+	return path == dir || dir == "/" || strings.HasPrefix(path, dir+"/")
+}
+
+// FindSubmatch reports whether path matches g and, if so, returns the
+// text matched by each `?`, `*` and `**` in g, in the order the wildcards
+// appear in the pattern. A `**` yields its whole span, slashes included.
+//
+// The returned slice always has NumWildcards elements; wildcards in a
+// branch of an alternation that did not match are returned as "". A
+// wildcard inside braces, or after them, appears in more than one
+// branch, and is returned from the branch that matched.
+func (g *Glob) FindSubmatch(path string) ([]string, bool) {
+	m := g.r.FindStringSubmatch(path)
+	if m == nil {
+		return nil, false
+	}
+	subs := make([]string, g.n)
+	for i, w := range g.groups {
+		if m[i+1] != "" {
+			subs[w] = m[i+1]
+		}
+	}
+	return subs, true
+}
+
+// NumWildcards returns the number of wildcards in g, which is the
+// number of strings returned by FindSubmatch.
+func (g *Glob) NumWildcards() int {
+	return g.n
+}
+
+// starRun returns the offset and length of the first run of three or
+// more unescaped `*` in pat; n is less than three if there is none.
+func starRun(pat string) (off, n int) {
+	escaped := false
+	for k, c := range pat {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '*':
+			i := k
+			for i < len(pat) && pat[i] == '*' {
+				i++
+			}
+			if i-k > n {
+				off, n = k, i-k
+			}
+			if n > 2 {
+				return off, n
+			}
+		}
+	}
+	return off, n
+}
+
+// GlobStarsError is the error for a pattern with a run of three or
+// more `*`, which means nothing in glob notation; it is most likely a
+// typo for `*` or `**`.
+type GlobStarsError struct {
+	Pattern string
+	Offset  int // of the first `*` in the run
+	Len     int
+}
+
+func (e *GlobStarsError) Error() string {
+	return fmt.Sprintf("invalid glob pattern: %s: %d stars at offset %d", e.Pattern, e.Len, e.Offset)
+}
+
 type GlobError string
 
 func (e GlobError) Error() string {
@@ -2,7 +2,9 @@ package store
 
 import (
 	"github.com/bmizerany/assert"
+	"strings"
 	"testing"
+	"time"
 )
 
 var globs = [][]string{
@@ -10,18 +12,42 @@ var globs = [][]string{
 	{"/a", `^/a$`},
 	{"/a.b", `^/a\.b$`},
 	{"/a-b", `^/a\-b$`},
-	{"/a?", `^/a[^/]$`},
+	{"/a,b", `^/a,b$`},
+	{"/a?", `^/a([^/])$`},
 	{"/a/b", `^/a/b$`},
-	{"/*", `^/[^/]*$`},
-	{"/*/a", `^/[^/]*/a$`},
-	{"/*a/b", `^/[^/]*a/b$`},
-	{"/a*/b", `^/a[^/]*/b$`},
-	{"/a*a/b", `^/a[^/]*a/b$`},
-	{"/*a*/b", `^/[^/]*a[^/]*/b$`},
-	{"/**", `^/.*$`},
-	{"/**/a", `^/.*/a$`},
-	{"/a|/b", "^(/a|/b)$"},
-	{"/a/**/b/*|/c", "^(/a/.*/b/[^/]*|/c)$"},
+	{"/*", `^/([^/]*)$`},
+	{"/*/a", `^/([^/]*)/a$`},
+	{"/*a/b", `^/([^/]*)a/b$`},
+	{"/a*/b", `^/a([^/]*)/b$`},
+	{"/a*a/b", `^/a([^/]*)a/b$`},
+	{"/*a*/b", `^/([^/]*)a([^/]*)/b$`},
+	{"/**", `^/(.*)$`},
+	{"/**/a", `^(?:/(.*))?/a$`},
+	{"/a/**", `^/a(?:/(.*))?$`},
+	{"/a/**/b", `^/a(?:/(.*))?/b$`},
+	{"/a/b**", `^/a/b(.*)$`},
+	{"/a/**b", `^/a/(.*)b$`},
+	{"/**|/a/**", `^/(.*)$|^/a(?:/(.*))?$`},
+	{"/a|/b", "^/a$|^/b$"},
+	{"/a/**/b/*|/c", "^/a(?:/(.*))?/b/([^/]*)$|^/c$"},
+	{"/[ab]", `^/[ab]$`},
+	{"/a[0-9]*", `^/a[0-9]([^/]*)$`},
+	{"/[a-z.]/b", `^/[a-z.]/b$`},
+	{"/[!.]*", `^/[^/.]([^/]*)$`},
+	{"/[^a-c]", `^/[^/a-c]$`},
+	{"/[!x]", `^/[^/x]$`},
+	{`/a\*b`, `^/a\*b$`},
+	{`/a\?`, `^/a\?$`},
+	{`/a\\b`, `^/a\\b$`},
+	{`/a\**`, `^/a\*([^/]*)$`},
+	{`/a*\*`, `^/a([^/]*)\*$`},
+	{`/a\\*`, `^/a\\([^/]*)$`},
+	{"/a/**{,2}", `^/a(?:/([^/]*(?:/[^/]*){0,1}))?$`},
+	{"/a/**{2,3}/b", `^/a/([^/]*(?:/[^/]*){1,2})/b$`},
+	{"/a/**{0,1}", `^/a(?:/([^/]*(?:/[^/]*){0,0}))?$`},
+	{"/a/**{,0}", `^/a(?:/())?$`},
+	{"/**{,2}", `^/([^/]*(?:/[^/]*){0,1})$`},
+	{"/a**{,2}", `^/a([^/]*(?:/[^/]*){0,1})$`},
 }
 
 var matches = [][]string{
@@ -30,6 +56,36 @@ var matches = [][]string{
 	{"/a*", "/a", "/ab", "/abc"},
 	{"/a**", "/a", "/ab", "/abc", "/a/", "/a/b", "/ab/c"},
 	{"/a/*/b|/c/*/d", "/a/qwer/b", "/a/uiop/b", "/c/qwer/d", "/c/uiop/d"},
+	{"/[ab]*/status", "/a/status", "/b/status", "/apple/status", "/bee/status"},
+	{"/node[0-9]", "/node0", "/node5", "/node9"},
+	{"/[a-c.]x", "/ax", "/bx", "/.x"},
+	{"/app/[!.]*", "/app/a", "/app/config", "/app/x.y"},
+	{"/[^a-c]", "/d", "/z", "/0"},
+	{"/ctl/node/{1,2,3}/addr", "/ctl/node/1/addr", "/ctl/node/2/addr", "/ctl/node/3/addr"},
+	{"/a{,x}", "/a", "/ax"},
+	{"/{a,b{c,d}}/*", "/a/x", "/bc/y", "/bd/z"},
+	{"/{a,b}|/c", "/a", "/b", "/c"},
+	{`/a\*b`, "/a*b"},
+	{`/a\?`, "/a?"},
+	{`/a\\b`, `/a\b`},
+	{`/a\**`, "/a*", "/a*b"},
+	{`/a\***`, "/a*", "/a*b", "/a*b/c"},
+	{`/\\{a,b}`, `/\a`, `/\b`},
+
+	// A whole-component `**` spans zero or more components.
+	{"/**", "/", "/a", "/a/b/c"},
+	{"/**/a", "/a", "/b/a", "/b/c/a"},
+	{"/a/**", "/a", "/a/b", "/a/b/c"},
+	{"/a/**/b", "/a/b", "/a/x/b", "/a/x/y/b"},
+	{"/a/**/b/**", "/a/b", "/a/x/b", "/a/b/y", "/a/x/b/y/z"},
+	{"/a/**|/c", "/a", "/a/b", "/c"},
+	{"/{a,b}/**", "/a", "/b/c"},
+	{"/a,b", "/a,b"},
+	{"/a,{b,c}/*,", "/a,b/x,", "/a,c/,"},
+	{"/a/**{,2}", "/a", "/a/", "/a/b", "/a/b/c"},
+	{"/a/**{,2}/b/c**{,3}", "/a/b/cq", "/a/x/b/c", "/a/x/y/b/cq/r"},
+	{"/a/**{,2}/z", "/a/z", "/a/b/z", "/a/b/c/z"},
+	{"/a/**{1,2}/z", "/a/b/z", "/a/b/c/z"},
 }
 
 var nonMatches = [][]string{
@@ -38,6 +94,26 @@ var nonMatches = [][]string{
 	{"/a*", "/", "/a/", "/ba"},
 	{"/a**", "/", "/ba"},
 	{"/a/*/b|/c/*/d", "/a/qwer/d", "/a", "/d", "/a/qwer/b|", "|/c/uiop/d"},
+	{"/[ab]*/status", "/c/status", "/status", "/a/b/status", "/[ab]/status"},
+	{"/node[0-9]", "/node", "/nodea", "/node10", "/node/"},
+	{"/[a-c.]x", "/dx", "/x", "//x", "/abx"},
+	{"/app/[!.]*", "/app/.", "/app/.ctl", "/app/", "/app//x"},
+	{"/[^a-c]", "/a", "/c", "//", "/"},
+	{"/a[!x]b", "/axb", "/a/b", "/ab"},
+	{"/ctl/node/{1,2,3}/addr", "/ctl/node/4/addr", "/ctl/node/12/addr", "/ctl/node/{1,2,3}/addr"},
+	{"/a{,x}", "/x", "/axx", "/a,x"},
+	{"/{a,b{c,d}}/*", "/b/x", "/bcd/y", "/c/z"},
+	{`/a\*b`, "/axb", "/ab", "/a/b", `/a\*b`},
+	{`/a\?`, "/ab", "/a", `/a\b`},
+	{`/a\\b`, "/ab", `/a\\b`},
+	{`/a\**`, "/a", "/ab", "/a*/b"},
+	{"/a/**{,2}", "/a/b/c/d", "/ab", "/b/c"},
+	{"/a/**{2,3}/z", "/a/b/z", "/a/b/c/d/e/z"},
+	{"/a/**{,0}", "/a/b", "/a/b/c"},
+	{"/**/a", "/", "/ab", "/b/ab", "/a/b"},
+	{"/a/**", "/", "/ab", "/ab/c", "/b/a"},
+	{"/a/**/b", "/a", "/ab", "/a/xb", "/a/b/c", "/ab/b"},
+	{"/a/**|/c", "/", "/ab", "/c/d"},
 }
 
 var dontCompile = []string{
@@ -53,6 +129,39 @@ var dontCompile = []string{
 	"/a$b",
 	"/a[b",
 	"/a]b",
+	"/foo[bar",
+	"/a[]",
+	"/a[b/c]",
+	"/a[*]",
+	"/a[z-a]",
+	"/a[!]",
+	"/a[^]",
+	"/a[!!b]",
+	"/a[b!]",
+	"/a[!z-a]",
+	"/a{b",
+	"/a}b",
+	"/a{b}}",
+	"/a{{b}",
+	"/a{b,/}",
+	`/a\`,
+	`/a\b`,
+	`/a\/b`,
+	"/***",
+	"/a/***/b",
+	"/a/****",
+	"/a***",
+	"/a/**{,2}***",
+	`/a\.`,
+	`/a\[b]`,
+	"/a/**{,}",
+	"/a/**{2,1}",
+	"/a/**{2}",
+	"/a/**{}",
+	"/a/**{a,2}",
+	"/a/**{-1,2}",
+	"/a/**{,1001}",
+	"/a/**{,2",
 	"/a(b",
 	"/a)b",
 	"/a世界",
@@ -74,6 +183,79 @@ func TestGlobTranslateOk(t *testing.T) {
 	}
 }
 
+var braces = [][]string{
+	{"/a", "/a"},
+	{"/a,b", "/a,b"},
+	{"/{a,b}", "/a", "/b"},
+	{"/a{,x}", "/a", "/ax"},
+	{"/{a,b}/{c,d}", "/a/c", "/a/d", "/b/c", "/b/d"},
+	{"/{a,b{c,d}}", "/a", "/bc", "/bd"},
+	{"/{a}", "/a"},
+	{"/a,{b,c}", "/a,b", "/a,c"},
+	{`/a\*{b,c}`, `/a\*b`, `/a\*c`},
+	{`/a\\{b,c}`, `/a\\b`, `/a\\c`},
+	{"/a/**{,2}", "/a/**{,2}"},
+	{"/{a,b}/**{1,2}", "/a/**{1,2}", "/b/**{1,2}"},
+	{"/{a/**{,2},c}", "/a/**{,2}", "/c"},
+	{"/*{a,b}", "/*a", "/*b"},
+	{`/\**{a,b}`, `/\**a`, `/\**b`},
+}
+
+var badBraces = []string{
+	"/{",
+	"/}",
+	"/{a,b",
+	"/a,b}",
+	"/{a}}",
+	"/{{a}",
+}
+
+func TestGlobExpandBraces(t *testing.T) {
+	for _, parts := range braces {
+		pat, exp := parts[0], parts[1:]
+		got, err := expandBraces(pat)
+		assert.Equal(t, nil, err, pat)
+		assert.Equal(t, exp, got, pat)
+	}
+}
+
+func TestGlobExpandBracesError(t *testing.T) {
+	for _, pat := range badBraces {
+		got, err := expandBraces(pat)
+		assert.Equal(t, GlobError(pat), err, pat)
+		assert.Equal(t, []string(nil), got, pat)
+	}
+}
+
+func TestGlobExpandBracesLimits(t *testing.T) {
+	// 2^18 branches.
+	pat := "/" + strings.Repeat("{a,b}", 18)
+	start := time.Now()
+	_, err := CompileGlob(pat)
+	assert.Equal(t, GlobError(pat), err)
+	assert.T(t, time.Since(start) < time.Second, time.Since(start))
+
+	pat = "/" + strings.Repeat("{a,b}", 10)
+	pats, err := expandBraces(pat)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, maxGlobBranches, len(pats))
+
+	pat = "/" + strings.Repeat("{a,", maxBraceDepth+1) + strings.Repeat("}", maxBraceDepth+1)
+	_, err = expandBraces(pat)
+	assert.Equal(t, GlobError(pat), err)
+}
+
+func TestGlobRelative(t *testing.T) {
+	for _, pat := range []string{"", "a", "foo/*", "*", "**", "a/b", "(?i)", "(?i)a/*", "{a,/b}", "{/a,/b}", "|/a"} {
+		_, err := CompileGlob(pat)
+		assert.Equalf(t, GlobError(strings.TrimPrefix(pat, "(?i)")), err, "%q", pat)
+	}
+	for _, pat := range []string{"/", "/a/*", "(?i)/a", "/{a,b}"} {
+		_, err := CompileGlob(pat)
+		assert.Equalf(t, nil, err, "%q", pat)
+	}
+}
+
 func TestGlobTranslateError(t *testing.T) {
 	for _, pat := range dontCompile {
 		re, err := translateGlob(pat)
@@ -89,6 +271,28 @@ func TestGlobTranslateError(t *testing.T) {
 	}
 }
 
+var starRuns = []struct {
+	pat string
+	off int
+	n   int
+}{
+	{"/a/***/b", 3, 3},
+	{"/a/****", 3, 4},
+	{"/a*/b***", 5, 3},
+	{`/\****`, 3, 3},
+	{"(?i)/***", 5, 3},
+}
+
+func TestGlobStarsError(t *testing.T) {
+	for _, x := range starRuns {
+		_, err := CompileGlob(x.pat)
+		assert.Equal(t, &GlobStarsError{x.pat, x.off, x.n}, err, x.pat)
+	}
+
+	_, err := CompileGlob("/a/***/b")
+	assert.Equal(t, "invalid glob pattern: /a/***/b: 3 stars at offset 3", err.Error())
+}
+
 func TestGlobMatches(t *testing.T) {
 	for _, parts := range matches {
 		pat, paths := parts[0], parts[1:]
@@ -102,6 +306,201 @@ func TestGlobMatches(t *testing.T) {
 	}
 }
 
+var submatches = [][]string{
+	{"/a", "/a"},
+	{"/a/*", "/a/b", "b"},
+	{"/services/*/*/status", "/services/web/3/status", "web", "3"},
+	{"/a?c", "/abc", "b"},
+	{"/a/**", "/a/b/c/d", "b/c/d"},
+	{"/a/**", "/a", ""},
+	{"/a/**/b", "/a/b", ""},
+	{"/a/**/b", "/a/x/y/b", "x/y"},
+	{"/**/x/*", "/a/b/x/y", "a/b", "y"},
+	{"/a/*|/b/*", "/b/x", "", "x"},
+	{"/a/*|/b/**", "/a/x", "x", ""},
+	{"/a/{x,y}/*", "/a/y/q", "q"},
+	{"/{a*,b}/*", "/b/q", "", "q"},
+	{"/{a*,b}/*", "/ax/q", "x", "q"},
+	{"/{a,b/**{,2}}/*", "/b/c/d/q", "c/d", "q"},
+	{"/x/?|/{a,b}/[cd]*", "/b/cz", "", "z"},
+	{"/[ab]*", "/abc", "bc"},
+	{`/\**`, "/*x", "x"},
+}
+
+func TestGlobFindSubmatch(t *testing.T) {
+	for _, parts := range submatches {
+		pat, path, exp := parts[0], parts[1], parts[2:]
+		glob, err := CompileGlob(pat)
+		assert.Equal(t, nil, err)
+		got, ok := glob.FindSubmatch(path)
+		assert.Tf(t, ok, "pat %q should match %q", pat, path)
+		assert.Equal(t, exp, got, pat)
+		assert.Equal(t, len(exp), glob.NumWildcards(), pat)
+	}
+}
+
+func TestGlobFindSubmatchNoMatch(t *testing.T) {
+	glob := MustCompileGlob("/a/*")
+	got, ok := glob.FindSubmatch("/b/c")
+	assert.T(t, !ok)
+	assert.Equal(t, []string(nil), got)
+}
+
+func TestGlobCaseInsensitive(t *testing.T) {
+	glob, err := CompileGlobFlags("/Services/*", GlobCaseInsensitive)
+	assert.Equal(t, nil, err)
+	assert.T(t, glob.Match("/services/web"))
+	assert.T(t, glob.Match("/SERVICES/web"))
+	assert.T(t, glob.Match("/Services/web"))
+	assert.T(t, !glob.Match("/services/web/x"))
+}
+
+func TestGlobCaseSensitiveByDefault(t *testing.T) {
+	glob, err := CompileGlobFlags("/Services/*", 0)
+	assert.Equal(t, nil, err)
+	assert.T(t, glob.Match("/Services/web"))
+	assert.T(t, !glob.Match("/services/web"))
+
+	glob, err = CompileGlob("/Services/*")
+	assert.Equal(t, nil, err)
+	assert.T(t, !glob.Match("/services/web"))
+}
+
+func TestGlobCaseInsensitiveClass(t *testing.T) {
+	glob := MustCompileGlob("/[a-c]")
+	assert.T(t, !glob.Match("/B"))
+
+	glob, err := CompileGlobFlags("/[a-c]", GlobCaseInsensitive)
+	assert.Equal(t, nil, err)
+	assert.T(t, glob.Match("/B"))
+}
+
+var prefixes = []struct {
+	pat      string
+	prefix   string
+	complete bool
+}{
+	{"/", "/", true},
+	{"/ctl/cal/0", "/ctl/cal/0", true},
+	{"/config/app/**", "/config/app", false},
+	{"/config/ap*", "/config", false},
+	{"/a/b?/c", "/a", false},
+	{"/a/[bc]", "/a", false},
+	{"/a/{b,c}/d", "/a", false},
+	{"/a/b|/a/c", "/a", false},
+	{"/x/y|/z", "/", false},
+	{"/a/b|/c/d", "/", false},
+	{"/a/b/*|/a/b", "/a/b", false},
+	{"/a/bc|/a/b/*", "/a", false},
+	{"/a/{b|/a/c/d}", "/a", false},
+	{`/a/b\*`, "/a", false},
+	{"/**", "/", false},
+	{"/*/a", "/", false},
+}
+
+func TestGlobPrefix(t *testing.T) {
+	for _, x := range prefixes {
+		prefix, complete := MustCompileGlob(x.pat).Prefix()
+		assert.Equal(t, x.prefix, prefix, x.pat)
+		assert.Equal(t, x.complete, complete, x.pat)
+	}
+}
+
+func TestGlobPrefixCaseInsensitive(t *testing.T) {
+	glob, err := CompileGlobFlags("/config/app/*", GlobCaseInsensitive)
+	assert.Equal(t, nil, err)
+	prefix, complete := glob.Prefix()
+	assert.Equal(t, "/", prefix)
+	assert.Equal(t, false, complete)
+}
+
+func TestGlobIsLiteral(t *testing.T) {
+	assert.T(t, MustCompileGlob("/").IsLiteral())
+	assert.T(t, MustCompileGlob("/ctl/cal/0").IsLiteral())
+	assert.T(t, !MustCompileGlob("/ctl/cal/*").IsLiteral())
+	assert.T(t, !MustCompileGlob("/ctl/cal/[0]").IsLiteral())
+	assert.T(t, !MustCompileGlob("/ctl/cal/{0,1}").IsLiteral())
+	assert.T(t, !MustCompileGlob("/a|/b").IsLiteral())
+	assert.T(t, !MustCompileGlob(`/a\*`).IsLiteral())
+
+	glob, err := CompileGlobFlags("/ctl", GlobCaseInsensitive)
+	assert.Equal(t, nil, err)
+	assert.T(t, !glob.IsLiteral())
+	assert.T(t, glob.Match("/CTL"))
+}
+
+func TestGlobLiteralMatch(t *testing.T) {
+	glob := MustCompileGlob("/ctl/cal/0")
+	assert.T(t, glob.Match("/ctl/cal/0"))
+	assert.T(t, !glob.Match("/ctl/cal/00"))
+	assert.T(t, !glob.Match("/ctl/cal"))
+	assert.T(t, !glob.Match("/ctl/cal/0/"))
+}
+
+func BenchmarkGlobMatchLiteral(b *testing.B) {
+	glob := MustCompileGlob("/ctl/cal/0")
+	for i := 0; i < b.N; i++ {
+		glob.Match("/ctl/cal/0")
+	}
+}
+
+func BenchmarkGlobMatchRegexp(b *testing.B) {
+	glob := MustCompileGlob("/ctl/cal/[0]")
+	for i := 0; i < b.N; i++ {
+		glob.Match("/ctl/cal/0")
+	}
+}
+
+func TestGlobFlagGroup(t *testing.T) {
+	glob, err := CompileGlob("(?i)/Services/*")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "/Services/*", glob.Pattern)
+	assert.T(t, glob.Match("/services/web"))
+
+	glob, err = CompileGlob("(?)/a")
+	assert.Equal(t, nil, err)
+	assert.T(t, glob.IsLiteral())
+}
+
+func TestGlobBadFlagGroup(t *testing.T) {
+	for _, pat := range []string{"(?", "(?i", "(?x)/a", "(?i)", "(?i)a"} {
+		_, err := CompileGlob(pat)
+		assert.NotEqual(t, nil, err, pat)
+	}
+}
+
+var roundTrips = []struct {
+	pat   string
+	flags GlobFlag
+	str   string
+}{
+	{"/a/*", 0, "/a/*"},
+	{"/a/{b,c}/**", 0, "/a/{b,c}/**"},
+	{"/A/[b-d]?", GlobCaseInsensitive, "(?i)/A/[b-d]?"},
+	{"(?i)/A", 0, "(?i)/A"},
+	{"(?i)/A", GlobCaseInsensitive, "(?i)/A"},
+}
+
+var roundTripPaths = []string{
+	"/", "/a", "/A", "/a/b", "/A/b", "/a/B", "/a/c/x", "/a/b/x/y", "/a/e",
+	"/a/bq", "/a/cz", "/A/DZ",
+}
+
+func TestGlobStringRoundTrip(t *testing.T) {
+	for _, x := range roundTrips {
+		g, err := CompileGlobFlags(x.pat, x.flags)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, x.str, g.String())
+
+		g2, err := CompileGlob(g.String())
+		assert.Equal(t, nil, err)
+		assert.Equal(t, g.String(), g2.String())
+		for _, path := range roundTripPaths {
+			assert.Equalf(t, g.Match(path), g2.Match(path), "%q on %q", x.pat, path)
+		}
+	}
+}
+
 func TestGlobNonMatches(t *testing.T) {
 	for _, parts := range nonMatches {
 		pat, paths := parts[0], parts[1:]
@@ -114,3 +513,70 @@ func TestGlobNonMatches(t *testing.T) {
 		}
 	}
 }
+
+// Each alternation matches a path just when one of its branches,
+// compiled on its own, does, and each branch keeps its wildcards within
+// the components they belong to.
+var alternations = []string{
+	"/a/*|/b/*",
+	"/a/*|/b/**",
+	"/a/**|/b/*",
+	"/a/?|/b/*",
+	"/a/*|/b/?",
+	"/a/?|/b/**",
+	"/*/x|/y/*",
+	"/**/x|/y/?",
+	"/a/*/c|/a/**",
+	"/a*|/b?|/c/**",
+	"/?|/*/?|/**/?/z",
+	"/a/**/b|/*/b",
+	"/a/**{,1}|/b/*",
+}
+
+var alternationPaths = []string{
+	"/", "/a", "/b", "/c", "/x", "/ab", "/bc", "/a/x", "/a/xy",
+	"/b/x", "/b/xy", "/a/x/y", "/b/x/y", "/q/x", "/y/q", "/y/qr",
+	"/a/b", "/a/x/b", "/a/x/c", "/c/d/e", "/m/n/z", "/m/n/o/z",
+	"/a/b/c/d", "/a|/b", "/a/x|/b/x",
+}
+
+func TestGlobAlternationBranches(t *testing.T) {
+	for _, pat := range alternations {
+		glob := MustCompileGlob(pat)
+		var branches []*Glob
+		for _, b := range strings.Split(pat, "|") {
+			branches = append(branches, MustCompileGlob(b))
+		}
+		for _, path := range alternationPaths {
+			exp := false
+			for _, b := range branches {
+				exp = exp || b.Match(path)
+			}
+			assert.Equalf(t, exp, glob.Match(path), "%q on %q", pat, path)
+		}
+	}
+}
+
+var alternationMatches = []struct {
+	pat string
+	yes []string
+	no  []string
+}{
+	{"/a/*|/b/*", []string{"/a/xy", "/b/xy", "/a/x", "/b/"}, []string{"/a/x/y", "/b/x/y", "/c/x"}},
+	{"/a/?|/b/**", []string{"/a/x", "/b", "/b/x/y"}, []string{"/a/xy", "/a/x/y", "/bx"}},
+	{"/a/**|/b/?", []string{"/a", "/a/x/y", "/b/x"}, []string{"/b/xy", "/b", "/ax"}},
+	{"/*/x|/y/*", []string{"/q/x", "/y/q"}, []string{"/q/r/x", "/y/q/r", "/x"}},
+	{"/a*|/b?|/c/**", []string{"/a", "/abc", "/bx", "/c", "/c/d/e"}, []string{"/a/b", "/b", "/bxy", "/cd"}},
+}
+
+func TestGlobAlternationMatches(t *testing.T) {
+	for _, x := range alternationMatches {
+		glob := MustCompileGlob(x.pat)
+		for _, path := range x.yes {
+			assert.Tf(t, glob.Match(path), "%q should match %q", x.pat, path)
+		}
+		for _, path := range x.no {
+			assert.Tf(t, !glob.Match(path), "%q should not match %q", x.pat, path)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"container/list"
+)
+
+// DefaultGlobCacheSize is the number of globs CompileGlobCached keeps
+// until SetGlobCacheSize says otherwise.
+const DefaultGlobCacheSize = 256
+
+type globKey struct {
+	pat   string
+	flags GlobFlag
+}
+
+type globEntry struct {
+	k globKey
+	g *Glob
+}
+
+// An LRU cache of compiled globs. A Glob is never changed once it is
+// compiled, so one may be shared by any number of goroutines.
+type globCache struct {
+	mu   chan bool // holds a value while locked
+	size int
+	lru  *list.List // of *globEntry, most recently used first
+	m    map[globKey]*list.Element
+}
+
+var cachedGlobs = &globCache{
+	mu:   make(chan bool, 1),
+	size: DefaultGlobCacheSize,
+	lru:  list.New(),
+	m:    make(map[globKey]*list.Element),
+}
+
+// CompileGlobCached is like CompileGlob, but returns the same *Glob for
+// the same pattern, compiling it only if it is not among the patterns
+// most recently compiled this way. Errors are not cached.
+func CompileGlobCached(pat string) (*Glob, error) {
+	return cachedGlobs.compile(pat, 0)
+}
+
+// SetGlobCacheSize sets the number of globs CompileGlobCached keeps,
+// forgetting the least recently used if there are more than n. If n is
+// zero or less, nothing is kept.
+func SetGlobCacheSize(n int) {
+	cachedGlobs.lock()
+	defer cachedGlobs.unlock()
+	cachedGlobs.size = n
+	cachedGlobs.evict()
+}
+
+func (c *globCache) lock()   { c.mu <- true }
+func (c *globCache) unlock() { <-c.mu }
+
+func (c *globCache) compile(pat string, flags GlobFlag) (*Glob, error) {
+	k := globKey{pat, flags}
+	c.lock()
+	if e, ok := c.m[k]; ok {
+		c.lru.MoveToFront(e)
+		c.unlock()
+		return e.Value.(*globEntry).g, nil
+	}
+	c.unlock()
+
+	g, err := CompileGlobFlags(pat, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock()
+	defer c.unlock()
+	if e, ok := c.m[k]; ok {
+		// Someone else compiled it meanwhile; share theirs.
+		c.lru.MoveToFront(e)
+		return e.Value.(*globEntry).g, nil
+	}
+	c.m[k] = c.lru.PushFront(&globEntry{k, g})
+	c.evict()
+	return g, nil
+}
+
+// Drops the least recently used globs until there are no more than
+// c.size. C must be locked.
+func (c *globCache) evict() {
+	for c.lru.Len() > 0 && c.lru.Len() > c.size {
+		ge := c.lru.Remove(c.lru.Back()).(*globEntry)
+		delete(c.m, ge.k)
+	}
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"strconv"
+	"testing"
+)
+
+const benchGlob = "/ctl/node/*/{addr,writable}|/app/**{1,3}/[a-z]?"
+
+func TestGlobCacheShares(t *testing.T) {
+	a, err := CompileGlobCached("/x/*")
+	assert.Equal(t, nil, err)
+	b, err := CompileGlobCached("/x/*")
+	assert.Equal(t, nil, err)
+	assert.T(t, a == b)
+	assert.T(t, a.Match("/x/y"))
+}
+
+func TestGlobCacheFlags(t *testing.T) {
+	a, _ := CompileGlobCached("/x")
+	b, _ := CompileGlobCached("(?i)/x")
+	assert.T(t, a != b)
+	assert.T(t, !a.Match("/X"))
+	assert.T(t, b.Match("/X"))
+}
+
+func TestGlobCacheError(t *testing.T) {
+	_, err := CompileGlobCached("x")
+	assert.Equal(t, GlobError("x"), err)
+	_, err = CompileGlobCached("x")
+	assert.Equal(t, GlobError("x"), err)
+}
+
+func TestGlobCacheEvicts(t *testing.T) {
+	defer SetGlobCacheSize(DefaultGlobCacheSize)
+	SetGlobCacheSize(2)
+
+	a, _ := CompileGlobCached("/a")
+	CompileGlobCached("/b")
+	CompileGlobCached("/a") // now /b is the least recently used
+	CompileGlobCached("/c")
+
+	a2, _ := CompileGlobCached("/a")
+	assert.T(t, a == a2)
+	assert.Equal(t, 2, cachedGlobs.lru.Len())
+	_, ok := cachedGlobs.m[globKey{"/b", 0}]
+	assert.T(t, !ok)
+}
+
+func TestGlobCacheShrink(t *testing.T) {
+	defer SetGlobCacheSize(DefaultGlobCacheSize)
+	for i := 0; i < 10; i++ {
+		CompileGlobCached("/" + strconv.Itoa(i))
+	}
+	SetGlobCacheSize(3)
+	assert.Equal(t, 3, cachedGlobs.lru.Len())
+	assert.Equal(t, 3, len(cachedGlobs.m))
+
+	SetGlobCacheSize(0)
+	a, _ := CompileGlobCached("/a")
+	b, _ := CompileGlobCached("/a")
+	assert.T(t, a != b)
+	assert.Equal(t, 0, len(cachedGlobs.m))
+}
+
+func BenchmarkCompileGlob(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		CompileGlob(benchGlob)
+	}
+}
+
+func BenchmarkCompileGlobCached(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		CompileGlobCached(benchGlob)
+	}
+}
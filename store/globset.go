@@ -0,0 +1,61 @@
+package store
+
+import (
+	"regexp"
+	"strings"
+)
+
+// GlobSet holds several globs for matching a path against all of them
+// at once.
+type GlobSet struct {
+	Globs []*Glob
+	r     *regexp.Regexp // alternation of every glob; nil if unavailable
+}
+
+// CompileGlobSet compiles each of patterns as with CompileGlob and
+// returns them as a set. The first error encountered is returned.
+func CompileGlobSet(patterns []string) (*GlobSet, error) {
+	s := &GlobSet{Globs: make([]*Glob, len(patterns))}
+	parts := make([]string, len(patterns))
+	for i, pat := range patterns {
+		g, err := CompileGlob(pat)
+		if err != nil {
+			return nil, err
+		}
+		s.Globs[i] = g
+		// Each translation is anchored and carries its own flags, so
+		// grouping keeps them from leaking into the other branches.
+		parts[i] = "(?:" + g.s + ")"
+	}
+
+	// An empty set matches nothing, and the empty alternation would
+	// match everything.
+	if len(parts) > 0 {
+		// If the combined regexp is too big to compile, fall back to
+		// matching the globs one at a time.
+		s.r, _ = regexp.Compile(strings.Join(parts, "|"))
+	}
+	return s, nil
+}
+
+// Match reports whether path matches any glob in s.
+func (s *GlobSet) Match(path string) bool {
+	if s.r != nil {
+		return s.r.MatchString(path)
+	}
+	return s.Which(path) >= 0
+}
+
+// Which returns the index of the first glob in s that matches path,
+// or -1 if none does.
+func (s *GlobSet) Which(path string) int {
+	if s.r != nil && !s.r.MatchString(path) {
+		return -1
+	}
+	for i, g := range s.Globs {
+		if g.Match(path) {
+			return i
+		}
+	}
+	return -1
+}
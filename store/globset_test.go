@@ -0,0 +1,61 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+var aclGlobs = []string{
+	"/public/**",
+	"/ctl/node/*/addr",
+	"(?i)/Users/*",
+	"/exact",
+}
+
+func TestGlobSetMatch(t *testing.T) {
+	s, err := CompileGlobSet(aclGlobs)
+	assert.Equal(t, nil, err)
+
+	for _, path := range []string{"/public/a/b", "/ctl/node/x/addr", "/users/bob", "/exact"} {
+		assert.Tf(t, s.Match(path), "should match %q", path)
+	}
+	for _, path := range []string{"/private", "/ctl/node/x/y/addr", "/users/bob/x", "/exact/x", "/Exact"} {
+		assert.Tf(t, !s.Match(path), "should not match %q", path)
+	}
+}
+
+func TestGlobSetWhich(t *testing.T) {
+	s, err := CompileGlobSet([]string{"/a/*", "/a/b", "/**"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, s.Which("/a/b"))
+	assert.Equal(t, 2, s.Which("/a/b/c"))
+	assert.Equal(t, 2, s.Which("/c"))
+
+	s, err = CompileGlobSet([]string{"/a/*", "/b"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, s.Which("/b"))
+	assert.Equal(t, -1, s.Which("/c"))
+}
+
+func TestGlobSetEmpty(t *testing.T) {
+	s, err := CompileGlobSet(nil)
+	assert.Equal(t, nil, err)
+	assert.T(t, !s.Match("/"))
+	assert.Equal(t, -1, s.Which("/"))
+}
+
+func TestGlobSetBadPattern(t *testing.T) {
+	s, err := CompileGlobSet([]string{"/a", "/b[", "/c"})
+	assert.Equal(t, GlobError("/b["), err)
+	assert.Equal(t, (*GlobSet)(nil), s)
+}
+
+func TestGlobSetFallback(t *testing.T) {
+	s, err := CompileGlobSet(aclGlobs)
+	assert.Equal(t, nil, err)
+	s.r = nil
+	assert.T(t, s.Match("/public/x"))
+	assert.T(t, s.Match("/USERS/x"))
+	assert.T(t, !s.Match("/private"))
+	assert.Equal(t, 3, s.Which("/exact"))
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"sort"
+	"strings"
+)
+
+// GlobTrie holds many globs, each with an ID, for finding every one
+// that matches a path. Rather than trying each glob in turn, it splits
+// the globs into path components and merges them into a trie, so a
+// path is matched by walking its components once, in time that grows
+// with the length of the path and not with the number of globs.
+//
+// A case-insensitive glob, or one with a `**` that is not a whole
+// component or has a bound, can't be split this way; such globs are
+// kept aside and tried one at a time.
+//
+// The zero value is an empty GlobTrie. A GlobTrie may be matched by
+// any number of goroutines at once, but not while one is adding to it.
+type GlobTrie struct {
+	root  *trieNode
+	other []trieGlob
+}
+
+type trieGlob struct {
+	id int
+	g  *Glob
+}
+
+// A trieNode is the state of a match after some number of components.
+type trieNode struct {
+	lits  map[string]*trieNode // next, by literal component
+	wilds []trieWild           // next, by component pattern
+	any   *trieNode            // next, for a whole-component `**`
+	loop  bool                 // reached by `**`, so stays put for any component
+	ids   []int                // globs that match a path ending here
+}
+
+type trieWild struct {
+	g *Glob // of the component, with its leading slash
+	n *trieNode
+}
+
+// Add adds pat to t under id. The same ID may be given to several
+// patterns; Match returns it once if any of them matches.
+func (t *GlobTrie) Add(id int, pat string) error {
+	g, err := CompileGlob(pat)
+	if err != nil {
+		return err
+	}
+
+	branches, ok := trieBranches(g)
+	if !ok {
+		t.other = append(t.other, trieGlob{id, g})
+		return nil
+	}
+
+	if t.root == nil {
+		t.root = new(trieNode)
+	}
+	for _, b := range branches {
+		n := t.root
+		for _, c := range b {
+			n = n.next(c)
+		}
+		n.ids = append(n.ids, id)
+	}
+	return nil
+}
+
+// Splits g into the components of each of its branches, reporting
+// false if any component can't be matched on its own.
+func trieBranches(g *Glob) (branches [][]string, ok bool) {
+	if g.flags&GlobCaseInsensitive != 0 {
+		return nil, false
+	}
+
+	pats, err := expandBraces(g.Pattern)
+	if err != nil {
+		return nil, false
+	}
+	for _, p := range pats {
+		for _, alt := range strings.Split(p, "|") {
+			var cs []string
+			if alt != "/" {
+				cs = strings.Split(alt[1:], "/")
+			}
+			for _, c := range cs {
+				if c != "**" && strings.Contains(c, "**") {
+					return nil, false
+				}
+			}
+			branches = append(branches, cs)
+		}
+	}
+	return branches, true
+}
+
+// Returns the node after n for component c, a component of a pattern,
+// adding it if need be.
+func (n *trieNode) next(c string) *trieNode {
+	switch {
+	case c == "**":
+		if n.any == nil {
+			n.any = &trieNode{loop: true}
+		}
+		return n.any
+	case !strings.ContainsAny(c, globMeta):
+		if n.lits == nil {
+			n.lits = make(map[string]*trieNode)
+		}
+		if n.lits[c] == nil {
+			n.lits[c] = new(trieNode)
+		}
+		return n.lits[c]
+	}
+
+	for _, w := range n.wilds {
+		if w.g.Pattern == "/"+c {
+			return w.n
+		}
+	}
+	// Each branch was checked whole by CompileGlob, so its components
+	// are valid on their own.
+	w := trieWild{MustCompileGlob("/" + c), new(trieNode)}
+	n.wilds = append(n.wilds, w)
+	return w.n
+}
+
+// Adds n to ns, along with every node a `**` can reach from n without
+// taking a component.
+func (n *trieNode) addTo(ns []*trieNode) []*trieNode {
+	for ; n != nil; n = n.any {
+		for _, x := range ns {
+			if x == n {
+				return ns
+			}
+		}
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+// Match returns, in increasing order, the ID of every glob in t that
+// matches path.
+func (t *GlobTrie) Match(path string) []int {
+	var ids []int
+	for _, o := range t.other {
+		if o.g.Match(path) {
+			ids = append(ids, o.id)
+		}
+	}
+
+	if t.root != nil && strings.HasPrefix(path, "/") {
+		ns := t.root.addTo(nil)
+		if path != "/" {
+			ns = trieStep(ns, path)
+		}
+		for _, n := range ns {
+			ids = append(ids, n.ids...)
+		}
+	}
+
+	if len(ids) < 2 {
+		return ids
+	}
+	sort.Ints(ids)
+	j := 1
+	for _, id := range ids[1:] {
+		if id != ids[j-1] {
+			ids[j] = id
+			j++
+		}
+	}
+	return ids[:j]
+}
+
+// Takes the nodes in ns through each component of path, which begins
+// with a slash, and returns the nodes reached.
+func trieStep(ns []*trieNode, path string) []*trieNode {
+	for i := 0; i < len(path) && len(ns) > 0; {
+		j := strings.Index(path[i+1:], "/") + i + 1
+		if j == i {
+			j = len(path)
+		}
+		c := path[i:j] // with its leading slash
+
+		var next []*trieNode
+		for _, n := range ns {
+			if n.loop {
+				next = n.addTo(next)
+			}
+			if m := n.lits[c[1:]]; m != nil {
+				next = m.addTo(next)
+			}
+			for _, w := range n.wilds {
+				if w.g.Match(c) {
+					next = w.n.addTo(next)
+				}
+			}
+		}
+		ns, i = next, j
+	}
+	return ns
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"strconv"
+	"testing"
+)
+
+var trieGlobs = []string{
+	"/",
+	"/a",
+	"/a/b",
+	"/a/*",
+	"/a/**",
+	"/a/**/c",
+	"/**",
+	"/**/c",
+	"/*/b",
+	"/a/b?",
+	"/a/[bc]",
+	"/a/[!b]",
+	"/a/b*c",
+	"/{a,x}/b",
+	"/a/{b,c/d}",
+	"/a/b|/x/y",
+	"/a/\\*",
+	"/a**",
+	"/a/**{1,2}",
+	"(?i)/A/B",
+}
+
+var triePaths = []string{
+	"/",
+	"/a",
+	"/A",
+	"/a/b",
+	"/A/b",
+	"/a/c",
+	"/a/bc",
+	"/a/bxc",
+	"/a/c/d",
+	"/a/b/c",
+	"/a/b/c/d",
+	"/a/*",
+	"/ab",
+	"/x/b",
+	"/x/y",
+	"/c",
+	"/x/c",
+	"a/b",
+	"",
+}
+
+func TestGlobTrieMatchesEachGlob(t *testing.T) {
+	var gt GlobTrie
+	for i, pat := range trieGlobs {
+		assert.Equal(t, nil, gt.Add(i, pat))
+	}
+
+	for _, path := range triePaths {
+		var exp []int
+		for i, pat := range trieGlobs {
+			if MustCompileGlob(pat).Match(path) {
+				exp = append(exp, i)
+			}
+		}
+		assert.Equal(t, exp, gt.Match(path), path)
+	}
+}
+
+func TestGlobTrieSharedID(t *testing.T) {
+	var gt GlobTrie
+	assert.Equal(t, nil, gt.Add(7, "/a/*"))
+	assert.Equal(t, nil, gt.Add(7, "/a/b"))
+	assert.Equal(t, nil, gt.Add(3, "/**"))
+	assert.Equal(t, []int{3, 7}, gt.Match("/a/b"))
+	assert.Equal(t, []int{3}, gt.Match("/b"))
+}
+
+func TestGlobTrieEmpty(t *testing.T) {
+	var gt GlobTrie
+	assert.Equal(t, []int(nil), gt.Match("/a"))
+}
+
+func TestGlobTrieBadGlob(t *testing.T) {
+	var gt GlobTrie
+	assert.NotEqual(t, nil, gt.Add(1, "/a/***"))
+	assert.Equal(t, []int(nil), gt.Match("/a/b"))
+}
+
+// A thousand globs of the sort a service registry might watch.
+func benchGlobs() []string {
+	pats := make([]string, 1000)
+	for i := range pats {
+		s := strconv.Itoa(i)
+		switch i % 4 {
+		case 0:
+			pats[i] = "/svc/" + s + "/addr"
+		case 1:
+			pats[i] = "/svc/" + s + "/*"
+		case 2:
+			pats[i] = "/cfg/" + s + "/**"
+		case 3:
+			pats[i] = "/svc/*/" + s
+		}
+	}
+	return pats
+}
+
+func BenchmarkGlobTrieMatch1e3(b *testing.B) {
+	var gt GlobTrie
+	for i, pat := range benchGlobs() {
+		gt.Add(i, pat)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gt.Match("/svc/501/addr")
+	}
+}
+
+func BenchmarkGlobEachMatch1e3(b *testing.B) {
+	var gs []*Glob
+	for _, pat := range benchGlobs() {
+		gs = append(gs, MustCompileGlob(pat))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var ids []int
+		for id, g := range gs {
+			if g.Match("/svc/501/addr") {
+				ids = append(ids, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package store
+
+// A request for the events logged at revisions from through to. The
+// reply is nil if any of them have been cleaned.
+type logReq struct {
+	from, to int64
+	c        chan []Event
+}
+
+// Returns the events logged at revisions from through to, in order.
+// Revisions not yet reached are left out.
+func (st *Store) events(from, to int64) ([]Event, error) {
+	if from < 1 {
+		from = 1
+	}
+
+	c := make(chan []Event, 1)
+	st.logCh <- logReq{from, to, c}
+	evs := <-c
+	if evs == nil {
+		return nil, ErrTooLate
+	}
+	return evs, nil
+}
+
+// Events returns the events made by the mutation at rev, in order:
+// one for most mutations, or several for a txn, deltree, delglob,
+// copy, move, or batch. It returns no events if rev hasn't been reached
+// yet, and ErrTooLate if rev has been cleaned.
+func (st *Store) Events(rev int64) ([]Event, error) {
+	if rev < 1 {
+		return []Event{}, nil
+	}
+	return st.events(rev, rev)
+}
+
+// History returns the set and delete events for path at revisions
+// fromRev through toRev, in order. It is built from the store's log,
+// so it returns ErrTooLate if fromRev is older than the history kept
+// (see Clean).
+func (st *Store) History(path string, fromRev, toRev int64) ([]Event, error) {
+	evs, err := st.events(fromRev, toRev)
+	if err != nil {
+		return nil, err
+	}
+
+	var h []Event
+	for _, ev := range evs {
+		if ev.Path == path && (ev.IsSet() || ev.IsDel()) {
+			h = append(h, ev)
+		}
+	}
+	return h, nil
+}
+
+// Diff returns the set and delete events that take the tree from its
+// state at fromRev to its state at toRev: the last change to each file
+// in that range, in order, leaving out files that were both created
+// and deleted in it. Like History, it is built from the log, and
+// returns ErrTooLate if fromRev is older than the history kept.
+func (st *Store) Diff(fromRev, toRev int64) ([]Event, error) {
+	var from Getter = emptyDir
+	if fromRev > 0 {
+		evs, err := st.events(fromRev, fromRev)
+		if err != nil {
+			return nil, err
+		}
+		if len(evs) > 0 {
+			from = evs[0].Getter
+		}
+	}
+
+	evs, err := st.events(fromRev+1, toRev)
+	if err != nil {
+		return nil, err
+	}
+
+	last := map[string]int{}
+	for i, ev := range evs {
+		if ev.IsSet() || ev.IsDel() {
+			last[ev.Path] = i
+		}
+	}
+
+	var d []Event
+	for i, ev := range evs {
+		if j, ok := last[ev.Path]; !ok || i != j {
+			continue
+		}
+		if ev.IsDel() {
+			if _, rev := from.Get(ev.Path); rev == Missing || rev == Dir {
+				continue // it didn't exist to begin with
+			}
+		}
+		d = append(d, ev)
+	}
+	return d, nil
+}
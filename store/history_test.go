@@ -0,0 +1,113 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "a", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/y", "z", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/x", "b", 1)}
+	st.Ops <- Op{4, MustEncodeSet("/x", "c", 1)} // rev mismatch
+	st.Ops <- Op{5, MustEncodeDel("/x", Clobber)}
+	st.Ops <- Op{6, Nop}
+	st.Ops <- Op{7, MustEncodeSet("/x", "d", Clobber)}
+	sync(st, 7)
+
+	h, err := st.History("/x", 1, 7)
+	assert.Equal(t, nil, err)
+	var got []string
+	for _, ev := range h {
+		got = append(got, ev.Desc()+" "+ev.Body)
+	}
+	assert.Equal(t, []string{"set a", "set b", "del ", "set d"}, got)
+	assert.Equal(t, int64(3), h[1].Seqn)
+
+	h, err = st.History("/x", 2, 5)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(h))
+	assert.Equal(t, int64(3), h[0].Seqn)
+	assert.Equal(t, int64(5), h[1].Seqn)
+
+	h, err = st.History("/x", 8, 100)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(h))
+}
+
+func TestHistoryTooLate(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "a", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/x", "b", Clobber)}
+	sync(st, 2)
+	st.Clean(1)
+
+	_, err := st.History("/x", 1, 2)
+	assert.Equal(t, ErrTooLate, err)
+
+	h, err := st.History("/x", 2, 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(h))
+}
+
+func TestDiff(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/keep", "a", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/gone", "a", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/temp", "a", Clobber)} // created...
+	st.Ops <- Op{4, MustEncodeSet("/multi", "1", Clobber)}
+	st.Ops <- Op{5, MustEncodeSet("/multi", "2", Clobber)}
+	st.Ops <- Op{6, MustEncodeDel("/temp", Clobber)} // ...and deleted
+	st.Ops <- Op{7, MustEncodeDel("/gone", Clobber)}
+	st.Ops <- Op{8, Nop}
+	st.Ops <- Op{9, MustEncodeSet("/multi", "3", Clobber)}
+	sync(st, 9)
+
+	d, err := st.Diff(2, 9)
+	assert.Equal(t, nil, err)
+	var got []string
+	for _, ev := range d {
+		got = append(got, ev.Desc()+" "+ev.Path+" "+ev.Body)
+	}
+	assert.Equal(t, []string{"del /gone ", "set /multi 3"}, got)
+	assert.Equal(t, int64(9), d[1].Seqn)
+
+	d, err = st.Diff(0, 5)
+	assert.Equal(t, nil, err)
+	got = nil
+	for _, ev := range d {
+		got = append(got, ev.Desc()+" "+ev.Path+" "+ev.Body)
+	}
+	assert.Equal(t, []string{"set /keep a", "set /gone a", "set /temp a", "set /multi 2"}, got)
+
+	d, err = st.Diff(9, 9)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(d))
+}
+
+func TestDiffTooLate(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "a", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/x", "b", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/x", "c", Clobber)}
+	sync(st, 3)
+	st.Clean(1)
+
+	_, err := st.Diff(1, 3)
+	assert.Equal(t, ErrTooLate, err)
+	_, err = st.Diff(0, 3)
+	assert.Equal(t, ErrTooLate, err)
+
+	d, err := st.Diff(2, 3)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(d))
+}
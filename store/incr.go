@@ -0,0 +1,98 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const incrPrefix = "incr:"
+
+// ErrNotInteger is the error for an increment of a file whose body is
+// not a decimal integer.
+var ErrNotInteger = errors.New("not an integer")
+
+// EncodeIncr returns a mutation that adds delta to the decimal integer
+// stored at path. A missing or empty file counts as zero. The result is
+// an ordinary set, so watchers see the new value like any other.
+func EncodeIncr(path string, delta int64) (mutation string, err error) {
+	if err = checkPath(path); err != nil {
+		return
+	}
+	return incrPrefix + strconv.FormatInt(delta, 10) + ":" + path, nil
+}
+
+func MustEncodeIncr(path string, delta int64) (mutation string) {
+	m, err := EncodeIncr(path, delta)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func isIncr(mut string) bool {
+	return strings.HasPrefix(mut, incrPrefix)
+}
+
+func decodeIncr(mutation string) (path string, delta int64, err error) {
+	dp := strings.SplitN(mutation[len(incrPrefix):], ":", 2)
+	if len(dp) != 2 {
+		return "", 0, ErrBadMutation
+	}
+
+	delta, err = strconv.ParseInt(dp[0], 10, 64)
+	if err != nil {
+		return "", 0, ErrBadMutation
+	}
+
+	if err = checkPath(dp[1]); err != nil {
+		return "", 0, err
+	}
+	return dp[1], delta, nil
+}
+
+// Rewrites an increment as the set it amounts to in g.
+func incrToSet(g Getter, mut string) (set string, err error) {
+	path, delta, err := decodeIncr(mut)
+	if err != nil {
+		return "", err
+	}
+
+	var cur int64
+	switch v, rev := g.Get(path); {
+	case rev == Dir:
+		return "", syscall.EISDIR
+	case rev != Missing && v[0] != "":
+		cur, err = strconv.ParseInt(v[0], 10, 64)
+		if err != nil {
+			return "", ErrNotInteger
+		}
+	}
+
+	if delta > 0 && cur > math.MaxInt64-delta || delta < 0 && cur < math.MinInt64-delta {
+		return "", syscall.ERANGE
+	}
+	return EncodeSet(path, strconv.FormatInt(cur+delta, 10), Clobber)
+}
+
+// Result returns the body that mut, an append or an increment, would
+// give its file if it were applied to g, such as a Getter from Snap,
+// or the error it would fail with. The file may change before mut is
+// applied, so mut's own result may still differ.
+func Result(g Getter, mut string) (body string, err error) {
+	switch {
+	case isIncr(mut):
+		mut, err = incrToSet(g, mut)
+	case isAppend(mut):
+		mut, err = appendToSet(g, mut)
+	default:
+		return "", ErrBadMutation
+	}
+	if err != nil {
+		return "", err
+	}
+	_, body, _, _, err = decode(mut)
+	return body, err
+}
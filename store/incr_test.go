@@ -0,0 +1,81 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"math"
+	"syscall"
+	"testing"
+)
+
+func TestNodeApplyIncr(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/x", "41", Clobber))
+	m := MustEncodeIncr("/x", 1)
+	n, e := r.apply(2, m)
+	assert.Equal(t, Event{2, "/x", "42", 2, m, nil, n}, e)
+	assert.T(t, e.IsSet())
+
+	m = MustEncodeIncr("/x", -50)
+	n, e = n.apply(3, m)
+	assert.Equal(t, Event{3, "/x", "-8", 3, m, nil, n}, e)
+}
+
+func TestNodeApplyIncrMissing(t *testing.T) {
+	m := MustEncodeIncr("/x", 5)
+	n, e := emptyDir.apply(1, m)
+	assert.Equal(t, Event{1, "/x", "5", 1, m, nil, n}, e)
+
+	r, _ := emptyDir.apply(1, MustEncodeSet("/y", "", Clobber))
+	_, e = r.apply(2, MustEncodeIncr("/y", 5))
+	assert.Equal(t, "5", e.Body)
+}
+
+func TestNodeApplyIncrErrors(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/x", "abc", Clobber))
+	r, _ = r.apply(2, MustEncodeSet("/d/e", "1", Clobber))
+	r, _ = r.apply(3, MustEncodeSet("/big", "9223372036854775807", Clobber))
+
+	for _, c := range []struct {
+		m   string
+		err error
+	}{
+		{MustEncodeIncr("/x", 1), ErrNotInteger},
+		{MustEncodeIncr("/d", 1), syscall.EISDIR},
+		{MustEncodeIncr("/big", 1), syscall.ERANGE},
+		{MustEncodeIncr("/d/e/f", 1), syscall.ENOTDIR},
+		{"incr:1", ErrBadMutation},
+		{"incr:x:/x", ErrBadMutation},
+		{"incr:1:x", ErrBadPath},
+	} {
+		n, e := r.apply(4, c.m)
+		exp, _ := r.apply(4, MustEncodeSet(ErrorPath, c.err.Error(), Clobber))
+		assert.Equalf(t, exp, n, "%q", c.m)
+		assert.Equalf(t, Event{4, ErrorPath, c.err.Error(), 4, c.m, c.err, n}, e, "%q", c.m)
+	}
+
+	_, e := r.apply(4, MustEncodeIncr("/big", math.MinInt64))
+	assert.Equal(t, "-1", e.Body)
+}
+
+func TestResult(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/x", "41", Clobber))
+
+	body, err := Result(r, MustEncodeIncr("/x", 1))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "42", body)
+
+	body, err = Result(r, MustEncodeAppend("/x", "0", Clobber, -1))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "410", body)
+
+	_, err = Result(r, MustEncodeAppend("/x", "0", Clobber, 2))
+	assert.Equal(t, ErrValueTooLong, err)
+
+	_, err = Result(r, MustEncodeIncr("/", 1))
+	assert.Equal(t, syscall.EISDIR, err)
+
+	_, err = Result(r, MustEncodeSet("/x", "1", Clobber))
+	assert.Equal(t, ErrBadMutation, err)
+
+	_, rev := r.Get("/x")
+	assert.Equal(t, int64(1), rev)
+}
@@ -0,0 +1,65 @@
+package store
+
+// A LogEntry is one committed entry of the log: the mutation applied
+// at Seqn, exactly as it was committed. A batch, transaction, or
+// traced change is one entry, whose Mut encodes all of it.
+type LogEntry struct {
+	Seqn int64
+	Mut  string
+
+	// retrieves values as defined at `Seqn`
+	Getter
+}
+
+// A LogStream receives, in order, every entry of st's log from a given
+// seqn on. Use Stop to end it; C is closed once it has stopped or the
+// store itself is closed.
+//
+// Like a Watch, a LogStream holds up the store until each entry is
+// received from C. A consumer that saves the Seqn of each entry it has
+// dealt with can pick up after a restart with LogStream(seqn+1).
+type LogStream struct {
+	C  <-chan LogEntry
+	wt *Watch
+}
+
+// LogStream returns a LogStream starting with the entry at seqn from.
+// If from has not yet been reached, the stream waits for it. Returns
+// ErrTooLate if from has been cleaned from the log.
+func (st *Store) LogStream(from int64) (*LogStream, error) {
+	if from < 1 {
+		from = 1
+	}
+
+	ch := make(chan Event)
+	w := st.watch(Any, nil, from, ch)
+	if from < st.head {
+		st.cancelWatch(w)
+		return nil, ErrTooLate
+	}
+
+	c := make(chan LogEntry)
+	go func() {
+		defer close(c)
+		var last int64
+		for ev := range ch {
+			// Every event made by one entry carries the whole of it.
+			if ev.Seqn == last {
+				continue
+			}
+			last = ev.Seqn
+			c <- LogEntry{ev.Seqn, ev.Mut, ev.Getter}
+		}
+	}()
+	return &LogStream{C: c, wt: &Watch{C: ch, st: st, w: w}}, nil
+}
+
+// Stop ends the stream. Entries not yet received from C are discarded.
+func (ls *LogStream) Stop() {
+	go func() {
+		for _ = range ls.C {
+		}
+	}()
+
+	ls.wt.Stop()
+}
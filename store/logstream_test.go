@@ -0,0 +1,80 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestLogStreamInOrder(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	ls, err := st.LogStream(1)
+	assert.Equal(t, nil, err)
+	defer ls.Stop()
+
+	muts := []string{
+		MustEncodeSet("/a", "1", Clobber),
+		Nop,
+		MustEncodeDel("/a", Clobber),
+	}
+	txn, err := EncodeTxn(MustEncodeSet("/b", "", Clobber), MustEncodeSet("/c", "", Clobber))
+	assert.Equal(t, nil, err)
+	muts = append(muts, txn)
+
+	go func() {
+		for i, mut := range muts {
+			st.Ops <- Op{int64(i + 1), mut}
+		}
+	}()
+
+	var e LogEntry
+	for i, mut := range muts {
+		e = <-ls.C
+		assert.Equal(t, int64(i+1), e.Seqn)
+		assert.Equal(t, mut, e.Mut)
+	}
+	_, rev := e.Get("/a")
+	assert.Equal(t, Missing, rev)
+}
+
+func TestLogStreamResume(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	for i := int64(1); i <= 5; i++ {
+		st.Ops <- Op{i, MustEncodeSet("/x", "", Clobber)}
+	}
+	sync(st, 5)
+
+	ls, err := st.LogStream(3)
+	assert.Equal(t, nil, err)
+	defer ls.Stop()
+	for i := int64(3); i <= 5; i++ {
+		assert.Equal(t, i, (<-ls.C).Seqn)
+	}
+
+	st.Ops <- Op{6, Nop}
+	e := <-ls.C
+	assert.Equal(t, int64(6), e.Seqn)
+	assert.Equal(t, Nop, e.Mut)
+}
+
+func TestLogStreamTooLate(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	for i := int64(1); i <= 5; i++ {
+		st.Ops <- Op{i, MustEncodeSet("/x", "", Clobber)}
+	}
+	sync(st, 5)
+	st.Clean(3)
+
+	_, err := st.LogStream(2)
+	assert.Equal(t, ErrTooLate, err)
+
+	ls, err := st.LogStream(4)
+	assert.Equal(t, nil, err)
+	defer ls.Stop()
+	assert.Equal(t, int64(4), (<-ls.C).Seqn)
+}
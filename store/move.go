@@ -0,0 +1,131 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	copyPrefix = "copy:"
+	movePrefix = "move:"
+)
+
+// EncodeCopy returns a mutation that copies the file or directory at
+// src to dst. If anything exists at dst, the mutation fails with
+// EEXIST unless rev is Clobber, in which case dst is replaced as a
+// whole. Neither of src and dst may be beneath the other.
+//
+// Copied files are stamped with the revision of the mutation; they
+// are new files, not the old ones in a new place.
+func EncodeCopy(src, dst string, rev int64) (mutation string, err error) {
+	return encodeCopy(copyPrefix, src, dst, rev)
+}
+
+// EncodeMove returns a mutation that moves the file or directory at
+// src to dst, with no revision at which neither exists. Apart from
+// removing src, it behaves exactly like EncodeCopy.
+func EncodeMove(src, dst string, rev int64) (mutation string, err error) {
+	return encodeCopy(movePrefix, src, dst, rev)
+}
+
+func MustEncodeCopy(src, dst string, rev int64) (mutation string) {
+	m, err := EncodeCopy(src, dst, rev)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func MustEncodeMove(src, dst string, rev int64) (mutation string) {
+	m, err := EncodeMove(src, dst, rev)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func encodeCopy(prefix, src, dst string, rev int64) (mutation string, err error) {
+	if err = checkPath(src); err != nil {
+		return
+	}
+	if err = checkPath(dst); err != nil {
+		return
+	}
+	return prefix + strconv.FormatInt(rev, 10) + ":" + src + "=" + dst, nil
+}
+
+func isCopy(mut string) bool {
+	return strings.HasPrefix(mut, copyPrefix) || strings.HasPrefix(mut, movePrefix)
+}
+
+// Reports whether path is dir or is beneath it.
+func within(path, dir string) bool {
+	return path == dir || dir == "/" || strings.HasPrefix(path, dir+"/")
+}
+
+func (n node) checkCopy(src, dst string, rev int64) error {
+	if within(src, dst) || within(dst, src) {
+		return syscall.EINVAL
+	}
+	if _, r := n.Get(src); r == Missing {
+		return syscall.ENOENT
+	}
+	if _, r := n.Get(dst); r != Missing && rev != Clobber {
+		return syscall.EEXIST
+	}
+	if err := n.check(dst, Clobber, true); err == syscall.ENOTDIR {
+		return err
+	}
+	return nil
+}
+
+// Applies a copy or move. The events are, in order: deletes for files
+// replaced at dst, sets for the new files at dst, and, for a move,
+// deletes for the files under src.
+func (n node) applyCopy(seqn int64, mut string) (rep node, evs []Event) {
+	move := strings.HasPrefix(mut, movePrefix)
+	src, dst, rev, keep, err := decode(mut[strings.Index(mut, ":")+1:])
+	if err == nil && !keep {
+		err = ErrBadMutation
+	}
+	if err == nil {
+		err = checkPath(dst)
+	}
+	if err == nil {
+		err = n.checkCopy(src, dst, rev)
+	}
+
+	if err != nil {
+		ev := Event{seqn, ErrorPath, err.Error(), seqn, mut, err, nil}
+		rep = n.setp(ev.Path, ev.Body, ev.Rev, true)
+		ev.Getter = rep
+		return rep, []Event{ev}
+	}
+
+	rep = n
+	for _, p := range n.files(dst) {
+		rep = rep.setp(p, "", Missing, false)
+		evs = append(evs, Event{seqn, p, "", Missing, mut, nil, nil})
+	}
+
+	srcs := n.files(src)
+	for _, p := range srcs {
+		body := GetString(n, p)
+		q := dst + p[len(src):]
+		rep = rep.setp(q, body, seqn, true)
+		evs = append(evs, Event{seqn, q, body, seqn, mut, nil, nil})
+	}
+
+	if move {
+		for _, p := range srcs {
+			rep = rep.setp(p, "", Missing, false)
+			evs = append(evs, Event{seqn, p, "", Missing, mut, nil, nil})
+		}
+	}
+
+	for i := range evs {
+		evs[i].Getter = rep
+	}
+	return rep, evs
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"sort"
+	"syscall"
+	"testing"
+)
+
+func stagingTree() node {
+	r := emptyDir
+	for i, p := range []string{"/staging/app/a", "/staging/app/b/c", "/prod/x"} {
+		r, _ = r.apply(int64(i+1), MustEncodeSet(p, p, Clobber))
+	}
+	return r
+}
+
+func TestNodeApplyMove(t *testing.T) {
+	r := stagingTree()
+	m := MustEncodeMove("/staging/app", "/prod/app", Missing)
+	n, evs := r.applyAll(4, m)
+
+	assert.Equal(t, []Event{
+		{4, "/prod/app/a", "/staging/app/a", 4, m, nil, n},
+		{4, "/prod/app/b/c", "/staging/app/b/c", 4, m, nil, n},
+		{4, "/staging/app/a", "", Missing, m, nil, n},
+		{4, "/staging/app/b/c", "", Missing, m, nil, n},
+	}, evs)
+
+	_, rev := n.Get("/staging")
+	assert.Equal(t, Missing, rev)
+	v, rev := n.Get("/prod/app/b/c")
+	assert.Equal(t, []string{"/staging/app/b/c"}, v)
+	assert.Equal(t, int64(4), rev)
+	_, rev = n.Get("/prod/x")
+	assert.Equal(t, int64(3), rev)
+}
+
+func TestNodeApplyCopy(t *testing.T) {
+	r := stagingTree()
+	m := MustEncodeCopy("/staging/app/a", "/prod/a", Missing)
+	n, evs := r.applyAll(4, m)
+
+	assert.Equal(t, []Event{{4, "/prod/a", "/staging/app/a", 4, m, nil, n}}, evs)
+	_, rev := n.Get("/staging/app/a")
+	assert.Equal(t, int64(1), rev)
+}
+
+func TestNodeApplyMoveClobber(t *testing.T) {
+	r := stagingTree()
+	m := MustEncodeMove("/staging/app", "/prod", Clobber)
+	n, evs := r.applyAll(4, m)
+
+	assert.Equal(t, 5, len(evs))
+	assert.Equal(t, Event{4, "/prod/x", "", Missing, m, nil, n}, evs[0])
+	assert.Equal(t, []string{"a", "b"}, sortedDir(n, "/prod"))
+	assert.Equal(t, []string{"prod"}, sortedDir(n, "/"))
+}
+
+func TestNodeApplyCopyErrors(t *testing.T) {
+	r := stagingTree()
+	for _, c := range []struct {
+		m   string
+		err error
+	}{
+		{MustEncodeMove("/staging/app", "/prod", Missing), syscall.EEXIST},
+		{MustEncodeMove("/staging/app", "/prod/x", 3), syscall.EEXIST},
+		{MustEncodeMove("/nope", "/x", Missing), syscall.ENOENT},
+		{MustEncodeMove("/staging", "/staging/app/z", Clobber), syscall.EINVAL},
+		{MustEncodeCopy("/staging/app", "/staging", Clobber), syscall.EINVAL},
+		{MustEncodeCopy("/staging/app", "/staging/app", Clobber), syscall.EINVAL},
+		{MustEncodeCopy("/staging/app", "/prod/x/y", Missing), syscall.ENOTDIR},
+		{"move:-1:/staging", ErrBadMutation},
+		{"copy:-1:/staging=x", ErrBadPath},
+	} {
+		n, evs := r.applyAll(4, c.m)
+		exp, _ := r.apply(4, MustEncodeSet(ErrorPath, c.err.Error(), Clobber))
+		assert.Equalf(t, exp, n, "%q", c.m)
+		assert.Equalf(t, []Event{{4, ErrorPath, c.err.Error(), 4, c.m, c.err, n}}, evs, "%q", c.m)
+	}
+}
+
+func TestEncodeMoveBadPath(t *testing.T) {
+	_, err := EncodeMove("/a", "b", Clobber)
+	assert.Equal(t, ErrBadPath, err)
+	_, err = EncodeCopy("a", "/b", Clobber)
+	assert.Equal(t, ErrBadPath, err)
+}
+
+func sortedDir(g Getter, path string) []string {
+	names := Getdir(g, path)
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,52 @@
+package store
+
+// A Mux routes events, such as those from one Watch on a broad glob, to
+// handlers registered for narrower globs.
+type Mux struct {
+	// If First is set, an event goes only to the first handler, in
+	// order of registration, whose glob its path matches. Otherwise it
+	// goes to every such handler.
+	First bool
+
+	pats []string
+	set  *GlobSet
+	hs   []func(Event)
+}
+
+// Handle registers h for events whose paths match pat. Returns the
+// error from compiling pat, if any, in which case h is not registered.
+func (m *Mux) Handle(pat string, h func(Event)) error {
+	set, err := CompileGlobSet(append(m.pats[:len(m.pats):len(m.pats)], pat))
+	if err != nil {
+		return err
+	}
+	m.pats = append(m.pats, pat)
+	m.set = set
+	m.hs = append(m.hs, h)
+	return nil
+}
+
+// Dispatch calls each handler for ev, in order of registration, and
+// returns the number called.
+func (m *Mux) Dispatch(ev Event) (n int) {
+	if m.set == nil || !m.set.Match(ev.Path) {
+		return 0
+	}
+	for i, g := range m.set.Globs {
+		if g.Match(ev.Path) {
+			m.hs[i](ev)
+			n++
+			if m.First {
+				break
+			}
+		}
+	}
+	return n
+}
+
+// Serve dispatches each event received from c until c is closed.
+func (m *Mux) Serve(c <-chan Event) {
+	for ev := range c {
+		m.Dispatch(ev)
+	}
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestMuxDispatch(t *testing.T) {
+	var got []string
+	record := func(name string) func(Event) {
+		return func(ev Event) { got = append(got, name+" "+ev.Path) }
+	}
+
+	m := new(Mux)
+	assert.Equal(t, nil, m.Handle("/svc/*/addr", record("addr")))
+	assert.Equal(t, nil, m.Handle("/svc/**", record("svc")))
+	assert.Equal(t, nil, m.Handle("/cfg/{a,b}", record("cfg")))
+
+	st := New()
+	defer close(st.Ops)
+	wt := st.Watch(Any)
+	done := make(chan bool)
+	go func() { m.Serve(wt.C); done <- true }()
+
+	st.Ops <- Op{1, MustEncodeSet("/svc/x/addr", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/svc/x/port", "2", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/cfg/b", "3", Clobber)}
+	st.Ops <- Op{4, MustEncodeSet("/cfg/c", "4", Clobber)}
+	st.Ops <- Op{5, MustEncodeDel("/svc/x/addr", Clobber)}
+	sync(st, 5)
+	wt.Stop()
+	<-done
+
+	exp := []string{
+		"addr /svc/x/addr",
+		"svc /svc/x/addr",
+		"svc /svc/x/port",
+		"cfg /cfg/b",
+		"addr /svc/x/addr",
+		"svc /svc/x/addr",
+	}
+	assert.Equal(t, exp, got)
+}
+
+func TestMuxFirst(t *testing.T) {
+	var got []string
+	m := &Mux{First: true}
+	m.Handle("/a/b", func(ev Event) { got = append(got, "b") })
+	m.Handle("/a/*", func(ev Event) { got = append(got, "*") })
+
+	assert.Equal(t, 1, m.Dispatch(Event{Path: "/a/b"}))
+	assert.Equal(t, 1, m.Dispatch(Event{Path: "/a/c"}))
+	assert.Equal(t, 0, m.Dispatch(Event{Path: "/c"}))
+	assert.Equal(t, []string{"b", "*"}, got)
+
+	m.First = false
+	assert.Equal(t, 2, m.Dispatch(Event{Path: "/a/b"}))
+}
+
+func TestMuxEmpty(t *testing.T) {
+	assert.Equal(t, 0, new(Mux).Dispatch(Event{Path: "/a"}))
+}
+
+func TestMuxBadPattern(t *testing.T) {
+	m := new(Mux)
+	assert.Equal(t, nil, m.Handle("/a", func(Event) {}))
+	assert.Equal(t, GlobError("/b["), m.Handle("/b[", func(Event) {}))
+	assert.Equal(t, 1, len(m.hs))
+	assert.Equal(t, 1, m.Dispatch(Event{Path: "/a"}))
+}
@@ -122,6 +122,12 @@ func (n node) setp(k, v string, rev int64, keep bool) node {
 }
 
 func (n node) apply(seqn int64, mut string) (rep node, ev Event) {
+	if isTxn(mut) || isDeltree(mut) || isDelGlob(mut) || isCopy(mut) || isBatch(mut) || isTrace(mut) || isOnce(mut) {
+		var evs []Event
+		rep, evs = n.applyAll(seqn, mut)
+		return rep, evs[0]
+	}
+
 	ev.Seqn, ev.Rev, ev.Mut = seqn, seqn, mut
 	if mut == Nop {
 		ev.Path = "/"
@@ -133,29 +139,23 @@ func (n node) apply(seqn int64, mut string) (rep node, ev Event) {
 
 	var rev int64
 	var keep bool
-	ev.Path, ev.Body, rev, keep, ev.Err = decode(mut)
+	// Apply these as the set or delete they come to; ev.Mut stays as
+	// given.
+	switch {
+	case isIncr(mut):
+		mut, ev.Err = incrToSet(n, mut)
+	case isAppend(mut):
+		mut, ev.Err = appendToSet(n, mut)
+	case isCad(mut):
+		mut, ev.Err = n.cadToDel(mut)
+	}
 
-	if ev.Err == nil && keep {
-		components := split(ev.Path)
-		for i := 0; i < len(components)-1; i++ {
-			_, dirRev := n.get(components[0 : i+1])
-			if dirRev == Missing {
-				break
-			}
-			if dirRev != Dir {
-				ev.Err = syscall.ENOTDIR
-				break
-			}
-		}
+	if ev.Err == nil {
+		ev.Path, ev.Body, rev, keep, ev.Err = decode(mut)
 	}
 
 	if ev.Err == nil {
-		_, curRev := n.Get(ev.Path)
-		if rev != Clobber && rev < curRev {
-			ev.Err = ErrRevMismatch
-		} else if curRev == Dir {
-			ev.Err = syscall.EISDIR
-		}
+		ev.Err = n.check(ev.Path, rev, keep)
 	}
 
 	if ev.Err != nil {
@@ -170,3 +170,56 @@ func (n node) apply(seqn int64, mut string) (rep node, ev Event) {
 	ev.Getter = rep
 	return
 }
+
+// Like apply, but returns every event caused by mut. All of them have
+// the same Seqn, Mut and Getter.
+func (n node) applyAll(seqn int64, mut string) (rep node, evs []Event) {
+	switch {
+	case isTxn(mut):
+		return n.applyTxn(seqn, mut)
+	case isDeltree(mut):
+		return n.applyDeltree(seqn, mut)
+	case isDelGlob(mut):
+		return n.applyDelGlob(seqn, mut)
+	case isCopy(mut):
+		return n.applyCopy(seqn, mut)
+	case isBatch(mut):
+		return n.applyBatch(seqn, mut)
+	case isTrace(mut):
+		return n.applyTrace(seqn, mut)
+	case isOnce(mut):
+		return n.applyOnce(seqn, mut)
+	}
+
+	var ev Event
+	rep, ev = n.apply(seqn, mut)
+	return rep, []Event{ev}
+}
+
+// Returns the error, if any, that would result from setting (if keep
+// is true) or deleting path in n with precondition rev. Making a new
+// file is subject to the limits in QuotaDir.
+func (n node) check(path string, rev int64, keep bool) error {
+	if keep {
+		components := split(path)
+		for i := 0; i < len(components)-1; i++ {
+			_, dirRev := n.get(components[0 : i+1])
+			if dirRev == Missing {
+				break
+			}
+			if dirRev != Dir {
+				return syscall.ENOTDIR
+			}
+		}
+	}
+
+	_, curRev := n.Get(path)
+	if rev != Clobber && rev < curRev {
+		return ErrRevMismatch
+	} else if curRev == Dir {
+		return syscall.EISDIR
+	} else if keep && curRev == Missing {
+		return n.checkQuota(split(path))
+	}
+	return nil
+}
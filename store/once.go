@@ -0,0 +1,123 @@
+package store
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const oncePrefix = "once:"
+
+// OpDir holds a record of each change made with an operation ID by
+// EncodeOnce: for ID id, the file OpDir/id. It holds the revision at
+// which the change was made, followed, for an incr, by a colon and the
+// value the incr made. Each record has a deadline in TTLDir, and is
+// deleted once it has passed.
+const OpDir = "/ctl/op"
+
+// ErrBadOpID is the error for an operation ID that OpIDRe doesn't
+// match.
+var ErrBadOpID = errors.New("bad op id")
+
+// OpIDRe matches the operation IDs EncodeOnce accepts. Each is a path
+// component under OpDir.
+var OpIDRe = regexp.MustCompile(`^` + charPat + `{1,64}$`)
+
+// OpPath returns the path of the record for operation ID id.
+func OpPath(id string) string {
+	return OpDir + "/" + id
+}
+
+// EncodeOnce returns a mutation that does what mut does, unless a
+// change with operation ID id has already been made, in which case it
+// does nothing and makes a single nop event. If mut succeeds, the
+// record of id is set in the same change, to be kept until deadline,
+// in nanoseconds since the Unix epoch. If mut fails it changed
+// nothing, and isn't recorded, so it can be tried again.
+//
+// Its events carry the whole mutation as Mut.
+func EncodeOnce(id string, deadline int64, mut string) (mutation string, err error) {
+	if !OpIDRe.MatchString(id) {
+		return "", ErrBadOpID
+	}
+	return oncePrefix + id + ":" + strconv.FormatInt(deadline, 10) + ":" + mut, nil
+}
+
+// OpResult returns the revision and, for an incr, the value, that the
+// record in g of operation ID id holds. Ok is false if g has no record
+// of id.
+func OpResult(g Getter, id string) (rev int64, value string, ok bool) {
+	body, frev := g.Get(OpPath(id))
+	if frev <= Missing || len(body) != 1 {
+		return 0, "", false
+	}
+	rv := strings.SplitN(body[0], ":", 2)
+	rev, err := strconv.ParseInt(rv[0], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	if len(rv) == 2 {
+		value = rv[1]
+	}
+	return rev, value, true
+}
+
+func isOnce(mut string) bool {
+	return strings.HasPrefix(mut, oncePrefix)
+}
+
+func decodeOnce(mutation string) (id string, deadline int64, mut string, err error) {
+	idm := strings.SplitN(mutation[len(oncePrefix):], ":", 3)
+	if len(idm) != 3 || !OpIDRe.MatchString(idm[0]) || isOnce(idm[2]) {
+		return "", 0, "", ErrBadMutation
+	}
+	deadline, err = strconv.ParseInt(idm[1], 10, 64)
+	if err != nil {
+		return "", 0, "", ErrBadMutation
+	}
+	return idm[0], deadline, idm[2], nil
+}
+
+// The record and its deadline follow the events of the change itself,
+// so the first event is still the one mut would have made.
+func (n node) applyOnce(seqn int64, mut string) (rep node, evs []Event) {
+	id, deadline, m, err := decodeOnce(mut)
+	if err != nil {
+		ev := Event{seqn, ErrorPath, err.Error(), seqn, mut, err, nil}
+		rep = n.setp(ev.Path, ev.Body, ev.Rev, true)
+		ev.Getter = rep
+		return rep, []Event{ev}
+	}
+
+	path := OpPath(id)
+	if _, rev := n.Get(path); rev > Missing {
+		return n, []Event{{seqn, "/", "", nop, mut, nil, n}}
+	}
+
+	rep, evs = n.applyAll(seqn, m)
+	for _, ev := range evs {
+		if ev.Err != nil {
+			for i := range evs {
+				evs[i].Mut = mut
+			}
+			return rep, evs
+		}
+	}
+
+	record := strconv.FormatInt(seqn, 10)
+	if isIncr(Untrace(m)) {
+		record += ":" + evs[0].Body
+	}
+	ttl := strconv.FormatInt(deadline, 10)
+	rep = rep.setp(path, record, seqn, true)
+	rep = rep.setp(TTLPath(path), ttl, seqn, true)
+	evs = append(evs,
+		Event{seqn, path, record, seqn, mut, nil, nil},
+		Event{seqn, TTLPath(path), ttl, seqn, mut, nil, nil},
+	)
+	for i := range evs {
+		evs[i].Mut, evs[i].Getter = mut, rep
+	}
+	return rep, evs
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestOnceEncodeBadID(t *testing.T) {
+	for _, id := range []string{"", "a:b", "a b", "a/b", "a_b"} {
+		_, err := EncodeOnce(id, 0, Nop)
+		assert.Equalf(t, ErrBadOpID, err, "%q", id)
+	}
+}
+
+func TestNodeApplyOnce(t *testing.T) {
+	m, err := EncodeOnce("op1", 99, MustEncodeIncr("/n", 5))
+	assert.Equal(t, nil, err)
+
+	n, evs := emptyDir.applyAll(1, m)
+	assert.Equal(t, 3, len(evs))
+	assert.Equal(t, Event{1, "/n", "5", 1, m, nil, n}, evs[0])
+	assert.Equal(t, OpPath("op1"), evs[1].Path)
+	assert.Equal(t, TTLPath(OpPath("op1")), evs[2].Path)
+	v, _ := n.Get(TTLPath(OpPath("op1")))
+	assert.Equal(t, []string{"99"}, v)
+
+	rev, value, ok := OpResult(n, "op1")
+	assert.T(t, ok)
+	assert.Equal(t, int64(1), rev)
+	assert.Equal(t, "5", value)
+
+	// Again, it does nothing.
+	n2, evs := n.applyAll(2, m)
+	assert.Equal(t, []Event{{2, "/", "", nop, m, nil, n}}, evs)
+	v, rev = n2.Get("/n")
+	assert.Equal(t, []string{"5"}, v)
+	assert.Equal(t, int64(1), rev)
+}
+
+func TestNodeApplyOnceSet(t *testing.T) {
+	m, _ := EncodeOnce("op1", 99, MustEncodeSet("/a", "x", Clobber))
+	n, _ := emptyDir.applyAll(1, m)
+	rev, value, ok := OpResult(n, "op1")
+	assert.T(t, ok)
+	assert.Equal(t, int64(1), rev)
+	assert.Equal(t, "", value)
+}
+
+func TestNodeApplyOnceFails(t *testing.T) {
+	n := emptyDir.setp("/a", "x", 5, true)
+	m, _ := EncodeOnce("op1", 99, MustEncodeSet("/a", "y", 1))
+	n, evs := n.applyAll(6, m)
+	assert.Equal(t, 1, len(evs))
+	assert.Equal(t, ErrRevMismatch, evs[0].Err)
+	assert.Equal(t, m, evs[0].Mut)
+
+	// Nothing was done, so nothing is recorded.
+	_, _, ok := OpResult(n, "op1")
+	assert.T(t, !ok)
+}
+
+func TestNodeApplyOnceBad(t *testing.T) {
+	inner, _ := EncodeOnce("b", 0, Nop)
+	for _, m := range []string{"once:a b:0:" + Nop, "once:a:x:" + Nop, "once:a:0", "once:a:0:" + inner} {
+		_, evs := emptyDir.applyAll(1, m)
+		assert.Equal(t, 1, len(evs), m)
+		assert.Equal(t, ErrBadMutation, evs[0].Err, m)
+		assert.Equal(t, ErrorPath, evs[0].Path, m)
+	}
+}
+
+func TestCanBatchOnce(t *testing.T) {
+	m, _ := EncodeOnce("x", 0, MustEncodeSet("/a", "", Clobber))
+	assert.T(t, !CanBatch(m))
+	m, _ = EncodeTrace("x", m)
+	assert.T(t, !CanBatch(m))
+}
+
+func TestOnceExpires(t *testing.T) {
+	m, _ := EncodeOnce("op1", 99, MustEncodeSet("/a", "x", Clobber))
+	n, _ := emptyDir.applyAll(1, m)
+
+	assert.T(t, Expired(n, 98) == nil)
+	del, err := Expired(n, 99).Mutation()
+	assert.Equal(t, nil, err)
+	n, _ = n.applyAll(2, del)
+	_, _, ok := OpResult(n, "op1")
+	assert.T(t, !ok)
+	v, _ := n.Get("/a")
+	assert.Equal(t, []string{"x"}, v)
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+)
+
+// QuotaDir holds limits on the number of entries in directories, one
+// to a file. Each file holds a glob and a number, separated by a space,
+// such as
+//
+//	/queues/* 1000
+//
+// A change that would give a directory matching the glob more entries
+// than that fails with a *QuotaError. Where several limits match a
+// directory, each applies. A file that doesn't parse limits nothing.
+// Limits are read as each change is applied, so a new one, like any
+// file, is seen by every node at the same revision, and can be
+// watched.
+const QuotaDir = "/ctl/quota"
+
+var quotaParts = split(QuotaDir)
+
+// A QuotaError says that a change would have given Dir more than Max
+// entries.
+type QuotaError struct {
+	Dir string
+	Max int
+}
+
+func (e *QuotaError) Error() string {
+	return "quota exceeded: " + e.Dir + " may hold " + strconv.Itoa(e.Max) + " entries"
+}
+
+type quota struct {
+	g   *Glob
+	max int
+}
+
+func parseQuota(rule string) (q quota, ok bool) {
+	f := strings.Fields(rule)
+	if len(f) != 2 {
+		return q, false
+	}
+	g, err := CompileGlobCached(f[0])
+	if err != nil {
+		return q, false
+	}
+	max, err := strconv.Atoi(f[1])
+	if err != nil || max < 0 {
+		return q, false
+	}
+	return quota{g, max}, true
+}
+
+// Returns the error, if any, from adding a file at parts, which n
+// doesn't have, to n. Only the deepest directory that n already has
+// gains an entry; any directories made beneath it have one each.
+func (n node) checkQuota(parts []string) error {
+	qd, err := n.at(quotaParts)
+	if err != nil || len(qd.Ds) == 0 {
+		return nil
+	}
+	var qs []quota
+	for _, f := range qd.Ds {
+		if q, ok := parseQuota(f.V); ok && len(f.Ds) == 0 {
+			qs = append(qs, q)
+		}
+	}
+
+	d := n
+	for i := range parts {
+		m, ok := d.Ds[parts[i]]
+		if ok {
+			d = m
+			continue
+		}
+
+		for j, count := i, len(d.Ds)+1; j < len(parts); j, count = j+1, 1 {
+			dir := join(parts[:j])
+			for _, q := range qs {
+				if count > q.max && q.g.Match(dir) {
+					return &QuotaError{dir, q.max}
+				}
+			}
+		}
+		break
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func quotaNode(rules ...string) node {
+	n := emptyDir
+	for i, r := range rules {
+		n = n.setp(QuotaDir+"/"+string(rune('a'+i)), r, 1, true)
+	}
+	return n
+}
+
+func TestQuotaChildren(t *testing.T) {
+	n := quotaNode("/q/* 2")
+	n = n.setp("/q/a/1", "", 2, true)
+	n = n.setp("/q/a/2", "", 3, true)
+
+	n, ev := n.apply(4, MustEncodeSet("/q/a/3", "", Clobber))
+	assert.Equal(t, &QuotaError{"/q/a", 2}, ev.Err)
+	assert.Equal(t, ErrorPath, ev.Path)
+	_, rev := n.Get("/q/a/3")
+	assert.Equal(t, Missing, rev)
+
+	// Changing a file that is already there is no new entry.
+	_, ev = n.apply(5, MustEncodeSet("/q/a/1", "x", Clobber))
+	assert.Equal(t, nil, ev.Err)
+
+	// Nor is a directory the glob doesn't match limited.
+	_, ev = n.apply(5, MustEncodeSet("/q/b/1", "", Clobber))
+	assert.Equal(t, nil, ev.Err)
+	_, ev = n.apply(5, MustEncodeSet("/r/3", "", Clobber))
+	assert.Equal(t, nil, ev.Err)
+}
+
+func TestQuotaAfterDelete(t *testing.T) {
+	n := quotaNode("/q 1")
+	n, _ = n.apply(2, MustEncodeSet("/q/a", "", Clobber))
+	_, ev := n.apply(3, MustEncodeSet("/q/b", "", Clobber))
+	assert.Equal(t, &QuotaError{"/q", 1}, ev.Err)
+
+	n, _ = n.apply(3, MustEncodeDel("/q/a", Clobber))
+	_, ev = n.apply(4, MustEncodeSet("/q/b", "", Clobber))
+	assert.Equal(t, nil, ev.Err)
+}
+
+func TestQuotaNewDirs(t *testing.T) {
+	n := quotaNode("/q 1", "/q/*/* 0")
+	n, _ = n.apply(2, MustEncodeSet("/q/a", "", Clobber))
+
+	// The new directory /q/b would be /q's second entry.
+	_, ev := n.apply(3, MustEncodeSet("/q/b/c", "", Clobber))
+	assert.Equal(t, &QuotaError{"/q", 1}, ev.Err)
+
+	// And a directory made on the way counts as well.
+	n = quotaNode("/q/*/* 0")
+	_, ev = n.apply(2, MustEncodeSet("/q/b/c/d", "", Clobber))
+	assert.Equal(t, &QuotaError{"/q/b/c", 0}, ev.Err)
+}
+
+func TestQuotaEachApplies(t *testing.T) {
+	n := quotaNode("/q/** 3", "/q/a 1")
+	n, _ = n.apply(2, MustEncodeSet("/q/a/1", "", Clobber))
+	_, ev := n.apply(3, MustEncodeSet("/q/a/2", "", Clobber))
+	assert.Equal(t, &QuotaError{"/q/a", 1}, ev.Err)
+}
+
+func TestQuotaBadRules(t *testing.T) {
+	n := quotaNode("/q 0 x", "q 0", "/q x", "/q -1", "")
+	_, ev := n.apply(2, MustEncodeSet("/q/a", "", Clobber))
+	assert.Equal(t, nil, ev.Err)
+}
+
+func TestQuotaTxn(t *testing.T) {
+	n := quotaNode("/q 1")
+	var tx Txn
+	tx.Set("/q/a", "", Clobber)
+	tx.Set("/q/b", "", Clobber)
+	m, _ := tx.Mutation()
+	n, evs := n.applyAll(2, m)
+	assert.Equal(t, 1, len(evs))
+	assert.Equal(t, &TxnError{1, &QuotaError{"/q", 1}}, evs[0].Err)
+	_, rev := n.Get("/q/a")
+	assert.Equal(t, Missing, rev)
+}
+
+func TestQuotaStore(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, MustEncodeSet(QuotaDir+"/q", "/q 1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/q/a", "", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/q/b", "", Clobber)}
+	sync(st, 3)
+
+	_, rev := st.Get("/q/b")
+	assert.Equal(t, Missing, rev)
+	v, _ := st.Get(ErrorPath)
+	assert.Equal(t, []string{"quota exceeded: /q may hold 1 entries"}, v)
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrBadToken is the error for a continuation token that Scan didn't
+// make, or made for another prefix or revision.
+var ErrBadToken = errors.New("bad scan token")
+
+// Scan returns up to limit files in the subtree at prefix, as of
+// revision rev, in the order Walk visits them. Each entry's Name is
+// the file's whole path. If there are more, nextToken is set, and
+// passing it back, with the same prefix, gives the files after these;
+// an empty nextToken means the scan is complete.
+//
+// The token holds the revision as well as the last path seen, so each
+// call of a scan reads the same revision, and changes made since
+// neither repeat nor skip files. A rev of 0 means the current
+// revision, for the first call, and the token's for each after.
+// A scan that takes longer than the store keeps its log fails with
+// ErrTooLate. A negative limit means no limit.
+//
+// Returns ENOENT if prefix does not exist, ENOTDIR if it is a file, and
+// EINVAL if limit is 0.
+func (st *Store) Scan(prefix string, rev int64, token string, limit int) (entries []DirEntry, nextToken string, err error) {
+	if err := checkPath(prefix); err != nil {
+		return nil, "", err
+	}
+	if limit == 0 {
+		return nil, "", syscall.EINVAL
+	}
+
+	var after []string
+	if token != "" {
+		trev, last, err := decodeToken(token)
+		if err != nil {
+			return nil, "", err
+		}
+		parts := split(last)
+		pparts := split(prefix)
+		if rev != 0 && rev != trev || !hasParts(parts, pparts) {
+			return nil, "", ErrBadToken
+		}
+		rev, after = trev, parts[len(pparts):]
+	}
+
+	var g Getter
+	if rev == 0 {
+		rev, g = st.Snap()
+	} else {
+		ch, err := st.Wait(Any, rev)
+		if err != nil {
+			return nil, "", err
+		}
+		g = <-ch
+	}
+
+	_, prev := g.Get(prefix)
+	switch {
+	case prev == Missing:
+		return nil, "", syscall.ENOENT
+	case prev != Dir:
+		return nil, "", syscall.ENOTDIR
+	}
+
+	// Look for one more than asked, to know whether there are more.
+	f := func(path, body string, frev int64) (stop bool) {
+		entries = append(entries, DirEntry{path, frev, int32(len(body)), false})
+		return limit > 0 && len(entries) > limit
+	}
+	if scan(g, prefix, after, f) {
+		entries = entries[:limit]
+		nextToken = encodeToken(rev, entries[limit-1].Name)
+	}
+	return entries, nextToken, nil
+}
+
+// Like walk, but visits only the files after the one at after, a path
+// relative to path, or every file if after is empty.
+func scan(g Getter, path string, after []string, f Visitor) (stopped bool) {
+	v, rev := g.Get(path)
+	if rev == Missing {
+		return
+	}
+
+	if rev != Dir {
+		return len(after) == 0 && f(path, v[0], rev)
+	}
+
+	if path == "/" {
+		path = ""
+	}
+
+	sort.Strings(v)
+	for _, ent := range v {
+		if ent == "" {
+			continue // an empty directory reads as one empty name
+		}
+
+		rest := after
+		switch {
+		case len(after) == 0:
+		case ent < after[0]:
+			continue
+		case ent == after[0]:
+			rest = after[1:]
+			if len(rest) == 0 {
+				continue // the last file seen
+			}
+		default:
+			rest = nil
+		}
+
+		stopped = scan(g, path+"/"+ent, rest, f)
+		if stopped {
+			return
+		}
+	}
+	return
+}
+
+func hasParts(parts, prefix []string) bool {
+	if len(parts) <= len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if parts[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeToken(rev int64, last string) string {
+	s := strconv.FormatInt(rev, 10) + ":" + last
+	return base64.URLEncoding.EncodeToString([]byte(s))
+}
+
+func decodeToken(token string) (rev int64, last string, err error) {
+	b, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, "", ErrBadToken
+	}
+	rl := strings.SplitN(string(b), ":", 2)
+	if len(rl) != 2 || checkPath(rl[1]) != nil {
+		return 0, "", ErrBadToken
+	}
+	rev, err = strconv.ParseInt(rl[0], 10, 64)
+	if err != nil || rev <= 0 {
+		return 0, "", ErrBadToken
+	}
+	return rev, rl[1], nil
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"syscall"
+	"testing"
+)
+
+func scanNames(ents []DirEntry) (names []string) {
+	for _, e := range ents {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestScan(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, MustEncodeSet("/d/a", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/d/b/x", "22", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/d/b/y", "3", Clobber)}
+	st.Ops <- Op{4, MustEncodeSet("/d/c", "4", Clobber)}
+	st.Ops <- Op{5, MustEncodeSet("/e", "5", Clobber)}
+	sync(st, 5)
+
+	ents, tok, err := st.Scan("/d", 0, "", 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []DirEntry{{"/d/a", 1, 1, false}, {"/d/b/x", 2, 2, false}}, ents)
+	assert.NotEqual(t, "", tok)
+
+	ents, tok, err = st.Scan("/d", 0, tok, 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"/d/b/y", "/d/c"}, scanNames(ents))
+	assert.Equal(t, "", tok)
+
+	ents, tok, err = st.Scan("/", 0, "", -1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"/d/a", "/d/b/x", "/d/b/y", "/d/c", "/e"}, scanNames(ents))
+	assert.Equal(t, "", tok)
+}
+
+func TestScanConsistent(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, MustEncodeSet("/d/b", "", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/d/d", "", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/d/f", "", Clobber)}
+	sync(st, 3)
+
+	ents, tok, err := st.Scan("/d", 0, "", 1)
+	assert.Equal(t, nil, err)
+	got := scanNames(ents)
+
+	// Files made and removed before and after the token's place.
+	st.Ops <- Op{4, MustEncodeSet("/d/a", "", Clobber)}
+	st.Ops <- Op{5, MustEncodeSet("/d/c", "", Clobber)}
+	st.Ops <- Op{6, MustEncodeDel("/d/d", Clobber)}
+	st.Ops <- Op{7, MustEncodeSet("/d/e/x", "", Clobber)}
+	sync(st, 7)
+
+	for tok != "" {
+		ents, tok, err = st.Scan("/d", 0, tok, 1)
+		assert.Equal(t, nil, err)
+		got = append(got, scanNames(ents)...)
+	}
+	assert.Equal(t, []string{"/d/b", "/d/d", "/d/f"}, got)
+
+	ents, _, err = st.Scan("/d", 0, "", -1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"/d/a", "/d/b", "/d/c", "/d/e/x", "/d/f"}, scanNames(ents))
+}
+
+func TestScanAtRev(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, MustEncodeSet("/d/a", "", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/d/b", "", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/d/c", "", Clobber)}
+	sync(st, 3)
+
+	ents, tok, err := st.Scan("/d", 1, "", -1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"/d/a"}, scanNames(ents))
+	assert.Equal(t, "", tok)
+
+	_, tok, _ = st.Scan("/d", 2, "", 1)
+	_, _, err = st.Scan("/d", 3, tok, 1)
+	assert.Equal(t, ErrBadToken, err)
+
+	ents, next, err := st.Scan("/d", 0, tok, 1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"/d/b"}, scanNames(ents))
+	assert.Equal(t, "", next)
+
+	st.Clean(3)
+	_, _, err = st.Scan("/d", 0, tok, 1)
+	assert.Equal(t, ErrTooLate, err)
+}
+
+func TestScanErrors(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, MustEncodeSet("/d/a", "", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/d/b", "", Clobber)}
+	sync(st, 2)
+
+	_, _, err := st.Scan("/x", 0, "", 1)
+	assert.Equal(t, syscall.ENOENT, err)
+	_, _, err = st.Scan("/d/a", 0, "", 1)
+	assert.Equal(t, syscall.ENOTDIR, err)
+	_, _, err = st.Scan("/d", 0, "", 0)
+	assert.Equal(t, syscall.EINVAL, err)
+	_, _, err = st.Scan("d", 0, "", 1)
+	assert.Equal(t, ErrBadPath, err)
+
+	_, tok, _ := st.Scan("/d", 0, "", 1)
+	_, _, err = st.Scan("/e", 0, tok, 1)
+	assert.Equal(t, ErrBadToken, err)
+	for _, bad := range []string{"x", encodeToken(0, "/d/a"), encodeToken(1, "d")} {
+		_, _, err = st.Scan("/d", 0, bad, 1)
+		assert.Equal(t, ErrBadToken, err, bad)
+	}
+}
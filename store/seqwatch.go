@@ -0,0 +1,125 @@
+package store
+
+import (
+	"sync/atomic"
+)
+
+// A SeqEvent is an event as a SeqWatch delivers it, stamped with its
+// place in the watch's stream.
+type SeqEvent struct {
+	Event
+	Seq int64 // 1 for the watch's first event, and one more for each after
+}
+
+// A SeqWatch is like a Watch from WatchBuffered, but each event it
+// sends is stamped with a sequence number. The store numbers every
+// event it takes for the watch, including those it then throws away,
+// so a watcher that finds a number missing knows it has missed events
+// and should resync; see Gap.
+type SeqWatch struct {
+	C    <-chan SeqEvent
+	st   *Store
+	w    *watch
+	last int64 // Seq of the last event given to Gap
+}
+
+// WatchSeq returns a SeqWatch for glob, starting with the next
+// revision to be applied to st, that holds up to n events for the
+// watcher and treats an event that finds them full according to
+// policy, as for WatchBuffered.
+func (st *Store) WatchSeq(glob *Glob, n int, policy Backpressure) *SeqWatch {
+	if n < 1 && policy != Block {
+		n = 1
+	}
+	ch := make(chan SeqEvent, n)
+	w := &watch{
+		glob:   glob,
+		rev:    <-st.Seqns + 1,
+		keep:   true,
+		policy: policy,
+		sc:     ch,
+	}
+	st.watchCh <- w
+	return &SeqWatch{C: ch, st: st, w: w}
+}
+
+// Gap reports whether events were lost between the last event passed
+// to Gap, if any, and ev. If so, resync is the revision to start again
+// from: a snapshot as of resync holds every lost change, and events
+// still to come from C with a Seqn of resync or less can be skipped.
+// For policy Overflow, the watcher must start a new watch (for
+// example, with WatchFrom) at resync once C is closed.
+//
+// Call Gap with each event received from C, in order.
+func (wt *SeqWatch) Gap(ev SeqEvent) (resync int64, missed bool) {
+	missed = ev.Seq != wt.last+1
+	wt.last = ev.Seq
+	if !missed {
+		return 0, false
+	}
+	return wt.Resync(), true
+}
+
+// Resync returns the revision to resync from after a gap: the seqn of
+// the latest event the store has thrown away or, once an Overflow
+// watch has been closed, of the event that didn't fit. It is 0 if
+// nothing has been lost.
+func (wt *SeqWatch) Resync() int64 {
+	return atomic.LoadInt64(&wt.w.resync)
+}
+
+// Err is as for Watch.
+func (wt *SeqWatch) Err() error {
+	return wt.w.err
+}
+
+// Dropped is as for Watch.
+func (wt *SeqWatch) Dropped() int64 {
+	return atomic.LoadInt64(&wt.w.dropped)
+}
+
+// Stop is as for Watch.
+func (wt *SeqWatch) Stop() {
+	go func() {
+		for _ = range wt.C {
+		}
+	}()
+
+	wt.st.cancelWatch(wt.w)
+}
+
+// Stamps e with w's next sequence number and sends it according to
+// w's policy, reporting whether w should stay open.
+func (w *watch) sendSeq(e Event) bool {
+	w.seq++
+	se := SeqEvent{e, w.seq}
+	switch w.policy {
+	case DropOldest:
+		for {
+			select {
+			case w.sc <- se:
+				return true
+			default:
+			}
+			select {
+			case old := <-w.sc:
+				atomic.AddInt64(&w.dropped, 1)
+				if old.Seqn > atomic.LoadInt64(&w.resync) {
+					atomic.StoreInt64(&w.resync, old.Seqn)
+				}
+			default:
+			}
+		}
+	case Overflow:
+		select {
+		case w.sc <- se:
+			return true
+		default:
+			atomic.StoreInt64(&w.resync, e.Seqn)
+			w.err = ErrWatchOverflow
+			return false
+		}
+	}
+	w.sc <- se
+	return true
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestWatchSeqInOrder(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.WatchSeq(Any, 0, Block)
+	defer wt.Stop()
+	setMany(st, 3)
+
+	for i := int64(1); i <= 3; i++ {
+		ev := <-wt.C
+		assert.Equal(t, i, ev.Seq)
+		assert.Equal(t, i, ev.Seqn)
+		_, missed := wt.Gap(ev)
+		assert.T(t, !missed, i)
+	}
+	assert.Equal(t, int64(0), wt.Resync())
+}
+
+func TestWatchSeqDropOldestGap(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.WatchSeq(Any, 2, DropOldest)
+	defer wt.Stop()
+	setMany(st, 5)
+	for <-st.Seqns < 5 {
+	}
+
+	ev := <-wt.C
+	assert.Equal(t, int64(4), ev.Seq)
+	assert.Equal(t, int64(4), ev.Seqn)
+	resync, missed := wt.Gap(ev)
+	assert.T(t, missed)
+	assert.Equal(t, int64(3), resync)
+	assert.Equal(t, int64(3), wt.Dropped())
+
+	ev = <-wt.C
+	assert.Equal(t, int64(5), ev.Seq)
+	_, missed = wt.Gap(ev)
+	assert.T(t, !missed)
+
+	st.Ops <- Op{6, MustEncodeSet("/x", "", Clobber)}
+	ev = <-wt.C
+	assert.Equal(t, int64(6), ev.Seq)
+	_, missed = wt.Gap(ev)
+	assert.T(t, !missed)
+	assert.Equal(t, nil, wt.Err())
+}
+
+func TestWatchSeqOverflowResync(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.WatchSeq(Any, 2, Overflow)
+	defer wt.Stop()
+	setMany(st, 5)
+	for <-st.Seqns < 5 {
+	}
+
+	assert.Equal(t, int64(1), (<-wt.C).Seq)
+	assert.Equal(t, int64(2), (<-wt.C).Seq)
+	_, ok := <-wt.C
+	assert.T(t, !ok)
+	assert.Equal(t, ErrWatchOverflow, wt.Err())
+	assert.Equal(t, int64(3), wt.Resync())
+
+	// Starting again from the resync revision picks up where the old
+	// watch left off.
+	again, err := st.WatchFrom(Any, wt.Resync())
+	assert.Equal(t, nil, err)
+	defer again.Stop()
+	ev := <-again.C
+	assert.Equal(t, int64(3), ev.Seqn)
+	assert.Equal(t, "/x", ev.Path)
+	assert.Equal(t, int64(3), ev.Rev)
+	assert.Equal(t, int64(4), (<-again.C).Seqn)
+	assert.Equal(t, int64(5), (<-again.C).Seqn)
+}
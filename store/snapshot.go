@@ -0,0 +1,295 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// Snapshot format:
+//
+//	magic     "doozer-snap"
+//	version   uvarint (snapVersion)
+//	rev       varint
+//	files     one per file, in sorted order of path:
+//	            len(path) uvarint, path,
+//	            rev varint,
+//	            len(body) uvarint, body
+//	end       uvarint 0
+//	checksum  4 bytes, big-endian CRC-32 (IEEE) of all of the above
+//
+// Directories are not written; they are implied by the files in them.
+const (
+	snapMagic   = "doozer-snap"
+	snapVersion = 1
+)
+
+// WriteSnapshot writes the whole tree as of revision rev to w, or the
+// tree as of the latest revision if rev is zero or less. If rev has
+// not yet been reached, WriteSnapshot waits for it. The tree is written
+// as it is traversed, not gathered up first.
+func (st *Store) WriteSnapshot(rev int64, w io.Writer) error {
+	var g Getter
+	if rev > 0 {
+		ch, err := st.Wait(Any, rev)
+		if err != nil {
+			return err
+		}
+		g = (<-ch).Getter
+	} else {
+		rev, g = st.Snap()
+	}
+	return WriteSnapshotOf(g, rev, w)
+}
+
+// WriteSnapshotOf is like WriteSnapshot, but writes g, the tree as of
+// rev, without asking the store for it. G must have come from a store,
+// as the Getter of an Event or LogEntry, or from Snap.
+func WriteSnapshotOf(g Getter, rev int64, w io.Writer) error {
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	sw := &snapWriter{w: bw}
+	sw.string(snapMagic)
+	sw.uvarint(snapVersion)
+	sw.varint(rev)
+	sw.node(g.(node), "")
+	sw.uvarint(0)
+	if sw.err != nil {
+		return sw.err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	_, err := w.Write(sum[:])
+	return err
+}
+
+// Writes snapshot fields, stopping at the first error.
+type snapWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (sw *snapWriter) string(s string) {
+	if sw.err == nil {
+		_, sw.err = sw.w.WriteString(s)
+	}
+}
+
+func (sw *snapWriter) uvarint(x uint64) {
+	if sw.err == nil {
+		_, sw.err = sw.w.Write(sw.buf[:binary.PutUvarint(sw.buf[:], x)])
+	}
+}
+
+func (sw *snapWriter) varint(x int64) {
+	if sw.err == nil {
+		_, sw.err = sw.w.Write(sw.buf[:binary.PutVarint(sw.buf[:], x)])
+	}
+}
+
+func (sw *snapWriter) node(n node, path string) {
+	if n.Rev != Dir {
+		sw.uvarint(uint64(len(path)))
+		sw.string(path)
+		sw.varint(n.Rev)
+		sw.uvarint(uint64(len(n.V)))
+		sw.string(n.V)
+		return
+	}
+
+	names := n.readdir()
+	sort.Strings(names)
+	for _, name := range names {
+		if sw.err != nil {
+			return
+		}
+		sw.node(n.Ds[name], path+"/"+name)
+	}
+}
+
+var (
+	ErrBadSnapshot      = errors.New("bad snapshot")
+	ErrSnapshotVersion  = errors.New("unsupported snapshot version")
+	ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+	ErrSnapshotStale    = errors.New("snapshot is no newer than the store")
+)
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot and returns a
+// new store holding its tree, along with the snapshot's revision. The
+// next mutation the store expects is number rev+1, so it can carry on
+// from there; revisions before rev are unknown to it, as if cleaned.
+// Truncated input gives io.ErrUnexpectedEOF.
+func ReadSnapshot(r io.Reader) (st *Store, rev int64, err error) {
+	root, rev, err := readSnapshot(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return newAt(rev, root), rev, nil
+}
+
+func readSnapshot(r io.Reader) (root node, rev int64, err error) {
+	sr := &snapReader{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+
+	if m, err := sr.bytes(uint64(len(snapMagic))); err != nil {
+		return emptyDir, 0, err
+	} else if string(m) != snapMagic {
+		return emptyDir, 0, ErrBadSnapshot
+	}
+
+	if v, err := binary.ReadUvarint(sr); err != nil {
+		return emptyDir, 0, snapErr(err)
+	} else if v != snapVersion {
+		return emptyDir, 0, ErrSnapshotVersion
+	}
+
+	if rev, err = binary.ReadVarint(sr); err != nil {
+		return emptyDir, 0, snapErr(err)
+	}
+	if rev < 0 {
+		return emptyDir, 0, ErrBadSnapshot
+	}
+
+	root = emptyDir
+	for {
+		n, err := binary.ReadUvarint(sr)
+		if err != nil {
+			return emptyDir, 0, snapErr(err)
+		}
+		if n == 0 {
+			break
+		}
+
+		path, err := sr.bytes(n)
+		if err != nil {
+			return emptyDir, 0, err
+		}
+		frev, err := binary.ReadVarint(sr)
+		if err != nil {
+			return emptyDir, 0, snapErr(err)
+		}
+		n, err = binary.ReadUvarint(sr)
+		if err != nil {
+			return emptyDir, 0, snapErr(err)
+		}
+		body, err := sr.bytes(n)
+		if err != nil {
+			return emptyDir, 0, err
+		}
+
+		p := string(path)
+		if checkPath(p) != nil || p == "/" || frev < 1 || frev > rev {
+			return emptyDir, 0, ErrBadSnapshot
+		}
+		if err := root.check(p, Clobber, true); err != nil {
+			return emptyDir, 0, ErrBadSnapshot
+		}
+		root = root.setp(p, string(body), frev, true)
+	}
+
+	var sum [4]byte
+	if _, err := io.ReadFull(sr.r, sum[:]); err != nil {
+		return emptyDir, 0, snapErr(err)
+	}
+	if binary.BigEndian.Uint32(sum[:]) != sr.crc.Sum32() {
+		return emptyDir, 0, ErrSnapshotChecksum
+	}
+
+	return root, rev, nil
+}
+
+// Reads snapshot fields, keeping a checksum of everything read.
+type snapReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (sr *snapReader) ReadByte() (byte, error) {
+	c, err := sr.r.ReadByte()
+	if err == nil {
+		sr.crc.Write([]byte{c})
+	}
+	return c, err
+}
+
+// Reads n bytes. The buffer grows as data arrives, so a corrupt length
+// can't make us allocate more than the input holds.
+func (sr *snapReader) bytes(n uint64) ([]byte, error) {
+	if int64(n) < 0 {
+		return nil, ErrBadSnapshot
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, io.TeeReader(sr.r, sr.crc), int64(n)); err != nil {
+		return nil, snapErr(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Input that ends early is truncated, wherever it ends.
+func snapErr(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+type installReq struct {
+	rev  int64
+	root node
+	c    chan error
+}
+
+// InstallSnapshot reads a snapshot written by WriteSnapshot and makes
+// its tree the contents of st, as of the snapshot's revision, which it
+// returns. This lets a store that has fallen too far behind to catch up
+// from the log jump ahead instead.
+//
+// Watchers get one event, at the snapshot's revision, for each file
+// that differs, or a nop if none do. Mutations queued at or before
+// that revision are dropped, and later ones are kept. The store's log
+// starts over after the snapshot's revision, so Wait on it or any
+// earlier revision returns ErrTooLate: the mutation that made it isn't
+// known here. InstallSnapshot returns ErrSnapshotStale, and changes
+// nothing, if st has already reached the snapshot's revision.
+func (st *Store) InstallSnapshot(r io.Reader) (rev int64, err error) {
+	root, rev, err := readSnapshot(r)
+	if err != nil {
+		return 0, err
+	}
+
+	c := make(chan error, 1)
+	st.installCh <- installReq{rev, root, c}
+	if err := <-c; err != nil {
+		return 0, err
+	}
+	return rev, nil
+}
+
+// Returns events, at seqn, that take the files in old to those in new.
+func diffEvents(old, new node, seqn int64) (evs []Event) {
+	for _, p := range new.files("/") {
+		v, rev := new.Get(p)
+		if ov, orev := old.Get(p); orev != rev || ov[0] != v[0] {
+			evs = append(evs, Event{seqn, p, v[0], rev, Nop, nil, new})
+		}
+	}
+	for _, p := range old.files("/") {
+		if _, rev := new.Get(p); rev == Missing || rev == Dir {
+			evs = append(evs, Event{seqn, p, "", Missing, Nop, nil, new})
+		}
+	}
+	if len(evs) == 0 {
+		evs = []Event{{seqn, "/", "", nop, Nop, nil, new}}
+	}
+	return evs
+}
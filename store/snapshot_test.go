@@ -0,0 +1,260 @@
+package store
+
+import (
+	"bytes"
+	"github.com/bmizerany/assert"
+	"io"
+	"sort"
+	"testing"
+)
+
+func TestWriteSnapshotUnchanged(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "a", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/y/z", "b", Clobber)}
+	sync(st, 2)
+
+	var before bytes.Buffer
+	assert.Equal(t, nil, st.WriteSnapshot(2, &before))
+
+	st.Ops <- Op{3, MustEncodeSet("/x", "c", Clobber)}
+	st.Ops <- Op{4, MustEncodeDel("/y/z", Clobber)}
+	sync(st, 4)
+
+	var after bytes.Buffer
+	assert.Equal(t, nil, st.WriteSnapshot(2, &after))
+	assert.Equal(t, before.Bytes(), after.Bytes())
+
+	var latest bytes.Buffer
+	assert.Equal(t, nil, st.WriteSnapshot(0, &latest))
+	assert.NotEqual(t, before.Bytes(), latest.Bytes())
+}
+
+func TestWriteSnapshotFormat(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/a", "xy", Clobber)}
+	sync(st, 1)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, st.WriteSnapshot(1, &buf))
+
+	b := buf.Bytes()
+	exp := "doozer-snap\x01\x02" + "\x02/a\x02\x02xy" + "\x00"
+	assert.Equal(t, exp, string(b[:len(b)-4]))
+}
+
+func TestWriteSnapshotTooLate(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, Nop}
+	st.Ops <- Op{2, Nop}
+	sync(st, 2)
+	st.Clean(1)
+
+	var buf bytes.Buffer
+	assert.Equal(t, ErrTooLate, st.WriteSnapshot(1, &buf))
+	assert.Equal(t, 0, buf.Len())
+}
+
+func snapshotStore() *Store {
+	st := New()
+	st.Ops <- Op{1, MustEncodeSet("/x", "a", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/y/z", "", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/y/w/v", "b=c", Clobber)}
+	st.Ops <- Op{4, MustEncodeSet("/x", "d", Clobber)}
+	st.Ops <- Op{5, Nop}
+	sync(st, 5)
+	return st
+}
+
+func TestReadSnapshot(t *testing.T) {
+	st := snapshotStore()
+	defer close(st.Ops)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, st.WriteSnapshot(0, &buf))
+
+	rs, rev, err := ReadSnapshot(&buf)
+	assert.Equal(t, nil, err)
+	defer close(rs.Ops)
+	assert.Equal(t, int64(5), rev)
+	assert.Equal(t, int64(5), <-rs.Seqns)
+
+	var exp, got []string
+	Walk(st, Any, func(path, body string, rev int64) bool {
+		exp = append(exp, path)
+		return false
+	})
+	Walk(rs, Any, func(path, body string, rev int64) bool {
+		got = append(got, path)
+		return false
+	})
+	assert.Equal(t, exp, got)
+	for _, p := range append(exp, "/", "/y", "/y/w", "/nope") {
+		v, r := st.Get(p)
+		sort.Strings(v)
+		gv, gr := rs.Get(p)
+		sort.Strings(gv)
+		assert.Equalf(t, v, gv, "%s", p)
+		assert.Equalf(t, r, gr, "%s", p)
+	}
+}
+
+func TestReadSnapshotResumes(t *testing.T) {
+	st := snapshotStore()
+	defer close(st.Ops)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, st.WriteSnapshot(3, &buf))
+
+	rs, rev, err := ReadSnapshot(&buf)
+	assert.Equal(t, nil, err)
+	defer close(rs.Ops)
+	assert.Equal(t, int64(3), rev)
+
+	_, err = rs.Wait(Any, 2)
+	assert.Equal(t, ErrTooLate, err)
+	ch, err := rs.Wait(Any, 3)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a", GetString(<-ch, "/x"))
+
+	rs.Ops <- Op{4, MustEncodeSet("/x", "e", 1)}
+	sync(rs, 4)
+	v, r := rs.Get("/x")
+	assert.Equal(t, []string{"e"}, v)
+	assert.Equal(t, int64(4), r)
+}
+
+func TestReadSnapshotEmpty(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, st.WriteSnapshot(0, &buf))
+	rs, rev, err := ReadSnapshot(&buf)
+	assert.Equal(t, nil, err)
+	defer close(rs.Ops)
+	assert.Equal(t, int64(0), rev)
+	assert.Equal(t, int64(0), <-rs.Seqns)
+}
+
+func TestReadSnapshotBad(t *testing.T) {
+	st := snapshotStore()
+	defer close(st.Ops)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, st.WriteSnapshot(0, &buf))
+	b := buf.Bytes()
+
+	for i := 0; i < len(b); i++ {
+		_, _, err := ReadSnapshot(bytes.NewReader(b[:i]))
+		assert.Equalf(t, io.ErrUnexpectedEOF, err, "truncated to %d", i)
+	}
+
+	for i := len(snapMagic) + 1; i < len(b); i++ {
+		c := append([]byte{}, b...)
+		c[i] ^= 0x40
+		_, _, err := ReadSnapshot(bytes.NewReader(c))
+		assert.Tf(t, err != nil, "corrupt at %d", i)
+	}
+
+	c := append([]byte{}, b...)
+	c[0] = 'D'
+	_, _, err := ReadSnapshot(bytes.NewReader(c))
+	assert.Equal(t, ErrBadSnapshot, err)
+
+	c = append([]byte{}, b...)
+	c[len(snapMagic)] = snapVersion + 1
+	_, _, err = ReadSnapshot(bytes.NewReader(c))
+	assert.Equal(t, ErrSnapshotVersion, err)
+
+	c = append([]byte{}, b...)
+	c[len(c)-1] ^= 1
+	_, _, err = ReadSnapshot(bytes.NewReader(c))
+	assert.Equal(t, ErrSnapshotChecksum, err)
+}
+
+func TestInstallSnapshot(t *testing.T) {
+	src := New()
+	defer close(src.Ops)
+	src.Ops <- Op{1, MustEncodeSet("/a", "1", Clobber)}
+	src.Ops <- Op{2, MustEncodeSet("/b", "2", Clobber)}
+	src.Ops <- Op{3, MustEncodeSet("/c", "3", Clobber)}
+	src.Ops <- Op{4, MustEncodeSet("/a", "4", Clobber)}
+	src.Ops <- Op{5, MustEncodeDel("/c", Clobber)}
+	sync(src, 5)
+	var buf bytes.Buffer
+	assert.Equal(t, nil, src.WriteSnapshot(5, &buf))
+
+	// st has seen only 1 through 3, and has 7 queued.
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, MustEncodeSet("/a", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/b", "2", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/c", "3", Clobber)}
+	st.Ops <- Op{5, MustEncodeSet("/stale", "", Clobber)}
+	st.Ops <- Op{7, MustEncodeSet("/d", "7", Clobber)}
+	sync(st, 3)
+
+	w := st.Watch(Any)
+	defer w.Stop()
+
+	errs := make(chan error)
+	go func() {
+		rev, err := st.InstallSnapshot(&buf)
+		assert.Equal(t, int64(5), rev)
+		errs <- err
+	}()
+
+	ev := <-w.C
+	assert.Equal(t, int64(5), ev.Seqn)
+	assert.Equal(t, "/a", ev.Path)
+	assert.Equal(t, "4", ev.Body)
+	assert.Equal(t, int64(4), ev.Rev)
+	ev = <-w.C
+	assert.Equal(t, int64(5), ev.Seqn)
+	assert.Equal(t, "/c", ev.Path)
+	assert.T(t, ev.IsDel())
+	assert.Equal(t, nil, <-errs)
+
+	_, err := st.Wait(Any, 5)
+	assert.Equal(t, ErrTooLate, err)
+
+	st.Ops <- Op{6, MustEncodeSet("/e", "6", Clobber)}
+	ev = <-w.C
+	assert.Equal(t, int64(6), ev.Seqn)
+	ev = <-w.C
+	assert.Equal(t, int64(7), ev.Seqn)
+
+	exp := map[string]string{"/a": "4", "/b": "2", "/d": "7", "/e": "6"}
+	got := map[string]string{}
+	Walk(st, Any, func(path, body string, rev int64) bool {
+		got[path] = body
+		return false
+	})
+	assert.Equal(t, exp, got)
+}
+
+func TestInstallSnapshotStale(t *testing.T) {
+	src := New()
+	defer close(src.Ops)
+	src.Ops <- Op{1, MustEncodeSet("/a", "1", Clobber)}
+	sync(src, 1)
+	var buf bytes.Buffer
+	assert.Equal(t, nil, src.WriteSnapshot(1, &buf))
+
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, MustEncodeSet("/a", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/b", "2", Clobber)}
+	sync(st, 2)
+
+	_, err := st.InstallSnapshot(&buf)
+	assert.Equal(t, ErrSnapshotStale, err)
+	assert.Equal(t, "2", GetString(st, "/b"))
+}
@@ -0,0 +1,102 @@
+package store
+
+// StoreStats describes the size of a store and its use.
+type StoreStats struct {
+	Nodes    int   // files and directories, not counting the root
+	MaxDepth int   // of the deepest node; a file in the root has depth 1
+	Rev      int64 // the current revision
+	Watches  int   // as made by Watch and friends
+	Waiters  int   // as made by Wait and WaitDeadline
+}
+
+// Stats returns st's current statistics. The node counts are kept up
+// to date as mutations are applied, so this is cheap.
+func (st *Store) Stats() StoreStats {
+	c := make(chan StoreStats, 1)
+	st.statsCh <- c
+	return <-c
+}
+
+// Counts of the nodes in a tree at each depth, kept up to date as it
+// changes.
+type nodeCounts []int
+
+func countNodes(n node) (c nodeCounts) {
+	c.add(n, 0)
+	return c
+}
+
+func (c *nodeCounts) add(n node, depth int) {
+	if depth > 0 {
+		c.inc(depth, 1)
+	}
+	for _, m := range n.Ds {
+		c.add(m, depth+1)
+	}
+}
+
+func (c *nodeCounts) inc(depth, delta int) {
+	for len(*c) <= depth {
+		*c = append(*c, 0)
+	}
+	(*c)[depth] += delta
+}
+
+// Updates c for a mutation that turned old into new, causing evs. Any
+// node added or removed is the path of an event or one of its parents.
+func (c *nodeCounts) update(old, new node, evs []Event) {
+	seen := map[string]bool{}
+	for _, ev := range evs {
+		if !ev.IsSet() && !ev.IsDel() {
+			continue
+		}
+
+		parts := split(ev.Path)
+		for i := 1; i <= len(parts); i++ {
+			p := join(parts[:i])
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+
+			_, was := old.get(parts[:i])
+			_, is := new.get(parts[:i])
+			switch {
+			case was == Missing && is != Missing:
+				c.inc(i, 1)
+			case was != Missing && is == Missing:
+				c.inc(i, -1)
+			}
+		}
+	}
+}
+
+func (c nodeCounts) total() (n int) {
+	for _, x := range c {
+		n += x
+	}
+	return n
+}
+
+func (c nodeCounts) maxDepth() int {
+	for d := len(c) - 1; d > 0; d-- {
+		if c[d] > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func (st *Store) stats() (s StoreStats) {
+	s.Nodes = st.counts.total()
+	s.MaxDepth = st.counts.maxDepth()
+	s.Rev = st.state.ver
+	for _, w := range st.watches {
+		if w.keep {
+			s.Watches++
+		} else {
+			s.Waiters++
+		}
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	assert.Equal(t, StoreStats{}, st.Stats())
+
+	st.Ops <- Op{1, MustEncodeSet("/a/b/c", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/a/d", "2", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/e", "3", Clobber)}
+	sync(st, 3)
+	assert.Equal(t, StoreStats{Nodes: 5, MaxDepth: 3, Rev: 3}, st.Stats())
+
+	st.Ops <- Op{4, MustEncodeSet("/a/d", "4", Clobber)}
+	st.Ops <- Op{5, MustEncodeDel("/a/b/c", Clobber)}
+	sync(st, 5)
+	assert.Equal(t, StoreStats{Nodes: 3, MaxDepth: 2, Rev: 5}, st.Stats())
+
+	st.Ops <- Op{6, MustEncodeDeltree("/a", Clobber)}
+	st.Ops <- Op{7, MustEncodeSet("/e", "x", 0)} // rev mismatch writes /ctl/err
+	sync(st, 7)
+	assert.Equal(t, countNodes(st.state.root).total(), st.Stats().Nodes)
+	assert.Equal(t, StoreStats{Nodes: 3, MaxDepth: 2, Rev: 7}, st.Stats())
+}
+
+func TestStatsTxn(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	m, _ := EncodeTxn(
+		MustEncodeSet("/a/b", "1", Clobber),
+		MustEncodeSet("/a/c", "2", Clobber),
+	)
+	st.Ops <- Op{1, m}
+	st.Ops <- Op{2, MustEncodeMove("/a", "/x/y", Missing)}
+	sync(st, 2)
+	assert.Equal(t, StoreStats{Nodes: 4, MaxDepth: 3, Rev: 2}, st.Stats())
+}
+
+func TestStatsWatches(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.Watch(Any)
+	st.Wait(Any, 1)
+	st.Wait(Any, 1)
+	s := st.Stats()
+	assert.Equal(t, 1, s.Watches)
+	assert.Equal(t, 2, s.Waiters)
+
+	wt.Stop()
+	assert.Equal(t, 0, st.Stats().Watches)
+}
+
+func TestStatsSnapshot(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/a/b", "1", Clobber))
+	st := newAt(1, r)
+	defer close(st.Ops)
+	assert.Equal(t, StoreStats{Nodes: 2, MaxDepth: 2, Rev: 1}, st.Stats())
+}
@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Special values for a revision.
@@ -14,6 +15,8 @@ const (
 	Clobber
 	Dir
 	nop
+	dirCreated
+	dirRemoved
 )
 
 // TODO revisit this when package regexp is more complete (e.g. do Unicode)
@@ -25,12 +28,20 @@ var Any = MustCompileGlob("/**")
 
 var ErrTooLate = errors.New("too late")
 
+var ErrTimeout = errors.New("timeout")
+
+var ErrCanceled = errors.New("canceled")
+
 var (
-	ErrBadMutation = errors.New("bad mutation")
-	ErrRevMismatch = errors.New("rev mismatch")
-	ErrBadPath     = errors.New("bad path")
+	ErrBadMutation  = errors.New("bad mutation")
+	ErrRevMismatch  = errors.New("rev mismatch")
+	ErrBadPath      = errors.New("bad path")
+	ErrValueTooLong = errors.New("value too long")
 )
 
+// The default limit on the length of a body; see Store.MaxValueLen.
+const DefaultMaxValueLen = 64 * 1024
+
 func mustBuildRe(p string) *regexp.Regexp {
 	return regexp.MustCompile(`^/$|^(/` + p + `+)+$`)
 }
@@ -42,14 +53,28 @@ type Store struct {
 	Ops     chan<- Op
 	Seqns   <-chan int64
 	Waiting <-chan int
-	watchCh chan *watch
-	watches []*watch
-	todo    []Op
-	state   *state
-	head    int64
-	log     map[int64]Event
-	cleanCh chan int64
-	flush   chan bool
+
+	// The longest body this node will accept in a write request. It is
+	// DefaultMaxValueLen unless set otherwise before the store is used.
+	MaxValueLen int
+
+	watchCh   chan *watch
+	cancelCh  chan *watch
+	done      chan bool
+	watches   []*watch
+	todo      []Op
+	state     *state
+	head      int64
+	log       map[int64][]Event
+	cleanCh   chan int64
+	logCh     chan logReq
+	statsCh   chan chan StoreStats
+	installCh chan installReq
+	counts    nodeCounts
+	flush     chan bool
+
+	patterns   map[string]*patternCount
+	patternsCh chan chan []PatternStats
 }
 
 // Represents an operation to apply to the store at position Seqn.
@@ -67,28 +92,106 @@ type state struct {
 
 type watch struct {
 	glob *Glob
+	excl []*Glob // events for paths matching any of these are skipped
 	rev  int64
 	c    chan<- Event
+	keep bool // stay registered after sending an event
+	dirs bool // also send directory events
+	kind EventKind
+
+	policy  Backpressure
+	buf     chan Event // c, for DropOldest to take events back from
+	err     error      // why the store closed c, if it did so early
+	dropped int64      // events thrown away by DropOldest
+
+	sc     chan SeqEvent // in place of c, for a SeqWatch
+	seq    int64         // the last sequence number stamped for sc
+	resync int64         // the seqn to resync from after a gap in sc
+
+	bc    chan []Event // in place of c, for a BatchWatch
+	batch []Event      // events for bc from the change being applied
+
+	count *patternCount // for w's pattern, while w is registered
+}
+
+// Closes whichever of w's channels it sends on.
+func (w *watch) close() {
+	if w.sc != nil {
+		close(w.sc)
+		return
+	}
+	if w.bc != nil {
+		close(w.bc)
+		return
+	}
+	close(w.c)
+}
+
+func (w *watch) match(path string) bool {
+	if !w.glob.Match(path) {
+		return false
+	}
+	for _, g := range w.excl {
+		if g.Match(path) {
+			return false
+		}
+	}
+	return true
+}
+
+// A watch with no kind set wants every event.
+func (w *watch) wants(e Event) bool {
+	switch {
+	case w.kind == 0:
+		return true
+	case e.IsSet():
+		return w.kind&SetEvents != 0
+	case e.IsDel():
+		return w.kind&DelEvents != 0
+	}
+	return false
 }
 
 // Creates a new, empty data store. Mutations will be applied in order,
 // starting at number 1 (number 0 can be thought of as the creation of the
 // store).
 func New() *Store {
+	return newAt(0, emptyDir)
+}
+
+// Creates a store holding root as of revision ver. The next mutation
+// to be applied is number ver+1.
+func newAt(ver int64, root node) *Store {
 	ops := make(chan Op)
 	seqns := make(chan int64)
 	watches := make(chan int)
 
 	st := &Store{
-		Ops:     ops,
-		Seqns:   seqns,
-		Waiting: watches,
-		watchCh: make(chan *watch),
-		watches: []*watch{},
-		state:   &state{0, emptyDir},
-		log:     map[int64]Event{},
-		cleanCh: make(chan int64),
-		flush:   make(chan bool),
+		Ops:         ops,
+		Seqns:       seqns,
+		Waiting:     watches,
+		MaxValueLen: DefaultMaxValueLen,
+		watchCh:     make(chan *watch),
+		cancelCh:    make(chan *watch),
+		done:        make(chan bool),
+		watches:     []*watch{},
+		state:       &state{ver, root},
+		log:         map[int64][]Event{},
+		cleanCh:     make(chan int64),
+		logCh:       make(chan logReq),
+		statsCh:     make(chan chan StoreStats),
+		installCh:   make(chan installReq),
+		counts:      countNodes(root),
+		flush:       make(chan bool),
+		patterns:    map[string]*patternCount{},
+		patternsCh:  make(chan chan []PatternStats),
+	}
+
+	if ver > 0 {
+		// Nothing before ver is known, but ver itself can be waited
+		// for, as if it were a nop.
+		st.head = ver
+		st.log[ver] = []Event{{ver, "/", "", nop, Nop, nil, root}}
 	}
 
 	go st.process(ops, seqns, watches)
@@ -158,6 +261,13 @@ func MustEncodeDel(path string, rev int64) (mutation string) {
 	return m
 }
 
+// Decode parses a mutation made by EncodeSet or EncodeDel, giving the
+// path and rev it was made with. For a set, isSet is true and body is
+// the new contents. Other mutations give ErrBadMutation or a parse error.
+func Decode(mutation string) (path, body string, rev int64, isSet bool, err error) {
+	return decode(mutation)
+}
+
 func decode(mutation string) (path, v string, rev int64, keep bool, err error) {
 	cm := strings.SplitN(mutation, ":", 2)
 
@@ -188,19 +298,53 @@ func decode(mutation string) (path, v string, rev int64, keep bool, err error) {
 
 func (st *Store) notify(e Event, ws []*watch) (nws []*watch) {
 	for _, w := range ws {
-		if e.Seqn >= w.rev && w.glob.Match(e.Path) {
-			w.c <- e
-		} else {
-			nws = append(nws, w)
+		if e.Seqn >= w.rev && (w.dirs || !e.IsDir()) && w.wants(e) && w.match(e.Path) {
+			if !w.send(e) {
+				st.untrack(w)
+				w.close()
+				continue
+			}
+			w.count.events++
+			if !w.keep {
+				st.untrack(w)
+				continue
+			}
 		}
+		nws = append(nws, w)
 	}
 
 	return nws
 }
 
+// Evs are the events of a single change.
+func (st *Store) notifyAll(evs []Event, ws []*watch) []*watch {
+	for _, e := range evs {
+		ws = st.notify(e, ws)
+	}
+	for _, w := range ws {
+		if len(w.batch) > 0 {
+			w.bc <- w.batch
+			w.batch = nil
+		}
+	}
+	return ws
+}
+
 func (st *Store) closeWatches() {
 	for _, w := range st.watches {
-		close(w.c)
+		w.close()
+	}
+	close(st.done)
+}
+
+func (st *Store) cancel(w *watch) {
+	for i, x := range st.watches {
+		if x == w {
+			st.watches = append(st.watches[:i], st.watches[i+1:]...)
+			st.untrack(w)
+			w.close()
+			return
+		}
 	}
 }
 
@@ -222,19 +366,61 @@ func (st *Store) process(ops <-chan Op, seqns chan<- int64, watches chan<- int)
 				st.todo = append(st.todo, a)
 			}
 		case w := <-st.watchCh:
+			st.track(w)
 			n, ws := w.rev, []*watch{w}
 			for ; len(ws) > 0 && n < st.head; n++ {
+				st.untrack(w)
 				ws = []*watch{}
 			}
 			for ; len(ws) > 0 && n <= ver; n++ {
-				ws = st.notify(st.log[n], ws)
+				ws = st.notifyAll(st.log[n], ws)
 			}
 
 			st.watches = append(st.watches, ws...)
+		case w := <-st.cancelCh:
+			st.cancel(w)
 		case seqn := <-st.cleanCh:
 			for ; st.head <= seqn; st.head++ {
 				delete(st.log, st.head)
 			}
+		case r := <-st.logCh:
+			if r.from < st.head {
+				r.c <- nil
+				break
+			}
+			evs := []Event{}
+			for n := r.from; n <= r.to && n <= ver; n++ {
+				for _, e := range st.log[n] {
+					if !e.IsDir() {
+						evs = append(evs, e)
+					}
+				}
+			}
+			r.c <- evs
+		case c := <-st.statsCh:
+			c <- st.stats()
+		case c := <-st.patternsCh:
+			c <- st.patternStats()
+		case r := <-st.installCh:
+			if r.rev <= ver {
+				r.c <- ErrSnapshotStale
+				break
+			}
+			evs := diffEvents(values, r.root, r.rev)
+			st.state = &state{r.rev, r.root}
+			st.counts = countNodes(r.root)
+			st.log = map[int64][]Event{}
+			st.head = r.rev + 1
+			var todo []Op
+			for _, t := range st.todo {
+				if t.Seqn > r.rev {
+					todo = append(todo, t)
+				}
+			}
+			st.todo = todo
+			st.watches = st.notifyAll(evs, st.watches)
+			ver, values = r.rev, r.root
+			r.c <- nil
 		case seqns <- ver:
 			// nothing to do here
 		case watches <- len(st.watches):
@@ -243,7 +429,7 @@ func (st *Store) process(ops <-chan Op, seqns chan<- int64, watches chan<- int)
 			// nothing
 		}
 
-		var ev Event
+		var evs []Event
 		// If we have any mutations that can be applied, do them.
 		for len(st.todo) > 0 {
 			i := firstTodo(st.todo)
@@ -260,19 +446,24 @@ func (st *Store) process(ops <-chan Op, seqns chan<- int64, watches chan<- int)
 				continue
 			}
 
-			values, ev = values.apply(t.Seqn, t.Mut)
-			st.state = &state{ev.Seqn, values}
-			ver = ev.Seqn
+			old := values
+			values, evs = values.applyAll(t.Seqn, t.Mut)
+			st.counts.update(old, values, evs)
+			evs = withDirEvents(old, values, evs)
+			st.state = &state{t.Seqn, values}
+			ver = t.Seqn
 			if !flush {
-				st.log[ev.Seqn] = ev
-				st.watches = st.notify(ev, st.watches)
+				st.log[t.Seqn] = evs
+				st.watches = st.notifyAll(evs, st.watches)
 			}
 		}
 
-		// A flush just gets one final event.
+		// A flush just gets one final mutation's events.
 		if flush {
-			st.log[ev.Seqn] = ev
-			st.watches = st.notify(ev, st.watches)
+			if len(evs) > 0 {
+				st.log[ver] = evs
+				st.watches = st.notifyAll(evs, st.watches)
+			}
 			st.head = ver + 1
 		}
 	}
@@ -331,6 +522,11 @@ func (st *Store) Flush() {
 // If rev is less than any value passed to st.Clean, Wait will return
 // ErrTooLate.
 func (st *Store) Wait(glob *Glob, rev int64) (<-chan Event, error) {
+	_, ch, err := st.wait(glob, rev)
+	return ch, err
+}
+
+func (st *Store) wait(glob *Glob, rev int64) (*watch, chan Event, error) {
 	if rev < 1 {
 		rev = 1
 	}
@@ -344,9 +540,56 @@ func (st *Store) Wait(glob *Glob, rev int64) (<-chan Event, error) {
 	st.watchCh <- wt
 
 	if rev < st.head {
-		return nil, ErrTooLate
+		return nil, nil, ErrTooLate
+	}
+	return wt, ch, nil
+}
+
+// Like Wait, but gives up at deadline, returning ErrTimeout. The waiter
+// is removed from the store either way.
+func (st *Store) WaitDeadline(glob *Glob, rev int64, deadline time.Time) (Event, error) {
+	wt, ch, err := st.wait(glob, rev)
+	if err != nil {
+		return Event{}, err
+	}
+
+	timer := time.NewTimer(deadline.Sub(time.Now()))
+	defer timer.Stop()
+
+	select {
+	case ev := <-ch:
+		return ev, nil
+	case <-timer.C:
+	}
+
+	// Once cancelled, ch holds the event if it raced with the timer,
+	// and is closed otherwise.
+	st.cancelWatch(wt)
+	if ev, ok := <-ch; ok {
+		return ev, nil
+	}
+	return Event{}, ErrTimeout
+}
+
+// Like Wait, but gives up once cancel is closed, returning ErrCanceled.
+// The waiter is removed from the store either way.
+func (st *Store) WaitCancel(glob *Glob, rev int64, cancel <-chan bool) (Event, error) {
+	wt, ch, err := st.wait(glob, rev)
+	if err != nil {
+		return Event{}, err
+	}
+
+	select {
+	case ev := <-ch:
+		return ev, nil
+	case <-cancel:
+	}
+
+	st.cancelWatch(wt)
+	if ev, ok := <-ch; ok {
+		return ev, nil
 	}
-	return ch, nil
+	return Event{}, ErrCanceled
 }
 
 func (st *Store) Clean(seqn int64) {
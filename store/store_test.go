@@ -4,6 +4,7 @@ import (
 	"github.com/bmizerany/assert"
 	"sort"
 	"testing"
+	"time"
 )
 
 type kvcm struct {
@@ -614,6 +615,70 @@ func TestWaitClose(t *testing.T) {
 	assert.Equal(t, 0, <-st.Waiting)
 }
 
+func TestWaitDeadline(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	go func() {
+		st.Ops <- Op{1, MustEncodeSet("/x", "a", Clobber)}
+	}()
+	ev, err := st.WaitDeadline(Any, 1, time.Now().Add(10e9))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "/x", ev.Path)
+}
+
+func TestWaitDeadlineExpires(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	for i := 0; i < 1000; i++ {
+		_, err := st.WaitDeadline(Any, 1, time.Now().Add(1e3))
+		assert.Equal(t, ErrTimeout, err)
+	}
+	assert.Equal(t, 0, <-st.Waiting)
+
+	_, err := st.WaitDeadline(Any, 1, time.Now().Add(-1e9))
+	assert.Equal(t, ErrTimeout, err)
+	assert.Equal(t, 0, <-st.Waiting)
+}
+
+func TestWaitCancel(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	cancel := make(chan bool)
+	errs := make(chan error)
+	go func() {
+		_, err := st.WaitCancel(Any, 1, cancel)
+		errs <- err
+	}()
+	for <-st.Waiting != 1 {
+	}
+	close(cancel)
+	assert.Equal(t, ErrCanceled, <-errs)
+	assert.Equal(t, 0, <-st.Waiting)
+
+	go func() {
+		st.Ops <- Op{1, MustEncodeSet("/x", "a", Clobber)}
+	}()
+	ev, err := st.WaitCancel(Any, 1, make(chan bool))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "/x", ev.Path)
+}
+
+func TestWaitDeadlineTooLate(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, Nop}
+	st.Ops <- Op{2, Nop}
+	sync(st, 2)
+	st.Clean(1)
+
+	_, err := st.WaitDeadline(Any, 1, time.Now().Add(10e9))
+	assert.Equal(t, ErrTooLate, err)
+}
+
 func TestStoreWaitWorks(t *testing.T) {
 	st := New()
 	defer close(st.Ops)
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const tracePrefix = "trace:"
+
+// ErrBadTrace is the error for a trace ID that TraceRe doesn't match.
+var ErrBadTrace = errors.New("bad trace id")
+
+// TraceRe matches the trace IDs EncodeTrace accepts.
+var TraceRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// EncodeTrace returns a mutation that does what mut does, marked with
+// id, so that the change can be followed through consensus to every
+// node that applies it. Its events carry the traced mutation as Mut.
+func EncodeTrace(id, mut string) (mutation string, err error) {
+	if !TraceRe.MatchString(id) {
+		return "", ErrBadTrace
+	}
+	return tracePrefix + id + ":" + mut, nil
+}
+
+// TraceID returns the trace ID that mutation is marked with, if any.
+func TraceID(mutation string) (id string, ok bool) {
+	id, _, err := decodeTrace(mutation)
+	return id, err == nil
+}
+
+func isTrace(mut string) bool {
+	return strings.HasPrefix(mut, tracePrefix)
+}
+
+func decodeTrace(mutation string) (id, mut string, err error) {
+	if !isTrace(mutation) {
+		return "", "", ErrBadMutation
+	}
+	im := strings.SplitN(mutation[len(tracePrefix):], ":", 2)
+	if len(im) != 2 || !TraceRe.MatchString(im[0]) {
+		return "", "", ErrBadMutation
+	}
+	return im[0], im[1], nil
+}
+
+// Untrace returns the mutation that mutation marks with a trace ID, or
+// mutation itself if it has none.
+func Untrace(mutation string) string {
+	if _, mut, err := decodeTrace(mutation); err == nil {
+		return mut
+	}
+	return mutation
+}
+
+func (n node) applyTrace(seqn int64, mut string) (rep node, evs []Event) {
+	_, m, err := decodeTrace(mut)
+	if err != nil {
+		ev := Event{seqn, ErrorPath, err.Error(), seqn, mut, err, nil}
+		rep = n.setp(ev.Path, ev.Body, ev.Rev, true)
+		ev.Getter = rep
+		return rep, []Event{ev}
+	}
+
+	rep, evs = n.applyAll(seqn, m)
+	for i := range evs {
+		evs[i].Mut = mut
+	}
+	return rep, evs
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestTraceEncode(t *testing.T) {
+	m, err := EncodeTrace("abc-1", MustEncodeSet("/a", "x", Clobber))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "trace:abc-1:-1:/a=x", m)
+
+	id, ok := TraceID(m)
+	assert.T(t, ok)
+	assert.Equal(t, "abc-1", id)
+	assert.Equal(t, MustEncodeSet("/a", "x", Clobber), Untrace(m))
+
+	_, ok = TraceID(MustEncodeSet("/a", "x", Clobber))
+	assert.T(t, !ok)
+	assert.Equal(t, Nop, Untrace(Nop))
+}
+
+func TestTraceEncodeBadID(t *testing.T) {
+	for _, id := range []string{"", "a:b", "a b", "a/b"} {
+		_, err := EncodeTrace(id, Nop)
+		assert.Equalf(t, ErrBadTrace, err, "%q", id)
+	}
+}
+
+func TestNodeApplyTrace(t *testing.T) {
+	m, _ := EncodeTrace("x", MustEncodeSet("/a", "b", Clobber))
+	n, evs := emptyDir.applyAll(1, m)
+	assert.Equal(t, 1, len(evs))
+	assert.Equal(t, "/a", evs[0].Path)
+	assert.Equal(t, "b", evs[0].Body)
+	assert.Equal(t, m, evs[0].Mut)
+	assert.Equal(t, nil, evs[0].Err)
+	v, rev := n.Get("/a")
+	assert.Equal(t, []string{"b"}, v)
+	assert.Equal(t, int64(1), rev)
+}
+
+func TestNodeApplyTraceTxn(t *testing.T) {
+	txn, _ := EncodeTxn(MustEncodeSet("/a", "1", Clobber), MustEncodeSet("/b", "2", Clobber))
+	m, _ := EncodeTrace("x", txn)
+	_, evs := emptyDir.applyAll(1, m)
+	assert.Equal(t, 2, len(evs))
+	for _, ev := range evs {
+		assert.Equal(t, m, ev.Mut)
+	}
+}
+
+func TestNodeApplyTraceBad(t *testing.T) {
+	_, evs := emptyDir.applyAll(1, "trace:a b:"+Nop)
+	assert.Equal(t, 1, len(evs))
+	assert.Equal(t, ErrBadMutation, evs[0].Err)
+	assert.Equal(t, ErrorPath, evs[0].Path)
+}
+
+func TestCanBatchTrace(t *testing.T) {
+	m, _ := EncodeTrace("x", MustEncodeSet("/a", "", Clobber))
+	assert.T(t, CanBatch(m))
+	m, _ = EncodeTrace("x", MustEncodeDeltree("/a", Clobber))
+	assert.T(t, !CanBatch(m))
+}
+
+func TestNodeApplyBatchTrace(t *testing.T) {
+	a, _ := EncodeTrace("x", MustEncodeSet("/a", "1", Clobber))
+	b := MustEncodeSet("/b", "2", Clobber)
+	m, err := EncodeBatch(a, b)
+	assert.Equal(t, nil, err)
+
+	n, evs := emptyDir.applyAll(1, m)
+	assert.Equal(t, 2, len(evs))
+	assert.Equal(t, "/a", evs[0].Path)
+	assert.Equal(t, "/b", evs[1].Path)
+	v, _ := n.Get("/a")
+	assert.Equal(t, []string{"1"}, v)
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The translator as it was before it wrote into a single builder. The
+// new one must give the same regexp, or the same error, for every
+// pattern.
+func oldTranslateGlob(pat string) (string, error) {
+	if !globRe.MatchString(pat) {
+		return "", GlobError(pat)
+	}
+
+	branches := strings.Split(pat, "|")
+	outs := make([]string, len(branches))
+	for i, b := range branches {
+		s, err := oldTranslateBranch(b)
+		if err != nil {
+			return "", GlobError(pat)
+		}
+		outs[i] = "^" + s + "$"
+	}
+	return strings.Join(outs, "|"), nil
+}
+
+// Translates one branch of a pattern that globRe has matched, giving
+// an unanchored regexp.
+func oldTranslateBranch(pat string) (string, error) {
+	outs := make([]string, len(pat))
+	i, double, class, escaped, skip := 0, false, false, false, 0
+	stars := 0 // in the run of them ending here
+	for k, c := range pat {
+		if skip > 0 {
+			skip--
+			i++
+			continue
+		}
+
+		if escaped {
+			outs[i] = regexp.QuoteMeta(string(c))
+			escaped = false
+			i++
+			continue
+		}
+
+		if class {
+			// globRe guarantees the class holds only path chars, so it
+			// can be copied verbatim and will never match a slash.
+			// A negated class must exclude the slash explicitly.
+			switch c {
+			case '!', '^':
+				outs[i] = `^/`
+			default:
+				outs[i] = string(c)
+			}
+			class = c != ']'
+			i++
+			continue
+		}
+
+		if c == '*' {
+			stars++
+		} else {
+			stars = 0
+		}
+		if stars > 2 {
+			return "", GlobError(pat)
+		}
+
+		switch c {
+		default:
+			outs[i] = string(c)
+			double = false
+		case '.', '+', '-', '^', '$', ']', '(', ')':
+			outs[i] = `\` + string(c)
+			double = false
+		case '[':
+			body := pat[k+1 : k+strings.IndexRune(pat[k:], ']')]
+			if !validClass(strings.TrimLeft(body, "!^")) {
+				return "", GlobError(pat)
+			}
+			outs[i] = `[`
+			double, class = false, true
+		case '?':
+			outs[i] = `([^/])`
+			double = false
+		case '\\':
+			double, escaped = false, true
+		case '{':
+			// globRe only lets a brace through as the bound of a `**`,
+			// whose translation sits two places back.
+			end := strings.IndexRune(pat[k:], '}')
+			body := pat[k+1 : k+end]
+			re, ok := translateBound(body)
+			if !ok {
+				return "", GlobError(pat)
+			}
+			if wholeBounded(pat, k-1) {
+				re = "/" + re
+				if lo, _ := strconv.Atoi(body[:strings.IndexRune(body, ',')]); lo == 0 {
+					re = "(?:" + re + ")?"
+				}
+				outs[i-3] = ""
+			}
+			outs[i-2] = re
+			skip = end
+		case '*':
+			if double && wholeDouble(pat, k) {
+				// The component may be left out altogether, slash and
+				// all, so that `/a/**` matches `/a` and `/a/**/b`
+				// matches `/a/b`.
+				outs[i-2], outs[i-1] = `(?:/(.*))?`, ""
+			} else if double {
+				outs[i-1] = `(.*)`
+			} else {
+				outs[i] = `([^/]*)`
+			}
+			double = !double
+		}
+		i++
+	}
+	outs = outs[0:i]
+	return strings.Join(outs, ""), nil
+}
+
+// Patterns from the tables in glob_test.go, and more mixing the
+// constructs that rewrite what came before them.
+func translateCorpus() (pats []string) {
+	for _, parts := range globs {
+		pats = append(pats, parts[0])
+	}
+	for _, parts := range matches {
+		pats = append(pats, parts[0])
+	}
+	for _, parts := range nonMatches {
+		pats = append(pats, parts[0])
+	}
+	for _, x := range starRuns {
+		pats = append(pats, x.pat)
+	}
+	pats = append(pats, dontCompile...)
+	return append(pats,
+		"/**/**", "/a/**/**/b", "/**{1,2}/**", "/a**{1,2}", "/a/**{1,2}*",
+		"/a/**{3,}", "/a/**{5,2}", "/a/**{,1001}", `/\***`, `/a\**\**`,
+		"/*?*", "/*[a]*", "/[!a]**", "/a-b.c/**/d+e", "/ctl/node/*/addr",
+		"/ctl/cal/[0-9]|/ctl/node/**|/ctl/ttl/**{,3}", "/a/**|/**/b",
+		"/**|/", "/|/a", "/a|/**{,0}",
+		"/a/**{,2}/b/c**{,3}", "/a/**{1,2}/**{,2}", "/x**{,1}/**{0,2}/y",
+		"/**{,2}/a**{2,}/b/**{1,}", "/a/**{,3}*/**{,1}",
+	)
+}
+
+func TestTranslateGlobUnchanged(t *testing.T) {
+	for _, pat := range translateCorpus() {
+		exp, experr := oldTranslateGlob(pat)
+		got, err := translateGlob(pat)
+		if got != exp || err != experr {
+			t.Errorf("%q: got %q, %v; want %q, %v", pat, got, err, exp, experr)
+		}
+	}
+}
+
+func BenchmarkTranslateGlob(b *testing.B) {
+	pats := []string{
+		"/ctl/node/*/addr",
+		"/ctl/cal/*",
+		"/app/**",
+		"/a/**/b/*|/c",
+		"/queues/[!.]*/items/**{,2}",
+		`/a\*b?`,
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		translateGlob(pats[i%len(pats)])
+	}
+}
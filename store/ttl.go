@@ -0,0 +1,80 @@
+package store
+
+import (
+	"strconv"
+)
+
+// TTLDir holds the deadlines of expiring files. The deadline for the
+// file at path p is stored, in nanoseconds since the Unix epoch, in the
+// file at TTLDir+p. A file expires only if its deadline was written at
+// or after its own last change, so a plain set makes a file permanent
+// again.
+const TTLDir = "/ctl/ttl"
+
+// TTLPath returns the path of the file holding the deadline for path.
+func TTLPath(path string) string {
+	return TTLDir + path
+}
+
+// EncodeSetTTL returns a mutation that sets path to body, as EncodeSet
+// does, and arranges for path to be deleted once deadline has passed.
+func EncodeSetTTL(path, body string, rev, deadline int64) (mutation string, err error) {
+	var t Txn
+	if err = t.Set(path, body, rev); err != nil {
+		return "", err
+	}
+	if err = t.Expire(path, deadline); err != nil {
+		return "", err
+	}
+	return t.Mutation()
+}
+
+// Expire adds an operation to delete path once deadline has passed, as
+// EncodeSetTTL arranges. It belongs after the operation that sets path,
+// in the same Txn.
+func (t *Txn) Expire(path string, deadline int64) error {
+	if err := checkPath(path); err != nil {
+		return err
+	}
+	return t.Set(TTLPath(path), strconv.FormatInt(deadline, 10), Clobber)
+}
+
+// EncodeRefresh returns a mutation that moves the deadline for path to
+// deadline. Refreshing a file with no deadline gives it one.
+func EncodeRefresh(path string, deadline int64) (mutation string, err error) {
+	if err = checkPath(path); err != nil {
+		return "", err
+	}
+	return EncodeSet(TTLPath(path), strconv.FormatInt(deadline, 10), Clobber)
+}
+
+// Expired returns a Txn that deletes every file in g whose deadline is
+// at or before now, along with the deadlines themselves, and the files'
+// content types. Each delete
+// is guarded by the revision seen in g, so a file changed since then
+// is left alone. A deadline that can't be parsed counts as passed.
+// If nothing has expired, Expired returns nil.
+func Expired(g Getter, now int64) *Txn {
+	var t Txn
+	Walk(g, MustCompileGlob(TTLDir+"/**"), func(ttlPath, body string, ttlRev int64) bool {
+		deadline, err := strconv.ParseInt(body, 10, 64)
+		if err == nil && deadline > now {
+			return false
+		}
+
+		path := ttlPath[len(TTLDir):]
+		if _, rev := g.Get(path); rev > Missing && rev <= ttlRev {
+			t.Del(path, rev)
+			if _, trev := g.Get(TypePath(path)); trev >= rev {
+				t.Del(TypePath(path), trev)
+			}
+		}
+		t.Del(ttlPath, ttlRev)
+		return false
+	})
+
+	if t.Len() == 0 {
+		return nil
+	}
+	return &t
+}
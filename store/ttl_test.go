@@ -0,0 +1,80 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestNodeApplySetTTL(t *testing.T) {
+	m, err := EncodeSetTTL("/x", "a", Clobber, 100)
+	assert.Equal(t, nil, err)
+
+	n, evs := emptyDir.applyAll(1, m)
+	assert.Equal(t, 2, len(evs))
+	assert.Equal(t, Event{1, "/x", "a", 1, m, nil, n}, evs[0])
+	assert.Equal(t, "100", GetString(n, "/ctl/ttl/x"))
+}
+
+func TestEncodeTTLBadPath(t *testing.T) {
+	_, err := EncodeSetTTL("x", "a", Clobber, 100)
+	assert.Equal(t, ErrBadPath, err)
+	_, err = EncodeRefresh("x", 100)
+	assert.Equal(t, ErrBadPath, err)
+}
+
+func TestExpired(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/b", "plain", Clobber))
+	m, _ := EncodeSetTTL("/a", "1", Clobber, 100)
+	r, _ = r.apply(2, m)
+	m, _ = EncodeSetTTL("/c/d", "2", Clobber, 200)
+	r, _ = r.apply(3, m)
+
+	assert.Equal(t, (*Txn)(nil), Expired(r, 99))
+
+	x := Expired(r, 100)
+	exp, _ := EncodeTxn(MustEncodeDel("/a", 2), MustEncodeDel("/ctl/ttl/a", 2))
+	assert.Equal(t, exp, mustMutation(x))
+
+	n, _ := r.applyAll(4, mustMutation(x))
+	_, rev := n.Get("/a")
+	assert.Equal(t, Missing, rev)
+	_, rev = n.Get("/c/d")
+	assert.Equal(t, int64(3), rev)
+	assert.Equal(t, "plain", GetString(n, "/b"))
+}
+
+func TestExpiredRefresh(t *testing.T) {
+	m, _ := EncodeSetTTL("/a", "1", Clobber, 100)
+	r, _ := emptyDir.apply(1, m)
+	m, _ = EncodeRefresh("/a", 300)
+	r, _ = r.apply(2, m)
+
+	assert.Equal(t, (*Txn)(nil), Expired(r, 200))
+	assert.NotEqual(t, (*Txn)(nil), Expired(r, 300))
+}
+
+func TestExpiredSetAgain(t *testing.T) {
+	m, _ := EncodeSetTTL("/a", "1", Clobber, 100)
+	r, _ := emptyDir.apply(1, m)
+	r, _ = r.apply(2, MustEncodeSet("/a", "2", Clobber))
+
+	// The file was set again without a ttl; only the deadline goes.
+	exp, _ := EncodeTxn(MustEncodeDel("/ctl/ttl/a", 1))
+	assert.Equal(t, exp, mustMutation(Expired(r, 100)))
+}
+
+func TestExpiredMissing(t *testing.T) {
+	m, _ := EncodeRefresh("/a", 100)
+	r, _ := emptyDir.apply(1, m)
+
+	exp, _ := EncodeTxn(MustEncodeDel("/ctl/ttl/a", 1))
+	assert.Equal(t, exp, mustMutation(Expired(r, 100)))
+}
+
+func mustMutation(t *Txn) string {
+	m, err := t.Mutation()
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+)
+
+const txnPrefix = "txn:"
+
+// A TxnError records which operation of a transaction failed. When any
+// operation fails, none of them are applied.
+type TxnError struct {
+	Op  int // index of the failed operation
+	Err error
+}
+
+func (e *TxnError) Error() string {
+	return "txn op " + strconv.Itoa(e.Op) + ": " + e.Err.Error()
+}
+
+// A Txn collects set and delete operations to be applied atomically,
+// as a single mutation at one revision. Each operation's rev is checked
+// like that of a lone set or delete, against the tree as left by the
+// operations before it. If any check fails, the whole batch aborts.
+type Txn struct {
+	muts []string
+}
+
+// Set adds an operation to set path to body, if the current revision
+// of path is no greater than rev.
+func (t *Txn) Set(path, body string, rev int64) error {
+	m, err := EncodeSet(path, body, rev)
+	if err != nil {
+		return err
+	}
+	t.muts = append(t.muts, m)
+	return nil
+}
+
+// Del adds an operation to delete path, if the current revision of
+// path is no greater than rev.
+func (t *Txn) Del(path string, rev int64) error {
+	m, err := EncodeDel(path, rev)
+	if err != nil {
+		return err
+	}
+	t.muts = append(t.muts, m)
+	return nil
+}
+
+// Len returns the number of operations in t.
+func (t *Txn) Len() int {
+	return len(t.muts)
+}
+
+// Mutation returns t encoded as a single mutation.
+func (t *Txn) Mutation() (mutation string, err error) {
+	return EncodeTxn(t.muts...)
+}
+
+// EncodeTxn combines set and delete mutations, as made by EncodeSet and
+// EncodeDel, into one mutation that applies all of them or none.
+func EncodeTxn(muts ...string) (mutation string, err error) {
+	if len(muts) == 0 {
+		return "", ErrBadMutation
+	}
+
+	parts := []string{txnPrefix}
+	for _, m := range muts {
+		if _, _, _, _, err = decode(m); err != nil {
+			return "", err
+		}
+		parts = append(parts, strconv.Itoa(len(m)), ":", m)
+	}
+	return strings.Join(parts, ""), nil
+}
+
+func isTxn(mut string) bool {
+	return strings.HasPrefix(mut, txnPrefix)
+}
+
+func decodeTxn(mutation string) (muts []string, err error) {
+	return decodeList(mutation[len(txnPrefix):])
+}
+
+// Splits s, a list of mutations each prefixed with its length and a
+// colon, as made by EncodeTxn and EncodeBatch.
+func decodeList(s string) (muts []string, err error) {
+	for len(s) > 0 {
+		i := strings.Index(s, ":")
+		if i < 0 {
+			return nil, ErrBadMutation
+		}
+
+		n, err := strconv.Atoi(s[:i])
+		if err != nil || n < 0 || n > len(s)-i-1 {
+			return nil, ErrBadMutation
+		}
+
+		muts = append(muts, s[i+1:i+1+n])
+		s = s[i+1+n:]
+	}
+	if len(muts) == 0 {
+		return nil, ErrBadMutation
+	}
+	return muts, nil
+}
+
+func (n node) applyTxn(seqn int64, mut string) (rep node, evs []Event) {
+	muts, err := decodeTxn(mut)
+
+	rep = n
+	for i := 0; err == nil && i < len(muts); i++ {
+		var ev Event
+		var rev int64
+		var keep bool
+		ev.Path, ev.Body, rev, keep, err = decode(muts[i])
+		if err == nil {
+			err = rep.check(ev.Path, rev, keep)
+		}
+		if err != nil {
+			err = &TxnError{i, err}
+			break
+		}
+
+		ev.Seqn, ev.Rev, ev.Mut = seqn, seqn, mut
+		if !keep {
+			ev.Rev = Missing
+		}
+		rep = rep.setp(ev.Path, ev.Body, ev.Rev, keep)
+		evs = append(evs, ev)
+	}
+
+	if err != nil {
+		ev := Event{seqn, ErrorPath, err.Error(), seqn, mut, err, nil}
+		rep = n.setp(ev.Path, ev.Body, ev.Rev, true)
+		evs = []Event{ev}
+	}
+
+	for i := range evs {
+		evs[i].Getter = rep
+	}
+	return rep, evs
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestTxnEncodeDecode(t *testing.T) {
+	a := MustEncodeSet("/a", "x:y=z", Clobber)
+	b := MustEncodeDel("/b", 3)
+	m, err := EncodeTxn(a, b)
+	assert.Equal(t, nil, err)
+	assert.T(t, isTxn(m))
+
+	muts, err := decodeTxn(m)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{a, b}, muts)
+}
+
+func TestTxnEncodeErrors(t *testing.T) {
+	_, err := EncodeTxn()
+	assert.Equal(t, ErrBadMutation, err)
+
+	_, err = EncodeTxn("-1:x")
+	assert.Equal(t, ErrBadPath, err)
+
+	var x Txn
+	assert.Equal(t, ErrBadPath, x.Set("a", "", Clobber))
+	assert.Equal(t, 0, x.Len())
+}
+
+func TestTxnDecodeBad(t *testing.T) {
+	for _, m := range []string{"txn:", "txn:5", "txn:9:-1:/a", "txn:x:-1:/a"} {
+		_, err := decodeTxn(m)
+		assert.Equalf(t, ErrBadMutation, err, "%q", m)
+	}
+}
+
+func TestNodeApplyTxn(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/b", "old", Clobber))
+
+	var x Txn
+	x.Set("/a", "1", Missing)
+	x.Set("/c/d", "2", Clobber)
+	x.Del("/b", 1)
+	m, err := x.Mutation()
+	assert.Equal(t, nil, err)
+
+	n, evs := r.applyAll(2, m)
+	exp := node{"", Dir, map[string]node{
+		"a": {"1", 2, nil},
+		"c": {"", Dir, map[string]node{"d": {"2", 2, nil}}},
+	}}
+	assert.Equal(t, exp, n)
+	assert.Equal(t, []Event{
+		{2, "/a", "1", 2, m, nil, n},
+		{2, "/c/d", "2", 2, m, nil, n},
+		{2, "/b", "", Missing, m, nil, n},
+	}, evs)
+
+	_, ev := r.apply(2, m)
+	assert.Equal(t, evs[0], ev)
+}
+
+func TestNodeApplyTxnSeesEarlierOps(t *testing.T) {
+	m, _ := EncodeTxn(
+		MustEncodeSet("/a", "1", Missing),
+		MustEncodeSet("/a", "2", 1),
+	)
+	n, evs := emptyDir.applyAll(1, m)
+	assert.Equal(t, 2, len(evs))
+	v, rev := n.Get("/a")
+	assert.Equal(t, []string{"2"}, v)
+	assert.Equal(t, int64(1), rev)
+}
+
+func TestNodeApplyTxnAbort(t *testing.T) {
+	r, _ := emptyDir.apply(1, MustEncodeSet("/b", "old", Clobber))
+
+	m, _ := EncodeTxn(
+		MustEncodeSet("/a", "1", Clobber),
+		MustEncodeSet("/b", "new", 0),
+	)
+	n, evs := r.applyAll(2, m)
+
+	err := &TxnError{1, ErrRevMismatch}
+	exp, _ := r.apply(2, MustEncodeSet(ErrorPath, err.Error(), Clobber))
+	assert.Equal(t, exp, n)
+	assert.Equal(t, []Event{{2, ErrorPath, err.Error(), 2, m, err, n}}, evs)
+	assert.Equal(t, "txn op 1: rev mismatch", err.Error())
+
+	_, rev := n.Get("/a")
+	assert.Equal(t, Missing, rev)
+}
+
+func TestNodeApplyTxnBadMutation(t *testing.T) {
+	n, evs := emptyDir.applyAll(1, "txn:3:foo")
+	assert.Equal(t, 1, len(evs))
+	assert.Equal(t, ErrorPath, evs[0].Path)
+	assert.Equal(t, &TxnError{0, ErrBadMutation}, evs[0].Err)
+	v, _ := n.Get(ErrorPath)
+	assert.Equal(t, []string{evs[0].Body}, v)
+}
+
+func TestStoreTxnEvents(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.Watch(MustCompileGlob("/x/*"))
+	defer wt.Stop()
+
+	m, _ := EncodeTxn(
+		MustEncodeSet("/x/a", "1", Clobber),
+		MustEncodeSet("/y", "2", Clobber),
+		MustEncodeSet("/x/b", "3", Clobber),
+	)
+	st.Ops <- Op{1, m}
+
+	ev := <-wt.C
+	assert.Equal(t, int64(1), ev.Seqn)
+	assert.Equal(t, "/x/a", ev.Path)
+	ev = <-wt.C
+	assert.Equal(t, int64(1), ev.Seqn)
+	assert.Equal(t, "/x/b", ev.Path)
+
+	ch, err := st.Wait(MustCompileGlob("/y"), 1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "2", (<-ch).Body)
+}
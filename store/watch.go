@@ -0,0 +1,250 @@
+package store
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+)
+
+// ErrWatchOverflow is the error for a watch with policy Overflow whose
+// buffer filled up.
+var ErrWatchOverflow = errors.New("watch overflow")
+
+// Backpressure says what the store does with an event for a watch
+// whose buffer is full.
+type Backpressure int
+
+const (
+	// Block waits for the watcher to make room, holding up the store
+	// and every other watcher meanwhile.
+	Block Backpressure = iota
+
+	// DropOldest throws away the oldest event in the buffer to make
+	// room for the new one.
+	DropOldest
+
+	// Overflow ends the watch, closing its channel; its Err is then
+	// ErrWatchOverflow. The watcher can start again from a snapshot.
+	Overflow
+)
+
+// A Watch receives, in order, every event for a file matching its
+// glob. Use Stop to end the watch; C is closed once it has stopped
+// or the store itself is closed.
+//
+// By default the store does not drop events, and will wait for each
+// one to be received from C; a watcher that falls behind holds up the
+// store. See WatchBuffered for the alternatives.
+type Watch struct {
+	C  <-chan Event
+	st *Store
+	w  *watch
+}
+
+// Watch returns a Watch for glob, starting with the next revision to
+// be applied to st.
+func (st *Store) Watch(glob *Glob) *Watch {
+	return st.WatchExcept(glob, nil)
+}
+
+// WatchExcept is like Watch, but events for paths matching any glob
+// in excludes are not delivered. The exclusions are applied inside the
+// store, so skipped events are never sent on C.
+func (st *Store) WatchExcept(glob *Glob, excludes []*Glob) *Watch {
+	ch := make(chan Event)
+	w := st.watch(glob, excludes, <-st.Seqns+1, ch)
+	return &Watch{C: ch, st: st, w: w}
+}
+
+// An EventKind picks out events by what they did to their file, for
+// WatchKinds.
+type EventKind int
+
+const (
+	SetEvents EventKind = 1 << iota // the file was set
+	DelEvents                       // the file was deleted
+)
+
+// WatchKinds is like WatchExcept, but delivers only events of the
+// given kinds: SetEvents, DelEvents, or both, or'd together. Like the
+// exclusions, the kinds are checked inside the store, so other events
+// are never sent on C. Kinds of 0 means both.
+func (st *Store) WatchKinds(glob *Glob, excludes []*Glob, kinds EventKind) *Watch {
+	ch := make(chan Event)
+	w := &watch{
+		glob: glob,
+		excl: excludes,
+		rev:  <-st.Seqns + 1,
+		c:    ch,
+		keep: true,
+		kind: kinds,
+	}
+	st.watchCh <- w
+	return &Watch{C: ch, st: st, w: w}
+}
+
+// WatchFrom returns a Watch that first sends a set event for each file
+// matching glob as of revision rev, in sorted order, and then every
+// later event, starting at rev+1. These synthetic events have Seqn rev
+// and an empty Mut; their Rev is the file's own revision. If rev has
+// not yet been reached, WatchFrom waits for it. Returns ErrTooLate if
+// rev has been cleaned from the log.
+func (st *Store) WatchFrom(glob *Glob, rev int64) (*Watch, error) {
+	var g Getter = emptyDir
+	if rev > 0 {
+		ch, err := st.Wait(Any, rev)
+		if err != nil {
+			return nil, err
+		}
+		g = (<-ch).Getter
+	}
+
+	live := make(chan Event)
+	w := st.watch(glob, nil, rev+1, live)
+	if rev+1 < st.head {
+		st.cancelWatch(w)
+		return nil, ErrTooLate
+	}
+
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		Walk(g, glob, func(path, body string, frev int64) bool {
+			ch <- Event{rev, path, body, frev, "", nil, g}
+			return false
+		})
+		for ev := range live {
+			ch <- ev
+		}
+	}()
+	return &Watch{C: ch, st: st, w: w}, nil
+}
+
+// A ResumeTooOldError says that Resume can't pick up after Rev,
+// because the events since then have been cleaned from the log. The
+// watcher has to start over from the files as they are, such as with
+// WatchFrom. Oldest is the earliest revision Resume could have taken.
+type ResumeTooOldError struct {
+	Rev    int64
+	Oldest int64
+}
+
+func (e *ResumeTooOldError) Error() string {
+	return "can't resume watch after rev " + strconv.FormatInt(e.Rev, 10) +
+		"; oldest is " + strconv.FormatInt(e.Oldest, 10)
+}
+
+// Resume returns a Watch for glob that picks up after rev, the last
+// revision a watcher saw, as after it reconnects: it first replays,
+// in order, every event after rev that st has already applied, and
+// then carries on with each new one. Returns a *ResumeTooOldError if
+// some of those events have been cleaned from the log.
+func (st *Store) Resume(glob *Glob, rev int64) (*Watch, error) {
+	ch := make(chan Event)
+	w := st.watch(glob, nil, rev+1, ch)
+	if head := st.head; rev+1 < head {
+		st.cancelWatch(w)
+		return nil, &ResumeTooOldError{rev, head - 1}
+	}
+	return &Watch{C: ch, st: st, w: w}, nil
+}
+
+// WatchBuffered is like Watch, but up to n events wait in C for the
+// watcher, and policy says what happens to an event that finds C full.
+// N is at least 1 for DropOldest and Overflow.
+func (st *Store) WatchBuffered(glob *Glob, n int, policy Backpressure) *Watch {
+	if n < 1 && policy != Block {
+		n = 1
+	}
+	ch := make(chan Event, n)
+	w := &watch{
+		glob:   glob,
+		rev:    <-st.Seqns + 1,
+		c:      ch,
+		keep:   true,
+		policy: policy,
+		buf:    ch,
+	}
+	st.watchCh <- w
+	return &Watch{C: ch, st: st, w: w}
+}
+
+// Err returns ErrWatchOverflow if the store ended wt because it fell
+// behind, once C is closed, and nil otherwise.
+func (wt *Watch) Err() error {
+	return wt.w.err
+}
+
+// Dropped returns the number of events thrown away so far because wt
+// fell behind.
+func (wt *Watch) Dropped() int64 {
+	return atomic.LoadInt64(&wt.w.dropped)
+}
+
+// Sends e to w according to w's policy, and reports whether w should
+// stay open.
+func (w *watch) send(e Event) bool {
+	if w.sc != nil {
+		return w.sendSeq(e)
+	}
+	if w.bc != nil {
+		w.batch = append(w.batch, e) // sent by notifyAll
+		return true
+	}
+	switch w.policy {
+	case DropOldest:
+		for {
+			select {
+			case w.c <- e:
+				return true
+			default:
+			}
+			select {
+			case <-w.buf:
+				atomic.AddInt64(&w.dropped, 1)
+			default:
+			}
+		}
+	case Overflow:
+		select {
+		case w.c <- e:
+			return true
+		default:
+			w.err = ErrWatchOverflow
+			return false
+		}
+	}
+	w.c <- e
+	return true
+}
+
+func (st *Store) watch(glob *Glob, excludes []*Glob, rev int64, c chan<- Event) *watch {
+	w := &watch{
+		glob: glob,
+		excl: excludes,
+		rev:  rev,
+		c:    c,
+		keep: true,
+	}
+	st.watchCh <- w
+	return w
+}
+
+// Stop ends the watch. Events not yet received from C are discarded.
+func (wt *Watch) Stop() {
+	// The store may be blocked sending us an event; keep C drained so
+	// it can get to the cancellation.
+	go func() {
+		for _ = range wt.C {
+		}
+	}()
+
+	wt.st.cancelWatch(wt.w)
+}
+
+func (st *Store) cancelWatch(w *watch) {
+	select {
+	case st.cancelCh <- w:
+	case <-st.done:
+	}
+}
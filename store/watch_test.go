@@ -0,0 +1,386 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+	"time"
+)
+
+func TestWatchDeliversInOrder(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.Watch(MustCompileGlob("/x/**"))
+	defer wt.Stop()
+
+	st.Ops <- Op{1, MustEncodeSet("/x/a", "1", Clobber)}
+	assert.Equal(t, "/x/a", (<-wt.C).Path)
+	st.Ops <- Op{2, MustEncodeSet("/y", "2", Clobber)}
+
+	st.Ops <- Op{3, MustEncodeSet("/x/b", "3", Clobber)}
+	ev := <-wt.C
+	assert.Equal(t, int64(3), ev.Seqn)
+	assert.Equal(t, "/x/b", ev.Path)
+	st.Ops <- Op{4, MustEncodeDel("/x/a", Clobber)}
+	ev = <-wt.C
+	assert.Equal(t, int64(4), ev.Seqn)
+	assert.T(t, ev.IsDel())
+}
+
+func TestWatchStartsAtNextRev(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "1", Clobber)}
+	sync(st, 1)
+
+	wt := st.Watch(Any)
+	defer wt.Stop()
+	st.Ops <- Op{2, MustEncodeSet("/x", "2", Clobber)}
+	assert.Equal(t, int64(2), (<-wt.C).Seqn)
+}
+
+func TestWatchExcept(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	excl := []*Glob{MustCompileGlob("/logs/debug/**")}
+	wt := st.WatchExcept(MustCompileGlob("/logs/**"), excl)
+	defer wt.Stop()
+
+	st.Ops <- Op{1, MustEncodeSet("/logs/debug/a", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/logs/debug/b/c", "2", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/logs/info/a", "3", Clobber)}
+	ev := <-wt.C
+	assert.Equal(t, int64(3), ev.Seqn)
+	assert.Equal(t, "/logs/info/a", ev.Path)
+
+	st.Ops <- Op{4, MustEncodeDel("/logs/debug/a", Clobber)}
+	st.Ops <- Op{5, MustEncodeSet("/logs/warn", "5", Clobber)}
+	ev = <-wt.C
+	assert.Equal(t, int64(5), ev.Seqn)
+	assert.Equal(t, "/logs/warn", ev.Path)
+}
+
+func TestWatchKindsDels(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+	st.Ops <- Op{1, MustEncodeSet("/x/a", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/x/b", "2", Clobber)}
+	sync(st, 2)
+
+	wt := st.WatchKinds(MustCompileGlob("/x/**"), nil, DelEvents)
+	defer wt.Stop()
+
+	st.Ops <- Op{3, MustEncodeSet("/x/c", "3", Clobber)}
+	st.Ops <- Op{4, MustEncodeDel("/x/a", Clobber)}
+	ev := <-wt.C
+	assert.Equal(t, int64(4), ev.Seqn)
+	assert.Equal(t, "/x/a", ev.Path)
+	assert.T(t, ev.IsDel())
+
+	st.Ops <- Op{5, MustEncodeSet("/x/b", "5", Clobber)}
+	st.Ops <- Op{6, MustEncodeDel("/y", Clobber)}
+	st.Ops <- Op{7, MustEncodeDeltree("/x", Clobber)}
+	for _, path := range []string{"/x/b", "/x/c"} {
+		ev = <-wt.C
+		assert.Equal(t, int64(7), ev.Seqn)
+		assert.Equal(t, path, ev.Path)
+		assert.T(t, ev.IsDel())
+	}
+}
+
+func TestWatchKindsSetsExcept(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.WatchKinds(Any, []*Glob{MustCompileGlob("/x/**")}, SetEvents)
+	defer wt.Stop()
+
+	st.Ops <- Op{1, MustEncodeSet("/x/a", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/y", "2", Clobber)}
+	ev := <-wt.C
+	assert.Equal(t, "/y", ev.Path)
+	assert.Equal(t, int64(2), ev.Seqn)
+
+	st.Ops <- Op{3, MustEncodeDel("/y", Clobber)}
+	st.Ops <- Op{4, Nop}
+	st.Ops <- Op{5, MustEncodeSet("/z", "5", Clobber)}
+	ev = <-wt.C
+	assert.Equal(t, "/z", ev.Path)
+	assert.Equal(t, int64(5), ev.Seqn)
+}
+
+func TestWatchKindsBoth(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	for _, k := range []EventKind{0, SetEvents | DelEvents} {
+		wt := st.WatchKinds(Any, nil, k)
+		n := <-st.Seqns
+		st.Ops <- Op{n + 1, MustEncodeSet("/x", "", Clobber)}
+		assert.T(t, (<-wt.C).IsSet(), k)
+		st.Ops <- Op{n + 2, MustEncodeDel("/x", Clobber)}
+		assert.T(t, (<-wt.C).IsDel(), k)
+		wt.Stop()
+	}
+}
+
+func TestWatchStop(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.Watch(Any)
+	assert.Equal(t, 1, <-st.Waiting)
+	st.Ops <- Op{1, MustEncodeSet("/x", "1", Clobber)}
+	wt.Stop() // the store is blocked delivering seqn 1
+	assert.Equal(t, 0, <-st.Waiting)
+
+	_, ok := <-wt.C
+	for ok {
+		_, ok = <-wt.C
+	}
+	wt.Stop() // no effect
+}
+
+func TestWatchStoreClose(t *testing.T) {
+	st := New()
+	wt := st.Watch(Any)
+	close(st.Ops)
+	_, ok := <-wt.C
+	assert.T(t, !ok)
+	wt.Stop()
+}
+
+func TestWatchFrom(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/config/b", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/config/a", "2", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/other", "3", Clobber)}
+	st.Ops <- Op{4, MustEncodeSet("/config/b", "4", Clobber)}
+	sync(st, 4)
+
+	wt, err := st.WatchFrom(MustCompileGlob("/config/**"), 2)
+	assert.Equal(t, nil, err)
+	defer wt.Stop()
+
+	// the state at rev 2, in sorted order
+	ev := <-wt.C
+	assert.Equal(t, int64(2), ev.Seqn)
+	assert.Equal(t, "/config/a", ev.Path)
+	assert.Equal(t, "2", ev.Body)
+	assert.Equal(t, int64(2), ev.Rev)
+	assert.T(t, ev.IsSet())
+	ev = <-wt.C
+	assert.Equal(t, int64(2), ev.Seqn)
+	assert.Equal(t, "/config/b", ev.Path)
+	assert.Equal(t, "1", ev.Body)
+	assert.Equal(t, int64(1), ev.Rev)
+
+	// then everything after it, from the log and live
+	ev = <-wt.C
+	assert.Equal(t, int64(4), ev.Seqn)
+	assert.Equal(t, "4", ev.Body)
+	st.Ops <- Op{5, MustEncodeDel("/config/a", Clobber)}
+	ev = <-wt.C
+	assert.Equal(t, int64(5), ev.Seqn)
+	assert.T(t, ev.IsDel())
+}
+
+func TestWatchFromCurrent(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "1", Clobber)}
+	sync(st, 1)
+
+	wt, err := st.WatchFrom(Any, 1)
+	assert.Equal(t, nil, err)
+	defer wt.Stop()
+
+	ev := <-wt.C
+	assert.Equal(t, "/x", ev.Path)
+	st.Ops <- Op{2, MustEncodeSet("/x", "2", Clobber)}
+	ev = <-wt.C
+	assert.Equal(t, int64(2), ev.Seqn)
+	assert.Equal(t, "2", ev.Body)
+}
+
+func TestWatchFromZero(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "1", Clobber)}
+	sync(st, 1)
+
+	wt, err := st.WatchFrom(Any, 0)
+	assert.Equal(t, nil, err)
+	defer wt.Stop()
+	assert.Equal(t, int64(1), (<-wt.C).Seqn)
+}
+
+func TestWatchFromTooLate(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/x", "2", Clobber)}
+	sync(st, 2)
+	st.Clean(1)
+
+	_, err := st.WatchFrom(Any, 1)
+	assert.Equal(t, ErrTooLate, err)
+}
+
+func TestWatchFromStop(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/y", "1", Clobber)}
+	sync(st, 2)
+
+	wt, err := st.WatchFrom(Any, 2)
+	assert.Equal(t, nil, err)
+	wt.Stop() // before reading the replay
+	for _ = range wt.C {
+	}
+	assert.Equal(t, 0, <-st.Waiting)
+}
+
+// Applies sets of /x at revs 1 through n, not waiting for any watcher.
+func setMany(st *Store, n int64) {
+	go func() {
+		for i := int64(1); i <= n; i++ {
+			st.Ops <- Op{i, MustEncodeSet("/x", "", Clobber)}
+		}
+	}()
+}
+
+func TestResume(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/y", "1", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/x", "2", Clobber)}
+	sync(st, 3)
+	st.Clean(1)
+
+	wt, err := st.Resume(MustCompileGlob("/x"), 1)
+	assert.Equal(t, nil, err)
+	defer wt.Stop()
+
+	ev := <-wt.C
+	assert.Equal(t, int64(3), ev.Seqn)
+	assert.Equal(t, "2", ev.Body)
+
+	st.Ops <- Op{4, MustEncodeDel("/x", Clobber)}
+	ev = <-wt.C
+	assert.Equal(t, int64(4), ev.Seqn)
+	assert.T(t, ev.IsDel())
+}
+
+func TestResumeTooOld(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "1", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/x", "2", Clobber)}
+	st.Ops <- Op{3, MustEncodeSet("/x", "3", Clobber)}
+	sync(st, 3)
+	st.Clean(2)
+
+	_, err := st.Resume(Any, 1)
+	assert.Equal(t, &ResumeTooOldError{1, 2}, err)
+
+	// Starting over from the files as they are always works.
+	wt, err := st.WatchFrom(Any, 3)
+	assert.Equal(t, nil, err)
+	defer wt.Stop()
+	assert.Equal(t, "3", (<-wt.C).Body)
+}
+
+func TestWatchBufferedBlock(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.WatchBuffered(Any, 2, Block)
+	defer wt.Stop()
+	setMany(st, 5)
+
+	// The store fills the buffer, then waits for the watcher.
+	select {
+	case n := <-st.Seqns:
+		if n == 5 {
+			t.Fatal("store didn't wait for the watcher")
+		}
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for i := int64(1); i <= 5; i++ {
+		assert.Equal(t, i, (<-wt.C).Seqn)
+	}
+	assert.Equal(t, nil, wt.Err())
+	assert.Equal(t, int64(0), wt.Dropped())
+}
+
+func TestWatchBufferedDropOldest(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.WatchBuffered(Any, 2, DropOldest)
+	defer wt.Stop()
+	setMany(st, 5)
+	for <-st.Seqns < 5 {
+	}
+
+	assert.Equal(t, int64(4), (<-wt.C).Seqn)
+	assert.Equal(t, int64(5), (<-wt.C).Seqn)
+	assert.Equal(t, int64(3), wt.Dropped())
+
+	st.Ops <- Op{6, MustEncodeSet("/x", "", Clobber)}
+	assert.Equal(t, int64(6), (<-wt.C).Seqn)
+	assert.Equal(t, nil, wt.Err())
+}
+
+func TestWatchBufferedOverflow(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.WatchBuffered(Any, 2, Overflow)
+	defer wt.Stop()
+	other := st.WatchBuffered(Any, 10, Block)
+	defer other.Stop()
+	assert.Equal(t, 2, <-st.Waiting)
+	setMany(st, 5)
+	for <-st.Seqns < 5 {
+	}
+
+	assert.Equal(t, int64(1), (<-wt.C).Seqn)
+	assert.Equal(t, int64(2), (<-wt.C).Seqn)
+	_, ok := <-wt.C
+	assert.T(t, !ok)
+	assert.Equal(t, ErrWatchOverflow, wt.Err())
+	assert.Equal(t, 1, <-st.Waiting)
+
+	for i := int64(1); i <= 5; i++ {
+		assert.Equal(t, i, (<-other.C).Seqn)
+	}
+	assert.Equal(t, nil, other.Err())
+}
+
+func TestWatchBufferedMinimum(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	wt := st.WatchBuffered(Any, 0, DropOldest)
+	defer wt.Stop()
+	setMany(st, 3)
+	for <-st.Seqns < 3 {
+	}
+	assert.Equal(t, int64(3), (<-wt.C).Seqn)
+	assert.Equal(t, int64(2), wt.Dropped())
+}
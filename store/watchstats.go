@@ -0,0 +1,80 @@
+package store
+
+import (
+	"sort"
+)
+
+// PatternStats describes the watches on one glob pattern.
+type PatternStats struct {
+	Pattern string // as given to CompileGlob, flag group and all
+	Watches int    // registered now, waiters included
+	Events  int64  // sent to them, since the pattern was last unwatched
+}
+
+// Counts for one pattern, kept by the store's loop. Each watch on the
+// pattern points to its count, so dispatching an event costs one add.
+type patternCount struct {
+	watches int
+	events  int64
+}
+
+// WatchStats returns an entry for each distinct pattern with a watch
+// registered on st, those with the most watches first. A pattern with
+// no watches is forgotten, so its count of events starts again from 0
+// when it next has some.
+func (st *Store) WatchStats() []PatternStats {
+	c := make(chan []PatternStats, 1)
+	st.patternsCh <- c
+	return <-c
+}
+
+// Starts counting for w, which is being registered.
+func (st *Store) track(w *watch) {
+	key := patternKey(w.glob)
+	pc := st.patterns[key]
+	if pc == nil {
+		pc = new(patternCount)
+		st.patterns[key] = pc
+	}
+	pc.watches++
+	w.count = pc
+}
+
+// Stops counting for w, which has left the store's list of watches.
+func (st *Store) untrack(w *watch) {
+	if w.count == nil {
+		return
+	}
+	if w.count.watches--; w.count.watches == 0 {
+		delete(st.patterns, patternKey(w.glob))
+	}
+	w.count = nil
+}
+
+func patternKey(g *Glob) string {
+	return g.flags.String() + g.Pattern
+}
+
+func (st *Store) patternStats() []PatternStats {
+	ps := make([]PatternStats, 0, len(st.patterns))
+	for p, pc := range st.patterns {
+		ps = append(ps, PatternStats{p, pc.watches, pc.events})
+	}
+	sort.Sort(byWatches(ps))
+	return ps
+}
+
+type byWatches []PatternStats
+
+func (a byWatches) Len() int      { return len(a) }
+func (a byWatches) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+
+func (a byWatches) Less(i, j int) bool {
+	switch {
+	case a[i].Watches != a[j].Watches:
+		return a[i].Watches > a[j].Watches
+	case a[i].Events != a[j].Events:
+		return a[i].Events > a[j].Events
+	}
+	return a[i].Pattern < a[j].Pattern
+}
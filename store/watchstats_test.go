@@ -0,0 +1,74 @@
+package store
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestWatchStats(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	assert.Equal(t, []PatternStats{}, st.WatchStats())
+
+	a := st.Watch(MustCompileGlob("/a/**"))
+	b := st.Watch(MustCompileGlob("/a/**"))
+	c := st.Watch(MustCompileGlob("(?i)/B"))
+	assert.Equal(t, []PatternStats{
+		{"/a/**", 2, 0},
+		{"(?i)/B", 1, 0},
+	}, st.WatchStats())
+
+	st.Ops <- Op{1, MustEncodeSet("/a/x", "", Clobber)}
+	<-a.C
+	<-b.C
+	st.Ops <- Op{2, MustEncodeSet("/b", "", Clobber)}
+	<-c.C
+	assert.Equal(t, []PatternStats{
+		{"/a/**", 2, 2},
+		{"(?i)/B", 1, 1},
+	}, st.WatchStats())
+
+	a.Stop()
+	assert.Equal(t, []PatternStats{
+		{"/a/**", 1, 2},
+		{"(?i)/B", 1, 1},
+	}, st.WatchStats())
+
+	b.Stop()
+	c.Stop()
+	assert.Equal(t, []PatternStats{}, st.WatchStats())
+
+	// A watch on a pattern already forgotten starts from nothing.
+	d := st.Watch(MustCompileGlob("/a/**"))
+	defer d.Stop()
+	assert.Equal(t, []PatternStats{{"/a/**", 1, 0}}, st.WatchStats())
+}
+
+func TestWatchStatsWaiter(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	ch, err := st.Wait(MustCompileGlob("/x"), 1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []PatternStats{{"/x", 1, 0}}, st.WatchStats())
+
+	// A waiter is gone once it has its event.
+	st.Ops <- Op{1, MustEncodeSet("/x", "", Clobber)}
+	<-ch
+	assert.Equal(t, []PatternStats{}, st.WatchStats())
+}
+
+func TestWatchStatsTooLate(t *testing.T) {
+	st := New()
+	defer close(st.Ops)
+
+	st.Ops <- Op{1, MustEncodeSet("/x", "", Clobber)}
+	st.Ops <- Op{2, MustEncodeSet("/x", "", Clobber)}
+	sync(st, 2)
+	st.Clean(1)
+
+	_, err := st.WatchFrom(MustCompileGlob("/x"), 0)
+	assert.Equal(t, ErrTooLate, err)
+	assert.Equal(t, []PatternStats{}, st.WatchStats())
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// The error for using a closed PipeListener or PacketConn. Its text
+// matches the net package's, which is what callers look for to tell a
+// closed socket from a failed read.
+var ErrClosed = errors.New("use of closed network connection")
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// A net.Listener whose connections are the server ends of net.Pipes,
+// one for each call of Dial. Nothing touches the network, so a server
+// can be run and talked to entirely in memory.
+type PipeListener struct {
+	addr  pipeAddr
+	conns chan net.Conn
+	done  chan bool
+	once  sync.Once
+}
+
+// NewPipeListener returns a PipeListener whose Addr is addr, which
+// needn't be bound, or even reachable, but should look like the
+// host:port a real listener would have, for code that parses it.
+func NewPipeListener(addr string) *PipeListener {
+	return &PipeListener{
+		addr:  pipeAddr(addr),
+		conns: make(chan net.Conn),
+		done:  make(chan bool),
+	}
+}
+
+// Dial returns the client end of a new connection, once Accept has
+// taken the other.
+func (l *PipeListener) Dial() (net.Conn, error) {
+	c, s := net.Pipe()
+	select {
+	case l.conns <- s:
+		return c, nil
+	case <-l.done:
+		return nil, ErrClosed
+	}
+}
+
+func (l *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, ErrClosed
+	}
+}
+
+func (l *PipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *PipeListener) Addr() net.Addr {
+	return l.addr
+}
+
+// A PacketNet carries packets between the PacketConns made by its
+// Listen, in memory. Like UDP, it drops a packet whose receiver is
+// missing or too far behind, and the sender never knows.
+type PacketNet struct {
+	mu    sync.Mutex
+	conns map[string]*PacketConn
+}
+
+type packet struct {
+	data []byte
+	from *net.UDPAddr
+}
+
+// The number of packets a PacketConn holds unread before it drops more.
+const PacketQueue = 1000
+
+// Listen returns a PacketConn for addr. Packets sent to addr go to it
+// until it is closed.
+func (pn *PacketNet) Listen(addr *net.UDPAddr) *PacketConn {
+	pc := &PacketConn{
+		pn:   pn,
+		addr: addr,
+		in:   make(chan packet, PacketQueue),
+		done: make(chan bool),
+	}
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+	if pn.conns == nil {
+		pn.conns = make(map[string]*PacketConn)
+	}
+	pn.conns[addr.String()] = pc
+	return pc
+}
+
+func (pn *PacketNet) send(p packet, to string) {
+	pn.mu.Lock()
+	pc := pn.conns[to]
+	pn.mu.Unlock()
+	if pc == nil {
+		return
+	}
+	select {
+	case pc.in <- p:
+	default:
+	}
+}
+
+// A net.PacketConn on a PacketNet. Its addresses are *net.UDPAddrs.
+// Deadlines are not supported; setting one does nothing.
+type PacketConn struct {
+	pn   *PacketNet
+	addr *net.UDPAddr
+	in   chan packet
+	done chan bool
+	once sync.Once
+}
+
+func (pc *PacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	select {
+	case <-pc.done:
+		return 0, nil, ErrClosed
+	default:
+	}
+	select {
+	case p := <-pc.in:
+		return copy(b, p.data), p.from, nil
+	case <-pc.done:
+		return 0, nil, ErrClosed
+	}
+}
+
+func (pc *PacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	select {
+	case <-pc.done:
+		return 0, ErrClosed
+	default:
+	}
+	p := packet{append([]byte(nil), b...), pc.addr}
+	pc.pn.send(p, addr.String())
+	return len(b), nil
+}
+
+func (pc *PacketConn) Close() error {
+	pc.once.Do(func() {
+		pc.pn.mu.Lock()
+		if pc.pn.conns[pc.addr.String()] == pc {
+			delete(pc.pn.conns, pc.addr.String())
+		}
+		pc.pn.mu.Unlock()
+		close(pc.done)
+	})
+	return nil
+}
+
+func (pc *PacketConn) LocalAddr() net.Addr {
+	return pc.addr
+}
+
+func (pc *PacketConn) SetDeadline(t time.Time) error      { return nil }
+func (pc *PacketConn) SetReadDeadline(t time.Time) error  { return nil }
+func (pc *PacketConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"github.com/bmizerany/assert"
+	"net"
+	"testing"
+)
+
+func TestPipeListener(t *testing.T) {
+	l := NewPipeListener("1.2.3.4:5")
+	assert.Equal(t, "1.2.3.4:5", l.Addr().String())
+
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			c.Write([]byte("x"))
+			c.Close()
+		}
+	}()
+	c, err := l.Dial()
+	assert.Equal(t, nil, err)
+	buf := make([]byte, 1)
+	n, err := c.Read(buf)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "x", string(buf))
+
+	l.Close()
+	l.Close()
+	_, err = l.Accept()
+	assert.Equal(t, ErrClosed, err)
+	_, err = l.Dial()
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestPacketNet(t *testing.T) {
+	var pn PacketNet
+	x := &net.UDPAddr{IP: net.IP{1, 2, 3, 4}, Port: 5}
+	y := &net.UDPAddr{IP: net.IP{2, 3, 4, 5}, Port: 6}
+	z := &net.UDPAddr{IP: net.IP{3, 4, 5, 6}, Port: 7}
+	px := pn.Listen(x)
+	py := pn.Listen(y)
+
+	n, err := px.WriteTo([]byte("a"), y)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, n)
+
+	// a packet to no one is lost, as with UDP
+	_, err = px.WriteTo([]byte("b"), z)
+	assert.Equal(t, nil, err)
+
+	buf := make([]byte, 10)
+	n, addr, err := py.ReadFrom(buf)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a", string(buf[:n]))
+	assert.Equal(t, x, addr)
+
+	for i := 0; i < PacketQueue+1; i++ {
+		px.WriteTo([]byte("c"), y)
+	}
+	assert.Equal(t, PacketQueue, len(py.in))
+
+	py.Close()
+	_, _, err = py.ReadFrom(buf)
+	assert.Equal(t, ErrClosed, err)
+	_, err = py.WriteTo([]byte("d"), x)
+	assert.Equal(t, ErrClosed, err)
+	px.Close()
+}
@@ -0,0 +1,32 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/madebymany/doozerd/server"
+	"net/http"
+)
+
+// Health, if set, answers /health.
+var Health func() server.Health
+
+// Serves the node's health as JSON, with status 200 if it is caught up
+// with the cluster and 503 if not, so that a load balancer can route
+// away from a node that has fallen behind.
+func healthServer(w http.ResponseWriter, r *http.Request) {
+	if Health == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	h := Health()
+	buf, err := json.Marshal(h)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	if !h.CaughtUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(buf)
+}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getHealth(t *testing.T, h server.Health) (*httptest.ResponseRecorder, server.Health) {
+	Health = func() server.Health { return h }
+	defer func() { Health = nil }()
+
+	w := httptest.NewRecorder()
+	healthServer(w, &http.Request{})
+	assert.Equal(t, "application/json", w.HeaderMap.Get("content-type"))
+
+	var got server.Health
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &got))
+	return w, got
+}
+
+func TestHealthOK(t *testing.T) {
+	h := server.Health{Role: "member", Rev: 10, Latest: 10, CaughtUp: true, Uptime: 1e9}
+	w, got := getHealth(t, h)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, h, got)
+}
+
+func TestHealthLagging(t *testing.T) {
+	h := server.Health{Role: "slave", Rev: 10, Latest: 5000, CaughtUp: false, Uptime: 1e9}
+	w, got := getHealth(t, h)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, h, got)
+}
+
+func TestHealthNone(t *testing.T) {
+	w := httptest.NewRecorder()
+	healthServer(w, &http.Request{})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"fmt"
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/server"
+	"github.com/madebymany/doozerd/store"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// ServeMetrics says whether Serve answers /metrics, in the Prometheus
+// text format.
+var ServeMetrics = true
+
+func metricsText(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/plain; version=0.0.4")
+	writeMetrics(w)
+}
+
+func writeMetrics(w io.Writer) {
+	reqs := server.Requests()
+	var verbs []string
+	for v := range reqs {
+		verbs = append(verbs, v)
+	}
+	sort.Strings(verbs)
+	metricHead(w, "doozer_requests_total", "counter", "Requests served, by verb.")
+	for _, v := range verbs {
+		fmt.Fprintf(w, "doozer_requests_total{verb=%q} %d\n", v, reqs[v])
+	}
+
+	const lat = "doozer_propose_latency_seconds"
+	h := consensus.ProposeLatency
+	cum, count, sum := h.Read()
+	metricHead(w, lat, "histogram", "Time for a value this node proposed to be learned.")
+	for i, b := range h.Bounds {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", lat, fmtFloat(b), cum[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", lat, count)
+	fmt.Fprintf(w, "%s_sum %s\n", lat, fmtFloat(sum))
+	fmt.Fprintf(w, "%s_count %d\n", lat, count)
+
+	metricHead(w, "doozer_connections", "gauge", "Client connections now open.")
+	fmt.Fprintf(w, "doozer_connections %d\n", server.Conns())
+	cc := server.ConnCount
+	metricHead(w, "doozer_connections_total", "counter", "Client connections served.")
+	fmt.Fprintf(w, "doozer_connections_total %d\n", cc.Opened())
+	metricHead(w, "doozer_connections_failed_total", "counter", "Client connections that ended with an error.")
+	fmt.Fprintf(w, "doozer_connections_failed_total %d\n", cc.Failed())
+
+	if Health != nil {
+		h := Health()
+		metricHead(w, "doozer_apply_lag", "gauge", "Revisions this node is behind the cluster.")
+		fmt.Fprintf(w, "doozer_apply_lag %d\n", h.Latest-h.Rev)
+	}
+
+	if Store != nil {
+		s := Store.Stats()
+		metricHead(w, "doozer_store_nodes", "gauge", "Files and directories in the store.")
+		fmt.Fprintf(w, "doozer_store_nodes %d\n", s.Nodes)
+		metricHead(w, "doozer_revision", "gauge", "The latest revision committed to the store.")
+		fmt.Fprintf(w, "doozer_revision %d\n", s.Rev)
+
+		nodes := store.Getdir(Store, "/ctl/node")
+		sort.Strings(nodes)
+		metricHead(w, "doozer_node_lag", "gauge", "Revisions each node last said it was behind the cluster.")
+		for _, id := range nodes {
+			lag, err := strconv.ParseInt(store.GetString(Store, "/ctl/node/"+id+"/lag"), 10, 64)
+			if err == nil {
+				fmt.Fprintf(w, "doozer_node_lag{node=%q} %d\n", id, lag)
+			}
+		}
+
+		ps := Store.WatchStats()
+		metricHead(w, "doozer_watches", "gauge", "Watches and waits registered, by glob pattern.")
+		for _, p := range ps {
+			fmt.Fprintf(w, "doozer_watches{pattern=%q} %d\n", p.Pattern, p.Watches)
+		}
+		metricHead(w, "doozer_watch_events_total", "counter", "Events sent to watches and waits, by glob pattern.")
+		for _, p := range ps {
+			fmt.Fprintf(w, "doozer_watch_events_total{pattern=%q} %d\n", p.Pattern, p.Events)
+		}
+	}
+}
+
+func metricHead(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func fmtFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,141 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/madebymany/doozerd/consensus"
+	"github.com/madebymany/doozerd/server"
+	"github.com/madebymany/doozerd/store"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Proposer makes the changes asked for through /keys/. If it is nil,
+// the gateway is read-only, as it is by default: it has no TLS and no
+// identity, so anyone who can reach it could change anything.
+var Proposer consensus.Proposer
+
+// Status codes for the errors a change can meet.
+var restErrs = map[error]int{
+	store.ErrRevMismatch:  http.StatusConflict,
+	store.ErrBadPath:      http.StatusBadRequest,
+	store.ErrValueTooLong: http.StatusRequestEntityTooLarge,
+	syscall.EISDIR:        http.StatusConflict,
+	syscall.ENOTDIR:       http.StatusConflict,
+}
+
+// Serves the store over HTTP under /keys/. GET reads a file, or lists
+// a directory as a sorted JSON array if given dir=1; PUT sets a file
+// to the request body; and DELETE deletes a file. A file's revision is
+// its ETag, and giving it in If-Match makes a PUT or DELETE conditional
+// on it, as rev is for SET and DEL.
+func restServer(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path[len("/keys"):]
+	if len(path) > 1 && strings.HasSuffix(path, "/") {
+		path = path[:len(path)-1]
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		restGet(w, r, path)
+	case "PUT", "DELETE":
+		restChange(w, r, path)
+	default:
+		w.Header().Set("allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func restGet(w http.ResponseWriter, r *http.Request, path string) {
+	_, g := Store.Snap()
+	v, rev := g.Get(path)
+	switch {
+	case rev == store.Missing:
+		http.Error(w, "no such file", http.StatusNotFound)
+	case rev == store.Dir && r.FormValue("dir") == "1":
+		sort.Strings(v)
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	case rev == store.Dir:
+		http.Error(w, "is a directory; use dir=1", http.StatusConflict)
+	case r.FormValue("dir") == "1":
+		http.Error(w, "not a directory", http.StatusConflict)
+	default:
+		w.Header().Set("content-type", "application/octet-stream")
+		w.Header().Set("etag", strconv.Quote(strconv.FormatInt(rev, 10)))
+		io.WriteString(w, v[0])
+	}
+}
+
+func restChange(w http.ResponseWriter, r *http.Request, path string) {
+	if Proposer == nil {
+		http.Error(w, "read-only", http.StatusForbidden)
+		return
+	}
+	if server.IsVirtual(path) {
+		http.Error(w, "read-only file", http.StatusForbidden)
+		return
+	}
+	if server.HasRules(Store) {
+		http.Error(w, "read-only while there are ACL rules", http.StatusForbidden)
+		return
+	}
+
+	rev := store.Clobber
+	if s := r.Header.Get("if-match"); s != "" {
+		n, err := strconv.ParseInt(strings.Trim(s, `"`), 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "bad If-Match", http.StatusBadRequest)
+			return
+		}
+		rev = n
+	}
+
+	var ev store.Event
+	if r.Method == "DELETE" {
+		if _, cur := Store.Get(path); cur == store.Missing {
+			http.Error(w, "no such file", http.StatusNotFound)
+			return
+		}
+		ev = consensus.Del(Proposer, path, rev)
+	} else {
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(Store.MaxValueLen)+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body) > Store.MaxValueLen {
+			http.Error(w, store.ErrValueTooLong.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := server.Validate(path, body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ev = consensus.Set(Proposer, path, body, rev)
+	}
+
+	if ev.Err != nil {
+		err := ev.Err
+		if te, ok := err.(*store.TxnError); ok {
+			err = te.Err
+		}
+		code, ok := restErrs[err]
+		if !ok {
+			code = http.StatusInternalServerError
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if r.Method == "DELETE" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("etag", strconv.Quote(strconv.FormatInt(ev.Seqn, 10)))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,133 @@
+package web
+
+import (
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"github.com/madebymany/doozerd/test"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func restDo(method, url, body string, hdr ...string) *httptest.ResponseRecorder {
+	r, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i+1 < len(hdr); i += 2 {
+		r.Header.Set(hdr[i], hdr[i+1])
+	}
+	w := httptest.NewRecorder()
+	restServer(w, r)
+	return w
+}
+
+func restSetup() func() {
+	Store = store.New()
+	Proposer = &test.FakeProposer{Store: Store}
+	return func() {
+		close(Store.Ops)
+		Store, Proposer = nil, nil
+	}
+}
+
+func TestRestSetGet(t *testing.T) {
+	defer restSetup()()
+
+	w := restDo("PUT", "http://x/keys/a/b", "hello")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `"1"`, w.HeaderMap.Get("etag"))
+
+	w = restDo("GET", "http://x/keys/a/b", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+	assert.Equal(t, `"1"`, w.HeaderMap.Get("etag"))
+}
+
+func TestRestMissing(t *testing.T) {
+	defer restSetup()()
+
+	assert.Equal(t, 404, restDo("GET", "http://x/keys/nope", "").Code)
+	assert.Equal(t, 404, restDo("DELETE", "http://x/keys/nope", "").Code)
+}
+
+func TestRestCASConflict(t *testing.T) {
+	defer restSetup()()
+
+	restDo("PUT", "http://x/keys/a", "1")
+	restDo("PUT", "http://x/keys/a", "2")
+
+	w := restDo("PUT", "http://x/keys/a", "3", "If-Match", `"1"`)
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, "2", restDo("GET", "http://x/keys/a", "").Body.String())
+
+	w = restDo("DELETE", "http://x/keys/a", "", "If-Match", "1")
+	assert.Equal(t, 409, w.Code)
+
+	w = restDo("PUT", "http://x/keys/a", "3", "If-Match", `"2"`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "3", restDo("GET", "http://x/keys/a", "").Body.String())
+
+	assert.Equal(t, 400, restDo("PUT", "http://x/keys/a", "4", "If-Match", "x").Code)
+}
+
+func TestRestDelete(t *testing.T) {
+	defer restSetup()()
+
+	restDo("PUT", "http://x/keys/a", "1")
+	assert.Equal(t, 204, restDo("DELETE", "http://x/keys/a", "", "If-Match", "1").Code)
+	assert.Equal(t, 404, restDo("GET", "http://x/keys/a", "").Code)
+}
+
+func TestRestDir(t *testing.T) {
+	defer restSetup()()
+
+	restDo("PUT", "http://x/keys/d/b", "")
+	restDo("PUT", "http://x/keys/d/a", "")
+
+	w := restDo("GET", "http://x/keys/d/?dir=1", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "[\"a\",\"b\"]\n", w.Body.String())
+
+	assert.Equal(t, 409, restDo("GET", "http://x/keys/d/", "").Code)
+	assert.Equal(t, 409, restDo("GET", "http://x/keys/d/a?dir=1", "").Code)
+	assert.Equal(t, 409, restDo("PUT", "http://x/keys/d", "x").Code)
+}
+
+func TestRestReadOnly(t *testing.T) {
+	defer restSetup()()
+	Proposer = nil
+
+	assert.Equal(t, 403, restDo("PUT", "http://x/keys/a", "1").Code)
+	assert.Equal(t, 405, restDo("POST", "http://x/keys/a", "1").Code)
+}
+
+func TestRestTooLong(t *testing.T) {
+	defer restSetup()()
+	Store.MaxValueLen = 3
+
+	assert.Equal(t, 200, restDo("PUT", "http://x/keys/a", "123").Code)
+	assert.Equal(t, 413, restDo("PUT", "http://x/keys/a", "1234").Code)
+	assert.Equal(t, "123", restDo("GET", "http://x/keys/a", "").Body.String())
+}
+
+func TestRestVirtual(t *testing.T) {
+	defer restSetup()()
+
+	assert.Equal(t, 403, restDo("PUT", "http://x/keys/ctl/limits/maxvalue", "1").Code)
+	assert.Equal(t, 403, restDo("PUT", "http://x/keys/ctl/stats/rev", "1").Code)
+	assert.Equal(t, 403, restDo("DELETE", "http://x/keys/ctl/watches", "").Code)
+	assert.Equal(t, 404, restDo("GET", "http://x/keys/ctl/stats/rev", "").Code)
+}
+
+func TestRestACL(t *testing.T) {
+	defer restSetup()()
+
+	restDo("PUT", "http://x/keys/a", "1")
+	restDo("PUT", "http://x/keys/ctl/acl/bob/r", "/a SET")
+
+	assert.Equal(t, 403, restDo("PUT", "http://x/keys/a", "2").Code)
+	assert.Equal(t, 403, restDo("DELETE", "http://x/keys/a", "").Code)
+	assert.Equal(t, "1", restDo("GET", "http://x/keys/a", "").Body.String())
+}
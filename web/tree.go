@@ -0,0 +1,72 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/madebymany/doozerd/store"
+	"net/http"
+	"strings"
+	"syscall"
+	"text/template"
+)
+
+var treeTpl = template.Must(template.New("tree.html").Parse(tree_html))
+
+// An entry in a directory listing for the tree browser. A file's entry
+// also has its contents, so the browser needn't fetch each one.
+type treeEntry struct {
+	store.DirEntry
+	Value string `json:",omitempty"`
+}
+
+func treePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	if len(path) > 1 && strings.HasSuffix(path, "/") {
+		path = path[:len(path)-1]
+	}
+	return path
+}
+
+func treeHtml(w http.ResponseWriter, r *http.Request) {
+	var x info
+	x.Name = ClusterName
+	x.Path = treePath(r.URL.Path[len("/$tree"):])
+	w.Header().Set("content-type", "text/html")
+	treeTpl.Execute(w, x)
+}
+
+// Serves the entries of a directory, sorted by name, as a JSON array
+// of treeEntry. Edits go through /keys/, with the revision given here
+// in If-Match.
+func dirServer(w http.ResponseWriter, r *http.Request) {
+	path := treePath(r.URL.Path[len("/$dir"):])
+	_, g := Store.Snap()
+	ents, err := store.GetdirStat(g, path)
+	switch err {
+	case nil:
+	case syscall.ENOENT:
+		http.Error(w, "no such directory", http.StatusNotFound)
+		return
+	case syscall.ENOTDIR:
+		http.Error(w, "not a directory", http.StatusConflict)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	prefix := path
+	if prefix == "/" {
+		prefix = ""
+	}
+	v := make([]treeEntry, len(ents))
+	for i, e := range ents {
+		v[i].DirEntry = e
+		if !e.IsDir {
+			v[i].Value = store.GetString(g, prefix+"/"+e.Name)
+		}
+	}
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
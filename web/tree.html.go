@@ -0,0 +1,5 @@
+package web
+
+// This file was generated from web/tree.html.
+
+var tree_html string = "<html>\n  <head>\n    <title>{{ .Name }} {{ .Path }} doozer tree</title>\n    <link rel=stylesheet href=/$main.css>\n  </head>\n\n  <body class=loading>\n    <div id=info>\n      <span id=status>loading</span>\n      <span id=conflict class=msg>\n        <span id=conflictmsg></span>\n        <a id=dismiss>[OK]</a>\n      </span>\n    </div>\n\n    <dl id=tree class=browse>\n      <dt>{{ .Path }}</dt>\n      <dd id=root>\n        <dl></dl>\n        <table><tbody></table>\n      </dd>\n    </dl>\n\n    <script>\n      var path = \"{{ .Path }}\";\n    </script>\n    <script src=/$tree.js></script>\n    <script src=\"http://ajax.googleapis.com/ajax/libs/jquery/1.4.2/jquery.min.js\" async defer onload=$(document).ready(dr) onerror=jerr()></script>\n  </body>\n</html>\n"
@@ -0,0 +1,130 @@
+// Browses the store as a tree, loading each directory from /$dir/ when
+// it is first expanded, and saves an edited file with a PUT to /keys/,
+// conditional on the revision shown.
+
+function join(dir, name) {
+  return (dir == '/' ? '' : dir) + '/' + name;
+}
+
+function conflict(msg) {
+  $('#conflictmsg').text(msg);
+  $('body').addClass('conflict');
+}
+
+function status(s) {
+  $('#status').text(s);
+}
+
+function load(dd, dir) {
+  status('loading ' + dir);
+  $.ajax({
+    url: '/$dir' + dir,
+    dataType: 'json',
+    success: function (ents) {
+      dd.children('dl').empty();
+      dd.children('table').children('tbody').empty();
+      for (var i = 0; i < ents.length; i++) {
+        if (ents[i].IsDir) {
+          addDir(dd, dir, ents[i]);
+        } else {
+          addFile(dd, dir, ents[i]);
+        }
+      }
+      dd.addClass('loaded');
+      status('open');
+      $('body').addClass('open').removeClass('loading error');
+    },
+    error: function (xhr) {
+      status('error loading ' + dir + ': ' + xhr.status);
+      $('body').addClass('error').removeClass('loading');
+    }
+  });
+}
+
+function addDir(parent, dir, ent) {
+  var p = join(dir, ent.Name);
+  var div = $('<div class=shut>').attr('name', ent.Name);
+  var dt = $('<dt>').text(ent.Name + '/ (' + ent.Len + ')');
+  var dd = $('<dd>').append('<dl>').append('<table><tbody>');
+  dt.click(function () {
+    div.toggleClass('shut');
+    if (!dd.hasClass('loaded')) {
+      load(dd, p);
+    }
+  });
+  div.append(dt).append(dd);
+  parent.children('dl').append(div);
+}
+
+function addFile(parent, dir, ent) {
+  var tr = $('<tr>').attr('name', ent.Name);
+  tr.append($('<th>').text(ent.Name)).
+    append('<td class=rev>').
+    append('<td class=eq>').
+    append('<td class=body>');
+  show(tr, join(dir, ent.Name), ent.Value, ent.Rev);
+  parent.children('table').children('tbody').append(tr);
+}
+
+function show(tr, p, value, rev) {
+  tr.children('td.rev').text('(' + rev + ')');
+  var td = tr.children('td.body').empty().text(value);
+  td.unbind('click').click(function () {
+    edit(tr, p, value, rev);
+  });
+}
+
+function edit(tr, p, value, rev) {
+  var td = tr.children('td.body').unbind('click').empty();
+  var input = $('<input>').val(value);
+  td.append(input);
+  input.focus();
+  input.keydown(function (ev) {
+    if (ev.keyCode == 27) { // escape
+      show(tr, p, value, rev);
+    } else if (ev.keyCode == 13) { // return
+      save(tr, p, input.val(), rev);
+    }
+  });
+}
+
+function save(tr, p, value, rev) {
+  $.ajax({
+    type: 'PUT',
+    url: '/keys' + p,
+    data: value,
+    processData: false,
+    contentType: 'application/octet-stream',
+    beforeSend: function (xhr) {
+      xhr.setRequestHeader('If-Match', '"' + rev + '"');
+    },
+    success: function (data, text, xhr) {
+      var etag = xhr.getResponseHeader('ETag') || '';
+      show(tr, p, value, etag.replace(/"/g, ''));
+      tr.addClass('new');
+      setTimeout(function() { tr.removeClass('new') }, 550);
+    },
+    error: function (xhr) {
+      if (xhr.status == 409) {
+        conflict(p + ' was changed by someone else; reloaded it');
+      } else {
+        conflict('could not save ' + p + ': ' + xhr.responseText);
+      }
+      var dir = p.slice(0, p.lastIndexOf('/')) || '/';
+      load(tr.closest('dd'), dir);
+    }
+  });
+}
+
+function dr() {
+  $('#dismiss').click(function () {
+    $('body').removeClass('conflict');
+  });
+  load($('#root'), path);
+}
+
+function jerr() {
+  const m = 'could not load jquery (is your network link down?)';
+  document.getElementById('status').innerText = m;
+  document.getElementsByTagName('body')[0].className = 'error';
+}
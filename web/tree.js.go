@@ -0,0 +1,5 @@
+package web
+
+// This file was generated from web/tree.js.
+
+var tree_js string = "// Browses the store as a tree, loading each directory from /$dir/ when\n// it is first expanded, and saves an edited file with a PUT to /keys/,\n// conditional on the revision shown.\n\nfunction join(dir, name) {\n  return (dir == '/' ? '' : dir) + '/' + name;\n}\n\nfunction conflict(msg) {\n  $('#conflictmsg').text(msg);\n  $('body').addClass('conflict');\n}\n\nfunction status(s) {\n  $('#status').text(s);\n}\n\nfunction load(dd, dir) {\n  status('loading ' + dir);\n  $.ajax({\n    url: '/$dir' + dir,\n    dataType: 'json',\n    success: function (ents) {\n      dd.children('dl').empty();\n      dd.children('table').children('tbody').empty();\n      for (var i = 0; i < ents.length; i++) {\n        if (ents[i].IsDir) {\n          addDir(dd, dir, ents[i]);\n        } else {\n          addFile(dd, dir, ents[i]);\n        }\n      }\n      dd.addClass('loaded');\n      status('open');\n      $('body').addClass('open').removeClass('loading error');\n    },\n    error: function (xhr) {\n      status('error loading ' + dir + ': ' + xhr.status);\n      $('body').addClass('error').removeClass('loading');\n    }\n  });\n}\n\nfunction addDir(parent, dir, ent) {\n  var p = join(dir, ent.Name);\n  var div = $('<div class=shut>').attr('name', ent.Name);\n  var dt = $('<dt>').text(ent.Name + '/ (' + ent.Len + ')');\n  var dd = $('<dd>').append('<dl>').append('<table><tbody>');\n  dt.click(function () {\n    div.toggleClass('shut');\n    if (!dd.hasClass('loaded')) {\n      load(dd, p);\n    }\n  });\n  div.append(dt).append(dd);\n  parent.children('dl').append(div);\n}\n\nfunction addFile(parent, dir, ent) {\n  var tr = $('<tr>').attr('name', ent.Name);\n  tr.append($('<th>').text(ent.Name)).\n    append('<td class=rev>').\n    append('<td class=eq>').\n    append('<td class=body>');\n  show(tr, join(dir, ent.Name), ent.Value, ent.Rev);\n  parent.children('table').children('tbody').append(tr);\n}\n\nfunction show(tr, p, value, rev) {\n  tr.children('td.rev').text('(' + rev + ')');\n  var td = tr.children('td.body').empty().text(value);\n  td.unbind('click').click(function () {\n    edit(tr, p, value, rev);\n  });\n}\n\nfunction edit(tr, p, value, rev) {\n  var td = tr.children('td.body').unbind('click').empty();\n  var input = $('<input>').val(value);\n  td.append(input);\n  input.focus();\n  input.keydown(function (ev) {\n    if (ev.keyCode == 27) { // escape\n      show(tr, p, value, rev);\n    } else if (ev.keyCode == 13) { // return\n      save(tr, p, input.val(), rev);\n    }\n  });\n}\n\nfunction save(tr, p, value, rev) {\n  $.ajax({\n    type: 'PUT',\n    url: '/keys' + p,\n    data: value,\n    processData: false,\n    contentType: 'application/octet-stream',\n    beforeSend: function (xhr) {\n      xhr.setRequestHeader('If-Match', '\"' + rev + '\"');\n    },\n    success: function (data, text, xhr) {\n      var etag = xhr.getResponseHeader('ETag') || '';\n      show(tr, p, value, etag.replace(/\"/g, ''));\n      tr.addClass('new');\n      setTimeout(function() { tr.removeClass('new') }, 550);\n    },\n    error: function (xhr) {\n      if (xhr.status == 409) {\n        conflict(p + ' was changed by someone else; reloaded it');\n      } else {\n        conflict('could not save ' + p + ': ' + xhr.responseText);\n      }\n      var dir = p.slice(0, p.lastIndexOf('/')) || '/';\n      load(tr.closest('dd'), dir);\n    }\n  });\n}\n\nfunction dr() {\n  $('#dismiss').click(function () {\n    $('body').removeClass('conflict');\n  });\n  load($('#root'), path);\n}\n\nfunction jerr() {\n  const m = 'could not load jquery (is your network link down?)';\n  document.getElementById('status').innerText = m;\n  document.getElementsByTagName('body')[0].className = 'error';\n}\n"
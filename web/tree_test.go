@@ -0,0 +1,101 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func dirGet(url string) (*httptest.ResponseRecorder, []treeEntry) {
+	r, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		panic(err)
+	}
+	w := httptest.NewRecorder()
+	dirServer(w, r)
+
+	var ents []treeEntry
+	if w.Code == 200 {
+		if err := json.Unmarshal(w.Body.Bytes(), &ents); err != nil {
+			panic(err)
+		}
+	}
+	return w, ents
+}
+
+func TestTreeDir(t *testing.T) {
+	defer restSetup()()
+
+	restDo("PUT", "http://x/keys/d/b", "hi")
+	restDo("PUT", "http://x/keys/d/a/x", "")
+	restDo("PUT", "http://x/keys/d/a/y", "")
+
+	exp := []treeEntry{
+		{store.DirEntry{"a", store.Dir, 2, true}, ""},
+		{store.DirEntry{"b", 1, 2, false}, "hi"},
+	}
+	w, ents := dirGet("http://x/$dir/d")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json", w.HeaderMap.Get("content-type"))
+	assert.Equal(t, exp, ents)
+
+	_, ents = dirGet("http://x/$dir/d/")
+	assert.Equal(t, exp, ents)
+}
+
+func TestTreeRoot(t *testing.T) {
+	defer restSetup()()
+
+	restDo("PUT", "http://x/keys/a", "1")
+
+	exp := []treeEntry{{store.DirEntry{"a", 1, 1, false}, "1"}}
+	_, ents := dirGet("http://x/$dir/")
+	assert.Equal(t, exp, ents)
+}
+
+func TestTreeDirErrors(t *testing.T) {
+	defer restSetup()()
+
+	restDo("PUT", "http://x/keys/a", "1")
+
+	w, _ := dirGet("http://x/$dir/nope")
+	assert.Equal(t, 404, w.Code)
+	w, _ = dirGet("http://x/$dir/a")
+	assert.Equal(t, 409, w.Code)
+}
+
+// An edit is a PUT to /keys/ with the revision from /$dir/ in If-Match;
+// once someone else has changed the file, it fails with a conflict.
+func TestTreeEditConflict(t *testing.T) {
+	defer restSetup()()
+
+	restDo("PUT", "http://x/keys/d/a", "1")
+	_, ents := dirGet("http://x/$dir/d")
+	rev := strconv.Quote(strconv.FormatInt(ents[0].Rev, 10))
+
+	restDo("PUT", "http://x/keys/d/a", "2")
+	w := restDo("PUT", "http://x/keys/d/a", "3", "If-Match", rev)
+	assert.Equal(t, 409, w.Code)
+
+	_, ents = dirGet("http://x/$dir/d")
+	assert.Equal(t, "2", ents[0].Value)
+}
+
+func TestTreeHtml(t *testing.T) {
+	ClusterName = "c"
+	defer func() { ClusterName = "" }()
+
+	r, err := http.NewRequest("GET", "http://x/$tree/d/", nil)
+	if err != nil {
+		panic(err)
+	}
+	w := httptest.NewRecorder()
+	treeHtml(w, r)
+	assert.Equal(t, "text/html", w.HeaderMap.Get("content-type"))
+	assert.T(t, strings.Contains(w.Body.String(), `var path = "/d";`))
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"code.google.com/p/go.net/websocket"
+	"github.com/madebymany/doozerd/store"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// Sent in place of an event when a watch can't go on, such as when rev
+// is older than the store's history.
+type watchError struct {
+	Err string
+}
+
+// Streams each change to a file matching the glob given in the query,
+// as a JSON-encoded store.Event, to a WebSocket client. The changes
+// start at rev if it is given, or else the next revision. A bad glob
+// or rev is refused with status 400 before the upgrade, where the
+// WATCH verb answers on the open connection; a browser's WebSocket
+// sees only that it failed to connect, not why.
+func watchServer(w http.ResponseWriter, r *http.Request) {
+	glob, err := store.CompileGlobCached(r.FormValue("glob"))
+	if err != nil {
+		http.Error(w, "bad glob: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rev, _ := Store.Snap()
+	rev++
+	if s := r.FormValue("rev"); s != "" {
+		rev, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || rev < 1 {
+			http.Error(w, "bad rev", http.StatusBadRequest)
+			return
+		}
+	}
+
+	websocket.Handler(func(ws *websocket.Conn) {
+		watch(ws, glob, rev)
+		ws.Close()
+	}).ServeHTTP(w, r)
+}
+
+func watch(ws *websocket.Conn, glob *store.Glob, rev int64) {
+	wt, err := Store.Resume(glob, rev-1)
+	if err != nil {
+		websocket.JSON.Send(ws, watchError{err.Error()})
+		return
+	}
+	defer wt.Stop()
+
+	// The client has nothing to send, so a read ends only when the
+	// socket is closed; that stops the watch, so it doesn't outlive
+	// the socket.
+	closed := make(chan bool)
+	go func() {
+		io.Copy(ioutil.Discard, ws)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case ev, ok := <-wt.C:
+			if !ok {
+				return
+			}
+			ev.Getter = nil // don't marshal the entire snapshot
+			if err := websocket.JSON.Send(ws, ev); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
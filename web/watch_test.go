@@ -0,0 +1,120 @@
+package web
+
+import (
+	"code.google.com/p/go.net/websocket"
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/store"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+func watchDial(url string) (*websocket.Conn, error) {
+	return websocket.Dial(url, "", "http://localhost/")
+}
+
+func waiting(st *store.Store, n int) bool {
+	for i := 0; i < 100; i++ {
+		if <-st.Waiting == n {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestWatch(t *testing.T) {
+	defer restSetup()()
+	hs := httptest.NewServer(http.HandlerFunc(watchServer))
+	defer hs.Close()
+
+	ws, err := watchDial("ws" + hs.URL[len("http"):] + "/watch?glob=/services/**")
+	assert.Equal(t, nil, err)
+	assert.T(t, waiting(Store, 1))
+
+	Store.Ops <- store.Op{Seqn: 1, Mut: store.MustEncodeSet("/other", "x", store.Clobber)}
+	Store.Ops <- store.Op{Seqn: 2, Mut: store.MustEncodeSet("/services/a/addr", "y", store.Clobber)}
+
+	var ev store.Event
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	assert.Equal(t, nil, websocket.JSON.Receive(ws, &ev))
+	assert.Equal(t, int64(2), ev.Seqn)
+	assert.Equal(t, "/services/a/addr", ev.Path)
+	assert.Equal(t, "y", ev.Body)
+
+	ws.Close()
+	assert.T(t, waiting(Store, 0))
+}
+
+func TestWatchRev(t *testing.T) {
+	defer restSetup()()
+	Store.Ops <- store.Op{Seqn: 1, Mut: store.MustEncodeSet("/a", "1", store.Clobber)}
+	Store.Ops <- store.Op{Seqn: 2, Mut: store.MustEncodeSet("/a", "2", store.Clobber)}
+	for <-Store.Seqns < 2 {
+	}
+	hs := httptest.NewServer(http.HandlerFunc(watchServer))
+	defer hs.Close()
+
+	ws, err := watchDial("ws" + hs.URL[len("http"):] + "/watch?glob=/a&rev=1")
+	assert.Equal(t, nil, err)
+	defer ws.Close()
+
+	for _, body := range []string{"1", "2"} {
+		var ev store.Event
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		assert.Equal(t, nil, websocket.JSON.Receive(ws, &ev))
+		assert.Equal(t, body, ev.Body)
+	}
+}
+
+func TestWatchTree(t *testing.T) {
+	defer restSetup()()
+	Store.Ops <- store.Op{Seqn: 1, Mut: store.MustEncodeSet("/d/a", "1", store.Clobber)}
+	Store.Ops <- store.Op{Seqn: 2, Mut: store.MustEncodeSet("/d/b", "2", store.Clobber)}
+	for <-Store.Seqns < 2 {
+	}
+	hs := httptest.NewServer(http.HandlerFunc(watchServer))
+	defer hs.Close()
+
+	ws, err := watchDial("ws" + hs.URL[len("http"):] + "/watch?glob=/d/*")
+	assert.Equal(t, nil, err)
+	defer ws.Close()
+	assert.T(t, waiting(Store, 1))
+
+	// Deleting the tree deletes both files in the one revision.
+	Store.Ops <- store.Op{Seqn: 3, Mut: store.MustEncodeDeltree("/d", store.Clobber)}
+
+	var paths []string
+	for i := 0; i < 2; i++ {
+		var ev store.Event
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		assert.Equal(t, nil, websocket.JSON.Receive(ws, &ev))
+		assert.Equal(t, int64(3), ev.Seqn)
+		assert.T(t, ev.IsDel())
+		paths = append(paths, ev.Path)
+	}
+	sort.Strings(paths)
+	assert.Equal(t, []string{"/d/a", "/d/b"}, paths)
+}
+
+func TestWatchBadGlob(t *testing.T) {
+	defer restSetup()()
+
+	r, err := http.NewRequest("GET", "http://x/watch?glob=/a/%5B", nil)
+	if err != nil {
+		panic(err)
+	}
+	w := httptest.NewRecorder()
+	watchServer(w, r)
+	assert.Equal(t, 400, w.Code)
+
+	r, err = http.NewRequest("GET", "http://x/watch?glob=/a&rev=x", nil)
+	if err != nil {
+		panic(err)
+	}
+	w = httptest.NewRecorder()
+	watchServer(w, r)
+	assert.Equal(t, 400, w.Code)
+}
@@ -3,9 +3,9 @@ package web
 import (
 	"code.google.com/p/go.net/websocket"
 	"encoding/json"
+	"github.com/madebymany/doozerd/logging"
 	"github.com/madebymany/doozerd/store"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"runtime"
@@ -41,7 +41,16 @@ func Serve(listener net.Listener) {
 	http.HandleFunc("/$stats.html", statsHtml)
 	http.Handle("/$main.js", stringHandler{"application/javascript", main_js})
 	http.Handle("/$main.css", stringHandler{"text/css", main_css})
+	http.HandleFunc("/$tree/", treeHtml)
+	http.Handle("/$tree.js", stringHandler{"application/javascript", tree_js})
+	http.HandleFunc("/$dir/", dirServer)
 	http.HandleFunc("/$events/", evServer)
+	http.HandleFunc("/watch", watchServer)
+	http.HandleFunc("/keys/", restServer)
+	http.HandleFunc("/health", healthServer)
+	if ServeMetrics {
+		http.HandleFunc("/metrics", metricsText)
+	}
 
 	http.Serve(listener, nil)
 }
@@ -53,12 +62,12 @@ func send(ws *websocket.Conn, path string, evs <-chan store.Event) {
 		ev.Path = ev.Path[l:]
 		b, err := json.Marshal(ev)
 		if err != nil {
-			log.Println(err)
+			logging.Error("marshal event", "path", ev.Path, "err", err)
 			return
 		}
 		_, err = ws.Write(b)
 		if err != nil {
-			log.Println(err)
+			logging.Warn("websocket write", "err", err)
 			return
 		}
 	}
@@ -1,6 +1,60 @@
 package web
 
-import "testing"
+import (
+	"github.com/bmizerany/assert"
+	"github.com/madebymany/doozerd/server"
+	"github.com/madebymany/doozerd/store"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
 
 func TestFoo(t *testing.T) {
 }
+
+var metricLine = regexp.MustCompile(`^[a-z_]+(\{[a-z]+="[^"]*"\})? [0-9.e+-]+$`)
+
+func TestMetrics(t *testing.T) {
+	Store = store.New()
+	defer func() { Store = nil }()
+	defer close(Store.Ops)
+	Store.Ops <- store.Op{Seqn: 1, Mut: store.MustEncodeSet("/a/b", "x", store.Clobber)}
+	Store.Ops <- store.Op{Seqn: 2, Mut: store.MustEncodeSet("/ctl/node/a/lag", "3", store.Clobber)}
+	Store.Ops <- store.Op{Seqn: 3, Mut: store.MustEncodeSet("/ctl/node/b/addr", "x", store.Clobber)}
+	for <-Store.Seqns < 3 {
+	}
+	Health = func() server.Health { return server.Health{Rev: 3, Latest: 5} }
+	defer func() { Health = nil }()
+	wt := Store.Watch(store.MustCompileGlob("/a/**"))
+	defer wt.Stop()
+
+	w := httptest.NewRecorder()
+	metricsText(w, &http.Request{})
+	assert.Equal(t, "text/plain; version=0.0.4", w.HeaderMap.Get("content-type"))
+
+	body := w.Body.String()
+	for _, l := range strings.Split(strings.TrimSpace(body), "\n") {
+		if !strings.HasPrefix(l, "# HELP ") && !strings.HasPrefix(l, "# TYPE ") {
+			assert.T(t, metricLine.MatchString(l), l)
+		}
+	}
+	for _, s := range []string{
+		"# TYPE doozer_requests_total counter\n",
+		"doozer_requests_total{verb=\"GET\"} ",
+		"# TYPE doozer_propose_latency_seconds histogram\n",
+		"doozer_propose_latency_seconds_bucket{le=\"+Inf\"} ",
+		"doozer_propose_latency_seconds_count ",
+		"# TYPE doozer_connections gauge\n",
+		"# TYPE doozer_connections_total counter\n",
+		"doozer_store_nodes 8\n",
+		"doozer_revision 3\n",
+		"doozer_node_lag{node=\"a\"} 3\n",
+		"doozer_apply_lag 2\n",
+		"doozer_watches{pattern=\"/a/**\"} 1\n",
+		"doozer_watch_events_total{pattern=\"/a/**\"} 0\n",
+	} {
+		assert.T(t, strings.Contains(body, s), s)
+	}
+}